@@ -0,0 +1,188 @@
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/gitlab_ci_yaml_parser"
+)
+
+const (
+	generateScriptDefaultBuildsDir = "/builds"
+	generateScriptDefaultCacheDir  = "/cache"
+	generateScriptDefaultExtension = "sh"
+)
+
+// GenerateScriptCommand writes the scripts generated by the shell for every
+// build stage of a job, without executing them
+type GenerateScriptCommand struct {
+	common.RunnerSettings
+
+	JobFile       string `long:"job-file" description:"File with the job payload in JSON format, as received from GitLab"`
+	JobName       string `long:"job" description:"Name of the job defined in the .gitlab-ci.yml file of the current directory"`
+	Output        string `long:"output" description:"Directory where the scripts are written"`
+	RunnerCommand string `long:"runner-command" description:"Runner command used by the scripts for the cache and artifacts operations"`
+	LoginShell    bool   `long:"login-shell" description:"Generate the scripts for a login shell, as used by the shell executor"`
+}
+
+func (c *GenerateScriptCommand) Execute(*cli.Context) {
+	if c.Output == "" {
+		logrus.Fatalln("Missing --output")
+	}
+
+	jobResponse, err := c.loadJob()
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	build, err := c.createBuild(jobResponse)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	err = c.writeScripts(build)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+}
+
+func (c *GenerateScriptCommand) loadJob() (common.JobResponse, error) {
+	var jobResponse common.JobResponse
+
+	switch {
+	case c.JobFile != "" && c.JobName != "":
+		return jobResponse, errors.New("--job-file and --job can't be used together")
+
+	case c.JobFile != "":
+		data, err := ioutil.ReadFile(c.JobFile)
+		if err != nil {
+			return jobResponse, err
+		}
+
+		err = json.Unmarshal(data, &jobResponse)
+		if err != nil {
+			return jobResponse, fmt.Errorf("parsing %s: %w", c.JobFile, err)
+		}
+
+	case c.JobName != "":
+		parser := gitlab_ci_yaml_parser.NewGitLabCiYamlParser(c.JobName)
+		err := parser.ParseYaml(&jobResponse)
+		if err != nil {
+			return jobResponse, err
+		}
+
+	default:
+		return jobResponse, errors.New("missing --job-file or --job")
+	}
+
+	return jobResponse, nil
+}
+
+func (c *GenerateScriptCommand) createBuild(jobResponse common.JobResponse) (*common.Build, error) {
+	runner := &common.RunnerConfig{
+		RunnerSettings: c.RunnerSettings,
+	}
+
+	build, err := common.NewBuild(jobResponse, runner, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	buildsDir := c.BuildsDir
+	if buildsDir == "" {
+		buildsDir = generateScriptDefaultBuildsDir
+	}
+
+	cacheDir := c.CacheDir
+	if cacheDir == "" {
+		cacheDir = generateScriptDefaultCacheDir
+	}
+
+	customBuildDirEnabled := c.CustomBuildDir != nil && c.CustomBuildDir.Enabled
+
+	err = build.StartBuild(buildsDir, cacheDir, customBuildDirEnabled, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return build, nil
+}
+
+func (c *GenerateScriptCommand) shellScriptInfo(build *common.Build) common.ShellScriptInfo {
+	info := common.ShellScriptInfo{
+		Shell:           c.Shell,
+		Build:           build,
+		Type:            common.NormalShell,
+		RunnerCommand:   c.RunnerCommand,
+		PreCloneScript:  c.PreCloneScript,
+		PreBuildScript:  c.PreBuildScript,
+		PostBuildScript: c.PostBuildScript,
+	}
+
+	if info.Shell == "" {
+		info.Shell = common.GetDefaultShell()
+	}
+
+	if c.LoginShell {
+		info.Type = common.LoginShell
+	}
+
+	return info
+}
+
+func (c *GenerateScriptCommand) writeScripts(build *common.Build) error {
+	info := c.shellScriptInfo(build)
+
+	shellConfiguration, err := common.GetShellConfiguration(info)
+	if err != nil {
+		return err
+	}
+
+	extension := shellConfiguration.Extension
+	if extension == "" {
+		extension = generateScriptDefaultExtension
+	}
+
+	err = os.MkdirAll(c.Output, 0777)
+	if err != nil {
+		return err
+	}
+
+	for _, stage := range build.BuildStages() {
+		script, err := common.GenerateShellScript(stage, info)
+		if errors.Is(err, common.ErrSkipBuildStage) {
+			logrus.WithField("build_stage", stage).Infoln("Skipping stage (nothing to do)")
+			continue
+		} else if err != nil {
+			return fmt.Errorf("generating %s script: %w", stage, err)
+		}
+
+		file := filepath.Join(c.Output, string(stage)+"."+extension)
+		err = ioutil.WriteFile(file, []byte(script), 0666)
+		if err != nil {
+			return err
+		}
+
+		logrus.WithField("build_stage", stage).Infoln("Script written to", file)
+	}
+
+	return nil
+}
+
+func init() {
+	common.RegisterCommand2(
+		"generate-script",
+		"write the scripts generated for every build stage of a job",
+		&GenerateScriptCommand{
+			RunnerCommand: "gitlab-runner",
+		},
+	)
+}
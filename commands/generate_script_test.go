@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers"
+)
+
+func writeJobFile(t *testing.T, dir string) string {
+	jobResponse := common.JobResponse{
+		ID: 1,
+		GitInfo: common.GitInfo{
+			RepoURL: "https://gitlab.example.com/group/project.git",
+			Sha:     "1234567890abcdef",
+			Ref:     "master",
+		},
+		Steps: common.Steps{
+			{
+				Name:   common.StepNameScript,
+				Script: common.StepScript{"echo hello"},
+				When:   common.StepWhenOnSuccess,
+			},
+		},
+	}
+
+	data, err := json.Marshal(jobResponse)
+	require.NoError(t, err)
+
+	file := filepath.Join(dir, "job.json")
+	require.NoError(t, ioutil.WriteFile(file, data, 0666))
+
+	return file
+}
+
+func TestGenerateScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "generate-script")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cmd := &GenerateScriptCommand{
+		RunnerSettings: common.RunnerSettings{
+			Shell:          "bash",
+			PreBuildScript: "echo pre build",
+		},
+		JobFile:       writeJobFile(t, dir),
+		Output:        filepath.Join(dir, "scripts"),
+		RunnerCommand: "gitlab-runner",
+	}
+	cmd.Execute(nil)
+
+	script, err := ioutil.ReadFile(filepath.Join(cmd.Output, "step_script.sh"))
+	require.NoError(t, err)
+	assert.Contains(t, string(script), "echo hello")
+	assert.Contains(t, string(script), "echo pre build")
+
+	script, err = ioutil.ReadFile(filepath.Join(cmd.Output, "get_sources.sh"))
+	require.NoError(t, err)
+	assert.Contains(t, string(script), "/builds/")
+}
+
+func TestGenerateScript_InvalidArguments(t *testing.T) {
+	removeHook := helpers.MakeFatalToPanic()
+	defer removeHook()
+
+	dir, err := ioutil.TempDir("", "generate-script")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	jobFile := writeJobFile(t, dir)
+	output := filepath.Join(dir, "scripts")
+
+	tests := map[string]*GenerateScriptCommand{
+		"missing output":     {JobFile: "job.json"},
+		"missing job":        {Output: "scripts"},
+		"job file and job":   {JobFile: "job.json", JobName: "test", Output: "scripts"},
+		"job file not found": {JobFile: "missing.json", Output: "scripts"},
+		"unknown shell": {
+			RunnerSettings: common.RunnerSettings{Shell: "unknown"},
+			JobFile:        jobFile,
+			Output:         output,
+		},
+	}
+
+	for tn, cmd := range tests {
+		t.Run(tn, func(t *testing.T) {
+			assert.Panics(t, func() {
+				cmd.Execute(nil)
+			})
+		})
+	}
+}
@@ -76,7 +76,7 @@ func (c *ArtifactsDownloaderCommand) Execute(context *cli.Context) {
 	}
 
 	// Extract artifacts file
-	err = archives.ExtractZipFile(file.Name())
+	err = archives.ExtractFile(file.Name())
 	if err != nil {
 		logrus.Fatalln(err)
 	}
@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"archive/tar"
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
@@ -9,6 +10,7 @@ import (
 	"os"
 	"testing"
 
+	"github.com/klauspost/compress/zstd"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/require"
 
@@ -111,6 +113,36 @@ func (m *testNetwork) consumeGzipUpload(reader io.Reader) common.UploadState {
 	return m.uploadState
 }
 
+func (m *testNetwork) consumeTarUpload(reader io.Reader, format common.ArtifactFormat) common.UploadState {
+	if format == common.ArtifactFormatTarZstd {
+		decoder, err := zstd.NewReader(reader)
+		if err != nil {
+			logrus.Warningln(err)
+			return common.UploadForbidden
+		}
+		defer decoder.Close()
+
+		reader = decoder
+	}
+
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			logrus.Warningln(err)
+			return common.UploadForbidden
+		}
+
+		m.uploadedFiles = append(m.uploadedFiles, header.Name)
+	}
+
+	m.uploadFormat = format
+
+	return m.uploadState
+}
+
 func (m *testNetwork) consumeRawUpload(reader io.Reader) common.UploadState {
 	_, _ = io.Copy(ioutil.Discard, reader)
 
@@ -137,6 +169,9 @@ func (m *testNetwork) UploadRawArtifacts(
 		case common.ArtifactFormatGzip:
 			return m.consumeGzipUpload(reader)
 
+		case common.ArtifactFormatTar, common.ArtifactFormatTarZstd:
+			return m.consumeTarUpload(reader, options.Format)
+
 		case common.ArtifactFormatRaw:
 			return m.consumeRawUpload(reader)
 
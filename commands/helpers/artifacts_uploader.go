@@ -37,15 +37,27 @@ type ArtifactsUploaderCommand struct {
 	ExpireIn string                `long:"expire-in" description:"When to expire artifacts"`
 	Format   common.ArtifactFormat `long:"artifact-format" description:"Format of generated artifacts"`
 	Type     string                `long:"artifact-type" description:"Type of generated artifacts"`
+
+	CompressionLevel string `long:"compression-level" env:"ARTIFACT_COMPRESSION_LEVEL" description:"Compression level of the zip, gzip and tarzstd archives: store, fastest, default or best"`
 }
 
 func (c *ArtifactsUploaderCommand) generateZipArchive(w *io.PipeWriter) {
-	err := archives.CreateZipArchive(w, c.sortedFiles())
+	err := archives.CreateZipArchive(w, c.sortedFiles(), archiveOptions(c.CompressionLevel)...)
 	_ = w.CloseWithError(err)
 }
 
 func (c *ArtifactsUploaderCommand) generateGzipStream(w *io.PipeWriter) {
-	err := archives.CreateGzipArchive(w, c.sortedFiles())
+	err := archives.CreateGzipArchive(w, c.sortedFiles(), archiveOptions(c.CompressionLevel)...)
+	_ = w.CloseWithError(err)
+}
+
+func (c *ArtifactsUploaderCommand) generateTarArchive(w *io.PipeWriter) {
+	err := archives.CreateTarArchive(w, c.sortedFiles())
+	_ = w.CloseWithError(err)
+}
+
+func (c *ArtifactsUploaderCommand) generateTarZstdArchive(w *io.PipeWriter) {
+	err := archives.CreateTarZstdArchive(w, c.sortedFiles(), archiveOptions(c.CompressionLevel)...)
 	_ = w.CloseWithError(err)
 }
 
@@ -81,6 +93,18 @@ func (c *ArtifactsUploaderCommand) createReadStream() (string, io.ReadCloser, er
 
 		return name + ".gz", pr, nil
 
+	case common.ArtifactFormatTar:
+		pr, pw := io.Pipe()
+		go c.generateTarArchive(pw)
+
+		return name + ".tar", pr, nil
+
+	case common.ArtifactFormatTarZstd:
+		pr, pw := io.Pipe()
+		go c.generateTarZstdArchive(pw)
+
+		return name + ".tar.zst", pr, nil
+
 	case common.ArtifactFormatRaw:
 		file, err := c.openRawStream()
 
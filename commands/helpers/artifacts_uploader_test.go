@@ -180,6 +180,43 @@ func TestArtifactsUploaderGzipSendsMultipleFiles(t *testing.T) {
 	assert.Contains(t, network.uploadedFiles, artifactsTestArchivedFile2)
 }
 
+func TestArtifactsUploaderTarSucceeded(t *testing.T) {
+	tests := map[common.ArtifactFormat]string{
+		common.ArtifactFormatTar:     "my-release.tar",
+		common.ArtifactFormatTarZstd: "my-release.tar.zst",
+	}
+
+	for format, expectedName := range tests {
+		t.Run(string(format), func(t *testing.T) {
+			network := &testNetwork{
+				uploadState: common.UploadSucceeded,
+			}
+			cmd := ArtifactsUploaderCommand{
+				JobCredentials: UploaderCredentials,
+				Format:         format,
+				Name:           "my-release",
+				network:        network,
+				fileArchiver: fileArchiver{
+					Paths: []string{artifactsTestArchivedFile, artifactsTestArchivedFile2},
+				},
+			}
+
+			writeTestFile(t, artifactsTestArchivedFile)
+			defer os.Remove(artifactsTestArchivedFile)
+
+			writeTestFile(t, artifactsTestArchivedFile2)
+			defer os.Remove(artifactsTestArchivedFile2)
+
+			cmd.Execute(nil)
+			assert.Equal(t, 1, network.uploadCalled)
+			assert.Equal(t, format, network.uploadFormat)
+			assert.Equal(t, expectedName, network.uploadName)
+			assert.Contains(t, network.uploadedFiles, artifactsTestArchivedFile)
+			assert.Contains(t, network.uploadedFiles, artifactsTestArchivedFile2)
+		})
+	}
+}
+
 func TestArtifactsUploaderRawSucceeded(t *testing.T) {
 	network := &testNetwork{
 		uploadState: common.UploadSucceeded,
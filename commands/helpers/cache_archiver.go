@@ -22,6 +22,9 @@ type CacheArchiverCommand struct {
 	URL     string `long:"url" description:"URL of remote cache resource"`
 	Timeout int    `long:"timeout" description:"Overall timeout for cache uploading request (in minutes)"`
 
+	CompressionLevel string `long:"compression-level" env:"CACHE_COMPRESSION_LEVEL" description:"Compression level of the archive: store, fastest, default or best"`
+	Format           string `long:"archive-format" description:"Format of the archive: zip, tar or tarzstd"`
+
 	client *CacheClient
 }
 
@@ -64,6 +67,18 @@ func (c *CacheArchiverCommand) upload(_ int) error {
 	return retryOnServerError(resp)
 }
 
+// archiveFormat returns the format of the archive, zip is used when the
+// requested one isn't supported
+func (c *CacheArchiverCommand) archiveFormat() archives.Format {
+	format, err := archives.ParseFormat(c.Format)
+	if err != nil {
+		logrus.WithError(err).Warningln("Using the zip archive format")
+		return archives.FormatZip
+	}
+
+	return format
+}
+
 func (c *CacheArchiverCommand) Execute(*cli.Context) {
 	log.SetRunnerFormatter()
 
@@ -85,7 +100,7 @@ func (c *CacheArchiverCommand) Execute(*cli.Context) {
 	}
 
 	// Create archive
-	err = archives.CreateZipFile(c.File, c.sortedFiles())
+	err = archives.CreateFile(c.File, c.archiveFormat(), c.sortedFiles(), archiveOptions(c.CompressionLevel)...)
 	if err != nil {
 		logrus.Fatalln(err)
 	}
@@ -1,6 +1,7 @@
 package helpers
 
 import (
+	"archive/zip"
 	"bytes"
 	"net/http"
 	"net/http/httptest"
@@ -10,8 +11,10 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-runner/helpers"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/archives"
 )
 
 const cacheArchiverArchive = "archive.zip"
@@ -144,3 +147,75 @@ func TestCacheArchiverRemoteServerFailOnInvalidServer(t *testing.T) {
 	_, err := os.Stat(cacheExtractorTestArchivedFile)
 	assert.Error(t, err)
 }
+
+func TestCacheArchiverCompressionLevel(t *testing.T) {
+	tests := map[string]uint16{
+		"store":       zip.Store,
+		"best":        zip.Deflate,
+		"unsupported": zip.Deflate,
+	}
+
+	for compressionLevel, expectedMethod := range tests {
+		t.Run(compressionLevel, func(t *testing.T) {
+			writeTestFile(t, cacheArchiverTestArchivedFile)
+			defer os.Remove(cacheArchiverTestArchivedFile)
+
+			os.Remove(cacheArchiverArchive)
+			defer os.Remove(cacheArchiverArchive)
+			cmd := CacheArchiverCommand{
+				File:             cacheArchiverArchive,
+				CompressionLevel: compressionLevel,
+				fileArchiver: fileArchiver{
+					Paths: []string{
+						cacheArchiverTestArchivedFile,
+					},
+				},
+			}
+			cmd.Execute(nil)
+
+			archive, err := zip.OpenReader(cacheArchiverArchive)
+			require.NoError(t, err)
+			defer archive.Close()
+
+			require.Len(t, archive.File, 1)
+			assert.Equal(t, expectedMethod, archive.File[0].Method)
+		})
+	}
+}
+
+func TestCacheArchiverArchiveFormat(t *testing.T) {
+	tests := map[string]archives.Format{
+		"":            archives.FormatZip,
+		"tar":         archives.FormatTar,
+		"tarzstd":     archives.FormatTarZstd,
+		"unsupported": archives.FormatZip,
+	}
+
+	for format, expectedFormat := range tests {
+		t.Run(format, func(t *testing.T) {
+			writeTestFile(t, cacheArchiverTestArchivedFile)
+			defer os.Remove(cacheArchiverTestArchivedFile)
+
+			os.Remove(cacheArchiverArchive)
+			defer os.Remove(cacheArchiverArchive)
+			cmd := CacheArchiverCommand{
+				File:   cacheArchiverArchive,
+				Format: format,
+				fileArchiver: fileArchiver{
+					Paths: []string{
+						cacheArchiverTestArchivedFile,
+					},
+				},
+			}
+			cmd.Execute(nil)
+
+			file, err := os.Open(cacheArchiverArchive)
+			require.NoError(t, err)
+			defer file.Close()
+
+			detectedFormat, err := archives.DetectFormat(file)
+			require.NoError(t, err)
+			assert.Equal(t, expectedFormat, detectedFormat)
+		})
+	}
+}
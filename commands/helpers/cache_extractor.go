@@ -123,7 +123,7 @@ func (c *CacheExtractorCommand) Execute(context *cli.Context) {
 				"Instead a local version of cache will be extracted.")
 	}
 
-	err := archives.ExtractZipFile(c.File)
+	err := archives.ExtractFile(c.File)
 	if err != nil && !os.IsNotExist(err) {
 		logrus.Fatalln(err)
 	}
@@ -11,8 +11,10 @@ import (
 
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-runner/helpers"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/archives"
 )
 
 const cacheExtractorArchive = "archive.zip"
@@ -45,6 +47,31 @@ func TestCacheExtractorValidArchive(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestCacheExtractorArchiveFormats(t *testing.T) {
+	for _, format := range []archives.Format{archives.FormatZip, archives.FormatTar, archives.FormatTarZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			writeTestFile(t, cacheExtractorTestArchivedFile)
+			err := archives.CreateFile(cacheExtractorArchive, format, []string{cacheExtractorTestArchivedFile})
+			require.NoError(t, err)
+			defer os.Remove(cacheExtractorArchive)
+
+			err = os.Remove(cacheExtractorTestArchivedFile)
+			require.NoError(t, err)
+			defer os.Remove(cacheExtractorTestArchivedFile)
+
+			cmd := CacheExtractorCommand{
+				File: cacheExtractorArchive,
+			}
+			assert.NotPanics(t, func() {
+				cmd.Execute(nil)
+			})
+
+			_, err = os.Stat(cacheExtractorTestArchivedFile)
+			assert.NoError(t, err)
+		})
+	}
+}
+
 func TestCacheExtractorForInvalidArchive(t *testing.T) {
 	removeHook := helpers.MakeFatalToPanic()
 	defer removeHook()
@@ -0,0 +1,45 @@
+package helpers
+
+import (
+	"net/http"
+	"os"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/egress"
+)
+
+//nolint:lll
+type EgressProxyCommand struct {
+	Listen              string   `long:"listen" description:"Address on which the proxy listens"`
+	AllowedCIDRs        []string `long:"allowed-cidr" description:"Network that is reachable through the proxy (can be specified multiple times)"`
+	AllowedHosts        []string `long:"allowed-host" description:"Hostname pattern that is reachable through the proxy (can be specified multiple times)"`
+	AllowedPorts        []int    `long:"allowed-port" description:"Port that is reachable through the proxy (can be specified multiple times)"`
+	AllowedDestinations []string `long:"allowed-destination" description:"host:port that is reachable through the proxy regardless of the other rules (can be specified multiple times)"`
+}
+
+func (c *EgressProxyCommand) Execute(*cli.Context) {
+	policy, err := egress.NewPolicy(c.AllowedCIDRs, c.AllowedHosts, c.AllowedPorts, c.AllowedDestinations)
+	if err != nil {
+		logrus.Fatalln("Invalid egress policy:", err)
+	}
+
+	logrus.Infoln("Starting egress proxy on", c.Listen)
+
+	err = http.ListenAndServe(c.Listen, egress.NewProxy(policy, os.Stdout))
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+}
+
+func init() {
+	common.RegisterCommand2(
+		"egress-proxy",
+		"run an HTTP proxy that enforces the build network egress policy",
+		&EgressProxyCommand{
+			Listen: ":8080",
+		},
+	)
+}
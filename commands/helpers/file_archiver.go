@@ -15,6 +15,8 @@ import (
 
 	"github.com/bmatcuk/doublestar"
 	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/archives"
 )
 
 type fileArchiver struct {
@@ -218,3 +220,15 @@ func (c *fileArchiver) enumerate() error {
 
 	return nil
 }
+
+// archiveOptions returns the options of the created archive, the default
+// compression level is used when the requested one isn't supported
+func archiveOptions(compressionLevel string) []archives.Option {
+	level, err := archives.ParseCompressionLevel(compressionLevel)
+	if err != nil {
+		logrus.WithError(err).Warningln("Using the default compression level")
+		level = archives.CompressionLevelDefault
+	}
+
+	return []archives.Option{archives.WithCompressionLevel(level)}
+}
@@ -0,0 +1,333 @@
+package helpers
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/filelock"
+	url_helpers "gitlab.com/gitlab-org/gitlab-runner/helpers/url"
+	"gitlab.com/gitlab-org/gitlab-runner/log"
+)
+
+const (
+	gitReferenceExtension     = ".git"
+	gitReferenceLockExtension = ".lock"
+)
+
+// GitReferenceCacheCommand maintains a bare mirror of the repository that is
+// shared between the jobs and registers it as an alternate object store of
+// the job's repository
+type GitReferenceCacheCommand struct {
+	Dir        string `long:"dir" description:"Directory where the reference repositories are stored"`
+	URL        string `long:"url" description:"URL of the repository"`
+	Repository string `long:"repository" description:"Path of the repository using the reference"`
+	MaxSize    int64  `long:"max-size" description:"Maximum size of the reference repositories in megabytes"`
+
+	Timeout time.Duration `long:"timeout" description:"Timeout of the job using the reference, it's not removed before it passes"`
+}
+
+func (c *GitReferenceCacheCommand) referenceName() string {
+	// The credentials are changing between the jobs, the same
+	// reference is used for all of them
+	name := c.URL
+	if u, err := url.Parse(c.URL); err == nil {
+		u.User = nil
+		name = u.String()
+	}
+
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(name)))
+}
+
+func (c *GitReferenceCacheCommand) Execute(*cli.Context) {
+	log.SetRunnerFormatter()
+
+	if c.Dir == "" {
+		logrus.Fatalln("Missing --dir")
+	}
+	if c.URL == "" {
+		logrus.Fatalln("Missing --url")
+	}
+	if c.Repository == "" {
+		logrus.Fatalln("Missing --repository")
+	}
+
+	dir, err := filepath.Abs(c.Dir)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	err = os.MkdirAll(dir, 0777)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	err = c.removeStaleAlternates()
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	name := c.referenceName()
+	reference := filepath.Join(dir, name+gitReferenceExtension)
+
+	err = c.updateReference(reference, filepath.Join(dir, name+gitReferenceLockExtension))
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	err = c.writeAlternates(reference)
+	if err != nil {
+		logrus.Fatalln(err)
+	}
+
+	if c.MaxSize > 0 {
+		err = evictGitReferences(dir, reference, c.MaxSize*1024*1024)
+		if err != nil {
+			logrus.WithError(err).Warningln("Failed to evict Git references")
+		}
+	}
+}
+
+func (c *GitReferenceCacheCommand) alternatesFile() string {
+	return filepath.Join(c.Repository, ".git", "objects", "info", "alternates")
+}
+
+// removeStaleAlternates removes the repository when one of its alternates
+// was evicted, as it's missing objects it relies on
+func (c *GitReferenceCacheCommand) removeStaleAlternates() error {
+	file, err := os.Open(c.alternatesFile())
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		alternate := strings.TrimSpace(scanner.Text())
+		if alternate == "" {
+			continue
+		}
+
+		_, err = os.Stat(alternate)
+		if os.IsNotExist(err) {
+			logrus.Warningln("Git reference", alternate, "was removed, removing the repository")
+			_ = file.Close()
+			return os.RemoveAll(filepath.Join(c.Repository, ".git"))
+		}
+	}
+
+	return scanner.Err()
+}
+
+func (c *GitReferenceCacheCommand) updateReference(reference string, lockFile string) error {
+	lock := filelock.New(lockFile)
+	err := lock.Lock()
+	if err != nil {
+		return fmt.Errorf("locking Git reference: %w", err)
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	// The modification time is read before fetching, as the fetch updates it
+	info, err := os.Stat(reference)
+	if os.IsNotExist(err) {
+		logrus.Infoln("Creating Git reference for", url_helpers.CleanURL(c.URL))
+
+		err = c.git("init", "--bare", "--quiet", reference)
+		if err != nil {
+			return err
+		}
+
+		// Repositories using the reference rely on its objects, they
+		// mustn't be removed even when they become unreachable
+		err = c.git("--git-dir", reference, "config", "gc.pruneExpire", "never")
+		if err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	logrus.Infoln("Fetching changes into Git reference...")
+	err = c.git(
+		"--git-dir", reference,
+		"fetch", "--quiet", "--no-tags", c.URL,
+		"+refs/heads/*:refs/heads/*",
+		"+refs/tags/*:refs/tags/*",
+	)
+	if err != nil {
+		return err
+	}
+
+	return c.markReferenceInUse(reference, info)
+}
+
+// markReferenceInUse sets the modification time of the reference to the time
+// when the job using it times out, unless another job uses it for longer. The
+// reference isn't evicted before that time, as the repositories of the jobs
+// rely on its objects. It's called with the lock held
+func (c *GitReferenceCacheCommand) markReferenceInUse(reference string, previous os.FileInfo) error {
+	inUseUntil := time.Now().Add(c.Timeout)
+	if previous != nil && previous.ModTime().After(inUseUntil) {
+		inUseUntil = previous.ModTime()
+	}
+
+	return os.Chtimes(reference, inUseUntil, inUseUntil)
+}
+
+func (c *GitReferenceCacheCommand) git(args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return fmt.Errorf("git %s: %w", args[0], err)
+	}
+
+	return nil
+}
+
+func (c *GitReferenceCacheCommand) writeAlternates(reference string) error {
+	alternatesFile := c.alternatesFile()
+
+	err := os.MkdirAll(filepath.Dir(alternatesFile), 0777)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(alternatesFile, []byte(filepath.Join(reference, "objects")+"\n"), 0666)
+}
+
+type gitReference struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// evictGitReferences removes the least recently used references until their
+// total size is below maxSize. The reference used by the job, the ones locked
+// by other jobs and the ones still used by running jobs are kept
+func evictGitReferences(dir string, current string, maxSize int64) error {
+	references, total, err := listGitReferences(dir)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(references, func(i, j int) bool {
+		return references[i].modTime.Before(references[j].modTime)
+	})
+
+	for _, reference := range references {
+		if total <= maxSize {
+			break
+		}
+
+		if reference.path == current || reference.modTime.After(time.Now()) {
+			continue
+		}
+
+		removed, err := removeGitReference(reference.path)
+		if err != nil {
+			return err
+		}
+
+		if removed {
+			logrus.Infoln("Removed Git reference", filepath.Base(reference.path))
+			total -= reference.size
+		}
+	}
+
+	return nil
+}
+
+func listGitReferences(dir string) ([]gitReference, int64, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var references []gitReference
+	var total int64
+
+	for _, entry := range entries {
+		if !entry.IsDir() || filepath.Ext(entry.Name()) != gitReferenceExtension {
+			continue
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		size, err := dirSize(path)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		references = append(references, gitReference{path: path, size: size, modTime: entry.ModTime()})
+		total += size
+	}
+
+	return references, total, nil
+}
+
+func removeGitReference(path string) (bool, error) {
+	lock := filelock.New(strings.TrimSuffix(path, gitReferenceExtension) + gitReferenceLockExtension)
+
+	err := lock.TryLock()
+	if errors.Is(err, filelock.ErrLocked) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	defer func() { _ = lock.Unlock() }()
+
+	// The reference could have been used by another job since it was listed
+	info, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+
+	if info.ModTime().After(time.Now()) {
+		return false, nil
+	}
+
+	return true, os.RemoveAll(path)
+}
+
+func dirSize(path string) (int64, error) {
+	var size int64
+
+	err := filepath.Walk(path, func(_ string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if !info.IsDir() {
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size, err
+}
+
+func init() {
+	common.RegisterCommand2(
+		"git-reference-cache",
+		"update the Git reference repository shared between jobs (internal)",
+		&GitReferenceCacheCommand{},
+	)
+}
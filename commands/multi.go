@@ -144,6 +144,7 @@ func (mr *RunCommand) loadConfig() error {
 
 	mr.healthy = nil
 	mr.log().Println("Configuration loaded")
+	mr.updateExecutorProviders()
 	mr.log().Debugln(helpers.ToYAML(mr.config))
 
 	// initialize sentry
@@ -160,6 +161,26 @@ func (mr *RunCommand) loadConfig() error {
 	return nil
 }
 
+// updateExecutorProviders lets the executor providers release the resources
+// of the runners removed from the configuration
+func (mr *RunCommand) updateExecutorProviders() {
+	for _, provider := range common.GetExecutorProviders() {
+		if managed, ok := provider.(common.ManagedExecutorProvider); ok {
+			managed.UpdateRunners(mr.config.Runners)
+		}
+	}
+}
+
+// shutdownExecutorProviders releases the resources the executor providers
+// keep for the runners
+func (mr *RunCommand) shutdownExecutorProviders() {
+	for _, provider := range common.GetExecutorProviders() {
+		if managed, ok := provider.(common.ManagedExecutorProvider); ok {
+			managed.Shutdown()
+		}
+	}
+}
+
 func (mr *RunCommand) updateLoggingConfiguration() error {
 	reloadNeeded := false
 
@@ -231,6 +252,8 @@ func (mr *RunCommand) run() {
 		mr.currentWorkers--
 	}
 
+	mr.shutdownExecutorProviders()
+
 	mr.log().Info("All workers stopped. Can exit now")
 
 	close(mr.runFinished)
@@ -51,6 +51,7 @@ func TestProcessRunner_BuildLimit(t *testing.T) {
 	mJobTrace.On("IsStdout").Return(false)
 	mJobTrace.On("SetCancelFunc", mock.Anything)
 	mJobTrace.On("SetMasked", mock.Anything)
+	mJobTrace.On("SetTimestamps", mock.Anything)
 	mJobTrace.On("Success")
 
 	mNetwork := common.MockNetwork{}
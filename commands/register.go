@@ -299,6 +299,11 @@ func (s *RegisterCommand) askExecutorOptions() {
 			s.Docker = docker
 			s.askDocker()
 		},
+		"docker+autoscaler": func() {
+			s.Machine = machine
+			s.Docker = docker
+			s.askDocker()
+		},
 		"docker-ssh+machine": func() {
 			s.Machine = machine
 			s.Docker = docker
@@ -43,6 +43,8 @@ const (
 	gitFetchFlagsNone    = "none"
 )
 
+const gitReferenceCacheDirName = "git-reference-cache"
+
 type SubmoduleStrategy int
 
 const (
@@ -73,6 +75,7 @@ const (
 	BuildStageDownloadArtifacts        BuildStage = "download_artifacts"
 	BuildStageAfterScript              BuildStage = "after_script"
 	BuildStageArchiveCache             BuildStage = "archive_cache"
+	BuildStageArchiveOnFailureCache    BuildStage = "archive_cache_on_failure"
 	BuildStageUploadOnSuccessArtifacts BuildStage = "upload_artifacts_on_success"
 	BuildStageUploadOnFailureArtifacts BuildStage = "upload_artifacts_on_failure"
 )
@@ -86,6 +89,7 @@ var staticBuildStages = []BuildStage{
 	BuildStageDownloadArtifacts,
 	BuildStageAfterScript,
 	BuildStageArchiveCache,
+	BuildStageArchiveOnFailureCache,
 	BuildStageUploadOnSuccessArtifacts,
 	BuildStageUploadOnFailureArtifacts,
 }
@@ -123,6 +127,10 @@ type Build struct {
 	ExecutorData     ExecutorData
 	ExecutorFeatures FeaturesInfo `json:"-" yaml:"-"`
 
+	// Directory of the reference repositories shared between jobs, empty
+	// when the git reference cache is disabled
+	GitReferenceCacheDir string `json:"-" yaml:"-"`
+
 	// Unique ID for all running builds on this runner
 	RunnerID int `json:"runner_id"`
 
@@ -138,6 +146,10 @@ type Build struct {
 	logger                BuildLogger
 	allVariables          JobVariables
 
+	// cancelReason is set when the job is cancelled or times out and the
+	// script is given a grace period to terminate
+	cancelReason BuildRuntimeState
+
 	createdAt time.Time
 
 	Referees         []referees.Referee
@@ -254,7 +266,8 @@ func (b *Build) StartBuild(rootDir, cacheDir string, customBuildDirEnabled, shar
 	// to be able to use CI_BUILDS_DIR
 	b.RootDir = rootDir
 	b.CacheDir = path.Join(cacheDir, b.ProjectUniqueDir(false))
-	b.refreshAllVariables()
+	b.GitReferenceCacheDir = b.getGitReferenceCacheDir(cacheDir)
+	b.RefreshAllVariables()
 
 	var err error
 	b.BuildDir, err = b.getCustomBuildDir(b.RootDir, "GIT_CLONE_PATH", customBuildDirEnabled, sharedDir)
@@ -264,10 +277,23 @@ func (b *Build) StartBuild(rootDir, cacheDir string, customBuildDirEnabled, shar
 
 	// We invalidate variables to be able to use
 	// CI_CACHE_DIR and CI_PROJECT_DIR
-	b.refreshAllVariables()
+	b.RefreshAllVariables()
 	return nil
 }
 
+func (b *Build) getGitReferenceCacheDir(cacheDir string) string {
+	config := b.Runner.GitReferenceCache
+	if config == nil {
+		return ""
+	}
+
+	if config.Path != "" {
+		return config.Path
+	}
+
+	return path.Join(cacheDir, gitReferenceCacheDirName)
+}
+
 func (b *Build) executeStage(ctx context.Context, buildStage BuildStage, executor Executor) error {
 	b.CurrentStage = buildStage
 
@@ -332,6 +358,7 @@ func getPredefinedEnv(buildStage BuildStage) bool {
 		BuildStageDownloadArtifacts:        true,
 		BuildStageAfterScript:              false,
 		BuildStageArchiveCache:             true,
+		BuildStageArchiveOnFailureCache:    true,
 		BuildStageUploadOnFailureArtifacts: true,
 		BuildStageUploadOnSuccessArtifacts: true,
 	}
@@ -352,6 +379,7 @@ func getStageDescription(stage BuildStage) string {
 		BuildStageDownloadArtifacts:        "Downloading artifacts",
 		BuildStageAfterScript:              "Running after_script",
 		BuildStageArchiveCache:             "Saving cache",
+		BuildStageArchiveOnFailureCache:    "Saving cache for failed job",
 		BuildStageUploadOnFailureArtifacts: "Uploading artifacts for failed job",
 		BuildStageUploadOnSuccessArtifacts: "Uploading artifacts for successful job",
 	}
@@ -372,6 +400,18 @@ func (b *Build) executeUploadArtifacts(ctx context.Context, state error, executo
 	return b.executeStage(ctx, BuildStageUploadOnFailureArtifacts, executor)
 }
 
+// executeArchiveCache saves the caches defined for the state of the job. A
+// failure to save the cache fails only a successful job
+func (b *Build) executeArchiveCache(ctx context.Context, state error, executor Executor) error {
+	if state == nil {
+		return b.executeStage(ctx, BuildStageArchiveCache, executor)
+	}
+
+	_ = b.executeStage(ctx, BuildStageArchiveOnFailureCache, executor)
+
+	return state
+}
+
 func (b *Build) executeScript(ctx context.Context, executor Executor) error {
 	// track job start and create referees
 	startTime := time.Now()
@@ -397,28 +437,12 @@ func (b *Build) executeScript(ctx context.Context, executor Executor) error {
 	}
 
 	if err == nil {
-		for _, s := range b.Steps {
-			// after_script has a separate BuildStage. See common.BuildStageAfterScript
-			if s.Name == StepNameAfterScript {
-				continue
-			}
-			err = b.executeStage(ctx, StepToBuildStage(s), executor)
-			if err != nil {
-				break
-			}
-		}
-
-		// Execute after script (after_script)
-		timeoutCtx, timeoutCancel := context.WithTimeout(ctx, AfterScriptTimeout)
-		defer timeoutCancel()
-
-		_ = b.executeStage(timeoutCtx, BuildStageAfterScript, executor)
+		err = b.executeSteps(ctx, executor)
+		b.executeAfterScript(ctx, executor)
 	}
 
 	// Execute post script (cache store, artifacts upload)
-	if err == nil {
-		err = b.executeStage(ctx, BuildStageArchiveCache, executor)
-	}
+	err = b.executeArchiveCache(ctx, err, executor)
 
 	artifactUploadErr := b.executeUploadArtifacts(ctx, err, executor)
 
@@ -435,6 +459,104 @@ func (b *Build) executeScript(ctx context.Context, executor Executor) error {
 	return artifactUploadErr
 }
 
+// executeAfterScript runs the after_script. When the script was terminated
+// gracefully, it's executed even though the job was cancelled or has timed out
+func (b *Build) executeAfterScript(ctx context.Context, executor Executor) {
+	if ctx.Err() != nil && b.cancelReason != "" {
+		b.logger.Warningln(fmt.Sprintf("Job %s, executing after_script...", b.cancelReason))
+
+		b.Variables = append(
+			b.Variables,
+			JobVariable{Key: "CI_JOB_CANCEL_REASON", Value: string(b.cancelReason), Public: true, Internal: true},
+		)
+		b.RefreshAllVariables()
+		ctx = context.Background()
+	}
+
+	timeoutCtx, timeoutCancel := context.WithTimeout(ctx, b.afterScriptTimeout())
+	defer timeoutCancel()
+
+	_ = b.executeStage(timeoutCtx, BuildStageAfterScript, executor)
+}
+
+// executeSteps runs the steps of the job, except after_script, in order.
+// Every step runs depending on its `when` and on the state of the previous
+// steps, and steps allowed to fail don't change that state
+func (b *Build) executeSteps(ctx context.Context, executor Executor) error {
+	var err error
+
+	for _, s := range b.Steps {
+		// after_script has a separate BuildStage. See common.BuildStageAfterScript
+		if s.Name == StepNameAfterScript {
+			continue
+		}
+
+		// The job was cancelled or has timed out
+		if ctx.Err() != nil {
+			break
+		}
+
+		if (err == nil && !s.When.OnSuccess()) || (err != nil && !s.When.OnFailure()) {
+			b.Log().WithField("step", s.Name).Debugln("Skipping step, when:", s.When)
+			continue
+		}
+
+		stepErr := b.executeStep(ctx, s, executor)
+		if stepErr == nil {
+			continue
+		}
+
+		var buildErr *BuildError
+		if s.AllowFailure && errors.As(stepErr, &buildErr) && ctx.Err() == nil {
+			b.logger.Warningln(fmt.Sprintf("Step %q failed, but is allowed to fail: %v", s.Name, stepErr))
+			continue
+		}
+
+		if err == nil {
+			err = stepErr
+		}
+	}
+
+	return err
+}
+
+func (b *Build) executeStep(ctx context.Context, s Step, executor Executor) error {
+	if s.Timeout <= 0 {
+		return b.executeStage(ctx, StepToBuildStage(s), executor)
+	}
+
+	timeout := time.Duration(s.Timeout) * time.Second
+	stepCtx, stepCancel := context.WithTimeout(ctx, timeout)
+	defer stepCancel()
+
+	err := b.executeStage(stepCtx, StepToBuildStage(s), executor)
+	if err != nil && stepCtx.Err() == context.DeadlineExceeded && ctx.Err() == nil {
+		return &BuildError{
+			Inner:         fmt.Errorf("step %q took longer than %v", s.Name, timeout),
+			FailureReason: JobExecutionTimeout,
+		}
+	}
+
+	return err
+}
+
+// afterScriptTimeout returns the timeout of the after_script step, which
+// can't be longer than AfterScriptTimeout
+func (b *Build) afterScriptTimeout() time.Duration {
+	for _, s := range b.Steps {
+		if s.Name != StepNameAfterScript || s.Timeout <= 0 {
+			continue
+		}
+
+		timeout := time.Duration(s.Timeout) * time.Second
+		if timeout < AfterScriptTimeout {
+			return timeout
+		}
+	}
+
+	return AfterScriptTimeout
+}
+
 // StepToBuildStage returns the BuildStage corresponding to a step.
 func StepToBuildStage(s Step) BuildStage {
 	return BuildStage(fmt.Sprintf("step_%s", strings.ToLower(string(s.Name))))
@@ -548,6 +670,10 @@ func (b *Build) run(ctx context.Context, executor Executor) (err error) {
 	case <-ctx.Done():
 		err = b.handleError(ctx.Err())
 
+		if b.GetCancelGracePeriod() > 0 {
+			b.cancelReason = b.CurrentState
+		}
+
 	case signal := <-b.SystemInterrupt:
 		err = fmt.Errorf("aborted: %v", signal)
 		b.CurrentState = BuildRunRuntimeTerminated
@@ -561,11 +687,22 @@ func (b *Build) run(ctx context.Context, executor Executor) (err error) {
 
 	// Wait till we receive that build did finish
 	runCancel()
-	b.waitForBuildFinish(buildFinish, WaitForBuildFinishTimeout)
+	b.waitForBuildFinish(buildFinish, b.waitForBuildFinishTimeout())
 
 	return err
 }
 
+// waitForBuildFinishTimeout returns the time to wait for the build to finish
+// once cancelled, including the grace period and the after_script when the
+// script is terminated gracefully
+func (b *Build) waitForBuildFinishTimeout() time.Duration {
+	if b.cancelReason == "" {
+		return WaitForBuildFinishTimeout
+	}
+
+	return WaitForBuildFinishTimeout + b.GetCancelGracePeriod() + b.afterScriptTimeout()
+}
+
 // waitForBuildFinish will wait for the build to finish or timeout, whichever
 // comes first. This is to prevent issues where something in the build can't be
 // killed or processed and results into the Job running until the GitLab Runner
@@ -725,6 +862,7 @@ func (b *Build) Run(globalConfig *Config, trace JobTrace) (err error) {
 
 	trace.SetCancelFunc(cancel)
 	trace.SetMasked(b.GetAllVariables().Masked())
+	trace.SetTimestamps(b.IsTraceTimestampsEnabled())
 
 	options := ExecutorPrepareOptions{
 		Config:  b.Runner,
@@ -906,7 +1044,9 @@ func (b *Build) IsSharedEnv() bool {
 	return b.ExecutorFeatures.Shared
 }
 
-func (b *Build) refreshAllVariables() {
+// RefreshAllVariables drops the cached variables of the build, so that the
+// variables added after they were computed are taken into account
+func (b *Build) RefreshAllVariables() {
 	b.allVariables = nil
 }
 
@@ -1013,6 +1153,39 @@ func (b *Build) GetSubmoduleStrategy() SubmoduleStrategy {
 	}
 }
 
+// GetSubmodulePaths returns the pathspecs of the submodules to initialize.
+// Submodules can be excluded with the `:(exclude)path` syntax
+func (b *Build) GetSubmodulePaths() ([]string, error) {
+	paths := strings.Fields(b.GetAllVariables().Get("GIT_SUBMODULE_PATHS"))
+	for _, path := range paths {
+		if path == ":(exclude)" || path == ":!" {
+			return nil, fmt.Errorf("GIT_SUBMODULE_PATHS: excluded path missing after %q", path)
+		}
+	}
+
+	return paths, nil
+}
+
+// GetSubmoduleDepth returns the depth used to fetch the submodules, 0 when
+// the whole history is fetched
+func (b *Build) GetSubmoduleDepth() (int, error) {
+	value := b.GetAllVariables().Get("GIT_SUBMODULE_DEPTH")
+	if value == "" {
+		return 0, nil
+	}
+
+	depth, err := strconv.Atoi(value)
+	if err != nil || depth < 0 {
+		return 0, fmt.Errorf("GIT_SUBMODULE_DEPTH: invalid depth %q", value)
+	}
+
+	return depth, nil
+}
+
+func (b *Build) GetSubmoduleUpdateFlags() []string {
+	return strings.Fields(b.GetAllVariables().Get("GIT_SUBMODULE_UPDATE_FLAGS"))
+}
+
 func (b *Build) GetGitCleanFlags() []string {
 	flags := b.GetAllVariables().Get("GIT_CLEAN_FLAGS")
 	if flags == "" {
@@ -1039,6 +1212,14 @@ func (b *Build) GetGitFetchFlags() []string {
 	return strings.Fields(flags)
 }
 
+func (b *Build) GetGitFetchFilter() string {
+	return strings.TrimSpace(b.GetAllVariables().Get("GIT_FETCH_FILTER"))
+}
+
+func (b *Build) GetGitSparseCheckoutPaths() []string {
+	return strings.Fields(b.GetAllVariables().Get("GIT_SPARSE_CHECKOUT_PATHS"))
+}
+
 func (b *Build) IsDebugTraceEnabled() bool {
 	trace, err := strconv.ParseBool(b.GetAllVariables().Get("CI_DEBUG_TRACE"))
 	if err != nil {
@@ -1056,6 +1237,30 @@ func (b *Build) IsDebugTraceEnabled() bool {
 	return trace
 }
 
+// GetCancelGracePeriod returns the time the script has to terminate once the
+// job is cancelled or has timed out, 0 when it's killed right away, which is
+// always the case for the executors not supporting the grace period
+func (b *Build) GetCancelGracePeriod() time.Duration {
+	if !b.ExecutorFeatures.CancelGracePeriod {
+		return 0
+	}
+
+	if b.Runner == nil || b.Runner.CancelGracePeriod <= 0 {
+		return 0
+	}
+
+	return time.Duration(b.Runner.CancelGracePeriod) * time.Second
+}
+
+func (b *Build) IsTraceTimestampsEnabled() bool {
+	timestamps, err := strconv.ParseBool(b.GetAllVariables().Get("CI_TRACE_TIMESTAMPS"))
+	if err != nil {
+		return b.Runner.TraceTimestamps
+	}
+
+	return timestamps
+}
+
 func (b *Build) GetDockerAuthConfig() string {
 	return b.GetAllVariables().Get("DOCKER_AUTH_CONFIG")
 }
@@ -1092,6 +1297,20 @@ func (b *Build) GetCacheRequestTimeout() int {
 	return timeout
 }
 
+// GetCacheArchiveFormat returns the format of the cache archives, as set by
+// the job or the runner configuration. Empty means the default one
+func (b *Build) GetCacheArchiveFormat() string {
+	if format := b.GetAllVariables().Get("CACHE_ARCHIVE_FORMAT"); format != "" {
+		return format
+	}
+
+	if b.Runner == nil || b.Runner.Cache == nil {
+		return ""
+	}
+
+	return b.Runner.Cache.Format
+}
+
 func (b *Build) GetExecutorJobSectionAttempts() (int, error) {
 	attempts, err := strconv.Atoi(b.GetAllVariables().Get(ExecutorJobSectionAttempts))
 	if err != nil {
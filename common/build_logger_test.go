@@ -19,6 +19,7 @@ func (fjt *fakeJobTrace) SetCancelFunc(cancelFunc context.CancelFunc)    {}
 func (fjt *fakeJobTrace) Cancel() bool                                   { return false }
 func (fjt *fakeJobTrace) SetFailuresCollector(fc FailuresCollector)      {}
 func (fjt *fakeJobTrace) SetMasked(masked []string)                      {}
+func (fjt *fakeJobTrace) SetTimestamps(enabled bool)                     {}
 func (fjt *fakeJobTrace) IsStdout() bool                                 { return false }
 
 func (fjt *fakeJobTrace) Write(p []byte) (n int, err error) {
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -251,7 +252,7 @@ func TestJobFailure(t *testing.T) {
 	thrownErr := &BuildError{Inner: errors.New("test error")}
 	executor.On("Shell").Return(&ShellScriptInfo{Shell: "script-shell"})
 	executor.On("Run", matchBuildStage(BuildStagePrepare)).Return(nil).Once()
-	executor.On("Run", mock.Anything).Return(thrownErr).Times(2)
+	executor.On("Run", mock.Anything).Return(thrownErr).Times(3)
 	executor.On("Finish", thrownErr).Once()
 
 	RegisterExecutorProvider("build-run-job-failure", provider)
@@ -273,6 +274,7 @@ func TestJobFailure(t *testing.T) {
 	trace.On("IsStdout").Return(true)
 	trace.On("SetCancelFunc", mock.Anything).Once()
 	trace.On("SetMasked", mock.Anything).Once()
+	trace.On("SetTimestamps", false).Once()
 	trace.On("Fail", thrownErr, ScriptFailure).Once()
 
 	err = build.Run(&Config{}, trace)
@@ -307,6 +309,7 @@ func TestJobFailureOnExecutionTimeout(t *testing.T) {
 	trace.On("IsStdout").Return(true)
 	trace.On("SetCancelFunc", mock.Anything).Once()
 	trace.On("SetMasked", mock.Anything).Once()
+	trace.On("SetTimestamps", false).Once()
 	trace.On("Fail", mock.Anything, JobExecutionTimeout).Run(func(arguments mock.Arguments) {
 		assert.Error(t, arguments.Get(0).(error))
 	}).Once()
@@ -333,6 +336,7 @@ func TestRunFailureRunsAfterScriptAndArtifactsOnFailure(t *testing.T) {
 	executor.On("Run", matchBuildStage(BuildStageDownloadArtifacts)).Return(nil).Once()
 	executor.On("Run", matchBuildStage("step_script")).Return(errors.New("build fail")).Once()
 	executor.On("Run", matchBuildStage(BuildStageAfterScript)).Return(nil).Once()
+	executor.On("Run", matchBuildStage(BuildStageArchiveOnFailureCache)).Return(nil).Once()
 	executor.On("Run", matchBuildStage(BuildStageUploadOnFailureArtifacts)).Return(nil).Once()
 	executor.On("Finish", errors.New("build fail")).Once()
 
@@ -364,6 +368,7 @@ func TestGetSourcesRunFailure(t *testing.T) {
 	executor.On("Shell").Return(&ShellScriptInfo{Shell: "script-shell"})
 	executor.On("Run", matchBuildStage(BuildStagePrepare)).Return(nil).Once()
 	executor.On("Run", matchBuildStage(BuildStageGetSources)).Return(errors.New("build fail")).Times(3)
+	executor.On("Run", matchBuildStage(BuildStageArchiveOnFailureCache)).Return(nil).Once()
 	executor.On("Run", matchBuildStage(BuildStageUploadOnFailureArtifacts)).Return(nil).Once()
 	executor.On("Finish", errors.New("build fail")).Once()
 
@@ -387,6 +392,7 @@ func TestArtifactDownloadRunFailure(t *testing.T) {
 	executor.On("Run", matchBuildStage(BuildStageGetSources)).Return(nil).Once()
 	executor.On("Run", matchBuildStage(BuildStageRestoreCache)).Return(nil).Once()
 	executor.On("Run", matchBuildStage(BuildStageDownloadArtifacts)).Return(errors.New("build fail")).Times(3)
+	executor.On("Run", matchBuildStage(BuildStageArchiveOnFailureCache)).Return(nil).Once()
 	executor.On("Run", matchBuildStage(BuildStageUploadOnFailureArtifacts)).Return(nil).Once()
 	executor.On("Finish", errors.New("build fail")).Once()
 
@@ -442,6 +448,7 @@ func TestRestoreCacheRunFailure(t *testing.T) {
 	executor.On("Run", matchBuildStage(BuildStagePrepare)).Return(nil).Once()
 	executor.On("Run", matchBuildStage(BuildStageGetSources)).Return(nil).Once()
 	executor.On("Run", matchBuildStage(BuildStageRestoreCache)).Return(errors.New("build fail")).Times(3)
+	executor.On("Run", matchBuildStage(BuildStageArchiveOnFailureCache)).Return(nil).Once()
 	executor.On("Run", matchBuildStage(BuildStageUploadOnFailureArtifacts)).Return(nil).Once()
 	executor.On("Finish", errors.New("build fail")).Once()
 
@@ -563,6 +570,57 @@ func TestDebugTrace(t *testing.T) {
 	}
 }
 
+func TestIsTraceTimestampsEnabled(t *testing.T) {
+	testCases := map[string]struct {
+		variableValue string
+		runnerSetting bool
+		expectedValue bool
+	}{
+		"variable not set": {
+			expectedValue: false,
+		},
+		"variable not set and enabled in configuration": {
+			runnerSetting: true,
+			expectedValue: true,
+		},
+		"variable set to true": {
+			variableValue: "true",
+			expectedValue: true,
+		},
+		"variable set to false and enabled in configuration": {
+			variableValue: "false",
+			runnerSetting: true,
+			expectedValue: false,
+		},
+		"variable set to a non-bool value": {
+			variableValue: "xyz",
+			runnerSetting: true,
+			expectedValue: true,
+		},
+	}
+
+	for testName, testCase := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			build := &Build{
+				Runner: &RunnerConfig{
+					RunnerSettings: RunnerSettings{
+						TraceTimestamps: testCase.runnerSetting,
+					},
+				},
+			}
+
+			if testCase.variableValue != "" {
+				build.Variables = append(
+					build.Variables,
+					JobVariable{Key: "CI_TRACE_TIMESTAMPS", Value: testCase.variableValue, Public: true},
+				)
+			}
+
+			assert.Equal(t, testCase.expectedValue, build.IsTraceTimestampsEnabled())
+		})
+	}
+}
+
 func TestDefaultEnvVariables(t *testing.T) {
 	buildDir := "/tmp/test-build/dir"
 	build := Build{
@@ -745,6 +803,43 @@ func TestAllowToOverwriteFeatureFlagWithRunnerVariables(t *testing.T) {
 	}
 }
 
+func TestStartBuildGitReferenceCacheDir(t *testing.T) {
+	tests := map[string]struct {
+		config      *GitReferenceCacheConfig
+		expectedDir string
+	}{
+		"disabled": {
+			config:      nil,
+			expectedDir: "",
+		},
+		"default path": {
+			config:      &GitReferenceCacheConfig{},
+			expectedDir: "/cache/git-reference-cache",
+		},
+		"custom path": {
+			config:      &GitReferenceCacheConfig{Path: "/references"},
+			expectedDir: "/references",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			build := &Build{
+				JobResponse: JobResponse{
+					GitInfo: GitInfo{RepoURL: "https://gitlab.com/test-namespace/test-repo.git"},
+				},
+				Runner: &RunnerConfig{
+					RunnerSettings: RunnerSettings{GitReferenceCache: tt.config},
+				},
+			}
+
+			err := build.StartBuild("/builds", "/cache", false, false)
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDir, build.GitReferenceCacheDir)
+		})
+	}
+}
+
 func TestStartBuild(t *testing.T) {
 	type startBuildArgs struct {
 		rootDir               string
@@ -1176,6 +1271,166 @@ func TestGitFetchFlags(t *testing.T) {
 	}
 }
 
+func TestGetSubmodulePaths(t *testing.T) {
+	tests := map[string]struct {
+		value          string
+		expectedPaths  []string
+		expectedErrMsg string
+	}{
+		"not defined": {
+			value:         "",
+			expectedPaths: []string{},
+		},
+		"included and excluded paths": {
+			value:         "libs/first :(exclude)libs/second :!libs/third",
+			expectedPaths: []string{"libs/first", ":(exclude)libs/second", ":!libs/third"},
+		},
+		"exclusion separated from the path": {
+			value:          "libs/first :(exclude) libs/second",
+			expectedErrMsg: `GIT_SUBMODULE_PATHS: excluded path missing after ":(exclude)"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			build := &Build{
+				Runner: &RunnerConfig{},
+				JobResponse: JobResponse{
+					Variables: JobVariables{
+						{Key: "GIT_SUBMODULE_PATHS", Value: test.value},
+					},
+				},
+			}
+
+			paths, err := build.GetSubmodulePaths()
+			if test.expectedErrMsg != "" {
+				assert.EqualError(t, err, test.expectedErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedPaths, paths)
+		})
+	}
+}
+
+func TestGetSubmoduleDepth(t *testing.T) {
+	tests := map[string]struct {
+		value          string
+		expectedDepth  int
+		expectedErrMsg string
+	}{
+		"not defined": {
+			value:         "",
+			expectedDepth: 0,
+		},
+		"depth defined": {
+			value:         "5",
+			expectedDepth: 5,
+		},
+		"negative depth": {
+			value:          "-1",
+			expectedErrMsg: `GIT_SUBMODULE_DEPTH: invalid depth "-1"`,
+		},
+		"invalid depth": {
+			value:          "full",
+			expectedErrMsg: `GIT_SUBMODULE_DEPTH: invalid depth "full"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			build := &Build{
+				Runner: &RunnerConfig{},
+				JobResponse: JobResponse{
+					Variables: JobVariables{
+						{Key: "GIT_SUBMODULE_DEPTH", Value: test.value},
+					},
+				},
+			}
+
+			depth, err := build.GetSubmoduleDepth()
+			if test.expectedErrMsg != "" {
+				assert.EqualError(t, err, test.expectedErrMsg)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, test.expectedDepth, depth)
+		})
+	}
+}
+
+func TestGitFetchFilter(t *testing.T) {
+	tests := map[string]struct {
+		value          string
+		expectedResult string
+	}{
+		"not defined": {
+			value:          "",
+			expectedResult: "",
+		},
+		"blob filter": {
+			value:          "blob:none",
+			expectedResult: "blob:none",
+		},
+		"tree filter with whitespace": {
+			value:          " tree:0 ",
+			expectedResult: "tree:0",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			build := &Build{
+				Runner: &RunnerConfig{},
+				JobResponse: JobResponse{
+					Variables: JobVariables{
+						{Key: "GIT_FETCH_FILTER", Value: test.value},
+					},
+				},
+			}
+
+			assert.Equal(t, test.expectedResult, build.GetGitFetchFilter())
+		})
+	}
+}
+
+func TestGitSparseCheckoutPaths(t *testing.T) {
+	tests := map[string]struct {
+		value          string
+		expectedResult []string
+	}{
+		"not defined": {
+			value:          "",
+			expectedResult: []string{},
+		},
+		"single path": {
+			value:          "services/api",
+			expectedResult: []string{"services/api"},
+		},
+		"multiple paths": {
+			value:          "services/api  docs\tlib",
+			expectedResult: []string{"services/api", "docs", "lib"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			build := &Build{
+				Runner: &RunnerConfig{},
+				JobResponse: JobResponse{
+					Variables: JobVariables{
+						{Key: "GIT_SPARSE_CHECKOUT_PATHS", Value: test.value},
+					},
+				},
+			}
+
+			assert.Equal(t, test.expectedResult, build.GetGitSparseCheckoutPaths())
+		})
+	}
+}
+
 func TestDefaultVariables(t *testing.T) {
 	tests := map[string]struct {
 		jobVariables  JobVariables
@@ -1471,3 +1726,358 @@ func runSuccessfulMockBuild(t *testing.T, prepareFn func(options ExecutorPrepare
 
 	return build
 }
+
+func TestBuildExecuteSteps(t *testing.T) {
+	buildErr := &BuildError{Inner: errors.New("script failed")}
+
+	tests := map[string]struct {
+		steps           Steps
+		stepErrors      map[BuildStage]error
+		expectedStages  []BuildStage
+		expectedErr     error
+		expectedWarning string
+	}{
+		"all steps succeed": {
+			steps: Steps{
+				{Name: "build"},
+				{Name: "test", When: StepWhenOnSuccess},
+				{Name: "report", When: StepWhenAlways},
+				{Name: "debug", When: StepWhenOnFailure},
+				{Name: StepNameAfterScript},
+			},
+			expectedStages: []BuildStage{"step_build", "step_test", "step_report"},
+		},
+		"failure runs only on_failure and always steps": {
+			steps: Steps{
+				{Name: "build"},
+				{Name: "test"},
+				{Name: "report", When: StepWhenAlways},
+				{Name: "debug", When: StepWhenOnFailure},
+			},
+			stepErrors:     map[BuildStage]error{"step_build": buildErr},
+			expectedStages: []BuildStage{"step_build", "step_report", "step_debug"},
+			expectedErr:    buildErr,
+		},
+		"first failure is returned": {
+			steps: Steps{
+				{Name: "build"},
+				{Name: "report", When: StepWhenAlways},
+			},
+			stepErrors: map[BuildStage]error{
+				"step_build":  buildErr,
+				"step_report": errors.New("report failed"),
+			},
+			expectedStages: []BuildStage{"step_build", "step_report"},
+			expectedErr:    buildErr,
+		},
+		"allowed failure doesn't fail the job": {
+			steps: Steps{
+				{Name: "lint", AllowFailure: true},
+				{Name: "test"},
+				{Name: "debug", When: StepWhenOnFailure},
+			},
+			stepErrors:      map[BuildStage]error{"step_lint": buildErr},
+			expectedStages:  []BuildStage{"step_lint", "step_test"},
+			expectedWarning: `Step "lint" failed, but is allowed to fail: script failed`,
+		},
+		"allowed failure doesn't cover system failures": {
+			steps: Steps{
+				{Name: "lint", AllowFailure: true},
+				{Name: "test"},
+			},
+			stepErrors:     map[BuildStage]error{"step_lint": errors.New("system failure")},
+			expectedStages: []BuildStage{"step_lint"},
+			expectedErr:    errors.New("system failure"),
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			build := &Build{
+				JobResponse: JobResponse{Steps: tt.steps},
+				Runner:      &RunnerConfig{},
+			}
+			build.logger = NewBuildLogger(&Trace{Writer: out}, logrus.NewEntry(logrus.New()))
+
+			var stages []BuildStage
+			e := &MockExecutor{}
+			defer e.AssertExpectations(t)
+
+			e.On("Shell").Return(&ShellScriptInfo{Shell: "script-shell"})
+			e.On("Run", mock.Anything).
+				Return(func(cmd ExecutorCommand) error {
+					stages = append(stages, cmd.Stage)
+					return tt.stepErrors[cmd.Stage]
+				})
+
+			err := build.executeSteps(context.Background(), e)
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedStages, stages)
+
+			if tt.expectedWarning != "" {
+				assert.Contains(t, out.String(), tt.expectedWarning)
+			}
+		})
+	}
+}
+
+func TestBuildExecuteStepsTimeout(t *testing.T) {
+	build := &Build{
+		JobResponse: JobResponse{
+			Steps: Steps{
+				{Name: "build", Timeout: 1},
+				{Name: "debug", When: StepWhenOnFailure},
+			},
+		},
+		Runner: &RunnerConfig{},
+	}
+
+	e := &MockExecutor{}
+	defer e.AssertExpectations(t)
+
+	e.On("Shell").Return(&ShellScriptInfo{Shell: "script-shell"})
+	e.On("Run", matchBuildStage("step_build")).
+		Return(func(cmd ExecutorCommand) error {
+			<-cmd.Context.Done()
+			return cmd.Context.Err()
+		}).
+		Once()
+	e.On("Run", matchBuildStage("step_debug")).Return(nil).Once()
+
+	err := build.executeSteps(context.Background(), e)
+
+	var buildErr *BuildError
+	require.True(t, errors.As(err, &buildErr), "expected BuildError, got %#v", err)
+	assert.Equal(t, JobExecutionTimeout, buildErr.FailureReason)
+	assert.EqualError(t, err, `step "build" took longer than 1s`)
+}
+
+func TestBuildAfterScriptTimeout(t *testing.T) {
+	tests := map[string]struct {
+		steps           Steps
+		expectedTimeout time.Duration
+	}{
+		"default timeout": {
+			steps:           Steps{{Name: StepNameScript}, {Name: StepNameAfterScript}},
+			expectedTimeout: AfterScriptTimeout,
+		},
+		"timeout of the step": {
+			steps:           Steps{{Name: StepNameScript, Timeout: 3600}, {Name: StepNameAfterScript, Timeout: 60}},
+			expectedTimeout: time.Minute,
+		},
+		"timeout of the step longer than the default one": {
+			steps:           Steps{{Name: StepNameScript}, {Name: StepNameAfterScript, Timeout: 3600}},
+			expectedTimeout: AfterScriptTimeout,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			build := &Build{JobResponse: JobResponse{Steps: tt.steps}}
+			assert.Equal(t, tt.expectedTimeout, build.afterScriptTimeout())
+		})
+	}
+}
+
+func TestGetCacheArchiveFormat(t *testing.T) {
+	tests := map[string]struct {
+		cache          *CacheConfig
+		variable       string
+		expectedFormat string
+	}{
+		"not set": {
+			expectedFormat: "",
+		},
+		"set by the runner": {
+			cache:          &CacheConfig{Format: "tarzstd"},
+			expectedFormat: "tarzstd",
+		},
+		"set by the job": {
+			variable:       "tar",
+			expectedFormat: "tar",
+		},
+		"job overrides the runner": {
+			cache:          &CacheConfig{Format: "tarzstd"},
+			variable:       "zip",
+			expectedFormat: "zip",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			build := &Build{
+				JobResponse: JobResponse{
+					Variables: JobVariables{
+						{Key: "CACHE_ARCHIVE_FORMAT", Value: tt.variable},
+					},
+				},
+				Runner: &RunnerConfig{
+					RunnerSettings: RunnerSettings{Cache: tt.cache},
+				},
+			}
+
+			assert.Equal(t, tt.expectedFormat, build.GetCacheArchiveFormat())
+		})
+	}
+}
+
+func TestGetCancelGracePeriod(t *testing.T) {
+	tests := map[string]struct {
+		runner           *RunnerConfig
+		unsupported      bool
+		expectedDuration time.Duration
+	}{
+		"no runner": {
+			expectedDuration: 0,
+		},
+		"not set": {
+			runner:           &RunnerConfig{},
+			expectedDuration: 0,
+		},
+		"negative": {
+			runner:           &RunnerConfig{RunnerSettings: RunnerSettings{CancelGracePeriod: -1}},
+			expectedDuration: 0,
+		},
+		"set": {
+			runner:           &RunnerConfig{RunnerSettings: RunnerSettings{CancelGracePeriod: 30}},
+			expectedDuration: 30 * time.Second,
+		},
+		"not supported by the executor": {
+			runner:           &RunnerConfig{RunnerSettings: RunnerSettings{CancelGracePeriod: 30}},
+			unsupported:      true,
+			expectedDuration: 0,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			build := &Build{
+				Runner:           tt.runner,
+				ExecutorFeatures: FeaturesInfo{CancelGracePeriod: !tt.unsupported},
+			}
+			assert.Equal(t, tt.expectedDuration, build.GetCancelGracePeriod())
+		})
+	}
+}
+
+func TestBuildExecuteAfterScriptOnCancel(t *testing.T) {
+	tests := map[string]struct {
+		cancelReason           BuildRuntimeState
+		expectedContextErr     bool
+		expectedCancelReason   string
+		expectedWarningMessage string
+	}{
+		"killed right away": {
+			expectedContextErr: true,
+		},
+		"canceled gracefully": {
+			cancelReason:           BuildRunRuntimeCanceled,
+			expectedCancelReason:   "canceled",
+			expectedWarningMessage: "Job canceled, executing after_script...",
+		},
+		"timed out gracefully": {
+			cancelReason:           BuildRunRuntimeTimedout,
+			expectedCancelReason:   "timedout",
+			expectedWarningMessage: "Job timedout, executing after_script...",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			build := &Build{
+				JobResponse: JobResponse{
+					Steps: Steps{{Name: StepNameScript}, {Name: StepNameAfterScript}},
+				},
+				Runner:       &RunnerConfig{},
+				cancelReason: tt.cancelReason,
+			}
+			build.logger = NewBuildLogger(&Trace{Writer: out}, logrus.NewEntry(logrus.New()))
+
+			e := &MockExecutor{}
+			defer e.AssertExpectations(t)
+
+			e.On("Shell").Return(&ShellScriptInfo{Shell: "script-shell"})
+			e.On("Run", matchBuildStage(BuildStageAfterScript)).
+				Return(func(cmd ExecutorCommand) error {
+					assert.Equal(t, tt.expectedContextErr, cmd.Context.Err() != nil)
+					return nil
+				}).
+				Once()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+
+			build.executeAfterScript(ctx, e)
+
+			assert.Equal(t, tt.expectedCancelReason, build.GetAllVariables().Get("CI_JOB_CANCEL_REASON"))
+			if tt.expectedWarningMessage != "" {
+				assert.Contains(t, out.String(), tt.expectedWarningMessage)
+			}
+		})
+	}
+}
+
+func TestBuildWaitForBuildFinishTimeout(t *testing.T) {
+	build := &Build{
+		JobResponse: JobResponse{
+			Steps: Steps{{Name: StepNameScript}, {Name: StepNameAfterScript, Timeout: 3600}},
+		},
+		Runner:           &RunnerConfig{RunnerSettings: RunnerSettings{CancelGracePeriod: 30}},
+		ExecutorFeatures: FeaturesInfo{CancelGracePeriod: true},
+	}
+	assert.Equal(t, WaitForBuildFinishTimeout, build.waitForBuildFinishTimeout())
+
+	build.cancelReason = BuildRunRuntimeCanceled
+	assert.Equal(
+		t,
+		WaitForBuildFinishTimeout+30*time.Second+AfterScriptTimeout,
+		build.waitForBuildFinishTimeout(),
+		"the after_script executed after the cancellation is limited to AfterScriptTimeout",
+	)
+}
+
+func TestBuildExecuteArchiveCache(t *testing.T) {
+	tests := map[string]struct {
+		state          error
+		stageErr       error
+		expectedStage  BuildStage
+		expectedResult error
+	}{
+		"successful job": {
+			expectedStage: BuildStageArchiveCache,
+		},
+		"successful job fails when cache can't be saved": {
+			stageErr:       errors.New("archive failed"),
+			expectedStage:  BuildStageArchiveCache,
+			expectedResult: errors.New("archive failed"),
+		},
+		"failed job": {
+			state:          errors.New("script failed"),
+			expectedStage:  BuildStageArchiveOnFailureCache,
+			expectedResult: errors.New("script failed"),
+		},
+		"failed job keeps its error when cache can't be saved": {
+			state:          errors.New("script failed"),
+			stageErr:       errors.New("archive failed"),
+			expectedStage:  BuildStageArchiveOnFailureCache,
+			expectedResult: errors.New("script failed"),
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			build := &Build{Runner: &RunnerConfig{}}
+
+			e := &MockExecutor{}
+			defer e.AssertExpectations(t)
+
+			e.On("Shell").Return(&ShellScriptInfo{Shell: "script-shell"})
+			e.On("Run", matchBuildStage(tt.expectedStage)).Return(tt.stageErr).Once()
+
+			err := build.executeArchiveCache(context.Background(), tt.state, e)
+			assert.Equal(t, tt.expectedResult, err)
+		})
+	}
+}
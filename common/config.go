@@ -113,7 +113,69 @@ type DockerConfig struct {
 	Tmpfs                      map[string]string `toml:"tmpfs,omitempty" json:"tmpfs" long:"tmpfs" env:"DOCKER_TMPFS" description:"A toml table/json object with the format key=values. When set this will mount the specified path in the key as a tmpfs volume in the main container, using the options specified as key. For the supported options, see the documentation for the unix 'mount' command"`
 	ServicesTmpfs              map[string]string `toml:"services_tmpfs,omitempty" json:"services_tmpfs" long:"services-tmpfs" env:"DOCKER_SERVICES_TMPFS" description:"A toml table/json object with the format key=values. When set this will mount the specified path in the key as a tmpfs volume in all the service containers, using the options specified as key. For the supported options, see the documentation for the unix 'mount' command"`
 	SysCtls                    DockerSysCtls     `toml:"sysctls,omitempty" json:"sysctls" long:"sysctls" env:"DOCKER_SYSCTLS" description:"Sysctl options, a toml table/json object of key=value. Value is expected to be a string."`
+	Ulimits                    []string          `toml:"ulimits,omitempty" json:"ulimits" long:"ulimits" env:"DOCKER_ULIMITS" description:"Ulimit options for the build container, in the format <type>=<soft limit>[:<hard limit>], e.g. nofile=1024:2048"`
+	PidsLimit                  int64             `toml:"pids_limit,omitzero" json:"pids_limit" long:"pids-limit" env:"DOCKER_PIDS_LIMIT" description:"Maximum number of processes in the build container. Set -1 for unlimited"`
+	BlkioWeight                uint16            `toml:"blkio_weight,omitzero" json:"blkio_weight" long:"blkio-weight" env:"DOCKER_BLKIO_WEIGHT" description:"Block IO weight (relative weight) of the build container, between 10 and 1000"`
+	DeviceReadBps              []string          `toml:"device_read_bps,omitempty" json:"device_read_bps" long:"device-read-bps" env:"DOCKER_DEVICE_READ_BPS" description:"Limit read rate (bytes per second) from a device for the build container, in the format <device-path>:<number>[<unit>]"`
+	DeviceWriteBps             []string          `toml:"device_write_bps,omitempty" json:"device_write_bps" long:"device-write-bps" env:"DOCKER_DEVICE_WRITE_BPS" description:"Limit write rate (bytes per second) to a device for the build container, in the format <device-path>:<number>[<unit>]"`
+	DeviceReadIOps             []string          `toml:"device_read_iops,omitempty" json:"device_read_iops" long:"device-read-iops" env:"DOCKER_DEVICE_READ_IOPS" description:"Limit read rate (IO per second) from a device for the build container, in the format <device-path>:<number>"`
+	DeviceWriteIOps            []string          `toml:"device_write_iops,omitempty" json:"device_write_iops" long:"device-write-iops" env:"DOCKER_DEVICE_WRITE_IOPS" description:"Limit write rate (IO per second) to a device for the build container, in the format <device-path>:<number>"`
+	ServicesUlimits            []string          `toml:"services_ulimits,omitempty" json:"services_ulimits" long:"services-ulimits" env:"DOCKER_SERVICES_ULIMITS" description:"Ulimit options for the service containers. Defaults to the value of ulimits"`
+	ServicesPidsLimit          int64             `toml:"services_pids_limit,omitzero" json:"services_pids_limit" long:"services-pids-limit" env:"DOCKER_SERVICES_PIDS_LIMIT" description:"Maximum number of processes in each service container. Defaults to the value of pids_limit"`
+	ServicesBlkioWeight        uint16            `toml:"services_blkio_weight,omitzero" json:"services_blkio_weight" long:"services-blkio-weight" env:"DOCKER_SERVICES_BLKIO_WEIGHT" description:"Block IO weight of the service containers. Defaults to the value of blkio_weight"`
+	ServicesDeviceReadBps      []string          `toml:"services_device_read_bps,omitempty" json:"services_device_read_bps" long:"services-device-read-bps" env:"DOCKER_SERVICES_DEVICE_READ_BPS" description:"Limit read rate (bytes per second) from a device for the service containers. Defaults to the value of device_read_bps"`
+	ServicesDeviceWriteBps     []string          `toml:"services_device_write_bps,omitempty" json:"services_device_write_bps" long:"services-device-write-bps" env:"DOCKER_SERVICES_DEVICE_WRITE_BPS" description:"Limit write rate (bytes per second) to a device for the service containers. Defaults to the value of device_write_bps"`
+	ServicesDeviceReadIOps     []string          `toml:"services_device_read_iops,omitempty" json:"services_device_read_iops" long:"services-device-read-iops" env:"DOCKER_SERVICES_DEVICE_READ_IOPS" description:"Limit read rate (IO per second) from a device for the service containers. Defaults to the value of device_read_iops"`
+	ServicesDeviceWriteIOps    []string          `toml:"services_device_write_iops,omitempty" json:"services_device_write_iops" long:"services-device-write-iops" env:"DOCKER_SERVICES_DEVICE_WRITE_IOPS" description:"Limit write rate (IO per second) to a device for the service containers. Defaults to the value of device_write_iops"`
 	HelperImage                string            `toml:"helper_image,omitempty" json:"helper_image" long:"helper-image" env:"DOCKER_HELPER_IMAGE" description:"[ADVANCED] Override the default helper image used to clone repos and upload artifacts"`
+
+	CPUSOverwriteMaxAllowed          string `toml:"cpus_overwrite_max_allowed,omitempty" json:"cpus_overwrite_max_allowed" long:"cpus-overwrite-max-allowed" env:"DOCKER_CPUS_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the cpus can be set to. Used with the DOCKER_CPUS variable in the build."`
+	MemoryOverwriteMaxAllowed        string `toml:"memory_overwrite_max_allowed,omitempty" json:"memory_overwrite_max_allowed" long:"memory-overwrite-max-allowed" env:"DOCKER_MEMORY_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory limit can be set to. Used with the DOCKER_MEMORY variable in the build."`
+	ShmSizeOverwriteMaxAllowed       string `toml:"shm_size_overwrite_max_allowed,omitempty" json:"shm_size_overwrite_max_allowed" long:"shm-size-overwrite-max-allowed" env:"DOCKER_SHM_SIZE_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the shared memory size can be set to. Used with the DOCKER_SHM_SIZE variable in the build."`
+	ServiceCPUSOverwriteMaxAllowed   string `toml:"service_cpus_overwrite_max_allowed,omitempty" json:"service_cpus_overwrite_max_allowed" long:"service-cpus-overwrite-max-allowed" env:"DOCKER_SERVICE_CPUS_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the cpus of service containers can be set to. Used with the DOCKER_SERVICE_CPUS variable in the build."`
+	ServiceMemoryOverwriteMaxAllowed string `toml:"service_memory_overwrite_max_allowed,omitempty" json:"service_memory_overwrite_max_allowed" long:"service-memory-overwrite-max-allowed" env:"DOCKER_SERVICE_MEMORY_OVERWRITE_MAX_ALLOWED" description:"If set, the max amount the memory limit of service containers can be set to. Used with the DOCKER_SERVICE_MEMORY variable in the build."`
+
+	EgressPolicy DockerEgressPolicy `toml:"egress_policy,omitempty" json:"egress_policy" namespace:"egress-policy" description:"Outbound traffic policy for the per-build network"`
+	ImagePolicy  DockerImagePolicy  `toml:"image_policy,omitempty" json:"image_policy" namespace:"image-policy" description:"Digest and signature policy for the build and service images"`
+	ImageWarmer  DockerImageWarmer  `toml:"image_warmer,omitempty" json:"image_warmer" namespace:"image-warmer" description:"Pre-pulling of images when the Docker host is idle"`
+}
+
+//nolint:lll
+type DockerImageWarmer struct {
+	Images          []string `toml:"images,omitempty" json:"images" long:"images" env:"DOCKER_IMAGE_WARMER_IMAGES" description:"Images that are pre-pulled when the Docker host is idle"`
+	RecentImages    int      `toml:"recent_images,omitzero" json:"recent_images" long:"recent-images" env:"DOCKER_IMAGE_WARMER_RECENT_IMAGES" description:"Number of images most recently used by jobs that are pre-pulled when the Docker host is idle"`
+	RefreshInterval int      `toml:"refresh_interval,omitzero" json:"refresh_interval" long:"refresh-interval" env:"DOCKER_IMAGE_WARMER_REFRESH_INTERVAL" description:"How often, in seconds, the pre-pulled images are pulled again to pick up updated tags. Defaults to 3600"`
+}
+
+func (w DockerImageWarmer) IsEnabled() bool {
+	return len(w.Images) > 0 || w.RecentImages > 0
+}
+
+func (w DockerImageWarmer) GetRefreshInterval() time.Duration {
+	if w.RefreshInterval > 0 {
+		return time.Duration(w.RefreshInterval) * time.Second
+	}
+
+	return DefaultImageWarmerRefreshInterval
+}
+
+//nolint:lll
+type DockerImagePolicy struct {
+	RequireDigest       bool     `toml:"require_digest,omitzero" json:"require_digest" long:"require-digest" env:"DOCKER_IMAGE_POLICY_REQUIRE_DIGEST" description:"Require the build and service images to be referenced by digest"`
+	AllowedDigests      []string `toml:"allowed_digests,omitempty" json:"allowed_digests" long:"allowed-digests" env:"DOCKER_IMAGE_POLICY_ALLOWED_DIGESTS" description:"Digests (sha256:<hex>) or wildcard patterns of digested references (<name>@sha256:<hex>) of images that are allowed to run"`
+	SignaturePublicKeys []string `toml:"signature_public_keys,omitempty" json:"signature_public_keys" long:"signature-public-keys" env:"DOCKER_IMAGE_POLICY_SIGNATURE_PUBLIC_KEYS" description:"Paths to PEM encoded public keys. When set, images must have a cosign signature made with one of the keys"`
+}
+
+func (p DockerImagePolicy) IsEnabled() bool {
+	return p.RequireDigest || len(p.AllowedDigests) > 0 || len(p.SignaturePublicKeys) > 0
+}
+
+//nolint:lll
+type DockerEgressPolicy struct {
+	Enabled      bool     `toml:"enabled,omitzero" json:"enabled" long:"enabled" env:"DOCKER_EGRESS_POLICY_ENABLED" description:"Deny all outbound traffic from the per-build network that is not explicitly allowed"`
+	AllowedCIDRs []string `toml:"allowed_cidrs,omitempty" json:"allowed_cidrs" long:"allowed-cidrs" env:"DOCKER_EGRESS_POLICY_ALLOWED_CIDRS" description:"Networks that jobs and services are allowed to connect to"`
+	AllowedHosts []string `toml:"allowed_hosts,omitempty" json:"allowed_hosts" long:"allowed-hosts" env:"DOCKER_EGRESS_POLICY_ALLOWED_HOSTS" description:"Wildcard list of hostnames that jobs and services are allowed to connect to"`
+	AllowedPorts []int    `toml:"allowed_ports,omitempty" json:"allowed_ports" long:"allowed-ports" env:"DOCKER_EGRESS_POLICY_ALLOWED_PORTS" description:"Ports that jobs and services are allowed to connect to. If empty all ports are allowed"`
 }
 
 //nolint:lll
@@ -125,6 +187,18 @@ type DockerMachine struct {
 	MachineName    string   `long:"machine-name" env:"MACHINE_NAME" description:"The template for machine name (needs to include %s)"`
 	MachineOptions []string `long:"machine-options" env:"MACHINE_OPTIONS" description:"Additional machine creation options"`
 
+	StateFile string `toml:"StateFile,omitempty" long:"state-file" env:"MACHINE_STATE_FILE" description:"File in which the state of the machines is persisted across runner restarts. Unknown machines found at startup are removed"`
+
+	InstanceProvider string `long:"instance-provider" env:"MACHINE_INSTANCE_PROVIDER" description:"Path to the instance provider plugin used by the docker+autoscaler executor instead of docker-machine"`
+
+	HealthCheckInterval     int    `toml:"HealthCheckInterval,omitzero" long:"health-check-interval" env:"MACHINE_HEALTH_CHECK_INTERVAL" description:"How often, in seconds, idle machines are health checked. 0 disables the health checks"`
+	HealthCheckMaxDiskUsage string `toml:"HealthCheckMaxDiskUsage,omitempty" long:"health-check-max-disk-usage" env:"MACHINE_HEALTH_CHECK_MAX_DISK_USAGE" description:"Maximum disk space used by images, containers and volumes on an idle machine, e.g. 50GB. Machines using more fail the health check"`
+	MaxHealthCheckFailures  int    `toml:"MaxHealthCheckFailures,omitzero" long:"max-health-check-failures" env:"MACHINE_MAX_HEALTH_CHECK_FAILURES" description:"Number of consecutive failed health checks after which a machine is quarantined and removed. Defaults to 3"`
+	MaxSystemFailures       int    `toml:"MaxSystemFailures,omitzero" long:"max-system-failures" env:"MACHINE_MAX_SYSTEM_FAILURES" description:"Number of consecutive jobs failing with a runner system failure after which a machine is quarantined and removed. 0 disables it"`
+
+	MaxGrowthRate        int `toml:"MaxGrowthRate,omitzero" long:"max-growth-rate" env:"MACHINE_MAX_GROWTH_RATE" description:"Maximum number of machines that can be created at the same time. 0 means no limit"`
+	PredictiveIdleWindow int `toml:"PredictiveIdleWindow,omitzero" long:"predictive-idle-window" env:"MACHINE_PREDICTIVE_IDLE_WINDOW" description:"Time, in seconds, over which the job arrival rate is measured to size the idle machines pool. 0 disables the predictive mode"`
+
 	OffPeakPeriods   []string `long:"off-peak-periods" env:"MACHINE_OFF_PEAK_PERIODS" description:"Time periods when the scheduler is in the OffPeak mode. DEPRECATED"`                                    // DEPRECATED
 	OffPeakTimezone  string   `long:"off-peak-timezone" env:"MACHINE_OFF_PEAK_TIMEZONE" description:"Timezone for the OffPeak periods (defaults to Local). DEPRECATED"`                                    // DEPRECATED
 	OffPeakIdleCount int      `long:"off-peak-idle-count" env:"MACHINE_OFF_PEAK_IDLE_COUNT" description:"Maximum idle machines when the scheduler is in the OffPeak mode. DEPRECATED"`                     // DEPRECATED
@@ -141,6 +215,7 @@ type DockerMachineAutoscaling struct {
 	Timezone        string   `long:"timezone" description:"Timezone for the periods (defaults to Local)"`
 	IdleCount       int      `long:"idle-count" description:"Maximum idle machines when this configuration is active"`
 	IdleTime        int      `long:"idle-time" description:"Minimum time after which and idle machine can be destroyed when this configuration is active"`
+	MaxCreations    int      `long:"max-creations" description:"Maximum number of machines created each time this configuration becomes active. 0 means no limit"`
 	compiledPeriods *timeperiod.TimePeriod
 }
 
@@ -176,8 +251,20 @@ type CustomConfig struct {
 	CleanupArgs        []string `toml:"cleanup_args,omitempty" json:"cleanup_args" long:"cleanup-args" description:"Arguments for the cleanup executable"`
 	CleanupExecTimeout *int     `toml:"cleanup_exec_timeout,omitempty" json:"cleanup_exec_timeout" long:"cleanup-exec-timeout" env:"CUSTOM_CLEANUP_EXEC_TIMEOUT" description:"Timeout for the cleanup executable (in seconds)"`
 
+	TerminalExec string   `toml:"terminal_exec,omitempty" json:"terminal_exec" long:"terminal-exec" env:"CUSTOM_TERMINAL_EXEC" description:"Executable that starts an interactive shell in the job environment, used by the interactive web terminal"`
+	TerminalArgs []string `toml:"terminal_args,omitempty" json:"terminal_args" long:"terminal-args" description:"Arguments for the terminal executable"`
+
+	ProxyExec string   `toml:"proxy_exec,omitempty" json:"proxy_exec" long:"proxy-exec" env:"CUSTOM_PROXY_EXEC" description:"Executable that prints the address of a service port in the job environment, used by the session server to proxy requests to the service"`
+	ProxyArgs []string `toml:"proxy_args,omitempty" json:"proxy_args" long:"proxy-args" description:"Arguments for the proxy executable"`
+
 	GracefulKillTimeout *int `toml:"graceful_kill_timeout,omitempty" json:"graceful_kill_timeout" long:"graceful-kill-timeout" env:"CUSTOM_GRACEFUL_KILL_TIMEOUT" description:"Graceful timeout for scripts execution after SIGTERM is sent to the process (in seconds). This limits the time given for scripts to perform the cleanup before exiting"`
 	ForceKillTimeout    *int `toml:"force_kill_timeout,omitempty" json:"force_kill_timeout" long:"force-kill-timeout" env:"CUSTOM_FORCE_KILL_TIMEOUT" description:"Force timeout for scripts execution (in seconds). Counted from the force kill call; if process will be not terminated, Runner will abandon process termination and log an error"`
+
+	DriverExec   string   `toml:"driver_exec,omitempty" json:"driver_exec" long:"driver-exec" env:"CUSTOM_DRIVER_EXEC" description:"Executable of a long-running driver, started once per runner, that is used instead of the stage executables"`
+	DriverArgs   []string `toml:"driver_args,omitempty" json:"driver_args" long:"driver-args" description:"Arguments for the driver executable"`
+	DriverSocket string   `toml:"driver_socket,omitempty" json:"driver_socket" long:"driver-socket" env:"CUSTOM_DRIVER_SOCKET" description:"Unix socket of the long-running driver. Without driver_exec, Runner connects to a driver that is already running"`
+
+	DriverMetrics []string `toml:"driver_metrics,omitempty" json:"driver_metrics" long:"driver-metrics" description:"Names of the metrics recorded from the structured log of the driver. Metrics with other names are ignored"`
 }
 
 type KubernetesPullPolicy string
@@ -345,11 +432,18 @@ type CacheConfig struct {
 	Type   string `toml:"Type,omitempty" long:"type" env:"CACHE_TYPE" description:"Select caching method"`
 	Path   string `toml:"Path,omitempty" long:"path" env:"CACHE_PATH" description:"Name of the path to prepend to the cache URL"`
 	Shared bool   `toml:"Shared,omitempty" long:"shared" env:"CACHE_SHARED" description:"Enable cache sharing between runners."`
+	Format string `toml:"Format,omitempty" long:"format" env:"CACHE_FORMAT" description:"Format of the cache archives: zip, tar or tarzstd. The CACHE_ARCHIVE_FORMAT variable of the job takes precedence"`
 
 	S3  *CacheS3Config  `toml:"s3,omitempty" json:"s3" namespace:"s3"`
 	GCS *CacheGCSConfig `toml:"gcs,omitempty" json:"gcs" namespace:"gcs"`
 }
 
+//nolint:lll
+type GitReferenceCacheConfig struct {
+	Path    string `toml:"path,omitempty" json:"path" long:"path" env:"GIT_REFERENCE_CACHE_PATH" description:"Directory where the reference repositories are stored, as seen by the job. Defaults to git-reference-cache in the cache_dir"`
+	MaxSize int64  `toml:"max_size,omitzero" json:"max_size" long:"max-size" env:"GIT_REFERENCE_CACHE_MAX_SIZE" description:"Maximum size of the reference repositories in megabytes. The least recently used ones are removed when it's exceeded"`
+}
+
 //nolint:lll
 type RunnerSettings struct {
 	Executor  string `toml:"executor" json:"executor" long:"executor" env:"RUNNER_EXECUTOR" required:"true" description:"Select executor, eg. shell, docker, etc."`
@@ -363,12 +457,17 @@ type RunnerSettings struct {
 	PostBuildScript string   `toml:"post_build_script,omitempty" json:"post_build_script" long:"post-build-script" env:"RUNNER_POST_BUILD_SCRIPT" description:"Runner-specific command script executed after code is pulled and just after build executes"`
 
 	DebugTraceDisabled bool `toml:"debug_trace_disabled,omitempty" json:"debug_trace_disabled" long:"debug-trace-disabled" env:"RUNNER_DEBUG_TRACE_DISABLED" description:"When set to true Runner will disable the possibility of using the CI_DEBUG_TRACE feature"`
+	TraceTimestamps    bool `toml:"trace_timestamps,omitempty" json:"trace_timestamps" long:"trace-timestamps" env:"RUNNER_TRACE_TIMESTAMPS" description:"When set to true Runner will prefix each line of the job log with a timestamp. Can be overridden with the CI_TRACE_TIMESTAMPS variable"`
+
+	CancelGracePeriod int `toml:"cancel_grace_period,omitzero" json:"cancel_grace_period" long:"cancel-grace-period" env:"RUNNER_CANCEL_GRACE_PERIOD" description:"Time in seconds given to the job script to terminate after receiving SIGTERM when the job is cancelled or times out, the after_script is executed afterwards. When 0 the script is killed right away"`
 
 	Shell          string           `toml:"shell,omitempty" json:"shell" long:"shell" env:"RUNNER_SHELL" description:"Select bash, cmd or powershell"`
 	CustomBuildDir *CustomBuildDir  `toml:"custom_build_dir,omitempty" json:"custom_build_dir" group:"custom build dir configuration" namespace:"custom_build_dir"`
 	Referees       *referees.Config `toml:"referees,omitempty" json:"referees" group:"referees configuration" namespace:"referees"`
 	Cache          *CacheConfig     `toml:"cache,omitempty" json:"cache" group:"cache configuration" namespace:"cache"`
 
+	GitReferenceCache *GitReferenceCacheConfig `toml:"git_reference_cache,omitempty" json:"git_reference_cache" group:"git reference cache configuration" namespace:"git-reference-cache"`
+
 	SSH        *ssh.Config       `toml:"ssh,omitempty" json:"ssh" group:"ssh executor" namespace:"ssh"`
 	Docker     *DockerConfig     `toml:"docker,omitempty" json:"docker" group:"docker executor" namespace:"docker"`
 	Parallels  *ParallelsConfig  `toml:"parallels,omitempty" json:"parallels" group:"parallels executor" namespace:"parallels"`
@@ -561,6 +660,40 @@ func (c *DockerMachine) GetIdleTime() int {
 	return c.IdleTime
 }
 
+// GetMaxCreations returns the maximum number of machines that can be created
+// while the active autoscaling period is active, and the key identifying the
+// current activation of this period, so that a recurring period gets a new
+// key every time it becomes active. Returns 0 when there is no limit.
+func (c *DockerMachine) GetMaxCreations() (int, string) {
+	autoscaling := c.getActiveAutoscalingConfig()
+	if autoscaling == nil {
+		return 0, ""
+	}
+
+	period := autoscaling.Timezone + " " + strings.Join(autoscaling.Periods, ",")
+	if autoscaling.compiledPeriods != nil {
+		period += " " + autoscaling.compiledPeriods.ActivationStart().Format(time.RFC3339)
+	}
+
+	return autoscaling.MaxCreations, period
+}
+
+func (c *DockerMachine) GetPredictiveIdleWindow() time.Duration {
+	return time.Duration(c.PredictiveIdleWindow) * time.Second
+}
+
+func (c *DockerMachine) GetHealthCheckInterval() time.Duration {
+	return time.Duration(c.HealthCheckInterval) * time.Second
+}
+
+func (c *DockerMachine) GetMaxHealthCheckFailures() int {
+	if c.MaxHealthCheckFailures > 0 {
+		return c.MaxHealthCheckFailures
+	}
+
+	return DefaultMachineMaxHealthCheckFailures
+}
+
 // getActiveAutoscalingConfig returns the autoscaling config matching the current time.
 // It goes through the [[docker.machine.autoscaling]] entries and returns the last one to match.
 // Returns nil on no matching entries.
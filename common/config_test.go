@@ -414,3 +414,88 @@ func TestDockerMachine(t *testing.T) {
 		})
 	}
 }
+
+func TestDockerMachineMaxCreations(t *testing.T) {
+	timeNow := func() time.Time {
+		return time.Date(2020, 05, 05, 20, 00, 00, 0, time.Local)
+	}
+	activeTimePeriod := []string{fmt.Sprintf("* * %d * * * *", timeNow().Hour())}
+	inactiveTimePeriod := []string{fmt.Sprintf("* * %d * * * *", timeNow().Add(2*time.Hour).Hour())}
+
+	oldPeriodTimer := periodTimer
+	defer func() {
+		periodTimer = oldPeriodTimer
+	}()
+	periodTimer = timeNow
+
+	tests := map[string]struct {
+		autoscaling          []*DockerMachineAutoscaling
+		expectedMaxCreations int
+		expectedPeriod       string
+	}{
+		"no autoscaling config": {
+			expectedMaxCreations: 0,
+			expectedPeriod:       "",
+		},
+		"autoscaling config active": {
+			autoscaling: []*DockerMachineAutoscaling{
+				{Periods: activeTimePeriod, Timezone: "UTC", MaxCreations: 10},
+			},
+			expectedMaxCreations: 10,
+			expectedPeriod:       "UTC " + activeTimePeriod[0] + " " + timeNow().UTC().Format(time.RFC3339),
+		},
+		"autoscaling config inactive": {
+			autoscaling: []*DockerMachineAutoscaling{
+				{Periods: inactiveTimePeriod, MaxCreations: 10},
+			},
+			expectedMaxCreations: 0,
+			expectedPeriod:       "",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			config := &DockerMachine{AutoscalingConfigs: tt.autoscaling}
+			require.NoError(t, config.CompilePeriods())
+
+			maxCreations, period := config.GetMaxCreations()
+			assert.Equal(t, tt.expectedMaxCreations, maxCreations)
+			assert.Equal(t, tt.expectedPeriod, period)
+		})
+	}
+}
+
+func TestDockerMachineMaxCreationsWithRecurringPeriod(t *testing.T) {
+	now := time.Date(2020, 05, 05, 20, 10, 00, 0, time.UTC)
+
+	oldPeriodTimer := periodTimer
+	defer func() {
+		periodTimer = oldPeriodTimer
+	}()
+	periodTimer = func() time.Time {
+		return now
+	}
+
+	config := &DockerMachine{
+		AutoscalingConfigs: []*DockerMachineAutoscaling{
+			{Periods: []string{"* * 20 * * * *"}, Timezone: "UTC", MaxCreations: 10},
+		},
+	}
+	require.NoError(t, config.CompilePeriods())
+
+	_, firstActivation := config.GetMaxCreations()
+	assert.Equal(t, "UTC * * 20 * * * * 2020-05-05T20:00:00Z", firstActivation)
+
+	now = now.Add(30 * time.Minute)
+	_, period := config.GetMaxCreations()
+	assert.Equal(t, firstActivation, period, "the key doesn't change while the period is active")
+
+	now = now.Add(time.Hour)
+	maxCreations, period := config.GetMaxCreations()
+	assert.Equal(t, 0, maxCreations)
+	assert.Empty(t, period)
+
+	now = time.Date(2020, 05, 06, 20, 05, 00, 0, time.UTC)
+	_, secondActivation := config.GetMaxCreations()
+	assert.Equal(t, "UTC * * 20 * * * * 2020-05-06T20:00:00Z", secondActivation)
+}
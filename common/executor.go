@@ -82,6 +82,16 @@ type ExecutorProvider interface {
 	GetDefaultShell() string
 }
 
+// ManagedExecutorProvider is implemented by the executor providers that keep
+// resources running for the runners between the jobs.
+type ManagedExecutorProvider interface {
+	// UpdateRunners is called with the runners of every loaded configuration,
+	// so the resources of the removed runners can be released.
+	UpdateRunners(runners []*RunnerConfig)
+	// Shutdown releases the resources of all runners when the process exits.
+	Shutdown()
+}
+
 // BuildError represents an error during build execution, not related to
 // the job script, e.g. failed to create container, establish ssh connection.
 type BuildError struct {
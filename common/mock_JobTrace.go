@@ -61,6 +61,11 @@ func (_m *MockJobTrace) SetMasked(values []string) {
 	_m.Called(values)
 }
 
+// SetTimestamps provides a mock function with given fields: enabled
+func (_m *MockJobTrace) SetTimestamps(enabled bool) {
+	_m.Called(enabled)
+}
+
 // Success provides a mock function with given fields:
 func (_m *MockJobTrace) Success() {
 	_m.Called()
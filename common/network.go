@@ -68,6 +68,10 @@ type FeaturesInfo struct {
 	RawVariables            bool `json:"raw_variables"`
 	ArtifactsExclude        bool `json:"artifacts_exclude"`
 	MultiBuildSteps         bool `json:"multi_build_steps"`
+
+	// CancelGracePeriod is set by the executors that terminate the script
+	// gracefully when the job is cancelled. It's only used by Runner
+	CancelGracePeriod bool `json:"-"`
 }
 
 type RegisterRunnerParameters struct {
@@ -167,6 +171,16 @@ const (
 	StepWhenAlways    StepWhen = "always"
 )
 
+// OnSuccess returns whether the step runs when the previous steps succeeded
+func (when StepWhen) OnSuccess() bool {
+	return when == "" || when == StepWhenOnSuccess || when == StepWhenAlways
+}
+
+// OnFailure returns whether the step runs when one of the previous steps failed
+func (when StepWhen) OnFailure() bool {
+	return when == StepWhenOnFailure || when == StepWhenAlways
+}
+
 type CachePolicy string
 
 const (
@@ -229,6 +243,8 @@ const (
 	ArtifactFormatZip     ArtifactFormat = "zip"
 	ArtifactFormatGzip    ArtifactFormat = "gzip"
 	ArtifactFormatRaw     ArtifactFormat = "raw"
+	ArtifactFormatTar     ArtifactFormat = "tar"
+	ArtifactFormatTarZstd ArtifactFormat = "tarzstd"
 )
 
 type Artifact struct {
@@ -244,11 +260,29 @@ type Artifact struct {
 
 type Artifacts []Artifact
 
+type CacheWhen string
+
+const (
+	CacheWhenOnFailure CacheWhen = "on_failure"
+	CacheWhenOnSuccess CacheWhen = "on_success"
+	CacheWhenAlways    CacheWhen = "always"
+)
+
+func (when CacheWhen) OnSuccess() bool {
+	return when == "" || when == CacheWhenOnSuccess || when == CacheWhenAlways
+}
+
+func (when CacheWhen) OnFailure() bool {
+	return when == CacheWhenOnFailure || when == CacheWhenAlways
+}
+
 type Cache struct {
-	Key       string        `json:"key"`
-	Untracked bool          `json:"untracked"`
-	Policy    CachePolicy   `json:"policy"`
-	Paths     ArtifactPaths `json:"paths"`
+	Key          string        `json:"key"`
+	Untracked    bool          `json:"untracked"`
+	Policy       CachePolicy   `json:"policy"`
+	Paths        ArtifactPaths `json:"paths"`
+	When         CacheWhen     `json:"when"`
+	FallbackKeys []string      `json:"fallback_keys"`
 }
 
 func (c Cache) CheckPolicy(wanted CachePolicy) (bool, error) {
@@ -377,6 +411,7 @@ type JobTrace interface {
 	Cancel() bool
 	SetFailuresCollector(fc FailuresCollector)
 	SetMasked(values []string)
+	SetTimestamps(enabled bool)
 	IsStdout() bool
 }
 
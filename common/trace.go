@@ -26,6 +26,9 @@ func (s *Trace) Write(p []byte) (n int, err error) {
 func (s *Trace) SetMasked(values []string) {
 }
 
+func (s *Trace) SetTimestamps(enabled bool) {
+}
+
 func (s *Trace) Success() {
 }
 
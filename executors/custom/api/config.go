@@ -5,6 +5,10 @@ package api
 // This should be used to pass the configuration values from Custom Executor
 // driver to the Runner.
 type ConfigExecOutput struct {
+	// Version is the version of the contract the output is written for.
+	// If undefined, version 1 is assumed
+	Version *int `json:"version,omitempty"`
+
 	Driver *DriverInfo `json:"driver,omitempty"`
 
 	Hostname  *string `json:"hostname,omitempty"`
@@ -12,6 +16,12 @@ type ConfigExecOutput struct {
 	CacheDir  *string `json:"cache_dir,omitempty"`
 
 	BuildsDirIsShared *bool `json:"builds_dir_is_shared,omitempty"`
+
+	Variables   []Variable   `json:"variables,omitempty"`
+	Timeouts    *Timeouts    `json:"timeouts,omitempty"`
+	Shell       *string      `json:"shell,omitempty"`
+	GitStrategy *string      `json:"git_strategy,omitempty"`
+	Unsupported *Unsupported `json:"unsupported,omitempty"`
 }
 
 // DriverInfo wraps the information about Custom Executor driver details
@@ -20,3 +30,36 @@ type DriverInfo struct {
 	Name    *string `json:"name,omitempty"`
 	Version *string `json:"version,omitempty"`
 }
+
+// Variable is a variable injected into the job by the driver. Masked
+// variables are hidden in the job log
+type Variable struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Masked bool   `json:"masked,omitempty"`
+}
+
+// Timeouts overwrite the timeouts of the executor stages, in seconds.
+// RunExec contains the timeouts of run_exec for the job stages, like
+// get_sources or step_script
+type Timeouts struct {
+	PrepareExec *int           `json:"prepare_exec,omitempty"`
+	CleanupExec *int           `json:"cleanup_exec,omitempty"`
+	RunExec     map[string]int `json:"run_exec,omitempty"`
+}
+
+// Unsupported marks the job as one that can't be run by the driver. The job
+// fails with the reason printed in the job log
+type Unsupported struct {
+	Reason      string      `json:"reason"`
+	FailureType FailureType `json:"failure_type,omitempty"`
+}
+
+type FailureType string
+
+const (
+	// BuildFailure fails the job like a failing script. This is the default
+	BuildFailure FailureType = "build_failure"
+	// SystemFailure fails the job like an error of the runner
+	SystemFailure FailureType = "system_failure"
+)
@@ -8,4 +8,16 @@ const (
 	// The name of the variable used to pass the value of System failure exit code
 	// that should be returned from Custom executor driver
 	SystemFailureExitCodeVariable = "SYSTEM_FAILURE_EXIT_CODE"
+
+	// The name of the variable used to pass the latest version of the config_exec
+	// output supported by Runner, so that drivers can detect the supported keys
+	ConfigExecVersionVariable = "CONFIG_EXEC_VERSION"
+
+	// The name of the variable used to pass the number of the file descriptor
+	// on which the executables can write structured log entries
+	StructuredLogFDVariable = "STRUCTURED_LOG_FD"
 )
+
+// ConfigExecVersion is the latest version of the config_exec output
+// supported by Runner
+const ConfigExecVersion = 2
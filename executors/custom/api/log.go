@@ -0,0 +1,44 @@
+package api
+
+// LogEntryType is the type of a structured log entry
+type LogEntryType string
+
+const (
+	// LogEntrySectionStart starts a collapsible section of the job log
+	LogEntrySectionStart LogEntryType = "section_start"
+	// LogEntrySectionEnd ends a collapsible section of the job log
+	LogEntrySectionEnd LogEntryType = "section_end"
+	// LogEntryWarning prints a warning in the job log
+	LogEntryWarning LogEntryType = "warning"
+	// LogEntryProgress prints the progress of a long operation in the job log
+	LogEntryProgress LogEntryType = "progress"
+	// LogEntryMetric records a value in the Prometheus metrics of Runner
+	LogEntryMetric LogEntryType = "metric"
+	// LogEntryArtifact annotates a file created for the job
+	LogEntryArtifact LogEntryType = "artifact"
+)
+
+// LogEntry is a single line, encoded as JSON, written by the executables to
+// the file descriptor passed in STRUCTURED_LOG_FD. The fields used depend on
+// the type of the entry
+type LogEntry struct {
+	Type LogEntryType `json:"type"`
+
+	// Name of the section or of the metric
+	Name string `json:"name,omitempty"`
+	// Header printed at the start of the section
+	Header string `json:"header,omitempty"`
+
+	// Message of the warning or of the progress
+	Message string `json:"message,omitempty"`
+	// Current step and total steps of the progress
+	Current int `json:"current,omitempty"`
+	Total   int `json:"total,omitempty"`
+
+	// Value of the metric
+	Value float64 `json:"value,omitempty"`
+
+	// Path and description of the artifact
+	Path        string `json:"path,omitempty"`
+	Description string `json:"description,omitempty"`
+}
@@ -42,6 +42,7 @@ func New(ctx context.Context, executable string, args []string, options process.
 		"TMPDIR":                          options.Dir,
 		api.BuildFailureExitCodeVariable:  strconv.Itoa(BuildFailureExitCode),
 		api.SystemFailureExitCodeVariable: strconv.Itoa(SystemFailureExitCode),
+		api.ConfigExecVersionVariable:     strconv.Itoa(api.ConfigExecVersion),
 	}
 
 	env := os.Environ()
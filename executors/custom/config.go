@@ -11,6 +11,12 @@ type config struct {
 	*common.CustomConfig
 }
 
+// usesDriver returns whether the stages are run by a long-running driver
+// instead of the stage executables
+func (c *config) usesDriver() bool {
+	return c.DriverExec != "" || c.DriverSocket != ""
+}
+
 func (c *config) GetConfigExecTimeout() time.Duration {
 	return getDuration(c.ConfigExecTimeout, defaultConfigExecTimeout)
 }
@@ -43,3 +49,34 @@ func getDuration(source *int, defaultValue time.Duration) time.Duration {
 
 	return time.Duration(timeout) * time.Second
 }
+
+// prepareExecTimeout returns the timeout of prepare_exec. The timeouts
+// returned by config_exec take precedence over the configured ones
+func (e *executor) prepareExecTimeout() time.Duration {
+	if e.timeouts == nil {
+		return e.config.GetPrepareExecTimeout()
+	}
+
+	return getDuration(e.timeouts.PrepareExec, e.config.GetPrepareExecTimeout())
+}
+
+func (e *executor) cleanupExecTimeout() time.Duration {
+	if e.timeouts == nil {
+		return e.config.GetCleanupScriptTimeout()
+	}
+
+	return getDuration(e.timeouts.CleanupExec, e.config.GetCleanupScriptTimeout())
+}
+
+func (e *executor) runExecTimeout(stage common.BuildStage) (time.Duration, bool) {
+	if e.timeouts == nil {
+		return 0, false
+	}
+
+	timeout := e.timeouts.RunExec[string(stage)]
+	if timeout <= 0 {
+		return 0, false
+	}
+
+	return time.Duration(timeout) * time.Second, true
+}
@@ -7,6 +7,7 @@ import (
 	"github.com/stretchr/testify/assert"
 
 	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
 )
 
@@ -96,3 +97,34 @@ func TestConfig_GetForceKillTimeout(t *testing.T) {
 		assert.Equal(t, tt.expectedValue, c.GetForceKillTimeout())
 	})
 }
+
+func TestExecutor_TimeoutsFromConfigExec(t *testing.T) {
+	prepareTimeout := 10
+	e := &executor{
+		config: &config{
+			CustomConfig: &common.CustomConfig{},
+		},
+	}
+
+	assert.Equal(t, defaultPrepareExecTimeout, e.prepareExecTimeout())
+	assert.Equal(t, defaultCleanupExecTimeout, e.cleanupExecTimeout())
+	_, ok := e.runExecTimeout("get_sources")
+	assert.False(t, ok)
+
+	e.timeouts = &api.Timeouts{
+		PrepareExec: &prepareTimeout,
+		RunExec: map[string]int{
+			"get_sources": 30,
+		},
+	}
+
+	assert.Equal(t, 10*time.Second, e.prepareExecTimeout())
+	assert.Equal(t, defaultCleanupExecTimeout, e.cleanupExecTimeout())
+
+	timeout, ok := e.runExecTimeout("get_sources")
+	assert.True(t, ok)
+	assert.Equal(t, 30*time.Second, timeout)
+
+	_, ok = e.runExecTimeout("step_script")
+	assert.False(t, ok)
+}
@@ -5,3 +5,4 @@ import "time"
 const defaultConfigExecTimeout = time.Hour
 const defaultPrepareExecTimeout = time.Hour
 const defaultCleanupExecTimeout = time.Hour
+const defaultProxyExecTimeout = 30 * time.Second
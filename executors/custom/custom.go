@@ -9,6 +9,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
 
 	"github.com/sirupsen/logrus"
 
@@ -16,6 +17,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-runner/executors"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/command"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
 )
 
@@ -34,7 +36,15 @@ type ConfigExecOutput struct {
 	api.ConfigExecOutput
 }
 
-func (c *ConfigExecOutput) InjectInto(executor *executor) {
+func (c *ConfigExecOutput) InjectInto(executor *executor) error {
+	if c.Version != nil && *c.Version > api.ConfigExecVersion {
+		return fmt.Errorf("unsupported config_exec output version %d, latest supported is %d", *c.Version, api.ConfigExecVersion)
+	}
+
+	if c.Unsupported != nil {
+		return c.unsupportedError()
+	}
+
 	if c.Hostname != nil {
 		executor.Build.Hostname = *c.Hostname
 	}
@@ -52,6 +62,66 @@ func (c *ConfigExecOutput) InjectInto(executor *executor) {
 	}
 
 	executor.driverInfo = c.Driver
+	executor.timeouts = c.Timeouts
+
+	if c.Shell != nil {
+		if common.GetShell(*c.Shell) == nil {
+			return fmt.Errorf("shell %q returned by config_exec is not supported", *c.Shell)
+		}
+		executor.Config.Shell = *c.Shell
+	}
+
+	if c.GitStrategy != nil {
+		switch *c.GitStrategy {
+		case "clone", "fetch", "none":
+		default:
+			return fmt.Errorf("git strategy %q returned by config_exec is not supported", *c.GitStrategy)
+		}
+
+		executor.Build.Variables = append(executor.Build.Variables, common.JobVariable{
+			Key:    "GIT_STRATEGY",
+			Value:  *c.GitStrategy,
+			Public: true,
+		})
+		executor.Build.RefreshAllVariables()
+	}
+
+	c.injectVariables(executor)
+
+	return nil
+}
+
+func (c *ConfigExecOutput) injectVariables(executor *executor) {
+	if len(c.Variables) < 1 {
+		return
+	}
+
+	for _, variable := range c.Variables {
+		executor.Build.Variables = append(executor.Build.Variables, common.JobVariable{
+			Key:    variable.Key,
+			Value:  variable.Value,
+			Masked: variable.Masked,
+		})
+	}
+
+	// The variables of the build are already computed when config_exec runs
+	executor.Build.RefreshAllVariables()
+
+	// The values of the new masked variables need to be hidden in the job log
+	executor.Trace.SetMasked(executor.Build.GetAllVariables().Masked())
+}
+
+func (c *ConfigExecOutput) unsupportedError() error {
+	err := fmt.Errorf("job is not supported by the custom executor driver: %s", c.Unsupported.Reason)
+
+	switch c.Unsupported.FailureType {
+	case api.SystemFailure:
+		return err
+	case api.BuildFailure, "":
+		return &common.BuildError{Inner: err}
+	default:
+		return fmt.Errorf("unknown failure type %q returned by config_exec: %w", c.Unsupported.FailureType, err)
+	}
 }
 
 type executor struct {
@@ -61,6 +131,12 @@ type executor struct {
 	tempDir string
 
 	driverInfo *api.DriverInfo
+	timeouts   *api.Timeouts
+
+	// driverClient is connected to the long-running driver listening on
+	// driverSocket, when the executor uses one
+	driverClient *driver.Client
+	driverSocket string
 }
 
 func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
@@ -76,6 +152,10 @@ func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
 		return err
 	}
 
+	if e.config.usesDriver() {
+		return e.prepareWithDriver()
+	}
+
 	err = e.dynamicConfig()
 	if err != nil {
 		return err
@@ -88,12 +168,14 @@ func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
 		return err
 	}
 
+	e.prepareProxyPool()
+
 	// nothing to do, as there's no prepare_script
 	if e.config.PrepareExec == "" {
 		return nil
 	}
 
-	ctx, cancelFunc := context.WithTimeout(e.Context, e.config.GetPrepareExecTimeout())
+	ctx, cancelFunc := context.WithTimeout(e.Context, e.prepareExecTimeout())
 	defer cancelFunc()
 
 	opts := prepareCommandOpts{
@@ -114,7 +196,7 @@ func (e *executor) prepareConfig() error {
 		CustomConfig: e.Config.Custom,
 	}
 
-	if e.config.RunExec == "" {
+	if e.config.RunExec == "" && !e.config.usesDriver() {
 		return common.MakeBuildError("custom executor is missing RunExec")
 	}
 
@@ -158,9 +240,7 @@ func (e *executor) dynamicConfig() error {
 		return fmt.Errorf("error while parsing JSON output: %w", err)
 	}
 
-	config.InjectInto(e)
-
-	return nil
+	return config.InjectInto(e)
 }
 
 func (e *executor) logStartupMessage() {
@@ -202,14 +282,36 @@ func (e *executor) prepareCommand(ctx context.Context, opts prepareCommandOpts)
 		ForceKillTimeout:    e.config.GetForceKillTimeout(),
 	}
 
+	cmdOpts.Env = append(cmdOpts.Env, e.customEnv()...)
+
+	if !supportsStructuredLog() {
+		return commandFactory(ctx, opts.executable, opts.args, cmdOpts)
+	}
+
+	return &structuredLogCommand{
+		executor:   e,
+		ctx:        ctx,
+		executable: opts.executable,
+		args:       opts.args,
+		options:    cmdOpts,
+	}
+}
+
+// customEnv returns the job variables prefixed with CUSTOM_ENV_
+func (e *executor) customEnv() []string {
+	env := make([]string, 0)
 	for _, variable := range e.Build.GetAllVariables() {
-		cmdOpts.Env = append(cmdOpts.Env, fmt.Sprintf("CUSTOM_ENV_%s=%s", variable.Key, variable.Value))
+		env = append(env, fmt.Sprintf("CUSTOM_ENV_%s=%s", variable.Key, variable.Value))
 	}
 
-	return commandFactory(ctx, opts.executable, opts.args, cmdOpts)
+	return env
 }
 
 func (e *executor) Run(cmd common.ExecutorCommand) error {
+	if e.driverClient != nil {
+		return e.runWithDriver(cmd)
+	}
+
 	scriptDir, err := ioutil.TempDir(e.tempDir, "script")
 	if err != nil {
 		return err
@@ -237,7 +339,30 @@ func (e *executor) Run(cmd common.ExecutorCommand) error {
 		out:        e.defaultCommandOutputs(),
 	}
 
-	return e.prepareCommand(cmd.Context, opts).Run()
+	return e.runWithStageTimeout(cmd, func(ctx context.Context) error {
+		return e.prepareCommand(ctx, opts).Run()
+	})
+}
+
+// runWithStageTimeout runs the stage with the timeout returned by config_exec
+func (e *executor) runWithStageTimeout(cmd common.ExecutorCommand, run func(ctx context.Context) error) error {
+	timeout, ok := e.runExecTimeout(cmd.Stage)
+	if !ok {
+		return run(cmd.Context)
+	}
+
+	ctx, cancelFunc := context.WithTimeout(cmd.Context, timeout)
+	defer cancelFunc()
+
+	err := run(ctx)
+	if err != nil && ctx.Err() == context.DeadlineExceeded && cmd.Context.Err() == nil {
+		return &common.BuildError{
+			Inner:         fmt.Errorf("stage %s timed out after %s: %w", cmd.Stage, timeout, err),
+			FailureReason: common.JobExecutionTimeout,
+		}
+	}
+
+	return err
 }
 
 func (e *executor) Cleanup() {
@@ -253,12 +378,17 @@ func (e *executor) Cleanup() {
 
 	defer func() { _ = os.RemoveAll(e.tempDir) }()
 
+	if e.driverClient != nil {
+		e.cleanupWithDriver()
+		return
+	}
+
 	// nothing to do, as there's no cleanup_script
 	if e.config.CleanupExec == "" {
 		return
 	}
 
-	ctx, cancelFunc := context.WithTimeout(context.Background(), e.config.GetCleanupScriptTimeout())
+	ctx, cancelFunc := context.WithTimeout(context.Background(), e.cleanupExecTimeout())
 	defer cancelFunc()
 
 	stdoutLogger := e.BuildLogger.WithFields(logrus.Fields{"cleanup_std": "out"})
@@ -303,11 +433,19 @@ func init() {
 	featuresUpdater := func(features *common.FeaturesInfo) {
 		features.Variables = true
 		features.Shared = true
+		features.Session = true
+		features.Proxy = true
+
+		if runtime.GOOS != "windows" {
+			features.Terminal = true
+		}
 	}
 
-	common.RegisterExecutorProvider("custom", executors.DefaultExecutorProvider{
-		Creator:          creator,
-		FeaturesUpdater:  featuresUpdater,
-		DefaultShellName: options.Shell.Shell,
+	common.RegisterExecutorProvider("custom", executorProvider{
+		DefaultExecutorProvider: executors.DefaultExecutorProvider{
+			Creator:          creator,
+			FeaturesUpdater:  featuresUpdater,
+			DefaultShellName: options.Shell.Shell,
+		},
 	})
 }
@@ -3,6 +3,7 @@ package custom
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -446,6 +447,131 @@ func TestExecutor_Prepare(t *testing.T) {
 	}
 }
 
+func TestConfigExecOutput_InjectInto(t *testing.T) {
+	tests := map[string]struct {
+		output         string
+		assertExecutor func(t *testing.T, e *executor)
+		expectedMasked []string
+		expectedError  string
+		expectBuildErr bool
+	}{
+		"variables": {
+			output: `{
+				"variables": [
+					{"key": "VM_IP", "value": "10.0.0.5"},
+					{"key": "LICENCE_TOKEN", "value": "secret-token", "masked": true}
+				]
+			}`,
+			assertExecutor: func(t *testing.T, e *executor) {
+				variables := e.Build.GetAllVariables()
+				assert.Equal(t, "10.0.0.5", variables.Get("VM_IP"))
+				assert.Equal(t, "secret-token", variables.Get("LICENCE_TOKEN"))
+			},
+			expectedMasked: []string{"secret-token"},
+		},
+		"shell and git strategy": {
+			output: `{"version": 2, "shell": "pwsh", "git_strategy": "none"}`,
+			assertExecutor: func(t *testing.T, e *executor) {
+				assert.Equal(t, "pwsh", e.Config.Shell)
+				assert.Equal(t, common.GitNone, e.Build.GetGitStrategy())
+			},
+		},
+		"timeouts": {
+			output: `{"timeouts": {"prepare_exec": 60, "run_exec": {"step_script": 600}}}`,
+			assertExecutor: func(t *testing.T, e *executor) {
+				require.NotNil(t, e.timeouts)
+				assert.Equal(t, 60, *e.timeouts.PrepareExec)
+				assert.Equal(t, 600, e.timeouts.RunExec["step_script"])
+			},
+		},
+		"unsupported shell": {
+			output:        `{"shell": "fish"}`,
+			expectedError: `shell "fish" returned by config_exec is not supported`,
+		},
+		"unsupported git strategy": {
+			output:        `{"git_strategy": "sparse"}`,
+			expectedError: `git strategy "sparse" returned by config_exec is not supported`,
+		},
+		"unsupported version": {
+			output:        `{"version": 99}`,
+			expectedError: "unsupported config_exec output version 99, latest supported is 2",
+		},
+		"unsupported job": {
+			output:         `{"unsupported": {"reason": "no GPU hosts available"}}`,
+			expectedError:  "job is not supported by the custom executor driver: no GPU hosts available",
+			expectBuildErr: true,
+		},
+		"unsupported job with system failure": {
+			output:        `{"unsupported": {"reason": "hypervisor is down", "failure_type": "system_failure"}}`,
+			expectedError: "job is not supported by the custom executor driver: hypervisor is down",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			trace := new(common.MockJobTrace)
+			defer trace.AssertExpectations(t)
+
+			if tt.expectedMasked != nil {
+				trace.On("SetMasked", tt.expectedMasked).Once()
+			}
+
+			runnerConfig := getRunnerConfig(&common.CustomConfig{RunExec: "bash"})
+			e := &executor{}
+			e.Config = runnerConfig
+			e.Build = &common.Build{Runner: &runnerConfig}
+			e.Trace = trace
+
+			output := new(ConfigExecOutput)
+			require.NoError(t, json.Unmarshal([]byte(tt.output), output))
+
+			err := output.InjectInto(e)
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.EqualError(t, err, tt.expectedError)
+
+				_, isBuildErr := err.(*common.BuildError)
+				assert.Equal(t, tt.expectBuildErr, isBuildErr)
+				return
+			}
+
+			require.NoError(t, err)
+			tt.assertExecutor(t, e)
+		})
+	}
+}
+
+func TestConfigExecOutput_InjectIntoComputedVariables(t *testing.T) {
+	trace := new(common.MockJobTrace)
+	defer trace.AssertExpectations(t)
+
+	trace.On("SetMasked", []string{"secret-token"}).Once()
+
+	runnerConfig := getRunnerConfig(&common.CustomConfig{RunExec: "bash"})
+	e := &executor{}
+	e.Config = runnerConfig
+	e.Build = &common.Build{Runner: &runnerConfig}
+	e.Trace = trace
+
+	// The variables are computed by the build before config_exec runs
+	require.Empty(t, e.Build.GetAllVariables().Get("LICENCE_TOKEN"))
+	require.NotEqual(t, common.GitNone, e.Build.GetGitStrategy())
+
+	output := new(ConfigExecOutput)
+	err := json.Unmarshal([]byte(`{
+		"git_strategy": "none",
+		"variables": [{"key": "LICENCE_TOKEN", "value": "secret-token", "masked": true}]
+	}`), output)
+	require.NoError(t, err)
+
+	require.NoError(t, output.InjectInto(e))
+
+	variables := e.Build.GetAllVariables()
+	assert.Equal(t, "secret-token", variables.Get("LICENCE_TOKEN"))
+	assert.Contains(t, variables.Masked(), "secret-token")
+	assert.Equal(t, common.GitNone, e.Build.GetGitStrategy())
+}
+
 func TestExecutor_Cleanup(t *testing.T) {
 	tests := map[string]executorTestCase{
 		"custom executor not set": {
@@ -711,3 +837,16 @@ func TestExecutor_Env(t *testing.T) {
 		})
 	}
 }
+
+func TestExecutorProvider_GetFeatures(t *testing.T) {
+	features := new(common.FeaturesInfo)
+
+	err := common.GetExecutorProvider("custom").GetFeatures(features)
+	require.NoError(t, err)
+
+	assert.True(t, features.Variables)
+	assert.True(t, features.Shared)
+	assert.True(t, features.Session)
+	assert.True(t, features.Proxy)
+	assert.Equal(t, runtime.GOOS != "windows", features.Terminal)
+}
@@ -0,0 +1,142 @@
+package custom
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
+)
+
+var driverLauncher = driver.DefaultLauncher
+
+// UpdateRunners stops the drivers of the runners that were removed from the
+// configuration or no longer use driver_exec
+func (p executorProvider) UpdateRunners(runners []*common.RunnerConfig) {
+	var used []string
+	for _, runner := range runners {
+		if runner.Executor == "custom" && runner.Custom != nil && runner.Custom.DriverExec != "" {
+			used = append(used, runner.ShortDescription())
+		}
+	}
+
+	driverLauncher.StopUnused(used)
+}
+
+// Shutdown stops the drivers of all runners
+func (p executorProvider) Shutdown() {
+	driverLauncher.Stop()
+}
+
+// prepareWithDriver runs the config and prepare stages with the long-running
+// driver, instead of config_exec and prepare_exec
+func (e *executor) prepareWithDriver() error {
+	err := e.connectDriver()
+	if err != nil {
+		return err
+	}
+
+	err = e.driverConfig()
+	if err != nil {
+		return err
+	}
+
+	e.logStartupMessage()
+
+	err = e.AbstractExecutor.PrepareBuildAndShell()
+	if err != nil {
+		return err
+	}
+
+	e.prepareProxyPool()
+
+	ctx, cancelFunc := context.WithTimeout(e.Context, e.prepareExecTimeout())
+	defer cancelFunc()
+
+	params := driver.PrepareParams{JobParams: e.driverJobParams()}
+
+	return e.callDriver(ctx, driver.MethodPrepare, params, nil, e.Trace, e.Trace)
+}
+
+func (e *executor) connectDriver() error {
+	socket := e.config.DriverSocket
+	if e.config.DriverExec != "" {
+		var err error
+		socket, err = driverLauncher.Socket(e.Config.ShortDescription(), driver.LaunchOptions{
+			Executable: e.config.DriverExec,
+			Args:       e.config.DriverArgs,
+			Socket:     e.config.DriverSocket,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	client, err := driver.Dial(e.Context, socket, e.config.GetGracefulKillTimeout())
+	if err != nil {
+		return err
+	}
+
+	e.driverClient = client
+	e.driverSocket = socket
+
+	return nil
+}
+
+func (e *executor) driverConfig() error {
+	ctx, cancelFunc := context.WithTimeout(e.Context, e.config.GetConfigExecTimeout())
+	defer cancelFunc()
+
+	config := new(ConfigExecOutput)
+	params := driver.ConfigParams{JobParams: e.driverJobParams()}
+
+	err := e.callDriver(ctx, driver.MethodConfig, params, &config.ConfigExecOutput, nil, e.Trace)
+	if err != nil {
+		return err
+	}
+
+	return config.InjectInto(e)
+}
+
+func (e *executor) runWithDriver(cmd common.ExecutorCommand) error {
+	params := driver.RunParams{
+		JobParams: e.driverJobParams(),
+		Stage:     string(cmd.Stage),
+		Script:    cmd.Script,
+	}
+
+	return e.runWithStageTimeout(cmd, func(ctx context.Context) error {
+		return e.callDriver(ctx, driver.MethodRun, params, nil, e.Trace, e.Trace)
+	})
+}
+
+func (e *executor) cleanupWithDriver() {
+	defer func() { _ = e.driverClient.Close() }()
+
+	ctx, cancelFunc := context.WithTimeout(context.Background(), e.cleanupExecTimeout())
+	defer cancelFunc()
+
+	stdoutLogger := e.BuildLogger.WithFields(logrus.Fields{"cleanup_std": "out"})
+	stderrLogger := e.BuildLogger.WithFields(logrus.Fields{"cleanup_std": "err"})
+
+	params := driver.CleanupParams{JobParams: e.driverJobParams()}
+	err := e.callDriver(
+		ctx,
+		driver.MethodCleanup,
+		params,
+		nil,
+		stdoutLogger.WriterLevel(logrus.DebugLevel),
+		stderrLogger.WriterLevel(logrus.WarnLevel),
+	)
+	if err != nil {
+		e.Warningln("Cleanup with driver failed:", err)
+	}
+}
+
+func (e *executor) driverJobParams() driver.JobParams {
+	return driver.JobParams{
+		JobID: e.Build.ID,
+		Env:   e.customEnv(),
+	}
+}
@@ -0,0 +1,304 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+var errClientClosed = errors.New("connection to the driver is closed")
+
+// maxMessageSize limits the size of a single message received from the driver
+const maxMessageSize = 16 * 1024 * 1024
+
+type call struct {
+	stdout io.Writer
+	stderr io.Writer
+	log    io.Writer
+
+	done chan *message
+}
+
+// Client sends the requests of a job to the driver
+type Client struct {
+	conn net.Conn
+
+	writeLock sync.Mutex
+	encoder   *json.Encoder
+
+	lock    sync.Mutex
+	nextID  int64
+	pending map[int64]*call
+	err     error
+
+	// cancelTimeout is the time given to the driver to finish a cancelled
+	// request
+	cancelTimeout time.Duration
+}
+
+// Dial connects to the driver listening on the unix socket
+func Dial(ctx context.Context, socket string, cancelTimeout time.Duration) (*Client, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the driver: %w", err)
+	}
+
+	return NewClient(conn, cancelTimeout), nil
+}
+
+func NewClient(conn net.Conn, cancelTimeout time.Duration) *Client {
+	c := &Client{
+		conn:          conn,
+		encoder:       json.NewEncoder(conn),
+		pending:       make(map[int64]*call),
+		cancelTimeout: cancelTimeout,
+	}
+
+	go c.read()
+
+	return c
+}
+
+// Call sends the request and waits for its result. The output notifications
+// of the request are written to stdout and stderr. When the context is done,
+// the request is cancelled and the driver is given cancelTimeout to finish it
+func (c *Client) Call(
+	ctx context.Context,
+	method string,
+	params interface{},
+	result interface{},
+	stdout io.Writer,
+	stderr io.Writer,
+) error {
+	return c.CallWithLog(ctx, method, params, result, stdout, stderr, nil)
+}
+
+// CallWithLog is like Call, with the structured log entries sent by the driver
+// for the request written to log. Without log, they are dropped
+func (c *Client) CallWithLog(
+	ctx context.Context,
+	method string,
+	params interface{},
+	result interface{},
+	stdout io.Writer,
+	stderr io.Writer,
+	log io.Writer,
+) error {
+	id, pending, err := c.register(stdout, stderr, log)
+	if err != nil {
+		return err
+	}
+	defer c.unregister(id)
+
+	err = c.send(&id, method, params)
+	if err != nil {
+		return err
+	}
+
+	var response *message
+	select {
+	case response = <-pending.done:
+	case <-ctx.Done():
+		response, err = c.cancel(id, pending)
+		if err != nil {
+			return err
+		}
+	}
+
+	if response == nil {
+		return c.closeErr()
+	}
+
+	return decodeResponse(response, result)
+}
+
+func (c *Client) cancel(id int64, pending *call) (*message, error) {
+	err := c.send(nil, MethodCancel, CancelParams{ID: id})
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case response := <-pending.done:
+		return response, nil
+	case <-time.After(c.cancelTimeout):
+		return nil, fmt.Errorf("driver didn't finish the cancelled request in %s", c.cancelTimeout)
+	}
+}
+
+func decodeResponse(response *message, result interface{}) error {
+	if response.Error != nil {
+		switch response.Error.Code {
+		case ErrorCodeBuildFailure:
+			return &common.BuildError{Inner: response.Error}
+		default:
+			return response.Error
+		}
+	}
+
+	if result == nil || len(response.Result) == 0 {
+		return nil
+	}
+
+	err := json.Unmarshal(response.Result, result)
+	if err != nil {
+		return fmt.Errorf("parsing result: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) register(stdout io.Writer, stderr io.Writer, log io.Writer) (int64, *call, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err != nil {
+		return 0, nil, c.err
+	}
+
+	c.nextID++
+	pending := &call{
+		stdout: stdout,
+		stderr: stderr,
+		log:    log,
+		done:   make(chan *message, 1),
+	}
+	c.pending[c.nextID] = pending
+
+	return c.nextID, pending, nil
+}
+
+func (c *Client) unregister(id int64) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	delete(c.pending, id)
+}
+
+func (c *Client) send(id *int64, method string, params interface{}) error {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("encoding params: %w", err)
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	err = c.encoder.Encode(&message{
+		JSONRPC: jsonRPCVersion,
+		ID:      id,
+		Method:  method,
+		Params:  data,
+	})
+	if err != nil {
+		return fmt.Errorf("sending %s request: %w", method, err)
+	}
+
+	return nil
+}
+
+func (c *Client) read() {
+	scanner := bufio.NewScanner(c.conn)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	for scanner.Scan() {
+		var msg message
+		if err := json.Unmarshal(scanner.Bytes(), &msg); err != nil {
+			c.close(fmt.Errorf("parsing message from the driver: %w", err))
+			return
+		}
+
+		c.handle(&msg)
+	}
+
+	err := scanner.Err()
+	if err == nil {
+		err = errClientClosed
+	}
+	c.close(err)
+}
+
+func (c *Client) handle(msg *message) {
+	if msg.Method == MethodOutput {
+		c.handleOutput(msg)
+		return
+	}
+
+	if msg.ID == nil {
+		return
+	}
+
+	c.lock.Lock()
+	pending := c.pending[*msg.ID]
+	c.lock.Unlock()
+
+	if pending == nil {
+		return
+	}
+
+	select {
+	case pending.done <- msg:
+	default:
+	}
+}
+
+func (c *Client) handleOutput(msg *message) {
+	var output OutputParams
+	if err := json.Unmarshal(msg.Params, &output); err != nil {
+		return
+	}
+
+	c.lock.Lock()
+	pending := c.pending[output.ID]
+	c.lock.Unlock()
+
+	if pending == nil {
+		return
+	}
+
+	w := pending.stdout
+	switch output.Stream {
+	case StreamStderr:
+		w = pending.stderr
+	case StreamLog:
+		w = pending.log
+	}
+
+	if w != nil {
+		_, _ = io.WriteString(w, output.Data)
+	}
+}
+
+func (c *Client) close(err error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.err != nil {
+		return
+	}
+
+	c.err = err
+	for _, pending := range c.pending {
+		close(pending.done)
+	}
+}
+
+func (c *Client) closeErr() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.err
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
@@ -0,0 +1,275 @@
+package driver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+)
+
+type fakeHandler struct {
+	cancelled chan struct{}
+	terminal  io.ReadWriteCloser
+}
+
+func (h *fakeHandler) Config(ctx context.Context, params ConfigParams) (*api.ConfigExecOutput, error) {
+	hostname := "fake"
+	return &api.ConfigExecOutput{Hostname: &hostname}, nil
+}
+
+func (h *fakeHandler) Prepare(ctx context.Context, params PrepareParams, output Output) error {
+	_, _ = io.WriteString(output.Stdout, "prepare stdout\n")
+	_, _ = io.WriteString(output.Stderr, "prepare stderr\n")
+	_, _ = io.WriteString(output.Log, "prepare log\n")
+	return nil
+}
+
+func (h *fakeHandler) Run(ctx context.Context, params RunParams, output Output) error {
+	switch params.Script {
+	case "fail":
+		return &Error{Code: ErrorCodeBuildFailure, Message: "script failed"}
+	case "crash":
+		return errors.New("driver crashed")
+	case "sleep":
+		<-ctx.Done()
+		close(h.cancelled)
+		return &Error{Code: ErrorCodeBuildFailure, Message: "cancelled"}
+	}
+
+	_, _ = io.WriteString(output.Stdout, params.Stage+": "+params.Script)
+	return nil
+}
+
+func (h *fakeHandler) Cleanup(ctx context.Context, params CleanupParams, output Output) error {
+	return nil
+}
+
+func (h *fakeHandler) Terminal(ctx context.Context, params TerminalParams) (io.ReadWriteCloser, error) {
+	if h.terminal == nil {
+		return nil, errors.New("no terminal")
+	}
+
+	return h.terminal, nil
+}
+
+func (h *fakeHandler) Proxy(ctx context.Context, params ProxyParams) (*ProxyResult, error) {
+	return &ProxyResult{Address: fmt.Sprintf("http://%s:%d", params.Service, params.Port)}, nil
+}
+
+// syncBuffer is written by the reader goroutine of the client
+type syncBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.buf.String()
+}
+
+func startServer(t *testing.T, handler Handler) (string, func()) {
+	dir, err := ioutil.TempDir("", "driver")
+	require.NoError(t, err)
+
+	socket := filepath.Join(dir, "driver.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	go func() { _ = Serve(listener, handler) }()
+
+	return socket, func() {
+		_ = listener.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func dialServer(t *testing.T, handler Handler) (*Client, func()) {
+	socket, cleanup := startServer(t, handler)
+
+	client, err := Dial(context.Background(), socket, time.Second)
+	require.NoError(t, err)
+
+	return client, func() {
+		_ = client.Close()
+		cleanup()
+	}
+}
+
+func TestClientCallWithResult(t *testing.T) {
+	client, cleanup := dialServer(t, &fakeHandler{})
+	defer cleanup()
+
+	var result api.ConfigExecOutput
+	err := client.Call(context.Background(), MethodConfig, ConfigParams{}, &result, nil, nil)
+	require.NoError(t, err)
+	require.NotNil(t, result.Hostname)
+	assert.Equal(t, "fake", *result.Hostname)
+}
+
+func TestClientCallProxy(t *testing.T) {
+	client, cleanup := dialServer(t, &fakeHandler{})
+	defer cleanup()
+
+	var result ProxyResult
+	params := ProxyParams{Service: "db", Port: 8080, Protocol: "http"}
+	err := client.Call(context.Background(), MethodProxy, params, &result, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://db:8080", result.Address)
+}
+
+func TestClientCallOutput(t *testing.T) {
+	client, cleanup := dialServer(t, &fakeHandler{})
+	defer cleanup()
+
+	stdout := new(syncBuffer)
+	stderr := new(syncBuffer)
+
+	err := client.Call(context.Background(), MethodPrepare, PrepareParams{}, nil, stdout, stderr)
+	require.NoError(t, err)
+	assert.Equal(t, "prepare stdout\n", stdout.String())
+	assert.Equal(t, "prepare stderr\n", stderr.String())
+
+	stdout = new(syncBuffer)
+	log := new(syncBuffer)
+	err = client.CallWithLog(context.Background(), MethodPrepare, PrepareParams{}, nil, stdout, nil, log)
+	require.NoError(t, err)
+	assert.Equal(t, "prepare stdout\n", stdout.String(), "the log isn't written to stdout")
+	assert.Equal(t, "prepare log\n", log.String())
+
+	stdout = new(syncBuffer)
+	params := RunParams{Stage: "build_script", Script: "echo"}
+	err = client.Call(context.Background(), MethodRun, params, nil, stdout, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "build_script: echo", stdout.String())
+}
+
+func TestClientCallErrors(t *testing.T) {
+	client, cleanup := dialServer(t, &fakeHandler{})
+	defer cleanup()
+
+	tests := map[string]struct {
+		method          string
+		params          interface{}
+		expectedMessage string
+		buildError      bool
+	}{
+		"build failure": {
+			method:          MethodRun,
+			params:          RunParams{Script: "fail"},
+			expectedMessage: "driver error 1: script failed",
+			buildError:      true,
+		},
+		"system failure": {
+			method:          MethodRun,
+			params:          RunParams{Script: "crash"},
+			expectedMessage: "driver error 2: driver crashed",
+		},
+		"unknown method": {
+			method:          "unknown",
+			params:          JobParams{},
+			expectedMessage: "driver error 2: unknown method unknown",
+		},
+	}
+
+	for tn, tc := range tests {
+		t.Run(tn, func(t *testing.T) {
+			err := client.Call(context.Background(), tc.method, tc.params, nil, nil, nil)
+			require.Error(t, err)
+			assert.EqualError(t, err, tc.expectedMessage)
+
+			var buildErr *common.BuildError
+			assert.Equal(t, tc.buildError, errors.As(err, &buildErr))
+		})
+	}
+}
+
+func TestClientCallCancel(t *testing.T) {
+	handler := &fakeHandler{cancelled: make(chan struct{})}
+	client, cleanup := dialServer(t, handler)
+	defer cleanup()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	err := client.Call(ctx, MethodRun, RunParams{Script: "sleep"}, nil, nil, nil)
+	assert.EqualError(t, err, "driver error 1: cancelled")
+
+	select {
+	case <-handler.cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("request wasn't cancelled in the driver")
+	}
+}
+
+func TestClientCallAfterDriverClosed(t *testing.T) {
+	server, conn := net.Pipe()
+	client := NewClient(conn, time.Second)
+
+	require.NoError(t, server.Close())
+
+	err := client.Call(context.Background(), MethodPrepare, PrepareParams{}, nil, nil, nil)
+	assert.Error(t, err)
+}
+
+// echoTerminal sends back the input of the terminal
+type echoTerminal struct {
+	*io.PipeReader
+	*io.PipeWriter
+}
+
+func newEchoTerminal() *echoTerminal {
+	r, w := io.Pipe()
+	return &echoTerminal{PipeReader: r, PipeWriter: w}
+}
+
+func (e *echoTerminal) Close() error {
+	return e.PipeWriter.Close()
+}
+
+func TestDialTerminal(t *testing.T) {
+	socket, cleanup := startServer(t, &fakeHandler{terminal: newEchoTerminal()})
+	defer cleanup()
+
+	session, err := DialTerminal(context.Background(), socket, TerminalParams{})
+	require.NoError(t, err)
+	defer session.Close()
+
+	_, err = session.Write([]byte("terminal input"))
+	require.NoError(t, err)
+
+	output := make([]byte, len("terminal input"))
+	_, err = io.ReadFull(session, output)
+	require.NoError(t, err)
+	assert.Equal(t, "terminal input", string(output))
+}
+
+func TestDialTerminalError(t *testing.T) {
+	socket, cleanup := startServer(t, &fakeHandler{})
+	defer cleanup()
+
+	_, err := DialTerminal(context.Background(), socket, TerminalParams{})
+	assert.EqualError(t, err, "driver error 2: no terminal")
+}
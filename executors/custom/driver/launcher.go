@@ -0,0 +1,239 @@
+package driver
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// SocketVariable is the name of the variable with which the launched driver
+// gets the path of the unix socket it needs to listen on
+const SocketVariable = "DRIVER_SOCKET"
+
+var startTimeout = 30 * time.Second
+var startCheckInterval = 100 * time.Millisecond
+
+type LaunchOptions struct {
+	Executable string
+	Args       []string
+	// Socket is the path of the unix socket the driver listens on. If empty,
+	// a socket in the temporary directory is used
+	Socket string
+}
+
+type process struct {
+	options LaunchOptions
+	socket  string
+	cmd     *exec.Cmd
+	// started is closed when the driver listens on the socket or failed to
+	// start, startErr holds the error in the latter case
+	started  chan struct{}
+	startErr error
+	done     chan struct{}
+	err      error
+}
+
+func newProcess(runner string, options LaunchOptions) *process {
+	socket := options.Socket
+	if socket == "" {
+		socket = filepath.Join(os.TempDir(), fmt.Sprintf("gitlab-runner-driver-%s.sock", runner))
+	}
+
+	return &process{
+		options: options,
+		socket:  socket,
+		started: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+}
+
+func (p *process) exited() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Launcher starts the driver processes and keeps them running, one for
+// every runner. A driver that exits is started again when it's needed
+type Launcher struct {
+	lock      sync.Mutex
+	processes map[string]*process
+}
+
+var DefaultLauncher = NewLauncher()
+
+func NewLauncher() *Launcher {
+	return &Launcher{
+		processes: make(map[string]*process),
+	}
+}
+
+// Socket returns the socket of the runner's driver, starting the driver if
+// it isn't running. Waiting for the driver to start doesn't block the
+// drivers of the other runners
+func (l *Launcher) Socket(runner string, options LaunchOptions) (string, error) {
+	l.lock.Lock()
+	p := l.processes[runner]
+	if p != nil && !p.exited() && reflect.DeepEqual(p.options, options) {
+		l.lock.Unlock()
+		return p.wait()
+	}
+
+	previous := p
+	p = newProcess(runner, options)
+	l.processes[runner] = p
+	l.lock.Unlock()
+
+	if previous != nil {
+		// The driver exited or the configuration of the runner was changed
+		stopProcess(previous)
+	}
+
+	p.start(runner)
+
+	socket, err := p.wait()
+	if err != nil {
+		l.lock.Lock()
+		if l.processes[runner] == p {
+			delete(l.processes, runner)
+		}
+		l.lock.Unlock()
+	}
+
+	return socket, err
+}
+
+// StopUnused stops the drivers of the runners that aren't in the list, e.g.
+// the runners removed from the configuration
+func (l *Launcher) StopUnused(runners []string) {
+	used := make(map[string]bool, len(runners))
+	for _, runner := range runners {
+		used[runner] = true
+	}
+
+	l.stop(func(runner string) bool {
+		return !used[runner]
+	})
+}
+
+// Stop stops the drivers of all runners
+func (l *Launcher) Stop() {
+	l.stop(func(string) bool {
+		return true
+	})
+}
+
+func (l *Launcher) stop(shouldStop func(runner string) bool) {
+	var stopped []*process
+
+	l.lock.Lock()
+	for runner, p := range l.processes {
+		if shouldStop(runner) {
+			stopped = append(stopped, p)
+			delete(l.processes, runner)
+		}
+	}
+	l.lock.Unlock()
+
+	for _, p := range stopped {
+		stopProcess(p)
+	}
+}
+
+func (p *process) wait() (string, error) {
+	<-p.started
+	if p.startErr != nil {
+		return "", p.startErr
+	}
+
+	return p.socket, nil
+}
+
+func (p *process) start(runner string) {
+	defer close(p.started)
+
+	// Remove the socket left by the previous driver
+	err := os.Remove(p.socket)
+	if err != nil && !os.IsNotExist(err) {
+		p.startErr = fmt.Errorf("removing old driver socket: %w", err)
+		return
+	}
+
+	logger := logrus.WithFields(logrus.Fields{
+		"runner": runner,
+		"driver": p.options.Executable,
+	})
+
+	cmd := exec.Command(p.options.Executable, p.options.Args...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("%s=%s", SocketVariable, p.socket))
+	cmd.Stdout = logger.WriterLevel(logrus.DebugLevel)
+	cmd.Stderr = logger.WriterLevel(logrus.WarnLevel)
+
+	err = cmd.Start()
+	if err != nil {
+		p.startErr = fmt.Errorf("starting driver: %w", err)
+		return
+	}
+
+	p.cmd = cmd
+
+	go func() {
+		p.err = cmd.Wait()
+		logger.WithError(p.err).Warningln("Custom executor driver exited")
+		close(p.done)
+	}()
+
+	err = waitForSocket(p)
+	if err != nil {
+		p.startErr = err
+		killProcess(p)
+		return
+	}
+
+	logger.WithField("socket", p.socket).Infoln("Custom executor driver started")
+}
+
+func waitForSocket(p *process) error {
+	deadline := time.Now().Add(startTimeout)
+	for time.Now().Before(deadline) {
+		if p.exited() {
+			return fmt.Errorf("driver exited before listening on %s: %v", p.socket, p.err)
+		}
+
+		conn, err := net.Dial("unix", p.socket)
+		if err == nil {
+			_ = conn.Close()
+			return nil
+		}
+
+		time.Sleep(startCheckInterval)
+	}
+
+	return errors.New("timed out waiting for the driver to listen on " + p.socket)
+}
+
+// stopProcess waits for the driver to finish starting and kills it
+func stopProcess(p *process) {
+	<-p.started
+	killProcess(p)
+}
+
+func killProcess(p *process) {
+	if p.cmd == nil || p.exited() {
+		return
+	}
+
+	_ = p.cmd.Process.Kill()
+	<-p.done
+}
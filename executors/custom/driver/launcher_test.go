@@ -0,0 +1,165 @@
+package driver
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+)
+
+var testDriver string
+
+func TestMain(m *testing.M) {
+	fmt.Println("Compiling test driver")
+
+	targetDir, err := ioutil.TempDir("", "test_driver")
+	if err != nil {
+		panic("Error on preparing tmp directory for test driver binary")
+	}
+
+	testDriver = filepath.Join(targetDir, "test_driver")
+
+	cmd := exec.Command("go", "build", "-o", testDriver, "./testdata/test_driver")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		panic("Error on executing go build to prepare test driver")
+	}
+
+	code := m.Run()
+
+	_ = os.RemoveAll(targetDir)
+	os.Exit(code)
+}
+
+func TestLauncherSocket(t *testing.T) {
+	dir, err := ioutil.TempDir("", "driver-socket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	launcher := NewLauncher()
+	defer launcher.Stop()
+
+	options := LaunchOptions{
+		Executable: testDriver,
+		Socket:     filepath.Join(dir, "driver.sock"),
+	}
+
+	socket, err := launcher.Socket("runner", options)
+	require.NoError(t, err)
+	assert.Equal(t, options.Socket, socket)
+
+	client, err := Dial(context.Background(), socket, time.Second)
+	require.NoError(t, err)
+	defer client.Close()
+
+	var result api.ConfigExecOutput
+	err = client.Call(context.Background(), MethodConfig, ConfigParams{}, &result, nil, nil)
+	require.NoError(t, err)
+	require.NotNil(t, result.Hostname)
+	assert.Equal(t, "test-driver", *result.Hostname)
+
+	first := launcher.processes["runner"]
+
+	_, err = launcher.Socket("runner", options)
+	require.NoError(t, err)
+	assert.Equal(t, first, launcher.processes["runner"], "running driver is reused")
+
+	require.NoError(t, first.cmd.Process.Kill())
+	<-first.done
+
+	_, err = launcher.Socket("runner", options)
+	require.NoError(t, err)
+	assert.NotEqual(t, first, launcher.processes["runner"], "exited driver is started again")
+}
+
+func TestLauncherSocketDriverExits(t *testing.T) {
+	launcher := NewLauncher()
+	defer launcher.Stop()
+
+	_, err := launcher.Socket("runner", LaunchOptions{Executable: "false"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "driver exited before listening on")
+}
+
+func TestLauncherSocketDoesntBlockOtherRunners(t *testing.T) {
+	dir, err := ioutil.TempDir("", "driver-socket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	oldStartTimeout := startTimeout
+	startTimeout = 2 * time.Second
+	defer func() { startTimeout = oldStartTimeout }()
+
+	launcher := NewLauncher()
+	defer launcher.Stop()
+
+	// The driver never listens on its socket
+	slowStarted := make(chan error)
+	go func() {
+		_, err := launcher.Socket("slow-runner", LaunchOptions{
+			Executable: "sleep",
+			Args:       []string{"10"},
+			Socket:     filepath.Join(dir, "slow.sock"),
+		})
+		slowStarted <- err
+	}()
+
+	_, err = launcher.Socket("runner", LaunchOptions{
+		Executable: testDriver,
+		Socket:     filepath.Join(dir, "driver.sock"),
+	})
+	require.NoError(t, err)
+
+	select {
+	case <-slowStarted:
+		t.Fatal("driver of the other runner is expected to be still starting")
+	default:
+	}
+
+	err = <-slowStarted
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "timed out waiting for the driver")
+}
+
+func TestLauncherStopUnused(t *testing.T) {
+	dir, err := ioutil.TempDir("", "driver-socket")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	launcher := NewLauncher()
+	defer launcher.Stop()
+
+	for _, runner := range []string{"runner-1", "runner-2"} {
+		_, err := launcher.Socket(runner, LaunchOptions{
+			Executable: testDriver,
+			Socket:     filepath.Join(dir, runner+".sock"),
+		})
+		require.NoError(t, err)
+	}
+
+	kept := launcher.processes["runner-1"]
+	removed := launcher.processes["runner-2"]
+
+	launcher.StopUnused([]string{"runner-1"})
+
+	assert.True(t, removed.exited(), "driver of the removed runner is stopped")
+	assert.False(t, kept.exited())
+	assert.NotContains(t, launcher.processes, "runner-2")
+	assert.Equal(t, kept, launcher.processes["runner-1"])
+
+	launcher.Stop()
+	assert.True(t, kept.exited())
+	assert.Empty(t, launcher.processes)
+}
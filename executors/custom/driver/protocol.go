@@ -0,0 +1,123 @@
+package driver
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// The driver protocol is JSON-RPC 2.0 with one JSON object per line, spoken
+// over a unix socket. Every job uses its own connection.
+const jsonRPCVersion = "2.0"
+
+const (
+	// MethodConfig returns the api.ConfigExecOutput of the job
+	MethodConfig = "config"
+	// MethodPrepare prepares the environment of the job
+	MethodPrepare = "prepare"
+	// MethodRun runs the script of a job stage
+	MethodRun = "run"
+	// MethodCleanup cleans up the environment of the job
+	MethodCleanup = "cleanup"
+	// MethodTerminal switches the connection to a terminal session in the
+	// environment of the job
+	MethodTerminal = "terminal"
+	// MethodProxy returns the address of a service port in the environment
+	// of the job
+	MethodProxy = "proxy"
+
+	// MethodCancel is a notification sent by Runner to cancel a request
+	MethodCancel = "cancel"
+	// MethodOutput is a notification sent by the driver with the output
+	// of a request
+	MethodOutput = "output"
+)
+
+const (
+	// ErrorCodeBuildFailure is the error code with which the driver reports
+	// a failure of the job, like a failing script
+	ErrorCodeBuildFailure = 1
+	// ErrorCodeSystemFailure is the error code with which the driver reports
+	// a failure of its own
+	ErrorCodeSystemFailure = 2
+)
+
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+	// StreamLog carries the structured log entries of the request, one
+	// JSON object per line, like the STRUCTURED_LOG_FD of the executables
+	StreamLog = "log"
+)
+
+type message struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      *int64          `json:"id,omitempty"`
+	Method  string          `json:"method,omitempty"`
+	Params  json.RawMessage `json:"params,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error is the error of a request returned by the driver
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("driver error %d: %s", e.Code, e.Message)
+}
+
+// JobParams identify the job of a request. Env contains the job variables
+// prefixed with CUSTOM_ENV_, like for the executables of the Custom executor
+type JobParams struct {
+	JobID int      `json:"job_id"`
+	Env   []string `json:"env"`
+}
+
+type ConfigParams struct {
+	JobParams
+}
+
+type PrepareParams struct {
+	JobParams
+}
+
+type RunParams struct {
+	JobParams
+
+	Stage  string `json:"stage"`
+	Script string `json:"script"`
+}
+
+type CleanupParams struct {
+	JobParams
+}
+
+type TerminalParams struct {
+	JobParams
+}
+
+type ProxyParams struct {
+	JobParams
+
+	Service  string `json:"service"`
+	Port     int    `json:"port"`
+	Protocol string `json:"protocol"`
+}
+
+type ProxyResult struct {
+	// Address is the URL to which the requests for the service port are
+	// proxied, like http://10.0.0.5:8080
+	Address string `json:"address"`
+}
+
+type CancelParams struct {
+	ID int64 `json:"id"`
+}
+
+type OutputParams struct {
+	ID     int64  `json:"id"`
+	Stream string `json:"stream"`
+	Data   string `json:"data"`
+}
@@ -0,0 +1,235 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+)
+
+// Output streams the output of a request to Runner. Log takes the
+// structured log entries, one JSON object per line
+type Output struct {
+	Stdout io.Writer
+	Stderr io.Writer
+	Log    io.Writer
+}
+
+// Handler handles the requests of the driver protocol. It can be used to
+// write drivers in Go. Returning an *Error sets the error code of the
+// response, other errors are reported as system failures
+type Handler interface {
+	Config(ctx context.Context, params ConfigParams) (*api.ConfigExecOutput, error)
+	Prepare(ctx context.Context, params PrepareParams, output Output) error
+	Run(ctx context.Context, params RunParams, output Output) error
+	Cleanup(ctx context.Context, params CleanupParams, output Output) error
+	// Terminal returns the input and output of a terminal session
+	Terminal(ctx context.Context, params TerminalParams) (io.ReadWriteCloser, error)
+	Proxy(ctx context.Context, params ProxyParams) (*ProxyResult, error)
+}
+
+// Serve handles the connections accepted by the listener until it's closed
+func Serve(listener net.Listener, handler Handler) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go newServerConn(conn, handler).serve()
+	}
+}
+
+type serverConn struct {
+	conn    net.Conn
+	handler Handler
+
+	writeLock sync.Mutex
+	encoder   *json.Encoder
+
+	lock    sync.Mutex
+	cancels map[int64]context.CancelFunc
+}
+
+func newServerConn(conn net.Conn, handler Handler) *serverConn {
+	return &serverConn{
+		conn:    conn,
+		handler: handler,
+		encoder: json.NewEncoder(conn),
+		cancels: make(map[int64]context.CancelFunc),
+	}
+}
+
+func (s *serverConn) serve() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	reader := bufio.NewReader(s.conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			_ = s.conn.Close()
+			return
+		}
+
+		var msg message
+		if json.Unmarshal(line, &msg) != nil {
+			continue
+		}
+
+		switch {
+		case msg.Method == MethodCancel:
+			s.cancel(msg.Params)
+		case msg.Method == MethodTerminal && msg.ID != nil:
+			s.terminal(ctx, *msg.ID, msg.Params, reader)
+			return
+		case msg.ID != nil:
+			requestCtx, requestCancel := context.WithCancel(ctx)
+			s.lock.Lock()
+			s.cancels[*msg.ID] = requestCancel
+			s.lock.Unlock()
+
+			go s.handle(requestCtx, *msg.ID, msg.Method, msg.Params)
+		}
+	}
+}
+
+func (s *serverConn) cancel(data json.RawMessage) {
+	var params CancelParams
+	if json.Unmarshal(data, &params) != nil {
+		return
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if cancel := s.cancels[params.ID]; cancel != nil {
+		cancel()
+	}
+}
+
+func (s *serverConn) handle(ctx context.Context, id int64, method string, data json.RawMessage) {
+	defer func() {
+		s.lock.Lock()
+		s.cancels[id]()
+		delete(s.cancels, id)
+		s.lock.Unlock()
+	}()
+
+	output := Output{
+		Stdout: &outputWriter{conn: s, id: id, stream: StreamStdout},
+		Stderr: &outputWriter{conn: s, id: id, stream: StreamStderr},
+		Log:    &outputWriter{conn: s, id: id, stream: StreamLog},
+	}
+
+	var result interface{}
+	var err error
+
+	switch method {
+	case MethodConfig:
+		var params ConfigParams
+		if err = json.Unmarshal(data, &params); err == nil {
+			result, err = s.handler.Config(ctx, params)
+		}
+	case MethodPrepare:
+		var params PrepareParams
+		if err = json.Unmarshal(data, &params); err == nil {
+			err = s.handler.Prepare(ctx, params, output)
+		}
+	case MethodRun:
+		var params RunParams
+		if err = json.Unmarshal(data, &params); err == nil {
+			err = s.handler.Run(ctx, params, output)
+		}
+	case MethodCleanup:
+		var params CleanupParams
+		if err = json.Unmarshal(data, &params); err == nil {
+			err = s.handler.Cleanup(ctx, params, output)
+		}
+	case MethodProxy:
+		var params ProxyParams
+		if err = json.Unmarshal(data, &params); err == nil {
+			result, err = s.handler.Proxy(ctx, params)
+		}
+	default:
+		err = &Error{Code: ErrorCodeSystemFailure, Message: "unknown method " + method}
+	}
+
+	s.respond(id, result, err)
+}
+
+func (s *serverConn) terminal(ctx context.Context, id int64, data json.RawMessage, reader *bufio.Reader) {
+	defer func() { _ = s.conn.Close() }()
+
+	var params TerminalParams
+	err := json.Unmarshal(data, &params)
+	if err != nil {
+		s.respond(id, nil, err)
+		return
+	}
+
+	session, err := s.handler.Terminal(ctx, params)
+	s.respond(id, nil, err)
+	if err != nil {
+		return
+	}
+	defer func() { _ = session.Close() }()
+
+	go func() { _, _ = io.Copy(session, reader) }()
+	_, _ = io.Copy(s.conn, session)
+}
+
+func (s *serverConn) respond(id int64, result interface{}, err error) {
+	msg := &message{
+		JSONRPC: jsonRPCVersion,
+		ID:      &id,
+	}
+
+	if err != nil {
+		var driverErr *Error
+		if !errors.As(err, &driverErr) {
+			driverErr = &Error{Code: ErrorCodeSystemFailure, Message: err.Error()}
+		}
+		msg.Error = driverErr
+	} else if result != nil {
+		msg.Result, err = json.Marshal(result)
+		if err != nil {
+			msg.Error = &Error{Code: ErrorCodeSystemFailure, Message: err.Error()}
+		}
+	}
+
+	s.write(msg)
+}
+
+func (s *serverConn) write(msg *message) {
+	s.writeLock.Lock()
+	defer s.writeLock.Unlock()
+
+	_ = s.encoder.Encode(msg)
+}
+
+type outputWriter struct {
+	conn   *serverConn
+	id     int64
+	stream string
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	data, err := json.Marshal(OutputParams{ID: w.id, Stream: w.stream, Data: string(p)})
+	if err != nil {
+		return 0, err
+	}
+
+	w.conn.write(&message{
+		JSONRPC: jsonRPCVersion,
+		Method:  MethodOutput,
+		Params:  data,
+	})
+
+	return len(p), nil
+}
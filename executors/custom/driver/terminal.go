@@ -0,0 +1,75 @@
+package driver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+)
+
+type terminalConn struct {
+	net.Conn
+
+	reader *bufio.Reader
+}
+
+func (t *terminalConn) Read(p []byte) (int, error) {
+	return t.reader.Read(p)
+}
+
+// DialTerminal opens a new connection to the driver and requests a terminal
+// session in the environment of the job. After the driver accepts the request,
+// the connection carries the raw input and output of the terminal
+func DialTerminal(ctx context.Context, socket string, params TerminalParams) (io.ReadWriteCloser, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to the driver: %w", err)
+	}
+
+	t, err := startTerminal(conn, params)
+	if err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+
+	return t, nil
+}
+
+func startTerminal(conn net.Conn, params TerminalParams) (*terminalConn, error) {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return nil, fmt.Errorf("encoding params: %w", err)
+	}
+
+	id := int64(1)
+	err = json.NewEncoder(conn).Encode(&message{
+		JSONRPC: jsonRPCVersion,
+		ID:      &id,
+		Method:  MethodTerminal,
+		Params:  data,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("sending terminal request: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("reading terminal response: %w", err)
+	}
+
+	var response message
+	err = json.Unmarshal(line, &response)
+	if err != nil {
+		return nil, fmt.Errorf("parsing terminal response: %w", err)
+	}
+
+	if response.Error != nil {
+		return nil, response.Error
+	}
+
+	return &terminalConn{Conn: conn, reader: reader}, nil
+}
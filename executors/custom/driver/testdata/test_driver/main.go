@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
+)
+
+type handler struct{}
+
+func (handler) Config(ctx context.Context, params driver.ConfigParams) (*api.ConfigExecOutput, error) {
+	hostname := "test-driver"
+	return &api.ConfigExecOutput{Hostname: &hostname}, nil
+}
+
+func (handler) Prepare(ctx context.Context, params driver.PrepareParams, output driver.Output) error {
+	_, err := fmt.Fprintf(output.Stdout, "preparing job %d\n", params.JobID)
+	return err
+}
+
+func (handler) Run(ctx context.Context, params driver.RunParams, output driver.Output) error {
+	_, err := fmt.Fprintf(output.Stdout, "running %s\n", params.Stage)
+	return err
+}
+
+func (handler) Cleanup(ctx context.Context, params driver.CleanupParams, output driver.Output) error {
+	return nil
+}
+
+func (handler) Terminal(ctx context.Context, params driver.TerminalParams) (io.ReadWriteCloser, error) {
+	return nil, errors.New("terminal not supported")
+}
+
+func (handler) Proxy(ctx context.Context, params driver.ProxyParams) (*driver.ProxyResult, error) {
+	return nil, errors.New("proxy not supported")
+}
+
+func main() {
+	listener, err := net.Listen("unix", os.Getenv(driver.SocketVariable))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	err = driver.Serve(listener, handler{})
+	fmt.Fprintln(os.Stderr, err)
+	os.Exit(1)
+}
@@ -0,0 +1,167 @@
+package custom
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
+)
+
+type fakeDriver struct {
+	lock     sync.Mutex
+	requests []string
+
+	proxyAddress string
+}
+
+func (f *fakeDriver) record(request string) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	f.requests = append(f.requests, request)
+}
+
+func (f *fakeDriver) Config(ctx context.Context, params driver.ConfigParams) (*api.ConfigExecOutput, error) {
+	f.record(driver.MethodConfig)
+
+	hostname := "driver-host"
+	return &api.ConfigExecOutput{Hostname: &hostname}, nil
+}
+
+func (f *fakeDriver) Prepare(ctx context.Context, params driver.PrepareParams, output driver.Output) error {
+	f.record(driver.MethodPrepare)
+
+	_, err := fmt.Fprintf(output.Stdout, "preparing job %d\n", params.JobID)
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintln(output.Log, `{"type": "progress", "message": "provisioning VM", "current": 1, "total": 2}`)
+	return err
+}
+
+func (f *fakeDriver) Run(ctx context.Context, params driver.RunParams, output driver.Output) error {
+	f.record(driver.MethodRun + " " + params.Stage)
+
+	if params.Script == "exit 1" {
+		return &driver.Error{Code: driver.ErrorCodeBuildFailure, Message: "exit status 1"}
+	}
+
+	_, err := fmt.Fprintf(output.Stdout, "running %s\n", params.Stage)
+	return err
+}
+
+func (f *fakeDriver) Cleanup(ctx context.Context, params driver.CleanupParams, output driver.Output) error {
+	f.record(driver.MethodCleanup)
+	return nil
+}
+
+func (f *fakeDriver) Terminal(ctx context.Context, params driver.TerminalParams) (io.ReadWriteCloser, error) {
+	return nil, &driver.Error{Code: driver.ErrorCodeSystemFailure, Message: "not supported"}
+}
+
+func (f *fakeDriver) Proxy(ctx context.Context, params driver.ProxyParams) (*driver.ProxyResult, error) {
+	if f.proxyAddress == "" {
+		return nil, &driver.Error{Code: driver.ErrorCodeSystemFailure, Message: "not supported"}
+	}
+
+	return &driver.ProxyResult{Address: f.proxyAddress}, nil
+}
+
+func startFakeDriver(t *testing.T, fake *fakeDriver) (string, func()) {
+	dir, err := ioutil.TempDir("", "custom-driver")
+	require.NoError(t, err)
+
+	socket := filepath.Join(dir, "driver.sock")
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	go func() { _ = driver.Serve(listener, fake) }()
+
+	return socket, func() {
+		_ = listener.Close()
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestExecutor_WithDriver(t *testing.T) {
+	fake := new(fakeDriver)
+	socket, cleanup := startFakeDriver(t, fake)
+	defer cleanup()
+
+	out := new(bytes.Buffer)
+	trace := new(common.MockJobTrace)
+	defer trace.AssertExpectations(t)
+
+	trace.On("Write", mock.Anything).
+		Run(func(args mock.Arguments) {
+			_, err := out.Write(args.Get(0).([]byte))
+			require.NoError(t, err)
+		}).
+		Return(0, nil).
+		Maybe()
+	trace.On("IsStdout").Return(false).Maybe()
+
+	runnerConfig := getRunnerConfig(&common.CustomConfig{DriverSocket: socket})
+	build := &common.Build{
+		JobResponse: common.JobResponse{
+			ID: jobID(),
+			GitInfo: common.GitInfo{
+				RepoURL: "https://gitlab.example.com/group/project.git",
+			},
+		},
+		Runner: &runnerConfig,
+	}
+
+	e := new(executor)
+	err := e.Prepare(common.ExecutorPrepareOptions{
+		Build:   build,
+		Config:  &runnerConfig,
+		Context: context.Background(),
+		Trace:   trace,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "driver-host", build.Hostname)
+	assert.Equal(t, socket, e.driverSocket)
+
+	err = e.Run(common.ExecutorCommand{Context: context.Background(), Stage: common.BuildStageRestoreCache})
+	assert.NoError(t, err)
+
+	err = e.Run(common.ExecutorCommand{
+		Context: context.Background(),
+		Stage:   common.BuildStageAfterScript,
+		Script:  "exit 1",
+	})
+	assert.IsType(t, &common.BuildError{}, err)
+
+	e.Cleanup()
+
+	fake.lock.Lock()
+	defer fake.lock.Unlock()
+
+	assert.Equal(t, []string{
+		driver.MethodConfig,
+		driver.MethodPrepare,
+		driver.MethodRun + " " + string(common.BuildStageRestoreCache),
+		driver.MethodRun + " " + string(common.BuildStageAfterScript),
+		driver.MethodCleanup,
+	}, fake.requests)
+	assert.Contains(t, out.String(), fmt.Sprintf("preparing job %d", build.ID))
+	assert.Contains(t, out.String(), "running restore_cache")
+	assert.Contains(t, out.String(), "provisioning VM 1/2")
+	assert.NotContains(t, out.String(), `"type"`)
+}
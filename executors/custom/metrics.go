@@ -0,0 +1,56 @@
+package custom
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+)
+
+var driverMetrics = newDriverMetricsCollector()
+
+// driverMetricsCollector exposes the values recorded by the drivers with
+// the metric entries of the structured log
+type driverMetricsCollector struct {
+	values *prometheus.HistogramVec
+}
+
+func newDriverMetricsCollector() *driverMetricsCollector {
+	return &driverMetricsCollector{
+		values: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "gitlab_runner_custom_executor_driver_metric",
+				Help: "Values recorded by the Custom executor drivers with the structured log",
+				Buckets: []float64{
+					0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600, 1800, 3600,
+				},
+			},
+			[]string{"runner", "name"},
+		),
+	}
+}
+
+func (c *driverMetricsCollector) observe(runner string, name string, value float64) {
+	c.values.WithLabelValues(runner, name).Observe(value)
+}
+
+func (c *driverMetricsCollector) Describe(ch chan<- *prometheus.Desc) {
+	c.values.Describe(ch)
+}
+
+func (c *driverMetricsCollector) Collect(ch chan<- prometheus.Metric) {
+	c.values.Collect(ch)
+}
+
+// executorProvider registers the metrics of the drivers together with the
+// executor and stops the drivers that are no longer needed
+type executorProvider struct {
+	executors.DefaultExecutorProvider
+}
+
+func (p executorProvider) Describe(ch chan<- *prometheus.Desc) {
+	driverMetrics.Describe(ch)
+}
+
+func (p executorProvider) Collect(ch chan<- prometheus.Metric) {
+	driverMetrics.Collect(ch)
+}
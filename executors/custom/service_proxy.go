@@ -0,0 +1,173 @@
+package custom
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
+	"gitlab.com/gitlab-org/gitlab-runner/session/proxy"
+)
+
+const buildServiceName = "build"
+
+func (e *executor) Pool() proxy.Pool {
+	return e.ProxyPool
+}
+
+// supportsProxy returns whether the driver can provide the addresses of
+// the service ports
+func (e *executor) supportsProxy() bool {
+	return e.config.ProxyExec != "" || e.config.usesDriver()
+}
+
+// prepareProxyPool registers the ports of the build image and the services
+// of the job in the pool used by the session server
+func (e *executor) prepareProxyPool() {
+	if !e.supportsProxy() {
+		return
+	}
+
+	e.addProxy(e.Build.Image, buildServiceName)
+	for i, service := range e.Build.Services {
+		e.addProxy(service, fmt.Sprintf("proxy-svc-%d", i))
+	}
+}
+
+func (e *executor) addProxy(image common.Image, defaultName string) {
+	if len(image.Ports) == 0 {
+		return
+	}
+
+	ports := make([]proxy.Port, len(image.Ports))
+	for i, port := range image.Ports {
+		ports[i] = proxy.Port{Name: port.Name, Number: port.Number, Protocol: port.Protocol}
+	}
+
+	serviceName := image.Alias
+	if serviceName == "" {
+		serviceName = defaultName
+	}
+
+	e.ProxyPool[serviceName] = &proxy.Proxy{
+		Settings:          proxy.NewProxySettings(serviceName, ports),
+		ConnectionHandler: e,
+	}
+}
+
+func (e *executor) ProxyRequest(
+	w http.ResponseWriter,
+	r *http.Request,
+	requestedURI string,
+	port string,
+	settings *proxy.Settings,
+) {
+	logger := logrus.WithFields(logrus.Fields{
+		"uri":      r.RequestURI,
+		"method":   r.Method,
+		"port":     port,
+		"settings": settings,
+	})
+
+	portSettings, err := settings.PortByNameOrNumber(port)
+	if err != nil {
+		logger.WithError(err).Errorf("port proxy %q not found", port)
+		http.Error(w, http.StatusText(http.StatusNotFound), http.StatusNotFound)
+		return
+	}
+
+	target, err := e.proxyTarget(r.Context(), settings.ServiceName, portSettings)
+	if err != nil {
+		logger.WithError(err).Errorf("service proxy: error getting the service address")
+		http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+		return
+	}
+
+	// The reverse proxy handles both HTTP and WebSocket requests
+	reverseProxy := &httputil.ReverseProxy{
+		Director: func(req *http.Request) {
+			req.URL.Scheme = target.Scheme
+			req.URL.Host = target.Host
+			req.URL.Path = strings.TrimSuffix(target.Path, "/") + "/" + requestedURI
+			req.URL.RawPath = ""
+			req.Host = target.Host
+		},
+		ErrorHandler: func(w http.ResponseWriter, req *http.Request, err error) {
+			logger.WithError(err).Errorf("service proxy: error proxying request")
+			http.Error(w, http.StatusText(http.StatusBadGateway), http.StatusBadGateway)
+		},
+	}
+
+	reverseProxy.ServeHTTP(w, r)
+}
+
+func (e *executor) proxyTarget(ctx context.Context, service string, port proxy.Port) (*url.URL, error) {
+	ctx, cancelFunc := context.WithTimeout(ctx, defaultProxyExecTimeout)
+	defer cancelFunc()
+
+	address, err := e.proxyAddress(ctx, service, port)
+	if err != nil {
+		return nil, err
+	}
+
+	target, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("parsing service address: %w", err)
+	}
+
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("service address %q is not an absolute URL", address)
+	}
+
+	return target, nil
+}
+
+func (e *executor) proxyAddress(ctx context.Context, service string, port proxy.Port) (string, error) {
+	if e.driverClient != nil {
+		params := driver.ProxyParams{
+			JobParams: e.driverJobParams(),
+			Service:   service,
+			Port:      port.Number,
+			Protocol:  port.Protocol,
+		}
+
+		var result driver.ProxyResult
+		err := e.driverClient.Call(ctx, driver.MethodProxy, params, &result, nil, nil)
+
+		return result.Address, err
+	}
+
+	if e.config.ProxyExec == "" {
+		return "", errors.New("proxy_exec is not defined")
+	}
+
+	args := append([]string{}, e.config.ProxyArgs...)
+	args = append(args, service, strconv.Itoa(port.Number), port.Protocol)
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+	opts := prepareCommandOpts{
+		executable: e.config.ProxyExec,
+		args:       args,
+		out: commandOutputs{
+			stdout: stdout,
+			stderr: stderr,
+		},
+	}
+
+	err := e.prepareCommand(ctx, opts).Run()
+	if err != nil {
+		return "", fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,156 @@
+package custom
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
+	"gitlab.com/gitlab-org/gitlab-runner/session/proxy"
+)
+
+func TestExecutor_PrepareProxyPool(t *testing.T) {
+	build := &common.Build{
+		JobResponse: common.JobResponse{
+			Image: common.Image{
+				Name:  "alpine",
+				Ports: []common.Port{{Number: 80, Protocol: "http"}},
+			},
+			Services: common.Services{
+				{Name: "postgres"},
+				{Name: "nginx", Ports: []common.Port{{Number: 8080, Protocol: "http", Name: "web"}}},
+				{Name: "redis", Alias: "cache", Ports: []common.Port{{Number: 6379, Protocol: "http"}}},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		config           common.CustomConfig
+		expectedServices []string
+	}{
+		"proxy not supported": {
+			config: common.CustomConfig{RunExec: "bash"},
+		},
+		"proxy_exec": {
+			config:           common.CustomConfig{RunExec: "bash", ProxyExec: "proxy"},
+			expectedServices: []string{"build", "cache", "proxy-svc-1"},
+		},
+		"driver": {
+			config:           common.CustomConfig{DriverSocket: "/tmp/driver.sock"},
+			expectedServices: []string{"build", "cache", "proxy-svc-1"},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			e := &executor{config: &config{CustomConfig: &tt.config}}
+			e.Build = build
+			e.ProxyPool = proxy.NewPool()
+
+			e.prepareProxyPool()
+
+			services := make([]string, 0)
+			for name := range e.Pool() {
+				services = append(services, name)
+			}
+			assert.ElementsMatch(t, tt.expectedServices, services)
+
+			if len(tt.expectedServices) > 0 {
+				web := e.Pool()["proxy-svc-1"]
+				assert.Equal(t, []proxy.Port{{Number: 8080, Protocol: "http", Name: "web"}}, web.Settings.Ports)
+				assert.Equal(t, e, web.ConnectionHandler)
+			}
+		})
+	}
+}
+
+func TestExecutor_ProxyRequest(t *testing.T) {
+	service := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.URL.RequestURI()))
+	}))
+	defer service.Close()
+
+	tests := map[string]struct {
+		proxyAddress   string
+		port           string
+		expectedStatus int
+		expectedBody   string
+	}{
+		"request is proxied": {
+			proxyAddress:   service.URL + "/app",
+			port:           "web",
+			expectedStatus: http.StatusOK,
+			expectedBody:   "/app/path/to/page?query=1",
+		},
+		"unknown port": {
+			proxyAddress:   service.URL,
+			port:           "9999",
+			expectedStatus: http.StatusNotFound,
+		},
+		"driver doesn't return an address": {
+			port:           "8080",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+		"address is not an URL": {
+			proxyAddress:   "10.0.0.5:8080",
+			port:           "8080",
+			expectedStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			socket, cleanup := startFakeDriver(t, &fakeDriver{proxyAddress: tt.proxyAddress})
+			defer cleanup()
+
+			client, err := driver.Dial(context.Background(), socket, time.Second)
+			require.NoError(t, err)
+			defer client.Close()
+
+			runnerConfig := getRunnerConfig(&common.CustomConfig{DriverSocket: socket})
+			e := &executor{config: &config{CustomConfig: runnerConfig.Custom}, driverClient: client}
+			e.Build = &common.Build{Runner: &runnerConfig}
+
+			settings := proxy.NewProxySettings("nginx", []proxy.Port{{Number: 8080, Protocol: "http", Name: "web"}})
+
+			r := httptest.NewRequest(http.MethodGet, "/session/proxy/nginx/web/path/to/page?query=1", nil)
+			w := httptest.NewRecorder()
+
+			e.ProxyRequest(w, r, "path/to/page", tt.port, settings)
+
+			resp := w.Result()
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if tt.expectedBody != "" {
+				body, err := ioutil.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedBody, string(body))
+			}
+		})
+	}
+}
+
+func TestExecutor_ProxyAddressWithProxyExec(t *testing.T) {
+	runnerConfig := getRunnerConfig(&common.CustomConfig{
+		RunExec:   "bash",
+		ProxyExec: "sh",
+		ProxyArgs: []string{"-c", "echo $3://$1.internal:$2", "sh"},
+	})
+
+	e := &executor{config: &config{CustomConfig: runnerConfig.Custom}, tempDir: os.TempDir()}
+	e.Build = &common.Build{Runner: &runnerConfig}
+
+	address, err := e.proxyAddress(context.Background(), "nginx", proxy.Port{Number: 8080, Protocol: "http"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://nginx.internal:8080", address)
+	assert.Equal(t, []string{"-c", "echo $3://$1.internal:$2", "sh"}, runnerConfig.Custom.ProxyArgs)
+}
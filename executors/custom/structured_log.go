@@ -0,0 +1,270 @@
+package custom
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"runtime"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/api"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+// structuredLogFD is the file descriptor of the structured log in the
+// executables. The descriptors passed in ExtraFiles start from 3
+const structuredLogFD = 3
+
+// structuredLogDrainTimeout is the time given to read the remaining entries
+// after the executable exits. It's needed when a child process of the
+// executable keeps the file descriptor open
+var structuredLogDrainTimeout = time.Second
+
+var sectionNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+
+// structuredLog renders the entries written by an executable to the
+// structured log file descriptor into the job log and the metrics
+type structuredLog struct {
+	logger      *common.BuildLogger
+	runner      string
+	metrics     []string
+	skipMetrics bool
+
+	reader *os.File
+	writer *os.File
+	done   chan struct{}
+
+	sections []helpers.BuildSection
+}
+
+// newStructuredLog starts reading the entries written to the writer of the
+// log, which must be closed with close. Only the metrics listed in metrics
+// are recorded, to keep the number of their labels bounded
+func newStructuredLog(
+	logger *common.BuildLogger,
+	runner string,
+	metrics []string,
+	skipMetrics bool,
+) (*structuredLog, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &structuredLog{
+		logger:      logger,
+		runner:      runner,
+		metrics:     metrics,
+		skipMetrics: skipMetrics,
+		reader:      reader,
+		writer:      writer,
+		done:        make(chan struct{}),
+	}
+
+	go l.read()
+
+	return l, nil
+}
+
+func (l *structuredLog) read() {
+	defer close(l.done)
+
+	scanner := bufio.NewScanner(l.reader)
+	for scanner.Scan() {
+		l.handle(scanner.Bytes())
+	}
+}
+
+// close is called after the executable exits. The sections left open by the
+// executable are ended
+func (l *structuredLog) close() {
+	_ = l.writer.Close()
+
+	select {
+	case <-l.done:
+	case <-time.After(structuredLogDrainTimeout):
+	}
+
+	_ = l.reader.Close()
+	<-l.done
+
+	for len(l.sections) > 0 {
+		l.endSection()
+	}
+}
+
+func (l *structuredLog) handle(line []byte) {
+	var entry api.LogEntry
+	err := json.Unmarshal(line, &entry)
+	if err != nil {
+		l.logger.Debugln("Invalid structured log entry:", err)
+		return
+	}
+
+	switch entry.Type {
+	case api.LogEntrySectionStart:
+		l.startSection(entry)
+	case api.LogEntrySectionEnd:
+		l.endSectionNamed(entry.Name)
+	case api.LogEntryWarning:
+		l.logger.Warningln(entry.Message)
+	case api.LogEntryProgress:
+		l.progress(entry)
+	case api.LogEntryMetric:
+		l.metric(entry)
+	case api.LogEntryArtifact:
+		l.artifact(entry)
+	default:
+		l.logger.Debugln("Unknown structured log entry type:", entry.Type)
+	}
+}
+
+func (l *structuredLog) startSection(entry api.LogEntry) {
+	if !sectionNameRegex.MatchString(entry.Name) {
+		l.logger.Debugln("Invalid section name in structured log:", entry.Name)
+		return
+	}
+
+	section := helpers.BuildSection{
+		Name:        entry.Name,
+		SkipMetrics: l.skipMetrics,
+	}
+	section.Start(l.logger)
+	l.sections = append(l.sections, section)
+
+	if entry.Header != "" {
+		l.logger.Println(fmt.Sprintf("%s%s%s", helpers.ANSI_BOLD_CYAN, entry.Header, helpers.ANSI_RESET))
+	}
+}
+
+// endSectionNamed ends the section and the sections nested in it
+func (l *structuredLog) endSectionNamed(name string) {
+	for i := len(l.sections) - 1; i >= 0; i-- {
+		if l.sections[i].Name != name {
+			continue
+		}
+
+		for len(l.sections) > i {
+			l.endSection()
+		}
+		return
+	}
+
+	l.logger.Debugln("Ending section that isn't open in structured log:", name)
+}
+
+func (l *structuredLog) endSection() {
+	last := len(l.sections) - 1
+	l.sections[last].End(l.logger)
+	l.sections = l.sections[:last]
+}
+
+func (l *structuredLog) progress(entry api.LogEntry) {
+	if entry.Total > 0 {
+		l.logger.Println(fmt.Sprintf("%s %d/%d", entry.Message, entry.Current, entry.Total))
+		return
+	}
+
+	l.logger.Println(entry.Message)
+}
+
+func (l *structuredLog) metric(entry api.LogEntry) {
+	if !sectionNameRegex.MatchString(entry.Name) {
+		l.logger.Debugln("Invalid metric name in structured log:", entry.Name)
+		return
+	}
+
+	if !l.isMetricAllowed(entry.Name) {
+		l.logger.Debugln("Metric not listed in driver_metrics ignored in structured log:", entry.Name)
+		return
+	}
+
+	driverMetrics.observe(l.runner, entry.Name, entry.Value)
+}
+
+func (l *structuredLog) isMetricAllowed(name string) bool {
+	for _, metric := range l.metrics {
+		if metric == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (l *structuredLog) artifact(entry api.LogEntry) {
+	if entry.Description == "" {
+		l.logger.Println("Artifact:", entry.Path)
+		return
+	}
+
+	l.logger.Println(fmt.Sprintf("Artifact: %s (%s)", entry.Path, entry.Description))
+}
+
+func (e *executor) newStructuredLog() (*structuredLog, error) {
+	return newStructuredLog(
+		&e.BuildLogger,
+		e.Config.ShortDescription(),
+		e.config.DriverMetrics,
+		!e.Build.JobResponse.Features.TraceSections,
+	)
+}
+
+// structuredLogCommand creates the structured log only when the executable
+// is run, and closes it after the executable exits
+type structuredLogCommand struct {
+	executor *executor
+
+	ctx        context.Context
+	executable string
+	args       []string
+	options    process.CommandOptions
+}
+
+func (c *structuredLogCommand) Run() error {
+	log, err := c.executor.newStructuredLog()
+	if err != nil {
+		c.executor.BuildLogger.Warningln("Structured log is not available:", err)
+		return commandFactory(c.ctx, c.executable, c.args, c.options).Run()
+	}
+	defer log.close()
+
+	options := c.options
+	options.ExtraFiles = []*os.File{log.writer}
+	options.Env = append(options.Env, fmt.Sprintf("%s=%d", api.StructuredLogFDVariable, structuredLogFD))
+
+	return commandFactory(c.ctx, c.executable, c.args, options).Run()
+}
+
+// callDriver sends the request to the long-running driver, with the
+// structured log entries sent by the driver rendered like the ones of the
+// executables
+func (e *executor) callDriver(
+	ctx context.Context,
+	method string,
+	params interface{},
+	result interface{},
+	stdout io.Writer,
+	stderr io.Writer,
+) error {
+	log, err := e.newStructuredLog()
+	if err != nil {
+		e.BuildLogger.Warningln("Structured log is not available:", err)
+		return e.driverClient.Call(ctx, method, params, result, stdout, stderr)
+	}
+	defer log.close()
+
+	return e.driverClient.CallWithLog(ctx, method, params, result, stdout, stderr, log.writer)
+}
+
+// supportsStructuredLog returns whether file descriptors can be passed to
+// the executables
+func supportsStructuredLog() bool {
+	return runtime.GOOS != "windows"
+}
@@ -0,0 +1,197 @@
+package custom
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/command"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/process"
+)
+
+func newTestStructuredLog(t *testing.T, runner string, metrics ...string) (*structuredLog, *bytes.Buffer) {
+	out := new(bytes.Buffer)
+	logger := common.NewBuildLogger(&common.Trace{Writer: out}, logrus.NewEntry(logrus.New()))
+
+	l, err := newStructuredLog(&logger, runner, metrics, false)
+	require.NoError(t, err)
+
+	return l, out
+}
+
+func TestStructuredLog(t *testing.T) {
+	tests := map[string]struct {
+		entries          []string
+		expectedOutput   []string
+		unexpectedOutput []string
+	}{
+		"sections": {
+			entries: []string{
+				`{"type": "section_start", "name": "provision", "header": "Provisioning VM"}`,
+				`{"type": "section_start", "name": "network"}`,
+				`{"type": "section_end", "name": "provision"}`,
+			},
+			expectedOutput: []string{
+				"section_start:",
+				":provision\r",
+				"Provisioning VM",
+				":network\r",
+				"section_end:",
+			},
+		},
+		"sections left open are ended": {
+			entries: []string{
+				`{"type": "section_start", "name": "provision"}`,
+			},
+			expectedOutput: []string{"section_end:"},
+		},
+		"invalid section name": {
+			entries: []string{
+				`{"type": "section_start", "name": "provision vm"}`,
+			},
+			unexpectedOutput: []string{"section_start:"},
+		},
+		"warning": {
+			entries:        []string{`{"type": "warning", "message": "VM image is deprecated"}`},
+			expectedOutput: []string{"WARNING: VM image is deprecated"},
+		},
+		"progress": {
+			entries: []string{
+				`{"type": "progress", "message": "provisioning VM", "current": 3, "total": 5}`,
+				`{"type": "progress", "message": "waiting for SSH"}`,
+			},
+			expectedOutput: []string{"provisioning VM 3/5", "waiting for SSH"},
+		},
+		"artifact": {
+			entries: []string{
+				`{"type": "artifact", "path": "vm/console.log", "description": "VM console"}`,
+				`{"type": "artifact", "path": "vm/dmesg.log"}`,
+			},
+			expectedOutput: []string{"Artifact: vm/console.log (VM console)", "Artifact: vm/dmesg.log"},
+		},
+		"invalid entries are not printed": {
+			entries:          []string{`provisioning VM`, `{"type": "unknown", "message": "hidden"}`},
+			unexpectedOutput: []string{"provisioning VM", "hidden"},
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			l, out := newTestStructuredLog(t, "runner")
+
+			for _, entry := range tt.entries {
+				_, err := l.writer.Write([]byte(entry + "\n"))
+				require.NoError(t, err)
+			}
+			l.close()
+
+			for _, expected := range tt.expectedOutput {
+				assert.Contains(t, out.String(), expected)
+			}
+			for _, unexpected := range tt.unexpectedOutput {
+				assert.NotContains(t, out.String(), unexpected)
+			}
+		})
+	}
+}
+
+func TestStructuredLog_Metric(t *testing.T) {
+	driverMetrics.values.DeleteLabelValues("metric-runner", "provisioning_seconds")
+	driverMetrics.values.DeleteLabelValues("metric-runner", "unlisted_seconds")
+
+	l, _ := newTestStructuredLog(t, "metric-runner", "provisioning_seconds")
+
+	_, err := l.writer.Write([]byte(`{"type": "metric", "name": "provisioning_seconds", "value": 42.5}` + "\n"))
+	require.NoError(t, err)
+	_, err = l.writer.Write([]byte(`{"type": "metric", "name": "unlisted_seconds", "value": 1}` + "\n"))
+	require.NoError(t, err)
+	l.close()
+
+	assert.False(
+		t,
+		driverMetrics.values.DeleteLabelValues("metric-runner", "unlisted_seconds"),
+		"metrics not listed in driver_metrics are ignored",
+	)
+
+	metric := new(dto.Metric)
+	observer := driverMetrics.values.WithLabelValues("metric-runner", "provisioning_seconds")
+	require.NoError(t, observer.(prometheus.Metric).Write(metric))
+
+	assert.Equal(t, uint64(1), metric.GetHistogram().GetSampleCount())
+	assert.Equal(t, 42.5, metric.GetHistogram().GetSampleSum())
+}
+
+func TestExecutor_StructuredLogFromExecutable(t *testing.T) {
+	if !supportsStructuredLog() {
+		t.Skip("structured log is not supported on this platform")
+	}
+
+	out := new(bytes.Buffer)
+	trace := &common.Trace{Writer: out}
+	runnerConfig := getRunnerConfig(&common.CustomConfig{RunExec: "bash"})
+
+	e := &executor{config: &config{CustomConfig: runnerConfig.Custom}, tempDir: os.TempDir()}
+	e.Config = runnerConfig
+	e.Build = &common.Build{Runner: &runnerConfig}
+	e.BuildLogger = common.NewBuildLogger(trace, logrus.NewEntry(logrus.New()))
+
+	script := `echo raw output; ` +
+		`echo '{"type": "progress", "message": "provisioning VM", "current": 1, "total": 2}' >&$STRUCTURED_LOG_FD`
+
+	opts := prepareCommandOpts{
+		executable: "sh",
+		args:       []string{"-c", script},
+		out:        commandOutputs{stdout: trace, stderr: trace},
+	}
+
+	require.NoError(t, e.prepareCommand(context.Background(), opts).Run())
+
+	assert.Contains(t, out.String(), "raw output\n")
+	assert.Contains(t, out.String(), "provisioning VM 1/2")
+	assert.NotContains(t, out.String(), `"type"`)
+}
+
+func TestExecutor_StructuredLogCreatedOnRun(t *testing.T) {
+	if !supportsStructuredLog() {
+		t.Skip("structured log is not supported on this platform")
+	}
+
+	runnerConfig := getRunnerConfig(&common.CustomConfig{RunExec: "bash"})
+
+	e := &executor{config: &config{CustomConfig: runnerConfig.Custom}, tempDir: os.TempDir()}
+	e.Config = runnerConfig
+	e.Build = &common.Build{Runner: &runnerConfig}
+	e.BuildLogger = common.NewBuildLogger(&common.Trace{Writer: new(bytes.Buffer)}, logrus.NewEntry(logrus.New()))
+
+	var extraFiles []*os.File
+
+	cmd := new(command.MockCommand)
+	defer cmd.AssertExpectations(t)
+	cmd.On("Run").Return(nil).Once()
+
+	oldFactory := commandFactory
+	defer func() {
+		commandFactory = oldFactory
+	}()
+	commandFactory = func(ctx context.Context, executable string, args []string, options process.CommandOptions) command.Command {
+		extraFiles = options.ExtraFiles
+		return cmd
+	}
+
+	prepared := e.prepareCommand(context.Background(), prepareCommandOpts{executable: "sh"})
+	assert.Nil(t, extraFiles, "the structured log isn't created before the command is run")
+
+	require.NoError(t, prepared.Run())
+	require.Len(t, extraFiles, 1)
+
+	_, err := extraFiles[0].Write([]byte("\n"))
+	assert.Error(t, err, "the structured log is closed after the command is run")
+}
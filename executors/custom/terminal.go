@@ -3,11 +3,127 @@
 package custom
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
 
+	"github.com/kr/pty"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/custom/driver"
 	terminalsession "gitlab.com/gitlab-org/gitlab-runner/session/terminal"
+	terminal "gitlab.com/gitlab-org/gitlab-terminal"
 )
 
 func (e *executor) Connect() (terminalsession.Conn, error) {
+	if e.driverSocket != "" {
+		return e.connectDriverTerminal()
+	}
+
+	if e.config != nil && e.config.TerminalExec != "" {
+		return e.connectTerminalExec()
+	}
+
 	return nil, errors.New("not yet supported")
 }
+
+func (e *executor) connectDriverTerminal() (terminalsession.Conn, error) {
+	ctx, cancelFn := context.WithCancel(e.Context)
+
+	return terminalConn{
+		logger:   &e.BuildLogger,
+		ctx:      ctx,
+		cancelFn: cancelFn,
+		socket:   e.driverSocket,
+		params:   driver.TerminalParams{JobParams: e.driverJobParams()},
+	}, nil
+}
+
+type terminalConn struct {
+	logger   *common.BuildLogger
+	ctx      context.Context
+	cancelFn func()
+
+	socket string
+	params driver.TerminalParams
+}
+
+func (t terminalConn) Start(w http.ResponseWriter, r *http.Request, timeoutCh, disconnectCh chan error) {
+	session, err := driver.DialTerminal(t.ctx, t.socket, t.params)
+	if err != nil {
+		t.logger.Errorln("Failed to start terminal with the driver:", err)
+		http.Error(w, "failed to start terminal with the driver", http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = session.Close() }()
+
+	proxy := terminal.NewStreamProxy(1) // one stopper: terminal exit handler
+
+	// stop the terminal when the job finishes
+	go func() {
+		<-t.ctx.Done()
+		proxy.GetStopCh() <- errors.New("build finished")
+	}()
+
+	terminalsession.ProxyTerminal(
+		timeoutCh,
+		disconnectCh,
+		proxy.StopCh,
+		func() {
+			terminal.ProxyStream(w, r, session, proxy)
+		},
+	)
+}
+
+func (t terminalConn) Close() error {
+	if t.cancelFn != nil {
+		t.cancelFn()
+	}
+	return nil
+}
+
+// connectTerminalExec starts terminal_exec with a pseudo-terminal, which is
+// expected to start an interactive shell in the environment of the job
+func (e *executor) connectTerminalExec() (terminalsession.Conn, error) {
+	cmd := exec.Command(e.config.TerminalExec, e.config.TerminalArgs...)
+	cmd.Dir = e.tempDir
+	cmd.Env = append(os.Environ(), fmt.Sprintf("TMPDIR=%s", e.tempDir))
+	cmd.Env = append(cmd.Env, e.customEnv()...)
+
+	terminalFd, err := pty.Start(cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	return execTerminalConn{cmd: cmd, terminalFd: terminalFd}, nil
+}
+
+type execTerminalConn struct {
+	cmd        *exec.Cmd
+	terminalFd *os.File
+}
+
+func (t execTerminalConn) Start(w http.ResponseWriter, r *http.Request, timeoutCh, disconnectCh chan error) {
+	proxy := terminal.NewFileDescriptorProxy(1) // one stopper: terminal exit handler
+
+	terminalsession.ProxyTerminal(
+		timeoutCh,
+		disconnectCh,
+		proxy.StopCh,
+		func() {
+			terminal.ProxyFileDescriptor(w, r, t.terminalFd, proxy)
+		},
+	)
+}
+
+func (t execTerminalConn) Close() error {
+	err := t.terminalFd.Close()
+
+	_ = t.cmd.Process.Kill()
+	_ = t.cmd.Wait()
+
+	return err
+}
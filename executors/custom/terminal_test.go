@@ -3,9 +3,14 @@
 package custom
 
 import (
+	"bufio"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
 )
 
 func TestExecutor_Connect(t *testing.T) {
@@ -15,3 +20,32 @@ func TestExecutor_Connect(t *testing.T) {
 	assert.Nil(t, connection)
 	assert.EqualError(t, err, "not yet supported")
 }
+
+func TestExecutor_ConnectTerminalExec(t *testing.T) {
+	e := &executor{
+		config: &config{
+			CustomConfig: &common.CustomConfig{
+				TerminalExec: "sh",
+				TerminalArgs: []string{"-c", "echo terminal of $CUSTOM_ENV_TERMINAL_NAME"},
+			},
+		},
+		tempDir: os.TempDir(),
+	}
+	e.Build = &common.Build{
+		JobResponse: common.JobResponse{
+			Variables: common.JobVariables{{Key: "TERMINAL_NAME", Value: "job"}},
+		},
+		Runner: &common.RunnerConfig{},
+	}
+
+	connection, err := e.Connect()
+	require.NoError(t, err)
+
+	conn, ok := connection.(execTerminalConn)
+	require.True(t, ok)
+	defer conn.Close()
+
+	output, err := bufio.NewReader(conn.terminalFd).ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "terminal of job\r\n", output)
+}
@@ -34,6 +34,7 @@ var knownBuildStages = map[string]struct{}{
 	"build_script":                {},
 	"after_script":                {},
 	"archive_cache":               {},
+	"archive_cache_on_failure":    {},
 	"upload_artifacts_on_success": {},
 	"upload_artifacts_on_failure": {},
 }
@@ -9,6 +9,8 @@ const dockerCleanupTimeout = 5 * time.Minute
 
 const waitForContainerTimeout = 15 * time.Second
 
+const containerKillTimeout = 30 * time.Second
+
 const osTypeLinux = "linux"
 const osTypeWindows = "windows"
 
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -25,15 +26,18 @@ import (
 
 	"gitlab.com/gitlab-org/gitlab-runner/common"
 	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/imagepolicy"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/labels"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/networks"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes/parser"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes/permission"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/wait"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/warmer"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/container/helperimage"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/container/services"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/dns"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker/auth"
 )
@@ -91,6 +95,16 @@ type executor struct {
 
 	networkMode container.NetworkMode
 
+	egressProxyEnvironment []string
+	stopEgressProxyWatch   func()
+
+	overwrites overwrites
+
+	imagePolicy    *imagepolicy.Policy
+	verifiedImages map[string]string
+
+	imageWarmer *warmer.Warmer
+
 	projectUniqRandomizedName string
 }
 
@@ -153,6 +167,10 @@ func (e *executor) getDockerImage(imageName string) (image *types.ImageInspect,
 		return &existingImage, nil
 	}
 
+	if existingImage.ID != imageName {
+		e.imageWarmer.ObserveImage(err == nil)
+	}
+
 	defer func() {
 		if err == nil {
 			e.markImageAsUsed(imageName, image.ID)
@@ -209,9 +227,26 @@ func (e *executor) expandAndGetDockerImage(imageName string, allowedImages []str
 		return nil, err
 	}
 
+	if !isInternalImage(imageName, allowedImages) {
+		err = e.verifyImagePolicy(imageName, image)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return image, nil
 }
 
+func isInternalImage(imageName string, internalImages []string) bool {
+	for _, internalImage := range internalImages {
+		if imageName == internalImage {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (e *executor) loadPrebuiltImage(path, ref, tag string) (*types.ImageInspect, error) {
 	file, err := os.OpenFile(path, os.O_RDONLY, 0600)
 	if err != nil {
@@ -309,6 +344,11 @@ func (e *executor) getBuildImage() (*types.ImageInspect, error) {
 		return nil, err
 	}
 
+	err = e.verifyImagePolicy(imageName, image)
+	if err != nil {
+		return nil, err
+	}
+
 	return image, nil
 }
 
@@ -377,6 +417,7 @@ func (e *executor) markImageAsUsed(imageName, imageID string) {
 
 	if imageName != imageID {
 		e.Println("Using docker image", imageID, "for", imageName, "...")
+		e.imageWarmer.MarkImageAsUsed(imageName)
 	}
 }
 
@@ -400,6 +441,11 @@ func (e *executor) createService(
 		return nil, err
 	}
 
+	err = e.verifyImagePolicy(image, serviceImage)
+	if err != nil {
+		return nil, err
+	}
+
 	serviceSlug := strings.ReplaceAll(service, "/", "__")
 	containerName := fmt.Sprintf("%s-%s-%d", e.getProjectUniqRandomizedName(), serviceSlug, serviceIndex)
 
@@ -415,7 +461,7 @@ func (e *executor) createService(
 	config := &container.Config{
 		Image:  serviceImage.ID,
 		Labels: e.labeler.Labels(labels),
-		Env:    append(e.getServiceVariables(), e.BuildShell.Environment...),
+		Env:    e.appendEgressProxyEnvironment(append(e.getServiceVariables(), e.BuildShell.Environment...)),
 	}
 
 	if len(serviceDefinition.Command) > 0 {
@@ -423,7 +469,11 @@ func (e *executor) createService(
 	}
 	config.Entrypoint = e.overwriteEntrypoint(&serviceDefinition)
 
-	hostConfig := e.createHostConfigForService()
+	hostConfig, err := e.createHostConfigForService()
+	if err != nil {
+		return nil, err
+	}
+
 	networkConfig := e.networkConfig(linkNames)
 
 	e.Debugln("Creating service container", containerName, "...")
@@ -442,8 +492,8 @@ func (e *executor) createService(
 	return fakeContainer(resp.ID, containerName), nil
 }
 
-func (e *executor) createHostConfigForService() *container.HostConfig {
-	return &container.HostConfig{
+func (e *executor) createHostConfigForService() (*container.HostConfig, error) {
+	hostConfig := &container.HostConfig{
 		DNS:           e.Config.Docker.DNS,
 		DNSSearch:     e.Config.Docker.DNSSearch,
 		RestartPolicy: neverRestartPolicy,
@@ -457,6 +507,15 @@ func (e *executor) createHostConfigForService() *container.HostConfig {
 			Type: "json-file",
 		},
 	}
+
+	err := serviceContainerLimits(e.Config.Docker).apply(&hostConfig.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	e.overwrites.applyToService(hostConfig)
+
+	return hostConfig, nil
 }
 
 func (e *executor) networkConfig(aliases []string) *network.NetworkingConfig {
@@ -724,7 +783,9 @@ func (e *executor) createContainerConfig(
 		AttachStderr: true,
 		OpenStdin:    true,
 		StdinOnce:    true,
-		Env:          append(e.Build.GetAllVariables().StringList(), e.BuildShell.Environment...),
+		Env: e.appendEgressProxyEnvironment(
+			append(e.Build.GetAllVariables().StringList(), e.BuildShell.Environment...),
+		),
 	}
 	config.Entrypoint = e.overwriteEntrypoint(&imageDefinition)
 
@@ -737,7 +798,7 @@ func (e *executor) createHostConfig() (*container.HostConfig, error) {
 		return nil, err
 	}
 
-	return &container.HostConfig{
+	hostConfig := &container.HostConfig{
 		Resources: container.Resources{
 			Memory:            e.Config.Docker.GetMemory(),
 			MemorySwap:        e.Config.Docker.GetMemorySwap(),
@@ -770,7 +831,16 @@ func (e *executor) createHostConfig() (*container.HostConfig, error) {
 		},
 		Tmpfs:   e.Config.Docker.Tmpfs,
 		Sysctls: e.Config.Docker.SysCtls,
-	}, nil
+	}
+
+	err = buildContainerLimits(e.Config.Docker).apply(&hostConfig.Resources)
+	if err != nil {
+		return nil, err
+	}
+
+	e.overwrites.applyToBuild(hostConfig)
+
+	return hostConfig, nil
 }
 
 func (e *executor) startAndWatchContainer(ctx context.Context, id string, input io.Reader) error {
@@ -827,11 +897,67 @@ func (e *executor) startAndWatchContainer(ctx context.Context, id string, input
 		e.Debugln("Container", id, "finished with", err)
 	}
 
+	gracePeriod := e.Build.GetCancelGracePeriod()
+	if ctx.Err() != nil && gracePeriod > 0 && e.info.OSType != osTypeWindows {
+		return e.terminateContainer(id, gracePeriod)
+	}
+
 	// Kill and wait for exit.
 	// Containers are stopped so that they can be reused by the job.
 	return e.waiter.KillWait(ctx, id)
 }
 
+// terminateContainer sends SIGTERM to the processes of the container and kills
+// it when they don't exit within the grace period. The signal is sent from
+// inside of the container, as the shell running the script as its PID 1
+// doesn't forward it. PID 1 receives the signal only when it handles it, for
+// example with a trap in the script
+func (e *executor) terminateContainer(id string, gracePeriod time.Duration) error {
+	e.Debugln("Terminating container", id, "...")
+
+	ctx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+	defer cancel()
+
+	err := e.signalContainerProcesses(ctx, id, "TERM")
+	if err == nil {
+		err = e.waiter.Wait(ctx, id)
+	}
+
+	var buildError *common.BuildError
+	if err == nil || errors.As(err, &buildError) {
+		return err
+	}
+
+	e.Debugln("Container", id, "not terminated, killing it:", err)
+
+	killCtx, killCancel := context.WithTimeout(context.Background(), containerKillTimeout)
+	defer killCancel()
+
+	return e.waiter.KillWait(killCtx, id)
+}
+
+func (e *executor) signalContainerProcesses(ctx context.Context, id string, signal string) error {
+	exec, err := e.client.ContainerExecCreate(ctx, id, types.ExecConfig{
+		// -1 doesn't include PID 1, which is signalled separately
+		Cmd:          []string{"sh", "-c", "kill -" + signal + " -1 1"},
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.ContainerExecAttach(ctx, exec.ID, types.ExecStartCheck{})
+	if err != nil {
+		return err
+	}
+	defer resp.Close()
+
+	// the output is closed once the command exits
+	_, err = io.Copy(ioutil.Discard, resp.Reader)
+	return err
+}
+
 func (e *executor) removeContainer(ctx context.Context, id string) error {
 	e.Debugln("Removing container", id)
 
@@ -1000,6 +1126,7 @@ func (e *executor) createDependencies() error {
 		e.createLabeler,
 		e.createNetworksManager,
 		e.createBuildNetwork,
+		e.createEgressProxy,
 		e.bindDevices,
 		e.createVolumesManager,
 		e.createVolumes,
@@ -1040,7 +1167,24 @@ func (e *executor) createVolumes() error {
 		}
 	}
 
-	return nil
+	return e.createGitReferenceCacheVolume()
+}
+
+// createGitReferenceCacheVolume mounts the reference repository of the
+// project. The volume is shared between the jobs of the project only, as the
+// jobs can write to it and mustn't access the other projects' repositories
+func (e *executor) createGitReferenceCacheVolume() error {
+	if e.Build.GitReferenceCacheDir == "" {
+		return nil
+	}
+
+	name := dns.MakeRFC1123Compatible(fmt.Sprintf(
+		"runner-%s-project-%d-git-reference-cache",
+		e.Build.Runner.ShortDescription(),
+		e.Build.JobInfo.ProjectID,
+	))
+
+	return e.volumesManager.CreateShared(e.Context, name, e.Build.GitReferenceCacheDir)
 }
 
 func (e *executor) createBuildVolume() error {
@@ -1087,6 +1231,9 @@ func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
 
 	e.AbstractExecutor.PrepareConfiguration(options)
 
+	e.imageWarmer = warmer.DefaultPool.Start(&e.Config)
+	e.imageWarmer.JobStarted()
+
 	err := e.connectDocker()
 	if err != nil {
 		return err
@@ -1106,6 +1253,16 @@ func (e *executor) Prepare(options common.ExecutorPrepareOptions) error {
 		return errors.New("docker doesn't support shells that require script file")
 	}
 
+	e.overwrites, err = createOverwrites(e.Config.Docker, e.Build.GetAllVariables(), e.BuildLogger)
+	if err != nil {
+		return err
+	}
+
+	err = e.createImagePolicy()
+	if err != nil {
+		return err
+	}
+
 	imageName, err := e.expandImageName(e.Build.Image.Name, []string{})
 	if err != nil {
 		return err
@@ -1145,6 +1302,11 @@ func (e *executor) prepareBuildsDir(options common.ExecutorPrepareOptions) error
 func (e *executor) Cleanup() {
 	e.SetCurrentStage(ExecutorStageCleanup)
 
+	// The job trace can't be written to after the job is finished
+	if e.stopEgressProxyWatch != nil {
+		e.stopEgressProxyWatch()
+	}
+
 	var wg sync.WaitGroup
 
 	ctx, cancel := context.WithTimeout(context.Background(), dockerCleanupTimeout)
@@ -1187,6 +1349,8 @@ func (e *executor) Cleanup() {
 		_ = e.client.Close()
 	}
 
+	e.imageWarmer.JobFinished()
+
 	e.AbstractExecutor.Cleanup()
 }
 
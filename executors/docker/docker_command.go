@@ -12,13 +12,19 @@ import (
 	"gitlab.com/gitlab-org/gitlab-runner/executors"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes/parser"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes/permission"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/warmer"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+	"gitlab.com/gitlab-org/gitlab-runner/shells"
 )
 
 type commandExecutor struct {
 	executor
 	buildContainer *types.ContainerJSON
 	lock           sync.Mutex
+
+	// shellSwitched is set when the shell was switched to sh after the
+	// script of the current stage was generated
+	shellSwitched bool
 }
 
 func (s *commandExecutor) getBuildContainer() *types.ContainerJSON {
@@ -91,15 +97,43 @@ func (s *commandExecutor) requestBuildContainer() (*types.ContainerJSON, error)
 		return nil, err
 	}
 
+	s.useShWithoutBash(s.buildContainer.ID)
+
 	return s.buildContainer, nil
 }
 
+// useShWithoutBash switches the job to the sh shell when the build container
+// doesn't provide bash, as the detect script then runs the scripts with sh
+func (s *commandExecutor) useShWithoutBash(containerID string) {
+	if s.Shell().Shell != "bash" {
+		return
+	}
+
+	for _, path := range shells.BashPaths {
+		_, err := s.client.ContainerStatPath(s.Context, containerID, path)
+		if err == nil {
+			return
+		}
+
+		if !docker.IsErrNotFound(err) {
+			s.Debugln("Failed to look for bash in the build container:", err)
+			return
+		}
+	}
+
+	s.Warningln("bash not found in the build image, the job scripts are generated for sh")
+	s.Shell().Shell = "sh"
+	s.shellSwitched = true
+}
+
 func (s *commandExecutor) Run(cmd common.ExecutorCommand) error {
 	maxAttempts, err := s.Build.GetExecutorJobSectionAttempts()
 	if err != nil {
 		return fmt.Errorf("getting job section attempts: %w", err)
 	}
 
+	script := cmd.Script
+
 	var runErr error
 	for attempts := 1; attempts <= maxAttempts; attempts++ {
 		if attempts > 1 {
@@ -111,10 +145,19 @@ func (s *commandExecutor) Run(cmd common.ExecutorCommand) error {
 			return err
 		}
 
-		s.Debugln("Executing on", ctr.Name, "the", cmd.Script)
+		// The script of the stage was generated for bash
+		if s.shellSwitched {
+			s.shellSwitched = false
+			script, err = common.GenerateShellScript(cmd.Stage, *s.Shell())
+			if err != nil {
+				return err
+			}
+		}
+
+		s.Debugln("Executing on", ctr.Name, "the", script)
 		s.SetCurrentStage(ExecutorStageRun)
 
-		runErr = s.startAndWatchContainer(cmd.Context, ctr.ID, bytes.NewBufferString(cmd.Script))
+		runErr = s.startAndWatchContainer(cmd.Context, ctr.ID, bytes.NewBufferString(script))
 		if !docker.IsErrNotFound(runErr) {
 			return runErr
 		}
@@ -187,11 +230,15 @@ func init() {
 		features.Services = true
 		features.Session = true
 		features.Terminal = true
+		features.CancelGracePeriod = true
 	}
 
-	common.RegisterExecutorProvider("docker", executors.DefaultExecutorProvider{
-		Creator:          creator,
-		FeaturesUpdater:  featuresUpdater,
-		DefaultShellName: options.Shell.Shell,
+	common.RegisterExecutorProvider("docker", provider{
+		DefaultExecutorProvider: executors.DefaultExecutorProvider{
+			Creator:          creator,
+			FeaturesUpdater:  featuresUpdater,
+			DefaultShellName: options.Shell.Shell,
+		},
+		warmers: warmer.DefaultPool,
 	})
 }
@@ -1,6 +1,7 @@
 package docker
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"errors"
@@ -18,6 +19,7 @@ import (
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/go-connections/nat"
+	"github.com/sirupsen/logrus"
 	logrustest "github.com/sirupsen/logrus/hooks/test"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -28,6 +30,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/networks"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes"
 	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/volumes/parser"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/wait"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/container/helperimage"
 	service_test "gitlab.com/gitlab-org/gitlab-runner/helpers/container/services/test"
@@ -35,6 +38,7 @@ import (
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker/auth"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/test"
+	"gitlab.com/gitlab-org/gitlab-runner/shells"
 )
 
 func TestMain(m *testing.M) {
@@ -806,6 +810,34 @@ func TestCreateVolumes(t *testing.T) {
 	}
 }
 
+func TestCreateGitReferenceCacheVolume(t *testing.T) {
+	vm := new(volumes.MockManager)
+	defer vm.AssertExpectations(t)
+
+	vm.On("Create", mock.Anything, "/volume").
+		Return(nil).
+		Once()
+	vm.On("CreateShared", mock.Anything, "runner-abcdefgh-project-42-git-reference-cache", "/git-reference-cache").
+		Return(nil).
+		Once()
+
+	e := &executor{volumesManager: vm}
+	e.Context = context.Background()
+	e.Config.Docker = &common.DockerConfig{Volumes: []string{"/volume"}}
+	e.Build = &common.Build{
+		GitReferenceCacheDir: "/git-reference-cache",
+		JobResponse: common.JobResponse{
+			JobInfo: common.JobInfo{ProjectID: 42},
+		},
+		Runner: &common.RunnerConfig{
+			RunnerCredentials: common.RunnerCredentials{Token: "abcdefghijklmnop"},
+		},
+	}
+
+	err := e.createVolumes()
+	assert.NoError(t, err)
+}
+
 func TestCreateBuildVolume(t *testing.T) {
 	tests := map[string]volumesTestCase{
 		"volumes manager not created": {
@@ -1546,6 +1578,60 @@ func TestDockerSysctlsSetting(t *testing.T) {
 	testDockerConfigurationWithJobContainer(t, dockerConfig, cce)
 }
 
+func TestDockerProcessAndIOLimitsSetting(t *testing.T) {
+	dockerConfig := &common.DockerConfig{
+		Ulimits:         []string{"nofile=1024:2048", "core=0"},
+		PidsLimit:       512,
+		BlkioWeight:     300,
+		DeviceReadBps:   []string{"/dev/sda:10mb"},
+		DeviceWriteBps:  []string{"/dev/sda:5mb"},
+		DeviceReadIOps:  []string{"/dev/sda:1000"},
+		DeviceWriteIOps: []string{"/dev/sda:500"},
+	}
+
+	cce := func(t *testing.T, config *container.Config, hostConfig *container.HostConfig) {
+		require.Len(t, hostConfig.Ulimits, 2)
+		assert.Equal(t, "nofile", hostConfig.Ulimits[0].Name)
+		assert.Equal(t, int64(1024), hostConfig.Ulimits[0].Soft)
+		assert.Equal(t, int64(2048), hostConfig.Ulimits[0].Hard)
+		assert.Equal(t, int64(512), hostConfig.PidsLimit)
+		assert.Equal(t, uint16(300), hostConfig.BlkioWeight)
+		require.Len(t, hostConfig.BlkioDeviceReadBps, 1)
+		assert.Equal(t, "/dev/sda", hostConfig.BlkioDeviceReadBps[0].Path)
+		assert.Equal(t, uint64(10*1024*1024), hostConfig.BlkioDeviceReadBps[0].Rate)
+		require.Len(t, hostConfig.BlkioDeviceWriteBps, 1)
+		assert.Equal(t, uint64(5*1024*1024), hostConfig.BlkioDeviceWriteBps[0].Rate)
+		require.Len(t, hostConfig.BlkioDeviceReadIOps, 1)
+		assert.Equal(t, uint64(1000), hostConfig.BlkioDeviceReadIOps[0].Rate)
+		require.Len(t, hostConfig.BlkioDeviceWriteIOps, 1)
+		assert.Equal(t, uint64(500), hostConfig.BlkioDeviceWriteIOps[0].Rate)
+	}
+
+	testDockerConfigurationWithJobContainer(t, dockerConfig, cce)
+}
+
+func TestDockerServicesProcessAndIOLimitsSetting(t *testing.T) {
+	dockerConfig := &common.DockerConfig{
+		Ulimits:               []string{"nofile=1024:2048"},
+		PidsLimit:             512,
+		BlkioWeight:           300,
+		ServicesPidsLimit:     128,
+		ServicesDeviceReadBps: []string{"/dev/sdb:1mb"},
+	}
+
+	cce := func(t *testing.T, config *container.Config, hostConfig *container.HostConfig) {
+		require.Len(t, hostConfig.Ulimits, 1)
+		assert.Equal(t, "nofile", hostConfig.Ulimits[0].Name)
+		assert.Equal(t, int64(128), hostConfig.PidsLimit)
+		assert.Equal(t, uint16(300), hostConfig.BlkioWeight)
+		require.Len(t, hostConfig.BlkioDeviceReadBps, 1)
+		assert.Equal(t, "/dev/sdb", hostConfig.BlkioDeviceReadBps[0].Path)
+		assert.Equal(t, uint64(1024*1024), hostConfig.BlkioDeviceReadBps[0].Rate)
+	}
+
+	testDockerConfigurationWithServiceContainer(t, dockerConfig, cce)
+}
+
 type networksTestCase struct {
 	clientAssertions          func(*docker.MockClient)
 	networksManagerAssertions func(*networks.MockManager)
@@ -2026,3 +2112,141 @@ func TestAddServiceHealthCheck(t *testing.T) {
 func init() {
 	auth.HomeDirectory = ""
 }
+
+func TestTerminateContainer(t *testing.T) {
+	testErr := errors.New("test-error")
+
+	cases := map[string]struct {
+		execCreateErr    error
+		waitErr          error
+		expectedKillWait bool
+		expectedErr      error
+		expectedBuildErr bool
+	}{
+		"processes terminated": {
+			expectedErr: nil,
+		},
+		"processes terminated with exit code": {
+			waitErr:          &common.BuildError{Inner: testErr},
+			expectedBuildErr: true,
+		},
+		"processes not terminated within the grace period": {
+			waitErr:          context.DeadlineExceeded,
+			expectedKillWait: true,
+			expectedErr:      testErr,
+		},
+		"signal not delivered": {
+			execCreateErr:    testErr,
+			expectedKillWait: true,
+			expectedErr:      testErr,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			c := new(docker.MockClient)
+			defer c.AssertExpectations(t)
+
+			waiter := new(wait.MockKillWaiter)
+			defer waiter.AssertExpectations(t)
+
+			e := executor{client: c, waiter: waiter}
+
+			c.On("ContainerExecCreate", mock.Anything, "1234", mock.MatchedBy(func(config types.ExecConfig) bool {
+				return assert.Equal(t, []string{"sh", "-c", "kill -TERM -1 1"}, config.Cmd)
+			})).Return(types.IDResponse{ID: "4321"}, tc.execCreateErr).Once()
+
+			if tc.execCreateErr == nil {
+				c.On("ContainerExecAttach", mock.Anything, "4321", mock.Anything).Return(types.HijackedResponse{
+					Conn:   nopConn{},
+					Reader: bufio.NewReader(strings.NewReader("")),
+				}, nil).Once()
+
+				waiter.On("Wait", mock.Anything, "1234").Return(tc.waitErr).Once()
+			}
+
+			if tc.expectedKillWait {
+				waiter.On("KillWait", mock.Anything, "1234").Return(testErr).Once()
+			}
+
+			err := e.terminateContainer("1234", time.Second)
+
+			if tc.expectedBuildErr {
+				var buildErr *common.BuildError
+				assert.True(t, errors.As(err, &buildErr))
+				return
+			}
+			assert.Equal(t, tc.expectedErr, err)
+		})
+	}
+}
+
+type pathNotFoundError struct{}
+
+func (pathNotFoundError) Error() string  { return "no such file or directory" }
+func (pathNotFoundError) NotFound() bool { return true }
+
+func TestDockerUseShWithoutBash(t *testing.T) {
+	notFound := fmt.Errorf("stat: %w", pathNotFoundError{})
+
+	tests := map[string]struct {
+		shell         string
+		statErrors    []error
+		expectedShell string
+	}{
+		"bash found": {
+			shell:         "bash",
+			statErrors:    []error{notFound, nil},
+			expectedShell: "bash",
+		},
+		"bash not found": {
+			shell:         "bash",
+			statErrors:    []error{notFound, notFound, notFound},
+			expectedShell: "sh",
+		},
+		"bash lookup failed": {
+			shell:         "bash",
+			statErrors:    []error{errors.New("daemon error")},
+			expectedShell: "bash",
+		},
+		"not using bash": {
+			shell:         "sh",
+			expectedShell: "sh",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			c := new(docker.MockClient)
+			defer c.AssertExpectations(t)
+
+			trace := new(bytes.Buffer)
+			s := &commandExecutor{
+				executor: executor{
+					AbstractExecutor: executors.AbstractExecutor{
+						ExecutorOptions: executors.ExecutorOptions{
+							Shell: common.ShellScriptInfo{Shell: tt.shell},
+						},
+						BuildLogger: common.NewBuildLogger(&common.Trace{Writer: trace}, logrus.WithField("test", t.Name())),
+						Context:     context.Background(),
+					},
+					client: c,
+				},
+			}
+
+			for i, err := range tt.statErrors {
+				c.On("ContainerStatPath", s.Context, "build-id", shells.BashPaths[i]).
+					Return(types.ContainerPathStat{}, err).
+					Once()
+			}
+
+			s.useShWithoutBash("build-id")
+
+			assert.Equal(t, tt.expectedShell, s.Shell().Shell)
+			assert.Equal(t, tt.expectedShell != tt.shell, s.shellSwitched)
+			if s.shellSwitched {
+				assert.Contains(t, trace.String(), "bash not found in the build image")
+			}
+		})
+	}
+}
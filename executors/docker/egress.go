@@ -0,0 +1,252 @@
+package docker
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/pkg/stdcopy"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/container/services"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/egress"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
+)
+
+const (
+	labelEgressProxyType = "egress-proxy"
+
+	egressProxyAlias = "egress-proxy"
+	egressProxyPort  = 8080
+)
+
+// createEgressProxy starts the egress proxy sidecar for the build. The proxy
+// container is attached to both the default bridge network, from which it can
+// reach the outside world, and to the internal per-build network, which has no
+// other route out. Build and service containers are configured to use it
+// through the standard proxy environment variables.
+func (e *executor) createEgressProxy() error {
+	policy := e.Config.Docker.EgressPolicy
+	if !policy.Enabled {
+		return nil
+	}
+
+	if e.Config.Docker.NetworkMode != "" || !e.Build.IsFeatureFlagOn(featureflags.NetworkPerBuild) {
+		return common.MakeBuildError(
+			"egress_policy requires the %s feature flag and can't be used with network_mode",
+			featureflags.NetworkPerBuild,
+		)
+	}
+
+	noProxy, err := e.getEgressNoProxyHosts()
+	if err != nil {
+		return err
+	}
+
+	proxyImage, err := e.getPrebuiltImage()
+	if err != nil {
+		return fmt.Errorf("getPrebuiltImage: %w", err)
+	}
+
+	containerName := e.getProjectUniqRandomizedName() + "-" + egressProxyAlias
+
+	// this will fail potentially some builds if there's name collision
+	_ = e.removeContainer(e.Context, containerName)
+
+	config := &container.Config{
+		Image:  proxyImage.ID,
+		Cmd:    e.getEgressProxyCommand(),
+		Labels: e.labeler.Labels(map[string]string{"type": labelEgressProxyType}),
+	}
+
+	hostConfig := &container.HostConfig{
+		RestartPolicy: neverRestartPolicy,
+		LogConfig: container.LogConfig{
+			Type: "json-file",
+		},
+	}
+
+	e.Debugln("Creating egress proxy container", containerName, "...")
+	resp, err := e.client.ContainerCreate(e.Context, config, hostConfig, nil, containerName)
+	if err != nil {
+		return fmt.Errorf("create egress proxy container: %w", err)
+	}
+	e.temporary = append(e.temporary, resp.ID)
+
+	endpoint := &network.EndpointSettings{Aliases: []string{egressProxyAlias}}
+	err = e.client.NetworkConnect(e.Context, e.networkMode.NetworkName(), resp.ID, endpoint)
+	if err != nil {
+		return fmt.Errorf("connect egress proxy to build network: %w", err)
+	}
+
+	e.Debugln(fmt.Sprintf("Starting egress proxy container %s (%s)...", containerName, resp.ID))
+	err = e.client.ContainerStart(e.Context, resp.ID, types.ContainerStartOptions{})
+	if err != nil {
+		return fmt.Errorf("start egress proxy container: %w", err)
+	}
+
+	watchCtx, cancelWatch := context.WithCancel(e.Context)
+	watchDone := make(chan struct{})
+	go func() {
+		defer close(watchDone)
+		e.watchEgressProxy(watchCtx, resp.ID)
+	}()
+	e.stopEgressProxyWatch = func() {
+		cancelWatch()
+		<-watchDone
+	}
+
+	proxyURL := fmt.Sprintf("http://%s:%d", egressProxyAlias, egressProxyPort)
+	noProxyList := strings.Join(noProxy, ",")
+	e.egressProxyEnvironment = []string{
+		"HTTP_PROXY=" + proxyURL,
+		"HTTPS_PROXY=" + proxyURL,
+		"NO_PROXY=" + noProxyList,
+		"http_proxy=" + proxyURL,
+		"https_proxy=" + proxyURL,
+		"no_proxy=" + noProxyList,
+	}
+
+	e.Println("Outbound traffic is restricted by the runner's egress policy")
+
+	return nil
+}
+
+func (e *executor) appendEgressProxyEnvironment(env []string) []string {
+	return append(env, e.egressProxyEnvironment...)
+}
+
+func (e *executor) getEgressProxyCommand() []string {
+	policy := e.Config.Docker.EgressPolicy
+
+	cmd := []string{
+		"gitlab-runner-helper", "egress-proxy",
+		"--listen", ":" + strconv.Itoa(egressProxyPort),
+	}
+
+	for _, cidr := range policy.AllowedCIDRs {
+		cmd = append(cmd, "--allowed-cidr", cidr)
+	}
+
+	// The job always needs to reach GitLab to fetch sources and
+	// to upload and download artifacts and caches
+	gitLabURLs := e.getGitLabURLs()
+	for _, host := range policy.AllowedHosts {
+		cmd = append(cmd, "--allowed-host", host)
+	}
+
+	for _, u := range gitLabURLs {
+		cmd = append(cmd, "--allowed-host", u.Hostname())
+	}
+
+	for _, port := range policy.AllowedPorts {
+		cmd = append(cmd, "--allowed-port", strconv.Itoa(port))
+	}
+
+	// The ports of the GitLab URLs are reachable even when they aren't
+	// in the allowed ports
+	for _, u := range gitLabURLs {
+		cmd = append(cmd, "--allowed-destination", net.JoinHostPort(u.Hostname(), urlPort(u)))
+	}
+
+	return cmd
+}
+
+func (e *executor) getGitLabURLs() []*url.URL {
+	var urls []*url.URL
+
+	for _, rawURL := range []string{e.Config.URL, e.Config.CloneURL} {
+		u, err := url.Parse(rawURL)
+		if err != nil || u.Hostname() == "" {
+			continue
+		}
+
+		urls = append(urls, u)
+	}
+
+	return urls
+}
+
+func urlPort(u *url.URL) string {
+	if u.Port() != "" {
+		return u.Port()
+	}
+
+	if u.Scheme == "http" {
+		return "80"
+	}
+
+	return "443"
+}
+
+// getEgressNoProxyHosts returns the hosts that are reached directly on the
+// build network, without going through the egress proxy
+func (e *executor) getEgressNoProxyHosts() ([]string, error) {
+	hosts := []string{"localhost", "127.0.0.1", "build"}
+
+	servicesDefinitions, err := e.getServicesDefinitions()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, serviceDefinition := range servicesDefinitions {
+		serviceMeta := services.SplitNameAndVersion(serviceDefinition.Name)
+		hosts = append(hosts, serviceMeta.Aliases...)
+
+		if serviceDefinition.Alias != "" {
+			hosts = append(hosts, serviceDefinition.Alias)
+		}
+	}
+
+	return hosts, nil
+}
+
+// watchEgressProxy follows the proxy output and reports blocked connections
+// in the job trace. It returns when the proxy container is removed or when
+// the context is canceled.
+func (e *executor) watchEgressProxy(ctx context.Context, id string) {
+	options := types.ContainerLogsOptions{
+		ShowStdout: true,
+		Follow:     true,
+	}
+
+	logs, err := e.client.ContainerLogs(ctx, id, options)
+	if err != nil {
+		e.Debugln("Failed to follow egress proxy logs:", err)
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = logs.Close()
+	}()
+
+	reader, writer := io.Pipe()
+	go func() {
+		_, errCopy := stdcopy.StdCopy(writer, ioutil.Discard, logs)
+		_ = writer.CloseWithError(errCopy)
+	}()
+
+	e.reportEgressBlocked(reader)
+}
+
+func (e *executor) reportEgressBlocked(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, egress.BlockedLogPrefix) {
+			continue
+		}
+
+		e.Warningln("Outbound connection denied by egress policy:", strings.TrimPrefix(line, egress.BlockedLogPrefix))
+	}
+}
@@ -0,0 +1,182 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/egress"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
+)
+
+func getExecutorForEgressTests(t *testing.T, networkPerBuild string, trace *bytes.Buffer) (*executor, *docker.MockClient) {
+	c := new(docker.MockClient)
+
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			BuildLogger: common.NewBuildLogger(&common.Trace{Writer: trace}, logrus.WithField("test", t.Name())),
+			Build: &common.Build{
+				ProjectRunnerID: 0,
+				Runner:          &common.RunnerConfig{},
+				JobResponse: common.JobResponse{
+					Variables: common.JobVariables{
+						{Key: featureflags.NetworkPerBuild, Value: networkPerBuild},
+					},
+				},
+			},
+			Config: common.RunnerConfig{
+				RunnerCredentials: common.RunnerCredentials{
+					URL: "https://gitlab.example.com/",
+				},
+				RunnerSettings: common.RunnerSettings{
+					Docker: &common.DockerConfig{
+						HelperImage: "gitlab/gitlab-runner-helper:latest",
+						PullPolicy:  common.PullPolicyIfNotPresent,
+						EgressPolicy: common.DockerEgressPolicy{
+							Enabled:      true,
+							AllowedCIDRs: []string{"10.0.0.0/8"},
+							AllowedHosts: []string{"*.mirror.example.com"},
+							AllowedPorts: []int{443},
+						},
+					},
+				},
+			},
+			Context: context.Background(),
+		},
+		client:      c,
+		networkMode: container.NetworkMode("job-network"),
+	}
+	e.Build.Token = "abcd123456"
+	e.Build.Services = common.Services{{Name: "postgres:12", Alias: "db"}}
+
+	require.NoError(t, e.createLabeler())
+
+	return e, c
+}
+
+func TestCreateEgressProxy(t *testing.T) {
+	trace := new(bytes.Buffer)
+	e, c := getExecutorForEgressTests(t, "true", trace)
+	defer c.AssertExpectations(t)
+
+	c.On("ImageInspectWithRaw", mock.Anything, "gitlab/gitlab-runner-helper:latest").
+		Return(types.ImageInspect{ID: "helper-image"}, nil, nil).
+		Once()
+	c.On("NetworkList", mock.Anything, mock.Anything).
+		Return(nil, nil).
+		Once()
+	c.On("ContainerRemove", mock.Anything, mock.Anything, mock.Anything).
+		Return(nil).
+		Once()
+
+	configMatcher := mock.MatchedBy(func(config *container.Config) bool {
+		return assert.Equal(t, "helper-image", config.Image) &&
+			assert.Equal(t, labelEgressProxyType, config.Labels["com.gitlab.gitlab-runner.type"]) &&
+			assert.Equal(t, []string{
+				"gitlab-runner-helper", "egress-proxy",
+				"--listen", ":8080",
+				"--allowed-cidr", "10.0.0.0/8",
+				"--allowed-host", "*.mirror.example.com",
+				"--allowed-host", "gitlab.example.com",
+				"--allowed-port", "443",
+				"--allowed-destination", "gitlab.example.com:443",
+			}, []string(config.Cmd))
+	})
+	c.On("ContainerCreate", mock.Anything, configMatcher, mock.Anything, mock.Anything, mock.Anything).
+		Return(container.ContainerCreateCreatedBody{ID: "proxy-id"}, nil).
+		Once()
+
+	endpointMatcher := mock.MatchedBy(func(endpoint *network.EndpointSettings) bool {
+		return assert.Equal(t, []string{egressProxyAlias}, endpoint.Aliases)
+	})
+	c.On("NetworkConnect", mock.Anything, "job-network", "proxy-id", endpointMatcher).
+		Return(nil).
+		Once()
+	c.On("ContainerStart", mock.Anything, "proxy-id", mock.Anything).
+		Return(nil).
+		Once()
+
+	// The logs are followed until the watch is stopped
+	logs, logsWriter := io.Pipe()
+	defer logsWriter.Close()
+	c.On("ContainerLogs", mock.Anything, "proxy-id", mock.Anything).
+		Return(logs, nil).
+		Once()
+
+	err := e.createEgressProxy()
+	require.NoError(t, err)
+	require.NotNil(t, e.stopEgressProxyWatch)
+	e.stopEgressProxyWatch()
+
+	assert.Equal(t, []string{"proxy-id"}, e.temporary)
+	assert.Contains(t, e.egressProxyEnvironment, "HTTPS_PROXY=http://egress-proxy:8080")
+	assert.Contains(t, e.egressProxyEnvironment, "NO_PROXY=localhost,127.0.0.1,build,postgres,db")
+}
+
+func TestCreateEgressProxyRequiresNetworkPerBuild(t *testing.T) {
+	e, c := getExecutorForEgressTests(t, "false", new(bytes.Buffer))
+	defer c.AssertExpectations(t)
+
+	err := e.createEgressProxy()
+	assert.Error(t, err)
+	assert.IsType(t, &common.BuildError{}, err)
+}
+
+func TestCreateEgressProxyDisabled(t *testing.T) {
+	e, c := getExecutorForEgressTests(t, "true", new(bytes.Buffer))
+	defer c.AssertExpectations(t)
+
+	e.Config.Docker.EgressPolicy.Enabled = false
+
+	err := e.createEgressProxy()
+	assert.NoError(t, err)
+	assert.Empty(t, e.egressProxyEnvironment)
+}
+
+func TestReportEgressBlocked(t *testing.T) {
+	trace := new(bytes.Buffer)
+	e, _ := getExecutorForEgressTests(t, "true", trace)
+
+	output := "Starting egress proxy\n" +
+		egress.BlockedLogPrefix + "egress to example.com:443 blocked: host not allowed\n"
+
+	e.reportEgressBlocked(strings.NewReader(output))
+
+	assert.Contains(
+		t,
+		trace.String(),
+		"Outbound connection denied by egress policy: egress to example.com:443 blocked: host not allowed",
+	)
+	assert.NotContains(t, trace.String(), "Starting egress proxy")
+}
+
+func TestGetEgressProxyCommandAllowsCloneURL(t *testing.T) {
+	e, _ := getExecutorForEgressTests(t, "true", new(bytes.Buffer))
+	e.Config.CloneURL = "https://clone.example.com"
+
+	assert.Contains(t, e.getEgressProxyCommand(), "clone.example.com")
+}
+
+func TestGetEgressProxyCommandAllowsGitLabPorts(t *testing.T) {
+	e, _ := getExecutorForEgressTests(t, "true", new(bytes.Buffer))
+	e.Config.URL = "http://gitlab.example.com"
+	e.Config.CloneURL = "https://clone.example.com:8443/"
+
+	cmd := strings.Join(e.getEgressProxyCommand(), " ")
+	assert.Contains(t, cmd, "--allowed-port 443")
+	assert.Contains(t, cmd, "--allowed-destination gitlab.example.com:80")
+	assert.Contains(t, cmd, "--allowed-destination clone.example.com:8443")
+}
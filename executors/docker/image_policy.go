@@ -0,0 +1,59 @@
+package docker
+
+import (
+	"github.com/docker/docker/api/types"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/imagepolicy"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker/auth"
+)
+
+func (e *executor) createImagePolicy() error {
+	policy, err := imagepolicy.New(e.Config.Docker.ImagePolicy)
+	if err != nil {
+		return err
+	}
+
+	e.imagePolicy = policy
+
+	return nil
+}
+
+// verifyImagePolicy checks the image against the configured image policy
+// and reports the exact digest of the image that's going to be used
+func (e *executor) verifyImagePolicy(imageName string, image *types.ImageInspect) error {
+	if e.imagePolicy == nil {
+		return nil
+	}
+
+	if digest, ok := e.verifiedImages[image.ID]; ok {
+		e.Debugln("Image", imageName, "already verified with digest", digest)
+		return nil
+	}
+
+	var authConfig *types.AuthConfig
+	registryInfo := auth.ResolveConfigForImage(
+		imageName,
+		e.Build.GetDockerAuthConfig(),
+		e.Shell().User,
+		e.Build.Credentials,
+	)
+	if registryInfo != nil {
+		authConfig = &registryInfo.AuthConfig
+	}
+
+	digest, err := e.imagePolicy.Verify(e.Context, imageName, image.RepoDigests, authConfig)
+	if err != nil {
+		e.Errorln("Image", imageName, "is not allowed by the runner's image policy:", err)
+		return &common.BuildError{Inner: err}
+	}
+
+	if e.verifiedImages == nil {
+		e.verifiedImages = make(map[string]string)
+	}
+	e.verifiedImages[image.ID] = digest
+
+	e.Println("Image", imageName, "verified with digest", digest)
+
+	return nil
+}
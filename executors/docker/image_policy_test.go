@@ -0,0 +1,125 @@
+package docker
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/imagepolicy"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+const testImageDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func getExecutorForImagePolicyTests(
+	t *testing.T,
+	policy common.DockerImagePolicy,
+	trace *bytes.Buffer,
+) (*executor, *docker.MockClient) {
+	c := new(docker.MockClient)
+
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			BuildLogger: common.NewBuildLogger(&common.Trace{Writer: trace}, logrus.WithField("test", t.Name())),
+			Build: &common.Build{
+				Runner: &common.RunnerConfig{},
+			},
+			Config: common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{
+					Docker: &common.DockerConfig{
+						PullPolicy:  common.PullPolicyIfNotPresent,
+						ImagePolicy: policy,
+					},
+				},
+			},
+			Context: context.Background(),
+		},
+		client: c,
+	}
+
+	require.NoError(t, e.createImagePolicy())
+
+	return e, c
+}
+
+func TestGetBuildImageWithImagePolicy(t *testing.T) {
+	policy := common.DockerImagePolicy{
+		AllowedDigests: []string{"registry.example.com/tools/*@sha256:*"},
+	}
+
+	tests := map[string]struct {
+		imageName     string
+		repoDigests   []string
+		expectedError bool
+		expectedTrace string
+	}{
+		"allowed image resolved to digest": {
+			imageName:     "registry.example.com/tools/go:1.15",
+			repoDigests:   []string{"registry.example.com/tools/go@" + testImageDigest},
+			expectedTrace: "verified with digest registry.example.com/tools/go@" + testImageDigest,
+		},
+		"denied image": {
+			imageName:     "registry.example.com/other/go:1.15",
+			repoDigests:   []string{"registry.example.com/other/go@" + testImageDigest},
+			expectedError: true,
+			expectedTrace: "is not allowed by the runner's image policy",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			trace := new(bytes.Buffer)
+			e, c := getExecutorForImagePolicyTests(t, policy, trace)
+			defer c.AssertExpectations(t)
+
+			e.Build.Image.Name = tt.imageName
+
+			c.On("ImageInspectWithRaw", mock.Anything, tt.imageName).
+				Return(types.ImageInspect{ID: "image-id", RepoDigests: tt.repoDigests}, nil, nil).
+				Once()
+
+			_, err := e.getBuildImage()
+			if tt.expectedError {
+				var buildErr *common.BuildError
+				require.True(t, errors.As(err, &buildErr))
+				assert.True(t, errors.Is(buildErr.Inner, new(imagepolicy.ViolationError)))
+			} else {
+				assert.NoError(t, err)
+			}
+
+			assert.Contains(t, trace.String(), tt.expectedTrace)
+		})
+	}
+}
+
+func TestImagePolicySkipsInternalImages(t *testing.T) {
+	trace := new(bytes.Buffer)
+	e, c := getExecutorForImagePolicyTests(t, common.DockerImagePolicy{RequireDigest: true}, trace)
+	defer c.AssertExpectations(t)
+
+	c.On("ImageInspectWithRaw", mock.Anything, "helper-image-id").
+		Return(types.ImageInspect{ID: "helper-image-id"}, nil, nil).
+		Once()
+
+	_, err := e.expandAndGetDockerImage("helper-image-id", []string{"helper-image-id"})
+	assert.NoError(t, err)
+}
+
+func TestImagePolicyIsNotCheckedWhenDisabled(t *testing.T) {
+	trace := new(bytes.Buffer)
+	e, c := getExecutorForImagePolicyTests(t, common.DockerImagePolicy{}, trace)
+	defer c.AssertExpectations(t)
+
+	assert.Nil(t, e.imagePolicy)
+	assert.NoError(t, e.verifyImagePolicy("alpine:latest", &types.ImageInspect{ID: "image-id"}))
+	assert.Empty(t, trace.String())
+}
@@ -0,0 +1,170 @@
+package imagepolicy
+
+import (
+	"context"
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// ViolationError is returned when an image is denied by the Policy
+type ViolationError struct {
+	Image  string
+	Reason string
+}
+
+func (e *ViolationError) Error() string {
+	return fmt.Sprintf("image %q denied by image policy: %s", e.Image, e.Reason)
+}
+
+func (e *ViolationError) Is(err error) bool {
+	_, ok := err.(*ViolationError)
+	return ok
+}
+
+// Policy decides whether an image may be used by a job, based on the digest
+// of the image and, optionally, on signatures stored in the image registry
+type Policy struct {
+	requireDigest  bool
+	allowedDigests []string
+	keys           []crypto.PublicKey
+
+	registry *registryClient
+}
+
+// New returns a Policy for the configuration or nil when no policy
+// is configured
+func New(config common.DockerImagePolicy) (*Policy, error) {
+	if !config.IsEnabled() {
+		return nil, nil
+	}
+
+	p := &Policy{
+		requireDigest:  config.RequireDigest,
+		allowedDigests: config.AllowedDigests,
+		registry:       newRegistryClient(),
+	}
+
+	for _, path := range config.SignaturePublicKeys {
+		key, err := loadPublicKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("loading signature public key %q: %w", path, err)
+		}
+
+		p.keys = append(p.keys, key)
+	}
+
+	return p, nil
+}
+
+func loadPublicKey(path string) (crypto.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	return x509.ParsePKIXPublicKey(block.Bytes)
+}
+
+// Verify checks the image against the policy and returns the digest of the
+// image, in the <name>@<digest> format. The digest is taken from the image
+// name when it's pinned, otherwise from the repository digests that Docker
+// recorded when pulling the image.
+func (p *Policy) Verify(
+	ctx context.Context,
+	imageName string,
+	repoDigests []string,
+	auth *types.AuthConfig,
+) (string, error) {
+	named, err := reference.ParseNormalizedNamed(imageName)
+	if err != nil {
+		return "", &ViolationError{Image: imageName, Reason: fmt.Sprintf("parsing image name: %v", err)}
+	}
+
+	canonical, err := p.resolveDigest(named, repoDigests)
+	if err != nil {
+		return "", &ViolationError{Image: imageName, Reason: err.Error()}
+	}
+
+	if !p.isDigestAllowed(canonical) {
+		return "", &ViolationError{Image: imageName, Reason: fmt.Sprintf("digest %s is not allowed", canonical)}
+	}
+
+	if len(p.keys) > 0 {
+		err = p.verifySignatures(ctx, canonical, auth)
+		if err != nil {
+			return "", &ViolationError{Image: imageName, Reason: err.Error()}
+		}
+	}
+
+	return reference.FamiliarString(canonical), nil
+}
+
+func (p *Policy) resolveDigest(named reference.Named, repoDigests []string) (reference.Canonical, error) {
+	if canonical, ok := named.(reference.Canonical); ok {
+		return canonical, nil
+	}
+
+	if p.requireDigest {
+		return nil, errors.New("image must be referenced by digest (<name>@sha256:<digest>)")
+	}
+
+	for _, repoDigest := range repoDigests {
+		resolved, err := reference.ParseNormalizedNamed(repoDigest)
+		if err != nil {
+			continue
+		}
+
+		canonical, ok := resolved.(reference.Canonical)
+		if ok && resolved.Name() == named.Name() {
+			return canonical, nil
+		}
+	}
+
+	return nil, errors.New("couldn't resolve the image digest")
+}
+
+func (p *Policy) isDigestAllowed(canonical reference.Canonical) bool {
+	if len(p.allowedDigests) < 1 {
+		return true
+	}
+
+	digest := canonical.Digest().String()
+	candidates := []string{
+		digest,
+		canonical.String(),
+		reference.FamiliarString(canonical),
+	}
+
+	for _, allowed := range p.allowedDigests {
+		for _, candidate := range candidates {
+			if allowed == candidate {
+				return true
+			}
+
+			if strings.Contains(allowed, "@") {
+				ok, _ := doublestar.Match(allowed, candidate)
+				if ok {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,275 @@
+package imagepolicy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestNewWithoutPolicy(t *testing.T) {
+	p, err := New(common.DockerImagePolicy{})
+	assert.NoError(t, err)
+	assert.Nil(t, p)
+}
+
+func TestNewWithInvalidKey(t *testing.T) {
+	_, err := New(common.DockerImagePolicy{SignaturePublicKeys: []string{"/not/existing/key.pub"}})
+	assert.Error(t, err)
+}
+
+func TestVerifyDigest(t *testing.T) {
+	tests := map[string]struct {
+		policy         common.DockerImagePolicy
+		image          string
+		repoDigests    []string
+		expectedDigest string
+		expectedError  string
+	}{
+		"pinned image without allow-list": {
+			policy:         common.DockerImagePolicy{RequireDigest: true},
+			image:          "alpine@" + testDigest,
+			expectedDigest: "alpine@" + testDigest,
+		},
+		"tagged image when digest is required": {
+			policy:        common.DockerImagePolicy{RequireDigest: true},
+			image:         "alpine:3.12",
+			repoDigests:   []string{"alpine@" + testDigest},
+			expectedError: "image must be referenced by digest",
+		},
+		"tagged image resolved to allowed digest": {
+			policy:         common.DockerImagePolicy{AllowedDigests: []string{testDigest}},
+			image:          "alpine:3.12",
+			repoDigests:    []string{"registry.example.com/alpine@sha256:" + strings.Repeat("f", 64), "alpine@" + testDigest},
+			expectedDigest: "alpine@" + testDigest,
+		},
+		"tagged image without repository digest": {
+			policy:        common.DockerImagePolicy{AllowedDigests: []string{testDigest}},
+			image:         "alpine:3.12",
+			expectedError: "couldn't resolve the image digest",
+		},
+		"digest matched by pattern": {
+			policy:         common.DockerImagePolicy{AllowedDigests: []string{"registry.example.com/tools/*@sha256:*"}},
+			image:          "registry.example.com/tools/go@" + testDigest,
+			expectedDigest: "registry.example.com/tools/go@" + testDigest,
+		},
+		"digest not allowed": {
+			policy:        common.DockerImagePolicy{AllowedDigests: []string{"registry.example.com/tools/*@sha256:*"}},
+			image:         "registry.example.com/other/go@" + testDigest,
+			expectedError: "digest registry.example.com/other/go@" + testDigest + " is not allowed",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			p, err := New(tt.policy)
+			require.NoError(t, err)
+
+			digest, err := p.Verify(context.Background(), tt.image, tt.repoDigests, nil)
+			if tt.expectedError != "" {
+				assert.True(t, errors.Is(err, new(ViolationError)))
+				assert.Contains(t, err.Error(), tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedDigest, digest)
+		})
+	}
+}
+
+type fakeRegistry struct {
+	manifests map[string][]byte
+	blobs     map[string][]byte
+	token     string
+}
+
+func (f *fakeRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		user, pass, _ := r.BasicAuth()
+		if user != "user" || pass != "pass" || r.URL.Query().Get("service") != "registry" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": f.token})
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+f.token {
+		w.Header().Set(
+			"WWW-Authenticate",
+			fmt.Sprintf(`Bearer realm="http://%s/token",service="registry",scope="repository:project/app:pull"`, r.Host),
+		)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if data, ok := f.manifests[r.URL.Path]; ok {
+		_, _ = w.Write(data)
+		return
+	}
+
+	if data, ok := f.blobs[r.URL.Path]; ok {
+		_, _ = w.Write(data)
+		return
+	}
+
+	w.WriteHeader(http.StatusNotFound)
+}
+
+func (f *fakeRegistry) addSignature(t *testing.T, imageDigest string, key *ecdsa.PrivateKey) {
+	payload := []byte(fmt.Sprintf(
+		`{"critical":{"identity":{"docker-reference":"project/app"},`+
+			`"image":{"docker-manifest-digest":%q},"type":"cosign container image signature"},"optional":null}`,
+		imageDigest,
+	))
+
+	sum := sha256.Sum256(payload)
+	signature, err := ecdsa.SignASN1(rand.Reader, key, sum[:])
+	require.NoError(t, err)
+
+	payloadDigest := "sha256:" + hex.EncodeToString(sum[:])
+	f.blobs["/v2/project/app/blobs/"+payloadDigest] = payload
+
+	m := manifest{
+		Layers: []descriptor{
+			{
+				MediaType: "application/vnd.dev.cosign.simplesigning.v1+json",
+				Digest:    payloadDigest,
+				Size:      int64(len(payload)),
+				Annotations: map[string]string{
+					signatureAnnotation: base64.StdEncoding.EncodeToString(signature),
+				},
+			},
+		},
+	}
+
+	data, err := json.Marshal(m)
+	require.NoError(t, err)
+
+	tag := strings.Replace(imageDigest, ":", "-", 1) + ".sig"
+	f.manifests["/v2/project/app/manifests/"+tag] = data
+}
+
+func writePublicKey(t *testing.T, dir string, key *ecdsa.PrivateKey) string {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+
+	path := filepath.Join(dir, "cosign.pub")
+	err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0600)
+	require.NoError(t, err)
+
+	return path
+}
+
+func TestVerifySignatures(t *testing.T) {
+	trustedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	untrustedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	signedDigest := testDigest
+	untrustedDigest := "sha256:" + strings.Repeat("1", 64)
+	unsignedDigest := "sha256:" + strings.Repeat("2", 64)
+
+	registry := &fakeRegistry{
+		manifests: make(map[string][]byte),
+		blobs:     make(map[string][]byte),
+		token:     "registry-token",
+	}
+	registry.addSignature(t, signedDigest, trustedKey)
+	registry.addSignature(t, untrustedDigest, untrustedKey)
+
+	server := httptest.NewServer(registry)
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "imagepolicy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p, err := New(common.DockerImagePolicy{
+		SignaturePublicKeys: []string{writePublicKey(t, dir, trustedKey)},
+	})
+	require.NoError(t, err)
+
+	registryHost := strings.TrimPrefix(server.URL, "http://")
+	auth := &types.AuthConfig{Username: "user", Password: "pass"}
+
+	tests := map[string]struct {
+		digest        string
+		auth          *types.AuthConfig
+		expectedError string
+	}{
+		"signed with trusted key": {
+			digest: signedDigest,
+			auth:   auth,
+		},
+		"signed with untrusted key": {
+			digest:        untrustedDigest,
+			auth:          auth,
+			expectedError: errNoValidSignature.Error(),
+		},
+		"not signed": {
+			digest:        unsignedDigest,
+			auth:          auth,
+			expectedError: "image is not signed",
+		},
+		"invalid registry credentials": {
+			digest:        signedDigest,
+			auth:          &types.AuthConfig{Username: "user", Password: "invalid"},
+			expectedError: "fetching registry token",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			image := registryHost + "/project/app@" + tt.digest
+
+			digest, err := p.Verify(context.Background(), image, nil, tt.auth)
+			if tt.expectedError != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.expectedError)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, image, digest)
+		})
+	}
+}
+
+func TestParseChallenge(t *testing.T) {
+	scheme, params := parseChallenge(
+		`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull,push"`,
+	)
+
+	assert.Equal(t, "Bearer", scheme)
+	assert.Equal(t, map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:a/b:pull,push",
+	}, params)
+}
@@ -0,0 +1,299 @@
+package imagepolicy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+)
+
+const (
+	dockerHubDomain   = "docker.io"
+	dockerHubRegistry = "registry-1.docker.io"
+
+	registryRequestTimeout = 30 * time.Second
+
+	// maxBlobSize limits the size of the signature payloads that are downloaded
+	maxBlobSize = 1024 * 1024
+)
+
+var manifestMediaTypes = []string{
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.docker.distribution.manifest.v2+json",
+}
+
+type manifest struct {
+	Layers []descriptor `json:"layers"`
+}
+
+type descriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+type errNotFound struct {
+	url string
+}
+
+func (e *errNotFound) Error() string {
+	return fmt.Sprintf("%s not found", e.url)
+}
+
+// registryClient is a minimal client of the Docker Registry HTTP API V2,
+// supporting only the calls needed to read image signatures
+type registryClient struct {
+	client *http.Client
+}
+
+func newRegistryClient() *registryClient {
+	return &registryClient{
+		client: &http.Client{Timeout: registryRequestTimeout},
+	}
+}
+
+func registryBaseURL(named reference.Named) string {
+	domain := reference.Domain(named)
+	if domain == dockerHubDomain {
+		domain = dockerHubRegistry
+	}
+
+	// Like the Docker Engine, we treat local registries as insecure ones
+	scheme := "https"
+	host := domain
+	if h, _, err := net.SplitHostPort(domain); err == nil {
+		host = h
+	}
+	if ip := net.ParseIP(host); host == "localhost" || (ip != nil && ip.IsLoopback()) {
+		scheme = "http"
+	}
+
+	return scheme + "://" + domain
+}
+
+func (c *registryClient) getManifest(
+	ctx context.Context,
+	named reference.Named,
+	tag string,
+	auth *types.AuthConfig,
+) (*manifest, error) {
+	u := fmt.Sprintf("%s/v2/%s/manifests/%s", registryBaseURL(named), reference.Path(named), tag)
+
+	body, err := c.get(ctx, u, strings.Join(manifestMediaTypes, ", "), auth)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	var m manifest
+	err = json.NewDecoder(io.LimitReader(body, maxBlobSize)).Decode(&m)
+	if err != nil {
+		return nil, fmt.Errorf("decoding manifest: %w", err)
+	}
+
+	return &m, nil
+}
+
+func (c *registryClient) getBlob(
+	ctx context.Context,
+	named reference.Named,
+	digest string,
+	auth *types.AuthConfig,
+) ([]byte, error) {
+	u := fmt.Sprintf("%s/v2/%s/blobs/%s", registryBaseURL(named), reference.Path(named), digest)
+
+	body, err := c.get(ctx, u, "", auth)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = body.Close() }()
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, maxBlobSize))
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	if "sha256:"+hex.EncodeToString(sum[:]) != digest {
+		return nil, fmt.Errorf("blob %s doesn't match its digest", digest)
+	}
+
+	return data, nil
+}
+
+func (c *registryClient) get(ctx context.Context, u string, accept string, auth *types.AuthConfig) (io.ReadCloser, error) {
+	resp, err := c.do(ctx, u, accept, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		_ = resp.Body.Close()
+
+		authorization, err := c.authorize(ctx, challenge, auth)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err = c.do(ctx, u, accept, authorization)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, &errNotFound{url: u}
+	case resp.StatusCode != http.StatusOK:
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("GET %s: unexpected status %s", u, resp.Status)
+	}
+
+	return resp.Body, nil
+}
+
+func (c *registryClient) do(ctx context.Context, u string, accept string, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	return c.client.Do(req)
+}
+
+// authorize answers the registry authentication challenge and returns the
+// value of the Authorization header to use
+func (c *registryClient) authorize(ctx context.Context, challenge string, auth *types.AuthConfig) (string, error) {
+	scheme, params := parseChallenge(challenge)
+
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if auth == nil {
+			return "", fmt.Errorf("registry requires credentials")
+		}
+		credentials := auth.Username + ":" + auth.Password
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(credentials)), nil
+	case "bearer":
+		token, err := c.fetchToken(ctx, params, auth)
+		if err != nil {
+			return "", err
+		}
+		return "Bearer " + token, nil
+	}
+
+	return "", fmt.Errorf("unsupported registry authentication challenge %q", challenge)
+}
+
+func (c *registryClient) fetchToken(ctx context.Context, params map[string]string, auth *types.AuthConfig) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || realm.Host == "" {
+		return "", fmt.Errorf("invalid token realm %q", params["realm"])
+	}
+
+	query := realm.Query()
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequest(http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+
+	if auth != nil && auth.Username != "" {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("fetching registry token: unexpected status %s", resp.Status)
+	}
+
+	var tokenResponse struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(io.LimitReader(resp.Body, maxBlobSize)).Decode(&tokenResponse)
+	if err != nil {
+		return "", fmt.Errorf("decoding registry token: %w", err)
+	}
+
+	if tokenResponse.Token != "" {
+		return tokenResponse.Token, nil
+	}
+
+	return tokenResponse.AccessToken, nil
+}
+
+// parseChallenge parses a WWW-Authenticate header value like
+// Bearer realm="https://auth.example.com/token",service="registry.example.com"
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	for _, param := range splitChallengeParams(parts[1]) {
+		kv := strings.SplitN(param, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+
+		params[strings.ToLower(strings.TrimSpace(kv[0]))] = strings.Trim(strings.TrimSpace(kv[1]), `"`)
+	}
+
+	return parts[0], params
+}
+
+// splitChallengeParams splits the parameters on commas that are not quoted
+func splitChallengeParams(s string) []string {
+	var params []string
+	var quoted bool
+	start := 0
+
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ',' && !quoted:
+			params = append(params, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(params, s[start:])
+}
@@ -0,0 +1,116 @@
+package imagepolicy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/docker/distribution/reference"
+	"github.com/docker/docker/api/types"
+)
+
+// signatureAnnotation is the layer annotation in which cosign stores
+// the signature of the layer content
+const signatureAnnotation = "dev.cosignproject.cosign/signature"
+
+var errNoValidSignature = errors.New("no valid signature found")
+
+// simpleSigning is the payload signed by cosign, in the "simple signing" format
+type simpleSigning struct {
+	Critical struct {
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+}
+
+// signatureTag returns the tag under which cosign stores the signatures
+// of the image digest, e.g. sha256-<hex>.sig
+func signatureTag(canonical reference.Canonical) string {
+	return strings.Replace(canonical.Digest().String(), ":", "-", 1) + ".sig"
+}
+
+func (p *Policy) verifySignatures(ctx context.Context, canonical reference.Canonical, auth *types.AuthConfig) error {
+	m, err := p.registry.getManifest(ctx, canonical, signatureTag(canonical), auth)
+	var notFoundErr *errNotFound
+	if errors.As(err, &notFoundErr) {
+		return errors.New("image is not signed")
+	}
+	if err != nil {
+		return fmt.Errorf("fetching signatures: %w", err)
+	}
+
+	for _, layer := range m.Layers {
+		signature, ok := layer.Annotations[signatureAnnotation]
+		if !ok {
+			continue
+		}
+
+		payload, err := p.registry.getBlob(ctx, canonical, layer.Digest, auth)
+		if err != nil {
+			return fmt.Errorf("fetching signature payload: %w", err)
+		}
+
+		if p.verifyPayload(canonical, payload, signature) {
+			return nil
+		}
+	}
+
+	return errNoValidSignature
+}
+
+func (p *Policy) verifyPayload(canonical reference.Canonical, payload []byte, signature string) bool {
+	rawSignature, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+
+	var signed simpleSigning
+	err = json.Unmarshal(payload, &signed)
+	if err != nil || signed.Critical.Image.DockerManifestDigest != canonical.Digest().String() {
+		return false
+	}
+
+	for _, key := range p.keys {
+		if verifySignature(key, payload, rawSignature) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ecdsaSignature struct {
+	R, S *big.Int
+}
+
+func verifySignature(key crypto.PublicKey, payload []byte, signature []byte) bool {
+	digest := sha256.Sum256(payload)
+
+	switch k := key.(type) {
+	case *ecdsa.PublicKey:
+		var sig ecdsaSignature
+		rest, err := asn1.Unmarshal(signature, &sig)
+		if err != nil || len(rest) > 0 || sig.R == nil || sig.S == nil {
+			return false
+		}
+		return ecdsa.Verify(k, digest[:], sig.R, sig.S)
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(k, crypto.SHA256, digest[:], signature) == nil
+	case ed25519.PublicKey:
+		return ed25519.Verify(k, payload, signature)
+	}
+
+	return false
+}
@@ -65,7 +65,12 @@ func (m *manager) Create(ctx context.Context, networkMode string) (container.Net
 	networkResponse, err := m.client.NetworkCreate(
 		ctx,
 		networkName,
-		types.NetworkCreate{Labels: m.labeler.Labels(map[string]string{})},
+		types.NetworkCreate{
+			Labels: m.labeler.Labels(map[string]string{}),
+			// An internal network has no route to the outside world, so the
+			// only way out is through the egress proxy attached to it
+			Internal: m.isEgressRestricted(),
+		},
 	)
 	if err != nil {
 		return "", err
@@ -83,6 +88,12 @@ func (m *manager) Create(ctx context.Context, networkMode string) (container.Net
 	return m.networkMode, nil
 }
 
+func (m *manager) isEgressRestricted() bool {
+	docker := m.build.Runner.Docker
+
+	return docker != nil && docker.EgressPolicy.Enabled
+}
+
 func (m *manager) Inspect(ctx context.Context) (types.NetworkResource, error) {
 	if !m.perBuild {
 		return types.NetworkResource{}, nil
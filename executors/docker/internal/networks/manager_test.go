@@ -3,6 +3,7 @@ package networks
 import (
 	"context"
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/docker/docker/api/types"
@@ -178,6 +179,41 @@ func TestCreateNetwork(t *testing.T) {
 	}
 }
 
+func TestCreateNetworkWithEgressPolicy(t *testing.T) {
+	for _, enabled := range []bool{true, false} {
+		t.Run(fmt.Sprintf("enabled=%v", enabled), func(t *testing.T) {
+			m := newDefaultManager()
+			m.build.Runner.Docker = &common.DockerConfig{
+				EgressPolicy: common.DockerEgressPolicy{Enabled: enabled},
+			}
+			m.build.Variables = append(m.build.Variables, common.JobVariable{
+				Key:   featureflags.NetworkPerBuild,
+				Value: "true",
+			})
+
+			client := addClient(m)
+			defer client.AssertExpectations(t)
+
+			client.On(
+				"NetworkCreate",
+				mock.Anything,
+				mock.AnythingOfType("string"),
+				mock.MatchedBy(func(options types.NetworkCreate) bool {
+					return options.Internal == enabled
+				}),
+			).
+				Return(types.NetworkCreateResponse{ID: "test-network"}, nil).
+				Once()
+			client.On("NetworkInspect", mock.Anything, "test-network").
+				Return(types.NetworkResource{ID: "test-network"}, nil).
+				Once()
+
+			_, err := m.Create(context.Background(), "")
+			assert.NoError(t, err)
+		})
+	}
+}
+
 func TestInspectNetwork(t *testing.T) {
 	networkName := "test-network"
 	testError := errors.New("failure")
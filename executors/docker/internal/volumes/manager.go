@@ -17,6 +17,7 @@ var ErrCacheVolumesDisabled = errors.New("cache volumes feature disabled")
 type Manager interface {
 	Create(ctx context.Context, volume string) error
 	CreateTemporary(ctx context.Context, destination string) error
+	CreateShared(ctx context.Context, name string, destination string) error
 	RemoveTemporary(ctx context.Context) error
 	Binds() []string
 }
@@ -197,6 +198,50 @@ func (m *manager) createCacheVolume(ctx context.Context, destination string) (st
 	return volumeName, nil
 }
 
+// CreateShared will create a volume shared between the jobs using the same
+// name and mount it at the destination. When the cache directory is configured
+// the volume is a directory of the host, otherwise a Docker volume named
+// after name is used.
+func (m *manager) CreateShared(ctx context.Context, name string, destination string) error {
+	destination, err := m.absolutePath(destination)
+	if err != nil {
+		return fmt.Errorf("defining absolute path: %w", err)
+	}
+
+	err = m.managedVolumes.Add(destination)
+	if err != nil {
+		return fmt.Errorf("updating managed volumes list: %w", err)
+	}
+
+	if m.config.CacheDir != "" {
+		m.appendVolumeBind(&parser.Volume{
+			Source:      m.parser.Path().Join(m.config.CacheDir, name),
+			Destination: destination,
+		})
+
+		return nil
+	}
+
+	v, err := m.client.VolumeCreate(ctx, volume.VolumeCreateBody{Name: name})
+	if err != nil {
+		return fmt.Errorf("creating docker volume: %w", err)
+	}
+
+	if m.permissionSetter != nil {
+		err = m.permissionSetter.Set(ctx, v.Name)
+		if err != nil {
+			return fmt.Errorf("set volume permissions: %w", err)
+		}
+	}
+
+	m.appendVolumeBind(&parser.Volume{
+		Source:      v.Name,
+		Destination: destination,
+	})
+
+	return nil
+}
+
 // CreateTemporary will create a volume, and mark it as temporary. When a volume
 // is marked as temporary it means that it should be cleaned up at some point.
 // It's up to the caller to clean up the temporary volumes by calling
@@ -577,6 +577,97 @@ func TestDefaultManager_CreateTemporary(t *testing.T) {
 	}
 }
 
+func TestDefaultManager_CreateShared(t *testing.T) {
+	existingBinding := "/host:/duplicated"
+
+	testCases := map[string]struct {
+		cacheDir    string
+		destination string
+
+		expectedVolumeName string
+		expectedBindings   []string
+		expectedError      error
+	}{
+		"volume based": {
+			destination:        "/git-reference-cache",
+			expectedVolumeName: "runner-shared",
+			expectedBindings: []string{
+				existingBinding,
+				"runner-shared:/git-reference-cache",
+			},
+		},
+		"host based": {
+			cacheDir:    "/cache",
+			destination: "/git-reference-cache",
+			expectedBindings: []string{
+				existingBinding,
+				"/cache/runner-shared:/git-reference-cache",
+			},
+		},
+		"volume root": {
+			destination:   "/",
+			expectedError: errDirectoryIsRootPath,
+		},
+		"duplicated volume definition": {
+			destination:   "/duplicated",
+			expectedError: &ErrVolumeAlreadyDefined{},
+		},
+	}
+
+	for testName, testCase := range testCases {
+		t.Run(testName, func(t *testing.T) {
+			config := ManagerConfig{
+				CacheDir:   testCase.cacheDir,
+				BasePath:   "/builds/project",
+				UniqueName: "unique",
+			}
+
+			m := newDefaultManager(config)
+			volumeParser := addParser(m)
+			mClient := new(docker.MockClient)
+			m.client = mClient
+
+			defer func() {
+				mClient.AssertExpectations(t)
+				volumeParser.AssertExpectations(t)
+			}()
+
+			volumeParser.On("ParseVolume", existingBinding).
+				Return(&parser.Volume{Source: "/host", Destination: "/duplicated"}, nil).
+				Once()
+
+			if testCase.expectedVolumeName != "" {
+				mClient.On(
+					"VolumeCreate",
+					mock.Anything,
+					volume.VolumeCreateBody{Name: testCase.expectedVolumeName},
+				).
+					Return(types.Volume{Name: testCase.expectedVolumeName}, nil).
+					Once()
+			}
+
+			err := m.Create(context.Background(), existingBinding)
+			require.NoError(t, err)
+
+			err = m.CreateShared(context.Background(), "runner-shared", testCase.destination)
+			if testCase.expectedError != nil {
+				assert.True(
+					t,
+					errors.Is(err, testCase.expectedError),
+					"expected err %T, but got %T",
+					testCase.expectedError,
+					err,
+				)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Empty(t, m.temporaryVolumes)
+			assert.Equal(t, testCase.expectedBindings, m.Binds())
+		})
+	}
+}
+
 func TestDefaultManager_RemoveTemporary(t *testing.T) {
 	testErr := errors.New("test-err")
 	testCases := map[string]struct {
@@ -43,6 +43,20 @@ func (_m *MockManager) Create(ctx context.Context, volume string) error {
 	return r0
 }
 
+// CreateShared provides a mock function with given fields: ctx, name, destination
+func (_m *MockManager) CreateShared(ctx context.Context, name string, destination string) error {
+	ret := _m.Called(ctx, name, destination)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) error); ok {
+		r0 = rf(ctx, name, destination)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // CreateTemporary provides a mock function with given fields: ctx, destination
 func (_m *MockManager) CreateTemporary(ctx context.Context, destination string) error {
 	ret := _m.Called(ctx, destination)
@@ -0,0 +1,154 @@
+package warmer
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+const (
+	imageWarm = "warm"
+	imageCold = "cold"
+
+	pullSucceeded = "success"
+	pullFailed    = "failure"
+)
+
+type metrics struct {
+	jobImages *prometheus.CounterVec
+	pulls     *prometheus.CounterVec
+}
+
+// DefaultPool is the pool shared by all the Docker executors of the process
+var DefaultPool = NewPool()
+
+// Pool manages one Warmer per runner and Docker host
+type Pool struct {
+	lock    sync.Mutex
+	warmers map[string]*Warmer
+	recent  map[string]*recentImages
+
+	newClient     func(credentials docker.Credentials) (docker.Client, error)
+	checkInterval time.Duration
+
+	metrics *metrics
+}
+
+func NewPool() *Pool {
+	return &Pool{
+		warmers: make(map[string]*Warmer),
+		recent:  make(map[string]*recentImages),
+		newClient: func(credentials docker.Credentials) (docker.Client, error) {
+			return docker.New(credentials, "")
+		},
+		checkInterval: defaultCheckInterval,
+		metrics: &metrics{
+			jobImages: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: "gitlab_runner_docker_image_warmer_job_images_total",
+					Help: "Total number of images needed by jobs, by whether they were already present " +
+						"on the Docker host (warm) or had to be pulled (cold).",
+				},
+				[]string{"type"},
+			),
+			pulls: prometheus.NewCounterVec(
+				prometheus.CounterOpts{
+					Name: "gitlab_runner_docker_image_warmer_pulls_total",
+					Help: "Total number of images pre-pulled by the image warmer, by result.",
+				},
+				[]string{"result"},
+			),
+		},
+	}
+}
+
+func warmerKey(config *common.RunnerConfig) string {
+	return config.ShortDescription() + "|" + config.Docker.Host
+}
+
+// Start makes sure that the images of the runner are kept warm on the Docker
+// host of the configuration and returns the Warmer of the host. It returns nil
+// when the image warmer is not configured.
+func (p *Pool) Start(config *common.RunnerConfig) *Warmer {
+	if config == nil || config.Docker == nil {
+		return nil
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	key := warmerKey(config)
+	w := p.warmers[key]
+
+	if !config.Docker.ImageWarmer.IsEnabled() {
+		if w != nil {
+			delete(p.warmers, key)
+			go w.stop()
+		}
+		return nil
+	}
+
+	if w != nil {
+		w.updateConfig(config.Docker.ImageWarmer)
+		return w
+	}
+
+	recent := p.recent[config.ShortDescription()]
+	if recent == nil {
+		recent = new(recentImages)
+		p.recent[config.ShortDescription()] = recent
+	}
+
+	w = &Warmer{
+		config:      config.Docker.ImageWarmer,
+		credentials: config.Docker.Credentials,
+		recent:      recent,
+		metrics:     p.metrics,
+		logger: logrus.WithFields(logrus.Fields{
+			"runner":      config.ShortDescription(),
+			"docker_host": config.Docker.Host,
+		}),
+		newClient:     p.newClient,
+		checkInterval: p.checkInterval,
+		pulled:        make(map[string]time.Time),
+	}
+	w.start()
+
+	p.warmers[key] = w
+
+	return w
+}
+
+// Stop stops the Warmer of the Docker host of the configuration, for example
+// when the host is removed
+func (p *Pool) Stop(config *common.RunnerConfig) {
+	if config == nil || config.Docker == nil {
+		return
+	}
+
+	p.lock.Lock()
+	w, ok := p.warmers[warmerKey(config)]
+	delete(p.warmers, warmerKey(config))
+	p.lock.Unlock()
+
+	if ok {
+		w.stop()
+	}
+}
+
+// Describe implements prometheus.Collector.
+func (p *Pool) Describe(ch chan<- *prometheus.Desc) {
+	p.metrics.jobImages.Describe(ch)
+	p.metrics.pulls.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (p *Pool) Collect(ch chan<- prometheus.Metric) {
+	p.metrics.jobImages.Collect(ch)
+	p.metrics.pulls.Collect(ch)
+}
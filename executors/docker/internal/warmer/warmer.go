@@ -0,0 +1,261 @@
+package warmer
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker/auth"
+)
+
+const (
+	defaultCheckInterval = 10 * time.Second
+	pullTimeout          = time.Hour
+)
+
+// Warmer pre-pulls the images of a runner on a single Docker host. The images
+// are pulled only while no job of the runner is running on the host, so that
+// warming up never competes with the jobs for bandwidth.
+type Warmer struct {
+	lock sync.Mutex
+
+	config      common.DockerImageWarmer
+	credentials docker.Credentials
+	recent      *recentImages
+	metrics     *metrics
+	logger      logrus.FieldLogger
+
+	newClient     func(credentials docker.Credentials) (docker.Client, error)
+	checkInterval time.Duration
+
+	runningJobs int
+	pulled      map[string]time.Time
+
+	ctx    context.Context
+	cancel func()
+	done   chan struct{}
+}
+
+func (w *Warmer) start() {
+	w.ctx, w.cancel = context.WithCancel(context.Background())
+	w.done = make(chan struct{})
+
+	go w.run()
+}
+
+func (w *Warmer) stop() {
+	w.cancel()
+	<-w.done
+}
+
+func (w *Warmer) updateConfig(config common.DockerImageWarmer) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.config = config
+}
+
+func (w *Warmer) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.checkInterval)
+	defer ticker.Stop()
+
+	for {
+		w.warm()
+
+		select {
+		case <-w.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Warmer) warm() {
+	images := w.imagesToRefresh()
+	if len(images) < 1 {
+		return
+	}
+
+	client, err := w.newClient(w.credentials)
+	if err != nil {
+		w.logger.WithError(err).Warningln("Failed to connect to Docker to pre-pull images")
+		return
+	}
+	defer func() { _ = client.Close() }()
+
+	for _, image := range images {
+		if !w.isIdle() || w.ctx.Err() != nil {
+			return
+		}
+
+		w.pull(client, image)
+	}
+}
+
+func (w *Warmer) imagesToRefresh() []string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.runningJobs > 0 {
+		return nil
+	}
+
+	images := append([]string{}, w.config.Images...)
+	images = append(images, w.recent.list(w.config.RecentImages)...)
+
+	refreshInterval := w.config.GetRefreshInterval()
+
+	var toRefresh []string
+	seen := make(map[string]bool)
+	for _, image := range images {
+		if seen[image] {
+			continue
+		}
+		seen[image] = true
+
+		if time.Since(w.pulled[image]) >= refreshInterval {
+			toRefresh = append(toRefresh, image)
+		}
+	}
+
+	return toRefresh
+}
+
+func (w *Warmer) pull(client docker.Client, image string) {
+	logger := w.logger.WithField("image", image)
+	logger.Debugln("Pre-pulling image...")
+
+	ref := image
+	// Add :latest to limit the download results
+	if !strings.ContainsAny(ref, ":@") {
+		ref += ":latest"
+	}
+
+	options := types.ImagePullOptions{}
+	registryInfo := auth.ResolveConfigForImage(image, "", "", nil)
+	if registryInfo != nil {
+		options.RegistryAuth, _ = auth.EncodeConfig(&registryInfo.AuthConfig)
+	}
+
+	ctx, cancel := context.WithTimeout(w.ctx, pullTimeout)
+	defer cancel()
+
+	started := time.Now()
+	err := client.ImagePullBlocking(ctx, ref, options)
+	if err != nil {
+		logger.WithError(err).Warningln("Failed to pre-pull image")
+		w.metrics.pulls.WithLabelValues(pullFailed).Inc()
+		return
+	}
+
+	logger.WithField("duration", time.Since(started)).Infoln("Image pre-pulled")
+	w.metrics.pulls.WithLabelValues(pullSucceeded).Inc()
+
+	w.lock.Lock()
+	w.pulled[image] = time.Now()
+	w.lock.Unlock()
+}
+
+func (w *Warmer) isIdle() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.runningJobs < 1
+}
+
+// JobStarted pauses the pre-pulling until the job is finished
+func (w *Warmer) JobStarted() {
+	if w == nil {
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.runningJobs++
+}
+
+// JobFinished resumes the pre-pulling when no other job is running
+func (w *Warmer) JobFinished() {
+	if w == nil {
+		return
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.runningJobs > 0 {
+		w.runningJobs--
+	}
+}
+
+// MarkImageAsUsed records an image used by a job, so that it's kept warm on
+// all the Docker hosts of the runner
+func (w *Warmer) MarkImageAsUsed(imageName string) {
+	if w == nil {
+		return
+	}
+
+	w.recent.add(imageName)
+}
+
+// ObserveImage records whether an image needed by a job was already present
+// on the Docker host or had to be pulled
+func (w *Warmer) ObserveImage(present bool) {
+	if w == nil {
+		return
+	}
+
+	if present {
+		w.metrics.jobImages.WithLabelValues(imageWarm).Inc()
+		return
+	}
+
+	w.metrics.jobImages.WithLabelValues(imageCold).Inc()
+}
+
+// recentImages keeps the most recently used images first
+type recentImages struct {
+	lock   sync.Mutex
+	images []string
+}
+
+// maxRecentImages bounds the memory used when the recent_images setting is
+// lowered or the configuration is reloaded
+const maxRecentImages = 100
+
+func (r *recentImages) add(imageName string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	images := []string{imageName}
+	for _, image := range r.images {
+		if image != imageName && len(images) < maxRecentImages {
+			images = append(images, image)
+		}
+	}
+
+	r.images = images
+}
+
+func (r *recentImages) list(limit int) []string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if limit > len(r.images) {
+		limit = len(r.images)
+	}
+	if limit < 1 {
+		return nil
+	}
+
+	return append([]string{}, r.images[:limit]...)
+}
@@ -0,0 +1,204 @@
+package warmer
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func newTestPool(c *docker.MockClient) *Pool {
+	p := NewPool()
+	p.checkInterval = 10 * time.Millisecond
+	p.newClient = func(credentials docker.Credentials) (docker.Client, error) {
+		return c, nil
+	}
+
+	return p
+}
+
+func newTestConfig(host string, warmerConfig common.DockerImageWarmer) *common.RunnerConfig {
+	return &common.RunnerConfig{
+		RunnerCredentials: common.RunnerCredentials{Token: "abcdef1234567890"},
+		RunnerSettings: common.RunnerSettings{
+			Docker: &common.DockerConfig{
+				Credentials: docker.Credentials{Host: host},
+				ImageWarmer: warmerConfig,
+			},
+		},
+	}
+}
+
+func TestStartWithoutImageWarmer(t *testing.T) {
+	p := NewPool()
+
+	assert.Nil(t, p.Start(&common.RunnerConfig{}))
+	assert.Nil(t, p.Start(newTestConfig("", common.DockerImageWarmer{})))
+
+	var w *Warmer
+	assert.NotPanics(t, func() {
+		w.JobStarted()
+		w.JobFinished()
+		w.MarkImageAsUsed("alpine")
+		w.ObserveImage(true)
+	})
+}
+
+func TestWarmerPullsConfiguredAndRecentImages(t *testing.T) {
+	c := new(docker.MockClient)
+	defer c.AssertExpectations(t)
+
+	pulled := make(chan string, 10)
+	c.On("ImagePullBlocking", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			pulled <- args.String(1)
+		}).
+		Return(nil)
+	c.On("Close").Return(nil)
+
+	p := newTestPool(c)
+	config := newTestConfig("tcp://host-1:2376", common.DockerImageWarmer{
+		Images:       []string{"registry.example.com/toolchain:1.0"},
+		RecentImages: 1,
+	})
+
+	w := p.Start(config)
+	require.NotNil(t, w)
+	defer p.Stop(config)
+
+	assert.Equal(t, "registry.example.com/toolchain:1.0", waitForPull(t, pulled))
+
+	w.MarkImageAsUsed("alpine")
+	assert.Equal(t, "alpine:latest", waitForPull(t, pulled))
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(p.metrics.pulls.WithLabelValues(pullSucceeded)))
+}
+
+func TestWarmerSharesRecentImagesBetweenHosts(t *testing.T) {
+	c := new(docker.MockClient)
+	defer c.AssertExpectations(t)
+
+	pulled := make(chan string, 10)
+	c.On("ImagePullBlocking", mock.Anything, mock.Anything, mock.Anything).
+		Run(func(args mock.Arguments) {
+			pulled <- args.String(1)
+		}).
+		Return(nil)
+	c.On("Close").Return(nil)
+
+	p := newTestPool(c)
+	warmerConfig := common.DockerImageWarmer{RecentImages: 5}
+
+	config1 := newTestConfig("tcp://host-1:2376", warmerConfig)
+	w1 := p.Start(config1)
+	defer p.Stop(config1)
+
+	w1.JobStarted()
+	w1.MarkImageAsUsed("ruby:2.7")
+	w1.JobFinished()
+	assert.Equal(t, "ruby:2.7", waitForPull(t, pulled))
+
+	config2 := newTestConfig("tcp://host-2:2376", warmerConfig)
+	p.Start(config2)
+	defer p.Stop(config2)
+
+	assert.Equal(t, "ruby:2.7", waitForPull(t, pulled))
+}
+
+func TestWarmerDoesNotPullWhileJobIsRunning(t *testing.T) {
+	c := new(docker.MockClient)
+	defer c.AssertExpectations(t)
+
+	p := newTestPool(c)
+	config := newTestConfig("", common.DockerImageWarmer{Images: []string{"alpine"}})
+
+	w := p.Start(config)
+	w.JobStarted()
+
+	time.Sleep(50 * time.Millisecond)
+	p.Stop(config)
+}
+
+func TestWarmerPullFailure(t *testing.T) {
+	c := new(docker.MockClient)
+	defer c.AssertExpectations(t)
+
+	pulled := make(chan string, 10)
+	c.On("ImagePullBlocking", mock.Anything, "alpine:latest", mock.Anything).
+		Run(func(args mock.Arguments) {
+			pulled <- args.String(1)
+		}).
+		Return(errors.New("pull failed"))
+	c.On("Close").Return(nil)
+
+	p := newTestPool(c)
+	config := newTestConfig("", common.DockerImageWarmer{Images: []string{"alpine"}})
+
+	p.Start(config)
+	waitForPull(t, pulled)
+	p.Stop(config)
+
+	assert.True(t, testutil.ToFloat64(p.metrics.pulls.WithLabelValues(pullFailed)) >= 1)
+}
+
+func TestWarmerIsStoppedWhenDisabled(t *testing.T) {
+	c := new(docker.MockClient)
+	defer c.AssertExpectations(t)
+
+	p := newTestPool(c)
+	p.checkInterval = time.Hour
+
+	config := newTestConfig("", common.DockerImageWarmer{RecentImages: 1})
+	require.NotNil(t, p.Start(config))
+	assert.Len(t, p.warmers, 1)
+
+	config.Docker.ImageWarmer = common.DockerImageWarmer{}
+	assert.Nil(t, p.Start(config))
+	assert.Empty(t, p.warmers)
+}
+
+func TestObserveImage(t *testing.T) {
+	p := NewPool()
+	config := newTestConfig("", common.DockerImageWarmer{RecentImages: 1})
+	p.checkInterval = time.Hour
+
+	w := p.Start(config)
+	defer p.Stop(config)
+
+	w.ObserveImage(true)
+	w.ObserveImage(true)
+	w.ObserveImage(false)
+
+	assert.Equal(t, float64(2), testutil.ToFloat64(p.metrics.jobImages.WithLabelValues(imageWarm)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(p.metrics.jobImages.WithLabelValues(imageCold)))
+}
+
+func TestRecentImages(t *testing.T) {
+	r := new(recentImages)
+	r.add("alpine")
+	r.add("ruby")
+	r.add("alpine")
+	r.add("golang")
+
+	assert.Equal(t, []string{"golang", "alpine"}, r.list(2))
+	assert.Equal(t, []string{"golang", "alpine", "ruby"}, r.list(10))
+	assert.Nil(t, r.list(0))
+}
+
+func waitForPull(t *testing.T, pulled chan string) string {
+	select {
+	case image := <-pulled:
+		return image
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "image wasn't pulled")
+	}
+
+	return ""
+}
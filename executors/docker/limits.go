@@ -0,0 +1,157 @@
+package docker
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types/blkiodev"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// processAndIOLimits holds the process and block IO limits applied to
+// a single container, in the format used by config.toml
+type processAndIOLimits struct {
+	ulimits         []string
+	pidsLimit       int64
+	blkioWeight     uint16
+	deviceReadBps   []string
+	deviceWriteBps  []string
+	deviceReadIOps  []string
+	deviceWriteIOps []string
+}
+
+func buildContainerLimits(c *common.DockerConfig) processAndIOLimits {
+	return processAndIOLimits{
+		ulimits:         c.Ulimits,
+		pidsLimit:       c.PidsLimit,
+		blkioWeight:     c.BlkioWeight,
+		deviceReadBps:   c.DeviceReadBps,
+		deviceWriteBps:  c.DeviceWriteBps,
+		deviceReadIOps:  c.DeviceReadIOps,
+		deviceWriteIOps: c.DeviceWriteIOps,
+	}
+}
+
+// serviceContainerLimits returns the limits for service containers. Every
+// setting that has no services_ specific value falls back to the one
+// defined for the build container.
+func serviceContainerLimits(c *common.DockerConfig) processAndIOLimits {
+	limits := buildContainerLimits(c)
+
+	if len(c.ServicesUlimits) > 0 {
+		limits.ulimits = c.ServicesUlimits
+	}
+	if c.ServicesPidsLimit != 0 {
+		limits.pidsLimit = c.ServicesPidsLimit
+	}
+	if c.ServicesBlkioWeight != 0 {
+		limits.blkioWeight = c.ServicesBlkioWeight
+	}
+	if len(c.ServicesDeviceReadBps) > 0 {
+		limits.deviceReadBps = c.ServicesDeviceReadBps
+	}
+	if len(c.ServicesDeviceWriteBps) > 0 {
+		limits.deviceWriteBps = c.ServicesDeviceWriteBps
+	}
+	if len(c.ServicesDeviceReadIOps) > 0 {
+		limits.deviceReadIOps = c.ServicesDeviceReadIOps
+	}
+	if len(c.ServicesDeviceWriteIOps) > 0 {
+		limits.deviceWriteIOps = c.ServicesDeviceWriteIOps
+	}
+
+	return limits
+}
+
+func (l processAndIOLimits) apply(resources *container.Resources) error {
+	var err error
+
+	resources.Ulimits, err = parseUlimits(l.ulimits)
+	if err != nil {
+		return err
+	}
+
+	resources.PidsLimit = l.pidsLimit
+	resources.BlkioWeight = l.blkioWeight
+
+	throttleDevices := []struct {
+		name   string
+		values []string
+		parse  func(string) (uint64, error)
+		target *[]*blkiodev.ThrottleDevice
+	}{
+		{name: "device_read_bps", values: l.deviceReadBps, parse: parseBytesRate, target: &resources.BlkioDeviceReadBps},
+		{name: "device_write_bps", values: l.deviceWriteBps, parse: parseBytesRate, target: &resources.BlkioDeviceWriteBps},
+		{name: "device_read_iops", values: l.deviceReadIOps, parse: parseIORate, target: &resources.BlkioDeviceReadIOps},
+		{name: "device_write_iops", values: l.deviceWriteIOps, parse: parseIORate, target: &resources.BlkioDeviceWriteIOps},
+	}
+
+	for _, td := range throttleDevices {
+		*td.target, err = parseThrottleDevices(td.values, td.parse)
+		if err != nil {
+			return fmt.Errorf("parsing %s: %w", td.name, err)
+		}
+	}
+
+	return nil
+}
+
+func parseUlimits(values []string) ([]*units.Ulimit, error) {
+	var ulimits []*units.Ulimit
+
+	for _, value := range values {
+		ulimit, err := units.ParseUlimit(value)
+		if err != nil {
+			return nil, fmt.Errorf("parsing ulimit %q: %w", value, err)
+		}
+
+		ulimits = append(ulimits, ulimit)
+	}
+
+	return ulimits, nil
+}
+
+// parseThrottleDevices parses the values in the <device-path>:<rate> format
+func parseThrottleDevices(values []string, parseRate func(string) (uint64, error)) ([]*blkiodev.ThrottleDevice, error) {
+	var devices []*blkiodev.ThrottleDevice
+
+	for _, value := range values {
+		sep := strings.LastIndex(value, ":")
+		if sep < 1 {
+			return nil, fmt.Errorf("invalid device limit %q, expected <device-path>:<rate>", value)
+		}
+
+		rate, err := parseRate(value[sep+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate for device %q: %w", value[:sep], err)
+		}
+
+		devices = append(devices, &blkiodev.ThrottleDevice{
+			Path: value[:sep],
+			Rate: rate,
+		})
+	}
+
+	return devices, nil
+}
+
+func parseBytesRate(value string) (uint64, error) {
+	rate, err := units.RAMInBytes(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if rate < 0 {
+		return 0, fmt.Errorf("negative rate %q", value)
+	}
+
+	return uint64(rate), nil
+}
+
+func parseIORate(value string) (uint64, error) {
+	return strconv.ParseUint(value, 10, 64)
+}
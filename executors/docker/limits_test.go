@@ -0,0 +1,45 @@
+package docker
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProcessAndIOLimitsApplyErrors(t *testing.T) {
+	tests := map[string]struct {
+		limits        processAndIOLimits
+		expectedError string
+	}{
+		"invalid ulimit": {
+			limits:        processAndIOLimits{ulimits: []string{"nofile"}},
+			expectedError: `parsing ulimit "nofile"`,
+		},
+		"device without rate": {
+			limits:        processAndIOLimits{deviceReadBps: []string{"/dev/sda"}},
+			expectedError: "parsing device_read_bps: invalid device limit",
+		},
+		"invalid bytes rate": {
+			limits:        processAndIOLimits{deviceWriteBps: []string{"/dev/sda:fast"}},
+			expectedError: `parsing device_write_bps: invalid rate for device "/dev/sda"`,
+		},
+		"invalid IO rate": {
+			limits:        processAndIOLimits{deviceReadIOps: []string{"/dev/sda:1mb"}},
+			expectedError: `parsing device_read_iops: invalid rate for device "/dev/sda"`,
+		},
+		"negative IO rate": {
+			limits:        processAndIOLimits{deviceWriteIOps: []string{"/dev/sda:-1"}},
+			expectedError: `parsing device_write_iops: invalid rate for device "/dev/sda"`,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			err := tt.limits.apply(&container.Resources{})
+			if assert.Error(t, err) {
+				assert.Contains(t, err.Error(), tt.expectedError)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package machine
+
+import (
+	"errors"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/autoscaler"
+)
+
+var errMissingInstanceProvider = errors.New("missing instance provider plugin")
+
+// autoscalerProvider autoscales the machines like the docker+machine executor,
+// but manages them with instance provider plugins instead of docker-machine
+type autoscalerProvider struct {
+	*machineProvider
+
+	instances *autoscaler.Machine
+}
+
+func (a *autoscalerProvider) Acquire(config *common.RunnerConfig) (common.ExecutorData, error) {
+	if config.Machine == nil || config.Machine.InstanceProvider == "" {
+		return nil, errMissingInstanceProvider
+	}
+
+	// The plugin needs to be known before the machines are listed
+	a.instances.Register(config.Machine.InstanceProvider)
+
+	return a.machineProvider.Acquire(config)
+}
+
+func newAutoscalerProvider(name, executor string) *autoscalerProvider {
+	instances := autoscaler.NewMachine()
+
+	provider := newMachineProvider(name, executor)
+	provider.machine = instances
+	provider.driver = func(config *common.DockerMachine) string {
+		return config.InstanceProvider
+	}
+
+	return &autoscalerProvider{
+		machineProvider: provider,
+		instances:       instances,
+	}
+}
@@ -0,0 +1,63 @@
+package machine
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/autoscaler"
+)
+
+func TestAutoscalerProviderIsRegistered(t *testing.T) {
+	provider := common.GetExecutorProvider("docker+autoscaler")
+	require.NotNil(t, provider)
+
+	_, ok := provider.(*autoscalerProvider)
+	assert.True(t, ok)
+}
+
+func TestAutoscalerProviderRequiresInstanceProvider(t *testing.T) {
+	p := newAutoscalerProvider("docker+autoscaler", "docker")
+
+	_, err := p.Acquire(&common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Machine: &common.DockerMachine{MachineName: "%s"},
+		},
+	})
+	assert.Equal(t, errMissingInstanceProvider, err)
+}
+
+func TestAutoscalerProviderUsesInstanceProviderAsDriver(t *testing.T) {
+	p := newAutoscalerProvider("docker+autoscaler", "docker")
+
+	_, ok := p.machine.(*autoscaler.Machine)
+	assert.True(t, ok, "machines are managed by instance provider plugins")
+
+	driver := p.driver(&common.DockerMachine{
+		MachineDriver:    "google",
+		InstanceProvider: "/usr/local/bin/fleeting-plugin",
+	})
+	assert.Equal(t, "/usr/local/bin/fleeting-plugin", driver)
+}
+
+func TestAutoscalerProviderAcquire(t *testing.T) {
+	p := newAutoscalerProvider("docker+autoscaler", "docker")
+
+	machines := &testMachine{
+		Created: make(chan bool, 10),
+		Removed: make(chan bool, 10),
+		Stopped: make(chan bool, 10),
+	}
+	p.machine = machines
+
+	config := createMachineConfig(t, 1, 5)
+	config.Machine.InstanceProvider = "/usr/local/bin/fleeting-plugin"
+
+	_, err := p.Acquire(config)
+	assert.Error(t, err, "no free machines yet")
+
+	<-machines.Created
+	assertIdleMachines(t, p.machineProvider, 1, "it should have one idle machine")
+}
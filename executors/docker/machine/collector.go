@@ -20,6 +20,9 @@ func (m *machineProvider) collectDetails() (data machinesData) {
 func (m *machineProvider) Describe(ch chan<- *prometheus.Desc) {
 	m.totalActions.Describe(ch)
 	m.creationHistogram.Describe(ch)
+	m.quarantinedMachines.Describe(ch)
+	m.idleTarget.Describe(ch)
+	m.jobArrivalRate.Describe(ch)
 	ch <- m.currentStatesDesc
 }
 
@@ -65,4 +68,7 @@ func (m *machineProvider) Collect(ch chan<- prometheus.Metric) {
 
 	m.totalActions.Collect(ch)
 	m.creationHistogram.Collect(ch)
+	m.quarantinedMachines.Collect(ch)
+	m.idleTarget.Collect(ch)
+	m.jobArrivalRate.Collect(ch)
 }
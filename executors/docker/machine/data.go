@@ -16,6 +16,12 @@ type machinesData struct {
 	Used            int
 	Removing        int
 	StuckOnRemoving int
+
+	// IdleTarget is the number of idle machines the provider is scaling to
+	IdleTarget int
+	// JobArrivalRate is the number of jobs per second started in the
+	// predictive idle window
+	JobArrivalRate float64
 }
 
 func (d *machinesData) Available() int {
@@ -57,6 +63,9 @@ func (d *machinesData) Fields() logrus.Fields {
 		"total":    d.Total(),
 		"creating": d.Creating,
 		"removing": d.Removing,
+
+		"idleTarget":     d.IdleTarget,
+		"jobArrivalRate": d.JobArrivalRate,
 	}
 }
 
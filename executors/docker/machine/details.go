@@ -7,6 +7,7 @@ import (
 
 	"github.com/sirupsen/logrus"
 
+	"gitlab.com/gitlab-org/gitlab-runner/common"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers"
 )
 
@@ -19,6 +20,16 @@ type machineDetails struct {
 	Reason     string
 	RetryCount int
 	LastSeen   time.Time
+
+	HealthCheckFailures int
+	LastHealthCheck     time.Time `yaml:"-"`
+	SystemFailures      int
+
+	healthCheckRunning bool
+
+	// imageWarmerConfig is the configuration with which the image warmer
+	// of the machine was started
+	imageWarmerConfig *common.RunnerConfig
 }
 
 func (m *machineDetails) isPersistedOnDisk() bool {
@@ -0,0 +1,172 @@
+package machine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/go-units"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const (
+	quarantineReasonHealthCheck    = "health_check"
+	quarantineReasonSystemFailures = "system_failures"
+)
+
+var healthCheckTimeout = 30 * time.Second
+
+// scheduleHealthCheck starts a health check of the idle machine when the
+// previous one is older than the configured interval
+func (m *machineProvider) scheduleHealthCheck(config *common.RunnerConfig, details *machineDetails) {
+	interval := config.Machine.GetHealthCheckInterval()
+	if interval <= 0 {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if details.State != machineStateIdle || details.healthCheckRunning {
+		return
+	}
+
+	if time.Since(details.LastHealthCheck) < interval {
+		return
+	}
+
+	details.healthCheckRunning = true
+	go m.checkHealth(config, details)
+}
+
+func (m *machineProvider) checkHealth(config *common.RunnerConfig, details *machineDetails) {
+	err := m.probeMachine(config, details.Name)
+
+	m.lock.Lock()
+	details.healthCheckRunning = false
+	details.LastHealthCheck = time.Now()
+	if err == nil {
+		details.HealthCheckFailures = 0
+		m.lock.Unlock()
+		return
+	}
+
+	details.HealthCheckFailures++
+	failures := details.HealthCheckFailures
+	m.lock.Unlock()
+
+	details.logger().
+		WithError(err).
+		WithField("failures", failures).
+		Warningln("Machine health check failed")
+
+	// Machines that were acquired in the meantime are checked again when
+	// they become idle
+	if failures >= config.Machine.GetMaxHealthCheckFailures() {
+		message := fmt.Sprintf("failed %d health checks: %v", failures, err)
+		m.quarantine(details, quarantineReasonHealthCheck, message, m.removeIfIdle)
+	}
+}
+
+// probeMachine pings the Docker daemon of the machine and checks how much
+// disk space is used by Docker on it
+func (m *machineProvider) probeMachine(config *common.RunnerConfig, name string) error {
+	dc, err := m.machine.Credentials(name)
+	if err != nil {
+		return fmt.Errorf("getting credentials: %w", err)
+	}
+
+	client, err := m.newDockerClient(dc)
+	if err != nil {
+		return fmt.Errorf("connecting to Docker: %w", err)
+	}
+	defer func() { _ = client.Close() }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+
+	_, err = client.Info(ctx)
+	if err != nil {
+		return fmt.Errorf("pinging Docker: %w", err)
+	}
+
+	if config.Machine.HealthCheckMaxDiskUsage == "" {
+		return nil
+	}
+
+	maxDiskUsage, err := units.FromHumanSize(config.Machine.HealthCheckMaxDiskUsage)
+	if err != nil {
+		return fmt.Errorf("parsing HealthCheckMaxDiskUsage: %w", err)
+	}
+
+	usage, err := client.DiskUsage(ctx)
+	if err != nil {
+		return fmt.Errorf("getting disk usage: %w", err)
+	}
+
+	used := diskUsage(usage)
+	if used > maxDiskUsage {
+		return fmt.Errorf("disk usage %s is over %s", units.HumanSize(float64(used)), config.Machine.HealthCheckMaxDiskUsage)
+	}
+
+	return nil
+}
+
+func diskUsage(usage types.DiskUsage) int64 {
+	used := usage.LayersSize
+
+	for _, container := range usage.Containers {
+		if container != nil {
+			used += container.SizeRw
+		}
+	}
+
+	for _, volume := range usage.Volumes {
+		if volume != nil && volume.UsageData != nil && volume.UsageData.Size > 0 {
+			used += volume.UsageData.Size
+		}
+	}
+
+	return used
+}
+
+// recordJobResult counts the consecutive jobs that failed with a system failure
+// on the machine
+func (m *machineProvider) recordJobResult(details *machineDetails, err error) {
+	var buildErr *common.BuildError
+	systemFailure := err != nil && !errors.As(err, &buildErr)
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if systemFailure {
+		details.SystemFailures++
+		return
+	}
+
+	details.SystemFailures = 0
+}
+
+// quarantine stops using the machine and removes it with the given remove
+// function
+func (m *machineProvider) quarantine(
+	details *machineDetails,
+	reason string,
+	message string,
+	remove func(machineName string, reason ...interface{}) error,
+) bool {
+	err := remove(details.Name, "Quarantined: ", message)
+	if err != nil {
+		return false
+	}
+
+	details.logger().
+		WithField("reason", reason).
+		Warningln("Machine quarantined:", message)
+	m.quarantinedMachines.WithLabelValues(reason).Inc()
+
+	return true
+}
@@ -0,0 +1,177 @@
+package machine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+func createHealthCheckConfig(t *testing.T) *common.RunnerConfig {
+	config := createMachineConfig(t, 1, 5)
+	config.Machine.HealthCheckInterval = 60
+	config.Machine.MaxHealthCheckFailures = 2
+
+	return config
+}
+
+func testHealthCheckProvider(t *testing.T, c *docker.MockClient) (*machineProvider, *machineDetails) {
+	p, _ := testMachineProvider("machine1")
+	p.newDockerClient = func(credentials docker.Credentials) (docker.Client, error) {
+		return c, nil
+	}
+
+	details := p.machineDetails("machine1", false)
+	require.Equal(t, machineStateIdle, details.State)
+
+	return p, details
+}
+
+func TestMachineHealthCheckQuarantinesUnhealthyMachine(t *testing.T) {
+	c := new(docker.MockClient)
+	defer c.AssertExpectations(t)
+
+	c.On("Info", mock.Anything).Return(types.Info{}, errors.New("connection refused")).Twice()
+	c.On("Close").Return(nil).Twice()
+
+	p, details := testHealthCheckProvider(t, c)
+	config := createHealthCheckConfig(t)
+
+	p.checkHealth(config, details)
+	assert.Equal(t, 1, details.HealthCheckFailures)
+	assert.Equal(t, machineStateIdle, details.State, "single failure doesn't quarantine the machine")
+
+	p.checkHealth(config, details)
+	assert.Equal(t, 2, details.HealthCheckFailures)
+	assert.Equal(t, machineStateRemoving, details.State)
+	assert.Contains(t, details.Reason, "Quarantined: failed 2 health checks")
+	assert.Equal(t, float64(1), testutil.ToFloat64(p.quarantinedMachines.WithLabelValues(quarantineReasonHealthCheck)))
+}
+
+func TestMachineHealthCheckKeepsAcquiredMachine(t *testing.T) {
+	p, details := testHealthCheckProvider(t, new(docker.MockClient))
+
+	// The machine is acquired by a job after its health check failed
+	details.State = machineStateAcquired
+
+	assert.False(t, p.quarantine(details, quarantineReasonHealthCheck, "failed 2 health checks", p.removeIfIdle))
+	assert.Equal(t, machineStateAcquired, details.State, "acquired machine isn't removed")
+	assert.Empty(t, details.Reason)
+	assert.Equal(t, float64(0), testutil.ToFloat64(p.quarantinedMachines.WithLabelValues(quarantineReasonHealthCheck)))
+}
+
+func TestMachineHealthCheckResetsFailures(t *testing.T) {
+	c := new(docker.MockClient)
+	defer c.AssertExpectations(t)
+
+	c.On("Info", mock.Anything).Return(types.Info{}, nil).Once()
+	c.On("Close").Return(nil).Once()
+
+	p, details := testHealthCheckProvider(t, c)
+	details.HealthCheckFailures = 1
+
+	p.checkHealth(createHealthCheckConfig(t), details)
+	assert.Equal(t, 0, details.HealthCheckFailures)
+	assert.False(t, details.LastHealthCheck.IsZero())
+	assert.Equal(t, machineStateIdle, details.State)
+}
+
+func TestMachineHealthCheckDiskUsage(t *testing.T) {
+	usage := types.DiskUsage{
+		LayersSize: 4 * 1000 * 1000 * 1000,
+		Containers: []*types.Container{{SizeRw: 500 * 1000 * 1000}},
+		Volumes:    []*types.Volume{{UsageData: &types.VolumeUsageData{Size: 1000 * 1000 * 1000}}},
+	}
+
+	tests := map[string]struct {
+		maxDiskUsage  string
+		expectedError string
+	}{
+		"under limit": {
+			maxDiskUsage: "10GB",
+		},
+		"over limit": {
+			maxDiskUsage:  "5GB",
+			expectedError: "disk usage 5.5 GB is over 5GB",
+		},
+		"invalid limit": {
+			maxDiskUsage:  "a lot",
+			expectedError: "parsing HealthCheckMaxDiskUsage",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			c := new(docker.MockClient)
+			defer c.AssertExpectations(t)
+
+			c.On("Info", mock.Anything).Return(types.Info{}, nil).Once()
+			c.On("DiskUsage", mock.Anything).Return(usage, nil).Maybe()
+			c.On("Close").Return(nil).Once()
+
+			p, _ := testHealthCheckProvider(t, c)
+			config := createHealthCheckConfig(t)
+			config.Machine.HealthCheckMaxDiskUsage = tt.maxDiskUsage
+
+			err := p.probeMachine(config, "machine1")
+			if tt.expectedError == "" {
+				assert.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.expectedError)
+		})
+	}
+}
+
+func TestMachineHealthCheckScheduling(t *testing.T) {
+	c := new(docker.MockClient)
+	p, details := testHealthCheckProvider(t, c)
+
+	config := createMachineConfig(t, 1, 5)
+	p.scheduleHealthCheck(config, details)
+	assert.False(t, details.healthCheckRunning, "health checks are disabled")
+
+	config = createHealthCheckConfig(t)
+	details.LastHealthCheck = time.Now()
+	p.scheduleHealthCheck(config, details)
+	assert.False(t, details.healthCheckRunning, "machine was checked recently")
+
+	details.LastHealthCheck = time.Time{}
+	details.State = machineStateUsed
+	p.scheduleHealthCheck(config, details)
+	assert.False(t, details.healthCheckRunning, "only idle machines are checked")
+}
+
+func TestMachineQuarantineAfterSystemFailures(t *testing.T) {
+	p, _ := testMachineProvider("machine1")
+	details := p.machineDetails("machine1", false)
+
+	config := createMachineConfig(t, 1, 5)
+	config.Machine.MaxSystemFailures = 2
+
+	p.recordJobResult(details, errors.New("system failure"))
+	p.recordJobResult(details, &common.BuildError{Inner: errors.New("script failure")})
+	assert.Equal(t, 0, details.SystemFailures, "script failures reset the counter")
+
+	p.recordJobResult(details, errors.New("system failure"))
+	details.State = machineStateUsed
+	p.Release(config, details)
+	assert.Equal(t, machineStateIdle, details.State)
+
+	p.recordJobResult(details, errors.New("system failure"))
+	details.State = machineStateUsed
+	p.Release(config, details)
+	assert.Equal(t, machineStateRemoving, details.State)
+	assert.Contains(t, details.Reason, "Quarantined: 2 consecutive jobs failed with a system failure")
+	assert.Equal(t, float64(1), testutil.ToFloat64(p.quarantinedMachines.WithLabelValues(quarantineReasonSystemFailures)))
+}
@@ -100,9 +100,28 @@ func (e *machineExecutor) Finish(err error) {
 	if e.executor != nil {
 		e.executor.Finish(err)
 	}
+
+	if details := e.usedMachine(); details != nil {
+		e.provider.recordJobResult(details, err)
+	}
+
 	e.log().Infoln("Finished docker-machine build:", err)
 }
 
+// usedMachine returns the details of the machine on which the job runs
+func (e *machineExecutor) usedMachine() *machineDetails {
+	if details, _ := e.data.(*machineDetails); details != nil {
+		return details
+	}
+
+	if e.build == nil {
+		return nil
+	}
+
+	details, _ := e.build.ExecutorData.(*machineDetails)
+	return details
+}
+
 func (e *machineExecutor) Cleanup() {
 	// Cleanup executor if were created
 	if e.executor != nil {
@@ -146,4 +165,5 @@ func (e *machineExecutor) GetMetricsSelector() string {
 func init() {
 	common.RegisterExecutorProvider("docker+machine", newMachineProvider("docker+machine", "docker"))
 	common.RegisterExecutorProvider("docker-ssh+machine", newMachineProvider("docker-ssh+machine", "docker-ssh"))
+	common.RegisterExecutorProvider("docker+autoscaler", newAutoscalerProvider("docker+autoscaler", "docker"))
 }
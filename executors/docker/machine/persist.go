@@ -0,0 +1,234 @@
+package machine
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// machinesStateVersion is the version of the state file format. It needs
+// to be increased on every incompatible change of the format
+const machinesStateVersion = 2
+
+// machinesState holds the machines of every runner sharing the state file,
+// keyed by the short description of the runner
+type machinesState struct {
+	Version int                           `json:"version"`
+	Runners map[string][]persistedMachine `json:"runners"`
+}
+
+type persistedMachine struct {
+	Name           string    `json:"name"`
+	Created        time.Time `json:"created"`
+	Used           time.Time `json:"used"`
+	UsedCount      int       `json:"used_count"`
+	SystemFailures int       `json:"system_failures,omitempty"`
+	Removing       bool      `json:"removing,omitempty"`
+	Reason         string    `json:"reason,omitempty"`
+}
+
+func loadMachinesState(path string) (*machinesState, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var state machinesState
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+
+	if state.Version != machinesStateVersion {
+		return nil, fmt.Errorf("unsupported version %d of %s", state.Version, path)
+	}
+
+	if state.Runners == nil {
+		state.Runners = make(map[string][]persistedMachine)
+	}
+
+	return &state, nil
+}
+
+// writeMachinesState replaces the state file atomically, so that the state
+// isn't lost when the runner is stopped during the write
+func writeMachinesState(path string, state *machinesState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	file, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+
+	_, err = file.Write(data)
+	if err != nil {
+		return err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		return err
+	}
+
+	err = file.Close()
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), path)
+}
+
+// saveState persists the details of the runner's machines. The state file can
+// be shared by several runners, so the machines of the other runners are read
+// and written back unchanged
+func (m *machineProvider) saveState(config *common.RunnerConfig) {
+	if config == nil || config.Machine == nil || config.Machine.StateFile == "" {
+		return
+	}
+
+	filter := machineFilter(config)
+	machines := []persistedMachine{}
+
+	m.lock.RLock()
+	for _, details := range m.details {
+		if !details.match(filter) {
+			continue
+		}
+
+		machines = append(machines, persistedMachine{
+			Name:           details.Name,
+			Created:        details.Created,
+			Used:           details.Used,
+			UsedCount:      details.UsedCount,
+			SystemFailures: details.SystemFailures,
+			Removing:       details.State == machineStateRemoving,
+			Reason:         details.Reason,
+		})
+	}
+	m.lock.RUnlock()
+
+	sort.Slice(machines, func(i, j int) bool {
+		return machines[i].Name < machines[j].Name
+	})
+
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	logger := logrus.WithField("runner", config.ShortDescription())
+
+	state, err := loadMachinesState(config.Machine.StateFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.WithError(err).Warningln("Failed to load state of machines, replacing it")
+		}
+
+		state = &machinesState{
+			Version: machinesStateVersion,
+			Runners: make(map[string][]persistedMachine),
+		}
+	}
+
+	state.Runners[config.ShortDescription()] = machines
+
+	err = writeMachinesState(config.Machine.StateFile, state)
+	if err != nil {
+		logger.WithError(err).Warningln("Failed to save state of machines")
+	}
+}
+
+// restoreState restores the details of the runner's machines after a restart.
+// The persisted machines are reconciled with the existing ones: machines that
+// no longer exist are forgotten and the unknown machines are removed. When the
+// file has no state of the runner, for example when it's shared with other
+// runners or the token changed, the existing machines are adopted as they are
+func (m *machineProvider) restoreState(config *common.RunnerConfig) {
+	path := config.Machine.StateFile
+	if path == "" {
+		return
+	}
+
+	m.stateLock.Lock()
+	defer m.stateLock.Unlock()
+
+	runner := config.ShortDescription()
+	if m.restoredState[runner] {
+		return
+	}
+
+	logger := logrus.WithField("runner", runner).WithField("path", path)
+
+	state, err := loadMachinesState(path)
+	if os.IsNotExist(err) {
+		m.restoredState[runner] = true
+		return
+	} else if err != nil {
+		m.restoredState[runner] = true
+		logger.WithError(err).Warningln("Failed to load state of machines")
+		return
+	}
+
+	machines, err := m.loadMachines(config)
+	if err != nil {
+		logger.WithError(err).Warningln("Failed to list machines to restore their state")
+		return
+	}
+	m.restoredState[runner] = true
+
+	runnerMachines, ok := state.Runners[runner]
+	if !ok {
+		for _, name := range machines {
+			m.machineDetails(name, false)
+		}
+
+		logger.WithField("machines", len(machines)).Infoln("No state of the runner found, adopted the existing machines")
+		return
+	}
+
+	persisted := make(map[string]persistedMachine, len(runnerMachines))
+	for _, machine := range runnerMachines {
+		persisted[machine.Name] = machine
+	}
+
+	for _, name := range machines {
+		machine, ok := persisted[name]
+		if !ok {
+			m.machineDetails(name, false)
+			_ = m.remove(name, "Unknown machine found at startup")
+			continue
+		}
+
+		m.restoreMachine(machine)
+	}
+
+	logger.WithField("machines", len(machines)).Infoln("Restored state of machines")
+}
+
+func (m *machineProvider) restoreMachine(machine persistedMachine) {
+	details := m.machineDetails(machine.Name, false)
+
+	m.lock.Lock()
+	details.Created = machine.Created
+	details.Used = machine.Used
+	details.UsedCount = machine.UsedCount
+	details.SystemFailures = machine.SystemFailures
+	m.lock.Unlock()
+
+	if machine.Removing {
+		_ = m.remove(machine.Name, machine.Reason)
+	}
+}
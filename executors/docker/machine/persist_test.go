@@ -0,0 +1,207 @@
+package machine
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createStateFile(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "machines-state")
+	require.NoError(t, err)
+
+	return filepath.Join(dir, "machines.json"), func() {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func TestMachinesStateReadWrite(t *testing.T) {
+	path, cleanup := createStateFile(t)
+	defer cleanup()
+
+	created := time.Date(2020, 05, 05, 20, 00, 00, 0, time.UTC)
+	state := &machinesState{
+		Version: machinesStateVersion,
+		Runners: map[string][]persistedMachine{
+			"runner": {
+				{Name: "machine1", Created: created, Used: created, UsedCount: 3},
+			},
+		},
+	}
+
+	require.NoError(t, writeMachinesState(path, state))
+
+	loaded, err := loadMachinesState(path)
+	require.NoError(t, err)
+	assert.Equal(t, state, loaded)
+
+	files, err := ioutil.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.Len(t, files, 1, "temporary file is removed")
+}
+
+func TestMachinesStateUnsupportedVersion(t *testing.T) {
+	path, cleanup := createStateFile(t)
+	defer cleanup()
+
+	require.NoError(t, ioutil.WriteFile(path, []byte(`{"version": 1, "machines": []}`), 0600))
+
+	_, err := loadMachinesState(path)
+	assert.EqualError(t, err, "unsupported version 1 of "+path)
+}
+
+func TestMachineSaveState(t *testing.T) {
+	path, cleanup := createStateFile(t)
+	defer cleanup()
+
+	p, _ := testMachineProvider()
+	config := createMachineConfig(t, 1, 5)
+	config.Machine.StateFile = path
+
+	p.machineDetails("test-machine-2", false).UsedCount = 4
+	p.machineDetails("test-machine-1", false).State = machineStateRemoving
+	p.machineDetails("other-machine", false)
+
+	p.saveState(config)
+
+	state, err := loadMachinesState(path)
+	require.NoError(t, err)
+	machines := state.Runners[config.ShortDescription()]
+	require.Len(t, machines, 2, "only machines of the runner are persisted")
+	assert.Equal(t, "test-machine-1", machines[0].Name)
+	assert.True(t, machines[0].Removing)
+	assert.Equal(t, "test-machine-2", machines[1].Name)
+	assert.Equal(t, 4, machines[1].UsedCount)
+}
+
+func TestMachineSaveStateSharedFile(t *testing.T) {
+	path, cleanup := createStateFile(t)
+	defer cleanup()
+
+	p, _ := testMachineProvider()
+
+	config1 := createMachineConfig(t, 1, 5)
+	config1.Token = "runner-1"
+	config1.Machine.MachineName = "first-%s"
+	config1.Machine.StateFile = path
+
+	config2 := createMachineConfig(t, 1, 5)
+	config2.Token = "runner-2"
+	config2.Machine.MachineName = "second-%s"
+	config2.Machine.StateFile = path
+
+	firstMachine := newMachineName(config1)
+	secondMachine := newMachineName(config2)
+	p.machineDetails(firstMachine, false)
+	p.machineDetails(secondMachine, false)
+
+	p.saveState(config1)
+	p.saveState(config2)
+	p.saveState(config1)
+
+	state, err := loadMachinesState(path)
+	require.NoError(t, err)
+	require.Len(t, state.Runners, 2, "the machines of the other runners are kept")
+	require.Len(t, state.Runners[config1.ShortDescription()], 1)
+	assert.Equal(t, firstMachine, state.Runners[config1.ShortDescription()][0].Name)
+	require.Len(t, state.Runners[config2.ShortDescription()], 1)
+	assert.Equal(t, secondMachine, state.Runners[config2.ShortDescription()][0].Name)
+}
+
+func TestMachineRestoreState(t *testing.T) {
+	path, cleanup := createStateFile(t)
+	defer cleanup()
+
+	created := time.Now().Add(-time.Hour)
+	p, machines := testMachineProvider("test-machine-used", "test-machine-removing", "test-machine-unknown")
+	config := createMachineConfig(t, 0, 5)
+	config.Machine.StateFile = path
+
+	err := writeMachinesState(path, &machinesState{
+		Version: machinesStateVersion,
+		Runners: map[string][]persistedMachine{
+			config.ShortDescription(): {
+				{Name: "test-machine-used", Created: created, Used: created, UsedCount: 7},
+				{Name: "test-machine-removing", Created: created, Removing: true, Reason: "Too many builds"},
+				{Name: "test-machine-gone", Created: created},
+			},
+			"other-runner": {
+				{Name: "test-machine-unknown", Created: created},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	// Removed machines are deleted from the details asynchronously
+	removing := p.machineDetails("test-machine-removing", false)
+	unknown := p.machineDetails("test-machine-unknown", false)
+
+	p.restoreState(config)
+
+	<-machines.Removed
+	<-machines.Removed
+
+	details := p.machineDetails("test-machine-used", false)
+	assert.Equal(t, 7, details.UsedCount)
+	assert.Equal(t, created.Unix(), details.Created.Unix())
+	assert.Equal(t, machineStateIdle, details.State)
+
+	assert.Equal(t, machineStateRemoving, removing.State)
+	assert.Equal(t, "Too many builds", removing.Reason)
+
+	assert.Equal(t, machineStateRemoving, unknown.State)
+	assert.Equal(t, "Unknown machine found at startup", unknown.Reason)
+
+	p.lock.RLock()
+	_, ok := p.details["test-machine-gone"]
+	p.lock.RUnlock()
+	assert.False(t, ok, "machines that no longer exist are forgotten")
+}
+
+func TestMachineRestoreStateWithoutRunnerState(t *testing.T) {
+	path, cleanup := createStateFile(t)
+	defer cleanup()
+
+	p, _ := testMachineProvider("test-machine-1", "test-machine-2")
+	config := createMachineConfig(t, 0, 5)
+	config.Machine.StateFile = path
+
+	err := writeMachinesState(path, &machinesState{
+		Version: machinesStateVersion,
+		Runners: map[string][]persistedMachine{
+			"other-runner": {
+				{Name: "other-machine", Created: time.Now()},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	p.restoreState(config)
+
+	for _, name := range []string{"test-machine-1", "test-machine-2"} {
+		details := p.machineDetails(name, false)
+		assert.Equal(t, machineStateIdle, details.State, "machine %s is adopted", name)
+	}
+	assert.True(t, p.restoredState[config.ShortDescription()])
+}
+
+func TestMachineRestoreStateWithoutStateFile(t *testing.T) {
+	path, cleanup := createStateFile(t)
+	defer cleanup()
+
+	p, _ := testMachineProvider("test-machine-1")
+	config := createMachineConfig(t, 0, 5)
+	config.Machine.StateFile = path
+
+	p.restoreState(config)
+
+	p.lock.RLock()
+	assert.Empty(t, p.details, "machines are kept when there is no state to reconcile with")
+	p.lock.RUnlock()
+	assert.True(t, p.restoredState[config.ShortDescription()])
+}
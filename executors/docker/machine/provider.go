@@ -10,6 +10,7 @@ import (
 	"github.com/sirupsen/logrus"
 
 	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/warmer"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
 )
 
@@ -21,13 +22,34 @@ type machineProvider struct {
 	acquireLock sync.Mutex
 	// provider stores a real executor that is used to start run the builds
 	provider common.ExecutorProvider
+	// driver returns the driver with which the machines are created
+	driver func(config *common.DockerMachine) string
+	// newDockerClient connects to the machines for the health checks
+	newDockerClient func(credentials docker.Credentials) (docker.Client, error)
 
 	stuckRemoveLock sync.Mutex
 
+	// stateLock serializes the reads and writes of the state files
+	stateLock sync.Mutex
+	// restoredState stores the runners whose machines state was restored
+	restoredState map[string]bool
+
+	// jobArrivals stores when the jobs of each runner were started, for the
+	// predictive sizing of the idle machines pool
+	jobArrivals map[string]*jobArrivals
+	// creationBudgets counts the machines created by each runner in the
+	// active autoscaling period
+	creationBudgets map[string]*creationBudget
+	// creationTime is the moving average of the machine creation time
+	creationTime time.Duration
+
 	// metrics
-	totalActions      *prometheus.CounterVec
-	currentStatesDesc *prometheus.Desc
-	creationHistogram prometheus.Histogram
+	totalActions        *prometheus.CounterVec
+	currentStatesDesc   *prometheus.Desc
+	creationHistogram   prometheus.Histogram
+	quarantinedMachines *prometheus.CounterVec
+	idleTarget          *prometheus.GaugeVec
+	jobArrivalRate      *prometheus.GaugeVec
 }
 
 func (m *machineProvider) machineDetails(name string, acquire bool) *machineDetails {
@@ -70,7 +92,7 @@ func (m *machineProvider) create(config *common.RunnerConfig, state machineState
 	// Create machine asynchronously
 	go func() {
 		started := time.Now()
-		err := m.machine.Create(config.Machine.MachineDriver, details.Name, config.Machine.MachineOptions...)
+		err := m.machine.Create(m.driver(config.Machine), details.Name, config.Machine.MachineOptions...)
 		for i := 0; i < 3 && err != nil; i++ {
 			details.RetryCount++
 			logrus.WithField("name", details.Name).
@@ -97,6 +119,11 @@ func (m *machineProvider) create(config *common.RunnerConfig, state machineState
 				Infoln("Machine created")
 			m.totalActions.WithLabelValues("created").Inc()
 			m.creationHistogram.Observe(creationTime.Seconds())
+			m.observeCreationTime(creationTime)
+
+			if state == machineStateIdle {
+				m.startImageWarmer(config, details)
+			}
 		}
 		errCh <- err
 	}()
@@ -104,6 +131,38 @@ func (m *machineProvider) create(config *common.RunnerConfig, state machineState
 	return details, errCh
 }
 
+// startImageWarmer pre-pulls the images of the runner on a new idle machine,
+// so that the first job on the machine doesn't wait for the images
+func (m *machineProvider) startImageWarmer(config *common.RunnerConfig, details *machineDetails) {
+	if config.Docker == nil || !config.Docker.ImageWarmer.IsEnabled() {
+		return
+	}
+
+	dc, err := m.machine.Credentials(details.Name)
+	if err != nil {
+		details.logger().
+			WithError(err).
+			Warningln("Failed to get machine credentials to pre-pull images")
+		return
+	}
+
+	details.imageWarmerConfig = machineRunnerConfig(config, dc)
+	warmer.DefaultPool.Start(details.imageWarmerConfig)
+}
+
+// machineRunnerConfig returns a shallow copy of the configuration that uses
+// the Docker host of the machine
+func machineRunnerConfig(config *common.RunnerConfig, dc docker.Credentials) *common.RunnerConfig {
+	newConfig := *config
+	newConfig.Docker = &common.DockerConfig{}
+	if config.Docker != nil {
+		*newConfig.Docker = *config.Docker
+	}
+	newConfig.Docker.Credentials = dc
+
+	return &newConfig
+}
+
 func (m *machineProvider) findFreeMachine(skipCache bool, machines ...string) (details *machineDetails) {
 	// Enumerate all machines in reverse order, to always take the newest machines first
 	for idx := range machines {
@@ -132,6 +191,11 @@ func (m *machineProvider) useMachine(config *common.RunnerConfig) (details *mach
 	}
 	details = m.findFreeMachine(true, machines...)
 	if details == nil {
+		err = m.reserveCreation(config, m.creatingMachines(machines))
+		if err != nil {
+			return
+		}
+
 		var errCh chan error
 		details, errCh = m.create(config, machineStateAcquired)
 		err = <-errCh
@@ -139,6 +203,17 @@ func (m *machineProvider) useMachine(config *common.RunnerConfig) (details *mach
 	return
 }
 
+func (m *machineProvider) creatingMachines(machines []string) int {
+	creating := 0
+	for _, name := range machines {
+		if m.machineDetails(name, false).State == machineStateCreating {
+			creating++
+		}
+	}
+
+	return creating
+}
+
 func (m *machineProvider) retryUseMachine(config *common.RunnerConfig) (details *machineDetails, err error) {
 	// Try to find a machine
 	for i := 0; i < 3; i++ {
@@ -193,6 +268,8 @@ func (m *machineProvider) finalizeRemoval(details *machineDetails) {
 		}
 	}
 
+	warmer.DefaultPool.Stop(details.imageWarmerConfig)
+
 	m.lock.Lock()
 	defer m.lock.Unlock()
 	delete(m.details, details.Name)
@@ -214,6 +291,31 @@ func (m *machineProvider) remove(machineName string, reason ...interface{}) erro
 		return errors.New("machine not found")
 	}
 
+	m.requestRemoval(details, reason...)
+	return nil
+}
+
+// removeIfIdle removes the machine only when it's still idle, so a machine
+// acquired by a job in the meantime isn't torn down under it
+func (m *machineProvider) removeIfIdle(machineName string, reason ...interface{}) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	details := m.details[machineName]
+	if details == nil {
+		return errors.New("machine not found")
+	}
+
+	if details.State != machineStateIdle {
+		return errors.New("machine is not idle")
+	}
+
+	m.requestRemoval(details, reason...)
+	return nil
+}
+
+// requestRemoval must be called with the lock held
+func (m *machineProvider) requestRemoval(details *machineDetails, reason ...interface{}) {
 	details.Reason = fmt.Sprint(reason...)
 	details.State = machineStateRemoving
 	details.RetryCount = 0
@@ -226,7 +328,6 @@ func (m *machineProvider) remove(machineName string, reason ...interface{}) erro
 	details.writeDebugInformation()
 
 	go m.finalizeRemoval(details)
-	return nil
 }
 
 func (m *machineProvider) updateMachine(
@@ -262,6 +363,7 @@ func (m *machineProvider) updateMachines(
 	config *common.RunnerConfig,
 ) (data machinesData, validMachines []string) {
 	data.Runner = config.ShortDescription()
+	data.JobArrivalRate = m.currentJobArrivalRate(config)
 	validMachines = make([]string, 0, len(machines))
 
 	for _, name := range machines {
@@ -271,6 +373,7 @@ func (m *machineProvider) updateMachines(
 		err := m.updateMachine(config, &data, details)
 		if err == nil {
 			validMachines = append(validMachines, name)
+			m.scheduleHealthCheck(config, details)
 		} else {
 			_ = m.remove(details.Name, err)
 		}
@@ -281,9 +384,13 @@ func (m *machineProvider) updateMachines(
 }
 
 func (m *machineProvider) createMachines(config *common.RunnerConfig, data *machinesData) {
+	data.IdleTarget = m.idleCountTarget(config, data)
+	m.idleTarget.WithLabelValues(data.Runner).Set(float64(data.IdleTarget))
+	m.jobArrivalRate.WithLabelValues(data.Runner).Set(data.JobArrivalRate)
+
 	// Create a new machines and mark them as Idle
 	for {
-		if data.Available() >= config.Machine.GetIdleCount() {
+		if data.Available() >= data.IdleTarget {
 			// Limit maximum number of idle machines
 			break
 		}
@@ -291,6 +398,10 @@ func (m *machineProvider) createMachines(config *common.RunnerConfig, data *mach
 			// Limit maximum number of machines
 			break
 		}
+		if m.reserveCreation(config, data.Creating) != nil {
+			// Limit growth rate and number of machines created in the autoscaling period
+			break
+		}
 		m.create(config, machineStateIdle)
 		data.Creating++
 	}
@@ -351,6 +462,9 @@ func (m *machineProvider) Acquire(config *common.RunnerConfig) (common.ExecutorD
 	m.acquireLock.Lock()
 	defer m.acquireLock.Unlock()
 
+	// Restore the machines state persisted before the restart
+	m.restoreState(config)
+
 	machines, err := m.loadMachines(config)
 	if err != nil {
 		return nil, err
@@ -361,6 +475,7 @@ func (m *machineProvider) Acquire(config *common.RunnerConfig) (common.ExecutorD
 
 	// Pre-create machines
 	m.createMachines(config, &machinesData)
+	m.saveState(config)
 
 	logrus.WithFields(machinesData.Fields()).
 		WithField("runner", config.ShortDescription()).
@@ -380,6 +495,10 @@ func (m *machineProvider) Acquire(config *common.RunnerConfig) (common.ExecutorD
 	if config.Machine.GetIdleCount() != 0 && machinesData.Idle == 0 {
 		err = errors.New("no free machines that can process builds")
 	}
+	if err == nil {
+		// The machine for the build is created on demand
+		err = m.checkCreation(config, machinesData.Creating)
+	}
 	return nil, err
 }
 
@@ -411,18 +530,20 @@ func (m *machineProvider) Use(
 	}
 
 	// Create shallow copy of config and store in it docker credentials
-	newConfig = *config
-	newConfig.Docker = &common.DockerConfig{}
-	if config.Docker != nil {
-		*newConfig.Docker = *config.Docker
+	newConfig = *machineRunnerConfig(config, dc)
+	if newConfig.Docker.ImageWarmer.IsEnabled() {
+		// The executor starts the image warmer of the machine, so it needs
+		// to be stopped when the machine is removed
+		details.imageWarmerConfig = &newConfig
 	}
-	newConfig.Docker.Credentials = dc
 
 	// Mark machine as used
 	details.State = machineStateUsed
 	details.Used = time.Now()
 	details.UsedCount++
 	m.totalActions.WithLabelValues("used").Inc()
+	m.recordJobArrival(config)
+	m.saveState(config)
 	return
 }
 
@@ -443,7 +564,17 @@ func (m *machineProvider) Release(config *common.RunnerConfig, data common.Execu
 				return
 			}
 		}
+
+		// Quarantine machine that keeps failing the jobs
+		if config != nil && config.Machine != nil &&
+			config.Machine.MaxSystemFailures > 0 && details.SystemFailures >= config.Machine.MaxSystemFailures {
+			message := fmt.Sprintf("%d consecutive jobs failed with a system failure", details.SystemFailures)
+			if m.quarantine(details, quarantineReasonSystemFailures, message, m.remove) {
+				return
+			}
+		}
 		details.State = machineStateIdle
+		m.saveState(config)
 	}
 }
 
@@ -472,10 +603,19 @@ func newMachineProvider(name, executor string) *machineProvider {
 	}
 
 	return &machineProvider{
-		name:     name,
-		details:  make(machinesDetails),
-		machine:  docker.NewMachineCommand(),
-		provider: provider,
+		name:            name,
+		details:         make(machinesDetails),
+		jobArrivals:     make(map[string]*jobArrivals),
+		creationBudgets: make(map[string]*creationBudget),
+		restoredState:   make(map[string]bool),
+		machine:         docker.NewMachineCommand(),
+		provider:        provider,
+		driver: func(config *common.DockerMachine) string {
+			return config.MachineDriver
+		},
+		newDockerClient: func(credentials docker.Credentials) (docker.Client, error) {
+			return docker.New(credentials, "")
+		},
 		totalActions: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Name: "gitlab_runner_autoscaling_actions_total",
@@ -504,5 +644,35 @@ func newMachineProvider(name, executor string) *machineProvider {
 				},
 			},
 		),
+		quarantinedMachines: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "gitlab_runner_autoscaling_machines_quarantined_total",
+				Help: "The total number of machines quarantined by the provider.",
+				ConstLabels: prometheus.Labels{
+					"executor": name,
+				},
+			},
+			[]string{"reason"},
+		),
+		idleTarget: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gitlab_runner_autoscaling_machines_idle_target",
+				Help: "The number of idle machines the provider is scaling to.",
+				ConstLabels: prometheus.Labels{
+					"executor": name,
+				},
+			},
+			[]string{"runner"},
+		),
+		jobArrivalRate: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: "gitlab_runner_autoscaling_job_arrival_rate",
+				Help: "The number of jobs per second started on the machines in the predictive idle window.",
+				ConstLabels: prometheus.Labels{
+					"executor": name,
+				},
+			},
+			[]string{"runner"},
+		),
 	}
 }
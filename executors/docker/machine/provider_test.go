@@ -305,6 +305,39 @@ func TestMachineCreationAndRemoval(t *testing.T) {
 	assert.Equal(t, machineStateRemoving, d.State)
 }
 
+func TestMachineCreationStartsImageWarmer(t *testing.T) {
+	provisionRetryInterval = 0
+
+	config := &common.RunnerConfig{
+		RunnerSettings: common.RunnerSettings{
+			Docker: &common.DockerConfig{
+				ImageWarmer: common.DockerImageWarmer{RecentImages: 1},
+			},
+			Machine: &common.DockerMachine{
+				MachineName: "warm-%s",
+				IdleTime:    5,
+			},
+		},
+	}
+
+	p, _ := testMachineProvider()
+
+	d, errCh := p.create(config, machineStateIdle)
+	require.NoError(t, <-errCh)
+	require.NotNil(t, d.imageWarmerConfig)
+	assert.True(t, d.imageWarmerConfig.Docker.ImageWarmer.IsEnabled())
+
+	d2, errCh := p.create(machineDefaultConfig, machineStateIdle)
+	require.NoError(t, <-errCh)
+	assert.Nil(t, d2.imageWarmerConfig, "image warmer is not configured")
+
+	d3, errCh := p.create(config, machineStateUsed)
+	require.NoError(t, <-errCh)
+	assert.Nil(t, d3.imageWarmerConfig, "machine created for a job is warmed by the executor")
+
+	p.finalizeRemoval(d)
+}
+
 func TestMachineUse(t *testing.T) {
 	provisionRetryInterval = 0
 
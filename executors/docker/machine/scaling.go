@@ -0,0 +1,183 @@
+package machine
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+// defaultMachineCreationTime is the expected creation time of a machine
+// used by the predictive mode until the first machine is created
+var defaultMachineCreationTime = 2 * time.Minute
+
+// maxJobArrivals limits the number of job arrivals remembered for a runner
+const maxJobArrivals = 10000
+
+type jobArrivals struct {
+	times []time.Time
+}
+
+func (a *jobArrivals) add(t time.Time) {
+	a.times = append(a.times, t)
+	if len(a.times) > maxJobArrivals {
+		a.times = a.times[len(a.times)-maxJobArrivals:]
+	}
+}
+
+// rate returns the number of jobs per second that arrived during the window
+func (a *jobArrivals) rate(window time.Duration, now time.Time) float64 {
+	since := now.Add(-window)
+
+	idx := 0
+	for idx < len(a.times) && a.times[idx].Before(since) {
+		idx++
+	}
+	a.times = a.times[idx:]
+
+	return float64(len(a.times)) / window.Seconds()
+}
+
+func (m *machineProvider) recordJobArrival(config *common.RunnerConfig) {
+	if config.Machine == nil || config.Machine.GetPredictiveIdleWindow() <= 0 {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	runner := config.ShortDescription()
+	arrivals := m.jobArrivals[runner]
+	if arrivals == nil {
+		arrivals = &jobArrivals{}
+		m.jobArrivals[runner] = arrivals
+	}
+	arrivals.add(time.Now())
+}
+
+func (m *machineProvider) currentJobArrivalRate(config *common.RunnerConfig) float64 {
+	window := config.Machine.GetPredictiveIdleWindow()
+	if window <= 0 {
+		return 0
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	arrivals := m.jobArrivals[config.ShortDescription()]
+	if arrivals == nil {
+		return 0
+	}
+
+	return arrivals.rate(window, time.Now())
+}
+
+// observeCreationTime keeps a moving average of the machine creation time
+func (m *machineProvider) observeCreationTime(creationTime time.Duration) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.creationTime == 0 {
+		m.creationTime = creationTime
+		return
+	}
+
+	m.creationTime = (3*m.creationTime + creationTime) / 4
+}
+
+// idleCountTarget returns the number of idle machines that should be
+// available. In the predictive mode it's the number of jobs expected to
+// arrive while a new machine is being created, but never less than IdleCount
+func (m *machineProvider) idleCountTarget(config *common.RunnerConfig, data *machinesData) int {
+	target := config.Machine.GetIdleCount()
+	if config.Machine.GetPredictiveIdleWindow() <= 0 {
+		return target
+	}
+
+	m.lock.RLock()
+	creationTime := m.creationTime
+	m.lock.RUnlock()
+
+	if creationTime == 0 {
+		creationTime = defaultMachineCreationTime
+	}
+
+	predicted := int(math.Ceil(data.JobArrivalRate * creationTime.Seconds()))
+	if predicted > target {
+		target = predicted
+	}
+
+	return target
+}
+
+var (
+	errMaxGrowthRate = errors.New("too many machines being created")
+	errMaxCreations  = errors.New("too many machines created in the autoscaling period")
+)
+
+// creationBudget counts the machines created since the autoscaling period
+// became active
+type creationBudget struct {
+	period  string
+	created int
+}
+
+// creationBudget returns the budget of the runner for the active autoscaling
+// period, starting a new one when the period changed. It must be called with
+// the lock held
+func (m *machineProvider) creationBudget(config *common.RunnerConfig) (*creationBudget, int) {
+	maxCreations, period := config.Machine.GetMaxCreations()
+
+	runner := config.ShortDescription()
+	budget := m.creationBudgets[runner]
+	if budget == nil || budget.period != period {
+		budget = &creationBudget{period: period}
+		m.creationBudgets[runner] = budget
+	}
+
+	return budget, maxCreations
+}
+
+// checkCreation checks whether another machine can be created without
+// exceeding the growth rate and the number of machines that can be created
+// in the autoscaling period
+func (m *machineProvider) checkCreation(config *common.RunnerConfig, creating int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	budget, maxCreations := m.creationBudget(config)
+
+	return checkCreationLimits(config, budget, maxCreations, creating)
+}
+
+// reserveCreation checks the limits of the creation of a machine and counts
+// it in the budget of the autoscaling period when it can be created
+func (m *machineProvider) reserveCreation(config *common.RunnerConfig, creating int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	budget, maxCreations := m.creationBudget(config)
+
+	err := checkCreationLimits(config, budget, maxCreations, creating)
+	if err != nil {
+		return err
+	}
+
+	budget.created++
+
+	return nil
+}
+
+func checkCreationLimits(config *common.RunnerConfig, budget *creationBudget, maxCreations int, creating int) error {
+	maxGrowthRate := config.Machine.MaxGrowthRate
+	if maxGrowthRate > 0 && creating >= maxGrowthRate {
+		return errMaxGrowthRate
+	}
+
+	if maxCreations > 0 && budget.created >= maxCreations {
+		return errMaxCreations
+	}
+
+	return nil
+}
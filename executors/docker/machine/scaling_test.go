@@ -0,0 +1,250 @@
+package machine
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestJobArrivalsRate(t *testing.T) {
+	now := time.Now()
+
+	arrivals := &jobArrivals{}
+	arrivals.add(now.Add(-5 * time.Minute))
+	arrivals.add(now.Add(-50 * time.Second))
+	arrivals.add(now.Add(-10 * time.Second))
+
+	assert.Equal(t, 2.0/60, arrivals.rate(time.Minute, now))
+	assert.Len(t, arrivals.times, 2, "arrivals out of the window are forgotten")
+	assert.Equal(t, 0.0, arrivals.rate(time.Second, now))
+}
+
+func TestJobArrivalsAreLimited(t *testing.T) {
+	now := time.Now()
+
+	arrivals := &jobArrivals{}
+	for i := 0; i < maxJobArrivals+10; i++ {
+		arrivals.add(now)
+	}
+
+	assert.Len(t, arrivals.times, maxJobArrivals)
+}
+
+func TestMachineCurrentJobArrivalRate(t *testing.T) {
+	p, _ := testMachineProvider()
+
+	config := createMachineConfig(t, 1, 5)
+	p.recordJobArrival(config)
+	assert.Equal(t, 0.0, p.currentJobArrivalRate(config), "predictive mode is disabled")
+
+	config.Machine.PredictiveIdleWindow = 10
+	p.recordJobArrival(config)
+	p.recordJobArrival(config)
+	assert.Equal(t, 0.2, p.currentJobArrivalRate(config))
+
+	otherConfig := createMachineConfig(t, 1, 5)
+	otherConfig.Token = "other-runner"
+	otherConfig.Machine.PredictiveIdleWindow = 10
+	assert.Equal(t, 0.0, p.currentJobArrivalRate(otherConfig), "job arrivals are tracked per runner")
+}
+
+func TestMachineIdleCountTarget(t *testing.T) {
+	tests := map[string]struct {
+		predictiveIdleWindow int
+		jobArrivalRate       float64
+		creationTime         time.Duration
+		expectedTarget       int
+	}{
+		"predictive mode disabled": {
+			jobArrivalRate: 1,
+			expectedTarget: 2,
+		},
+		"no jobs arrived": {
+			predictiveIdleWindow: 600,
+			expectedTarget:       2,
+		},
+		"default creation time": {
+			predictiveIdleWindow: 600,
+			jobArrivalRate:       0.05,
+			expectedTarget:       6,
+		},
+		"observed creation time": {
+			predictiveIdleWindow: 600,
+			jobArrivalRate:       0.05,
+			creationTime:         time.Minute,
+			expectedTarget:       3,
+		},
+		"prediction below IdleCount": {
+			predictiveIdleWindow: 600,
+			jobArrivalRate:       0.001,
+			expectedTarget:       2,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			p, _ := testMachineProvider()
+			p.creationTime = tt.creationTime
+
+			config := createMachineConfig(t, 2, 5)
+			config.Machine.PredictiveIdleWindow = tt.predictiveIdleWindow
+
+			target := p.idleCountTarget(config, &machinesData{JobArrivalRate: tt.jobArrivalRate})
+			assert.Equal(t, tt.expectedTarget, target)
+		})
+	}
+}
+
+func TestMachineObserveCreationTime(t *testing.T) {
+	p, _ := testMachineProvider()
+
+	p.observeCreationTime(time.Minute)
+	assert.Equal(t, time.Minute, p.creationTime)
+
+	p.observeCreationTime(5 * time.Minute)
+	assert.Equal(t, 2*time.Minute, p.creationTime)
+}
+
+func autoscalingMachineConfig(t *testing.T, periods []string, maxCreations int) *common.RunnerConfig {
+	config := createMachineConfig(t, 10, 5)
+	config.Machine.AutoscalingConfigs = []*common.DockerMachineAutoscaling{
+		{
+			Periods:      periods,
+			IdleCount:    10,
+			IdleTime:     5,
+			MaxCreations: maxCreations,
+		},
+	}
+	require.NoError(t, config.Machine.CompilePeriods())
+
+	return config
+}
+
+func TestMachineCreateMachinesLimits(t *testing.T) {
+	tests := map[string]struct {
+		maxGrowthRate    int
+		maxCreations     int
+		created          int
+		data             machinesData
+		expectedCreating int
+	}{
+		"no limits": {
+			expectedCreating: 10,
+		},
+		"growth rate": {
+			maxGrowthRate:    3,
+			data:             machinesData{Creating: 1},
+			expectedCreating: 3,
+		},
+		"growth rate already reached": {
+			maxGrowthRate:    3,
+			data:             machinesData{Creating: 4},
+			expectedCreating: 4,
+		},
+		"existing machines don't count in the creations": {
+			maxCreations:     6,
+			data:             machinesData{Used: 4},
+			expectedCreating: 6,
+		},
+		"machines created in autoscaling period": {
+			maxCreations:     6,
+			created:          4,
+			expectedCreating: 2,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			p, machines := testMachineProvider()
+
+			config := autoscalingMachineConfig(t, []string{"* * * * * * *"}, tt.maxCreations)
+			config.Machine.MaxGrowthRate = tt.maxGrowthRate
+
+			for i := 0; i < tt.created; i++ {
+				require.NoError(t, p.reserveCreation(config, 0))
+			}
+
+			data := tt.data
+			data.Runner = config.ShortDescription()
+			p.createMachines(config, &data)
+
+			assert.Equal(t, tt.expectedCreating, data.Creating)
+			assert.Equal(t, 10, data.IdleTarget)
+			assert.Equal(t, float64(10), testutil.ToFloat64(p.idleTarget.WithLabelValues(data.Runner)))
+
+			for i := tt.data.Creating; i < tt.expectedCreating; i++ {
+				<-machines.Created
+			}
+		})
+	}
+}
+
+func TestMachineCreationBudgetIsResetWithPeriod(t *testing.T) {
+	p, _ := testMachineProvider()
+
+	config := autoscalingMachineConfig(t, []string{"* * * * * * *"}, 2)
+	require.NoError(t, p.reserveCreation(config, 0))
+	require.NoError(t, p.reserveCreation(config, 0))
+	assert.Equal(t, errMaxCreations, p.reserveCreation(config, 0))
+	assert.Equal(t, errMaxCreations, p.checkCreation(config, 0))
+
+	otherRunner := autoscalingMachineConfig(t, []string{"* * * * * * *"}, 2)
+	otherRunner.Token = "other-runner"
+	assert.NoError(t, p.checkCreation(otherRunner, 0), "creations are counted per runner")
+
+	newPeriod := autoscalingMachineConfig(t, []string{"* * * * * * *"}, 2)
+	newPeriod.Machine.AutoscalingConfigs[0].Timezone = "UTC"
+	require.NoError(t, newPeriod.Machine.CompilePeriods())
+	assert.NoError(t, p.reserveCreation(newPeriod, 0), "the budget is reset when the period changes")
+}
+
+func TestMachineOnDemandCreationLimits(t *testing.T) {
+	provisionRetryInterval = 0
+
+	tests := map[string]struct {
+		maxGrowthRate int
+		maxCreations  int
+		creating      int
+		expectedErr   error
+	}{
+		"growth rate reached": {
+			maxGrowthRate: 1,
+			creating:      1,
+			expectedErr:   errMaxGrowthRate,
+		},
+		"creations in autoscaling period reached": {
+			maxCreations: 1,
+			expectedErr:  errMaxCreations,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			p, machines := testMachineProvider()
+
+			config := autoscalingMachineConfig(t, []string{"* * * * * * *"}, tt.maxCreations)
+			config.Machine.AutoscalingConfigs[0].IdleCount = 0
+			config.Machine.MaxGrowthRate = tt.maxGrowthRate
+
+			if tt.maxCreations > 0 {
+				require.NoError(t, p.reserveCreation(config, 0))
+			}
+			for i := 0; i < tt.creating; i++ {
+				name := newMachineName(config)
+				p.machineDetails(name, true).State = machineStateCreating
+				machines.machines = append(machines.machines, name)
+			}
+
+			_, err := p.Acquire(config)
+			assert.Equal(t, tt.expectedErr, err, "the job isn't requested")
+
+			_, _, err = p.Use(config, nil)
+			assert.Equal(t, tt.expectedErr, err, "the machine isn't created on demand")
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package docker
+
+import (
+	"fmt"
+	"math/big"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/go-units"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+const (
+	// CPUSOverwriteVariableName is the key for the JobVariable containing user overwritten cpus
+	CPUSOverwriteVariableName = "DOCKER_CPUS"
+	// MemoryOverwriteVariableName is the key for the JobVariable containing user overwritten memory
+	MemoryOverwriteVariableName = "DOCKER_MEMORY"
+	// ShmSizeOverwriteVariableName is the key for the JobVariable containing user overwritten shm_size
+	ShmSizeOverwriteVariableName = "DOCKER_SHM_SIZE"
+	// ServiceCPUSOverwriteVariableName is the key for the JobVariable containing user overwritten
+	// cpus of the service containers
+	ServiceCPUSOverwriteVariableName = "DOCKER_SERVICE_CPUS"
+	// ServiceMemoryOverwriteVariableName is the key for the JobVariable containing user overwritten
+	// memory of the service containers
+	ServiceMemoryOverwriteVariableName = "DOCKER_SERVICE_MEMORY"
+)
+
+type overwriteTooHighError struct {
+	resource  string
+	max       string
+	overwrite string
+}
+
+func (o *overwriteTooHighError) Error() string {
+	return fmt.Sprintf("the resource %q requested %q is higher than limit allowed %q", o.resource, o.overwrite, o.max)
+}
+
+func (o *overwriteTooHighError) Is(err error) bool {
+	_, ok := err.(*overwriteTooHighError)
+	return ok
+}
+
+// overwrites holds the resources requested by the job. A zero value
+// means that the value from config.toml is used.
+type overwrites struct {
+	nanoCPUs      int64
+	memory        int64
+	shmSize       int64
+	serviceCPUs   int64
+	serviceMemory int64
+}
+
+func createOverwrites(
+	config *common.DockerConfig,
+	variables common.JobVariables,
+	logger common.BuildLogger,
+) (overwrites, error) {
+	var err error
+	o := overwrites{}
+
+	variables = variables.Expand()
+
+	resources := []struct {
+		fieldName   string
+		maxResource string
+		overwrite   string
+		parse       func(string) (int64, error)
+		target      *int64
+	}{
+		{
+			fieldName:   "CPUS",
+			maxResource: config.CPUSOverwriteMaxAllowed,
+			overwrite:   variables.Get(CPUSOverwriteVariableName),
+			parse:       parseNanoCPUs,
+			target:      &o.nanoCPUs,
+		},
+		{
+			fieldName:   "Memory",
+			maxResource: config.MemoryOverwriteMaxAllowed,
+			overwrite:   variables.Get(MemoryOverwriteVariableName),
+			parse:       units.RAMInBytes,
+			target:      &o.memory,
+		},
+		{
+			fieldName:   "ShmSize",
+			maxResource: config.ShmSizeOverwriteMaxAllowed,
+			overwrite:   variables.Get(ShmSizeOverwriteVariableName),
+			parse:       units.RAMInBytes,
+			target:      &o.shmSize,
+		},
+		{
+			fieldName:   "ServiceCPUS",
+			maxResource: config.ServiceCPUSOverwriteMaxAllowed,
+			overwrite:   variables.Get(ServiceCPUSOverwriteVariableName),
+			parse:       parseNanoCPUs,
+			target:      &o.serviceCPUs,
+		},
+		{
+			fieldName:   "ServiceMemory",
+			maxResource: config.ServiceMemoryOverwriteMaxAllowed,
+			overwrite:   variables.Get(ServiceMemoryOverwriteVariableName),
+			parse:       units.RAMInBytes,
+			target:      &o.serviceMemory,
+		},
+	}
+
+	for _, r := range resources {
+		*r.target, err = evaluateMaxResourceOverwrite(r.fieldName, r.maxResource, r.overwrite, r.parse, logger)
+		if err != nil {
+			return overwrites{}, err
+		}
+	}
+
+	return o, nil
+}
+
+func evaluateMaxResourceOverwrite(
+	fieldName, maxResource, overwriteValue string,
+	parse func(string) (int64, error),
+	logger common.BuildLogger,
+) (int64, error) {
+	if maxResource == "" {
+		logger.Debugln("setting allowing overrides for", fieldName, "is empty, disabling override.")
+		return 0, nil
+	}
+
+	if overwriteValue == "" {
+		return 0, nil
+	}
+
+	max, err := parse(maxResource)
+	if err != nil {
+		return 0, fmt.Errorf("parsing resource limit: %q", err.Error())
+	}
+
+	value, err := parse(overwriteValue)
+	if err != nil {
+		return 0, fmt.Errorf("parsing resource limit: %q", err.Error())
+	}
+
+	if value > max {
+		return 0, &overwriteTooHighError{
+			resource:  fieldName,
+			max:       maxResource,
+			overwrite: overwriteValue,
+		}
+	}
+
+	logger.Println(fmt.Sprintf("%q overwritten with %q", fieldName, overwriteValue))
+
+	return value, nil
+}
+
+func parseNanoCPUs(value string) (int64, error) {
+	cpu, ok := new(big.Rat).SetString(value)
+	if !ok {
+		return 0, fmt.Errorf("failed to parse %v as a rational number", value)
+	}
+
+	nano, _ := cpu.Mul(cpu, big.NewRat(1e9, 1)).Float64()
+
+	return int64(nano), nil
+}
+
+func (o overwrites) applyToBuild(hostConfig *container.HostConfig) {
+	if o.nanoCPUs > 0 {
+		hostConfig.NanoCPUs = o.nanoCPUs
+	}
+
+	if o.memory > 0 {
+		overwriteMemory(&hostConfig.Resources, o.memory)
+	}
+
+	if o.shmSize > 0 {
+		hostConfig.ShmSize = o.shmSize
+	}
+}
+
+func (o overwrites) applyToService(hostConfig *container.HostConfig) {
+	if o.serviceCPUs > 0 {
+		hostConfig.NanoCPUs = o.serviceCPUs
+	}
+
+	if o.serviceMemory > 0 {
+		overwriteMemory(&hostConfig.Resources, o.serviceMemory)
+	}
+}
+
+// overwriteMemory sets the memory limit while keeping the configured amount of
+// swap, as memory_swap is the total of memory and swap and Docker refuses to
+// create a container with a memory limit higher than it
+func overwriteMemory(resources *container.Resources, memory int64) {
+	if resources.MemorySwap > 0 {
+		swap := resources.MemorySwap - resources.Memory
+		if swap < 0 {
+			swap = 0
+		}
+		resources.MemorySwap = memory + swap
+	}
+
+	resources.Memory = memory
+}
@@ -0,0 +1,195 @@
+package docker
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types/container"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+)
+
+func TestOverwrites(t *testing.T) {
+	overwritesAllowedConfig := &common.DockerConfig{
+		CPUSOverwriteMaxAllowed:          "4",
+		MemoryOverwriteMaxAllowed:        "16g",
+		ShmSizeOverwriteMaxAllowed:       "1g",
+		ServiceCPUSOverwriteMaxAllowed:   "2",
+		ServiceMemoryOverwriteMaxAllowed: "4g",
+	}
+
+	tests := map[string]struct {
+		config             *common.DockerConfig
+		variables          common.JobVariables
+		expectedOverwrites overwrites
+		expectedError      error
+	}{
+		"no overwrites allowed": {
+			config: &common.DockerConfig{},
+			variables: common.JobVariables{
+				{Key: CPUSOverwriteVariableName, Value: "2"},
+				{Key: MemoryOverwriteVariableName, Value: "8g"},
+			},
+			expectedOverwrites: overwrites{},
+		},
+		"no overwrites requested": {
+			config:             overwritesAllowedConfig,
+			expectedOverwrites: overwrites{},
+		},
+		"overwrites within limits": {
+			config: overwritesAllowedConfig,
+			variables: common.JobVariables{
+				{Key: CPUSOverwriteVariableName, Value: "1.5"},
+				{Key: MemoryOverwriteVariableName, Value: "16g"},
+				{Key: ShmSizeOverwriteVariableName, Value: "256m"},
+				{Key: ServiceCPUSOverwriteVariableName, Value: "0.5"},
+				{Key: ServiceMemoryOverwriteVariableName, Value: "$SERVICE_MEMORY"},
+				{Key: "SERVICE_MEMORY", Value: "1g"},
+			},
+			expectedOverwrites: overwrites{
+				nanoCPUs:      1500000000,
+				memory:        16 * 1024 * 1024 * 1024,
+				shmSize:       256 * 1024 * 1024,
+				serviceCPUs:   500000000,
+				serviceMemory: 1024 * 1024 * 1024,
+			},
+		},
+		"cpus overwrite too high": {
+			config: overwritesAllowedConfig,
+			variables: common.JobVariables{
+				{Key: CPUSOverwriteVariableName, Value: "8"},
+			},
+			expectedError: new(overwriteTooHighError),
+		},
+		"service memory overwrite too high": {
+			config: overwritesAllowedConfig,
+			variables: common.JobVariables{
+				{Key: ServiceMemoryOverwriteVariableName, Value: "5g"},
+			},
+			expectedError: new(overwriteTooHighError),
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			trace := new(bytes.Buffer)
+			logger := common.NewBuildLogger(&common.Trace{Writer: trace}, logrus.WithFields(logrus.Fields{}))
+
+			o, err := createOverwrites(tt.config, tt.variables, logger)
+			if tt.expectedError != nil {
+				assert.True(t, errors.Is(err, tt.expectedError))
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedOverwrites, o)
+		})
+	}
+}
+
+func TestOverwritesMalformedValue(t *testing.T) {
+	config := &common.DockerConfig{MemoryOverwriteMaxAllowed: "4g"}
+	variables := common.JobVariables{{Key: MemoryOverwriteVariableName, Value: "a lot"}}
+	logger := common.NewBuildLogger(&common.Trace{Writer: new(bytes.Buffer)}, logrus.WithFields(logrus.Fields{}))
+
+	_, err := createOverwrites(config, variables, logger)
+	assert.Error(t, err)
+}
+
+func TestOverwritesAreReportedInTrace(t *testing.T) {
+	config := &common.DockerConfig{CPUSOverwriteMaxAllowed: "4"}
+	variables := common.JobVariables{{Key: CPUSOverwriteVariableName, Value: "2"}}
+
+	trace := new(bytes.Buffer)
+	logger := common.NewBuildLogger(&common.Trace{Writer: trace}, logrus.WithFields(logrus.Fields{}))
+
+	_, err := createOverwrites(config, variables, logger)
+	require.NoError(t, err)
+	assert.Contains(t, trace.String(), `"CPUS" overwritten with "2"`)
+}
+
+func TestOverwritesApply(t *testing.T) {
+	o := overwrites{
+		nanoCPUs:      2e9,
+		memory:        1024,
+		shmSize:       2048,
+		serviceCPUs:   1e9,
+		serviceMemory: 512,
+	}
+
+	buildHostConfig := &container.HostConfig{ShmSize: 1}
+	o.applyToBuild(buildHostConfig)
+	assert.Equal(t, int64(2e9), buildHostConfig.NanoCPUs)
+	assert.Equal(t, int64(1024), buildHostConfig.Memory)
+	assert.Equal(t, int64(2048), buildHostConfig.ShmSize)
+
+	serviceHostConfig := &container.HostConfig{ShmSize: 1}
+	o.applyToService(serviceHostConfig)
+	assert.Equal(t, int64(1e9), serviceHostConfig.NanoCPUs)
+	assert.Equal(t, int64(512), serviceHostConfig.Memory)
+	assert.Equal(t, int64(1), serviceHostConfig.ShmSize)
+
+	emptyHostConfig := &container.HostConfig{Resources: container.Resources{Memory: 42}}
+	overwrites{}.applyToBuild(emptyHostConfig)
+	assert.Equal(t, int64(42), emptyHostConfig.Memory)
+}
+
+func TestOverwritesApplyMemoryKeepsSwap(t *testing.T) {
+	tests := map[string]struct {
+		memory             int64
+		memorySwap         int64
+		overwrite          int64
+		expectedMemorySwap int64
+	}{
+		"swap not configured": {
+			memory:             1024,
+			overwrite:          4096,
+			expectedMemorySwap: 0,
+		},
+		"unlimited swap": {
+			memory:             1024,
+			memorySwap:         -1,
+			overwrite:          4096,
+			expectedMemorySwap: -1,
+		},
+		"memory raised above memory_swap": {
+			memory:             1024,
+			memorySwap:         1536,
+			overwrite:          4096,
+			expectedMemorySwap: 4608,
+		},
+		"memory lowered": {
+			memory:             4096,
+			memorySwap:         8192,
+			overwrite:          1024,
+			expectedMemorySwap: 5120,
+		},
+		"memory_swap without swap": {
+			memory:             1024,
+			memorySwap:         1024,
+			overwrite:          4096,
+			expectedMemorySwap: 4096,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			o := overwrites{memory: tt.overwrite, serviceMemory: tt.overwrite}
+			resources := container.Resources{Memory: tt.memory, MemorySwap: tt.memorySwap}
+
+			buildHostConfig := &container.HostConfig{Resources: resources}
+			o.applyToBuild(buildHostConfig)
+			assert.Equal(t, tt.overwrite, buildHostConfig.Memory)
+			assert.Equal(t, tt.expectedMemorySwap, buildHostConfig.MemorySwap)
+
+			serviceHostConfig := &container.HostConfig{Resources: resources}
+			o.applyToService(serviceHostConfig)
+			assert.Equal(t, tt.overwrite, serviceHostConfig.Memory)
+			assert.Equal(t, tt.expectedMemorySwap, serviceHostConfig.MemorySwap)
+		})
+	}
+}
@@ -0,0 +1,33 @@
+package docker
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/executors"
+	"gitlab.com/gitlab-org/gitlab-runner/executors/docker/internal/warmer"
+)
+
+// provider starts the image warmer of the runners before they request jobs,
+// so that the configured images are pulled while the Docker host is idle
+type provider struct {
+	executors.DefaultExecutorProvider
+
+	warmers *warmer.Pool
+}
+
+func (p provider) Acquire(config *common.RunnerConfig) (common.ExecutorData, error) {
+	p.warmers.Start(config)
+
+	return p.DefaultExecutorProvider.Acquire(config)
+}
+
+// Describe implements prometheus.Collector.
+func (p provider) Describe(ch chan<- *prometheus.Desc) {
+	p.warmers.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (p provider) Collect(ch chan<- prometheus.Metric) {
+	p.warmers.Collect(ch)
+}
@@ -393,17 +393,34 @@ func (s *executor) setupScriptsConfigMap() error {
 	// After issue https://gitlab.com/gitlab-org/gitlab-runner/issues/10342 is resolved and
 	// the legacy execution mode is removed we can remove the manual construction of trapShell and just use "bash+trap"
 	// in the exec options
-	bashShell, ok := common.GetShell(s.Shell().Shell).(*shells.BashShell)
-	if !ok {
+	var trapShell common.Shell
+	var shVariantShell common.Shell
+	switch shell := common.GetShell(s.Shell().Shell).(type) {
+	case *shells.BashShell:
+		trapShell = &shells.BashTrapShell{BashShell: shell, LogFile: s.logFile()}
+		// The detect script runs the sh variant of the scripts when the
+		// image doesn't provide bash
+		if sh, ok := common.GetShell("sh").(*shells.ShShell); ok {
+			shVariantShell = &shells.ShTrapShell{ShShell: sh, LogFile: s.logFile()}
+		}
+	case *shells.ShShell:
+		trapShell = &shells.ShTrapShell{ShShell: shell, LogFile: s.logFile()}
+	default:
 		return fmt.Errorf("kubernetes executor incorrect shell type")
 	}
 
-	trapShell := &shells.BashTrapShell{BashShell: bashShell, LogFile: s.logFile()}
 	scripts, err := s.generateScripts(trapShell)
 	if err != nil {
 		return err
 	}
 
+	if shVariantShell != nil {
+		err = s.addShVariantScripts(scripts, shVariantShell)
+		if err != nil {
+			return err
+		}
+	}
+
 	configMap := &api.ConfigMap{
 		ObjectMeta: metav1.ObjectMeta{
 			GenerateName: fmt.Sprintf("%s-scripts", s.Build.ProjectUniqueName()),
@@ -438,6 +455,27 @@ func (s *executor) generateScripts(shell common.Shell) (map[string]string, error
 	return scripts, nil
 }
 
+// addShVariantScripts adds the sh variant of every stage script next to it,
+// for the detect script to run when bash isn't found
+func (s *executor) addShVariantScripts(scripts map[string]string, shell common.Shell) error {
+	for _, stage := range s.Build.BuildStages() {
+		if _, ok := scripts[string(stage)]; !ok {
+			continue
+		}
+
+		script, err := shell.GenerateScript(stage, *s.Shell())
+		if err != nil {
+			return fmt.Errorf("generating sh variant of trap shell script: %w", err)
+		}
+
+		scripts[string(stage)+shells.ShVariantSuffix] = script
+	}
+
+	scripts[detectShellScriptName] = shells.BashFileDetectShellScript
+
+	return nil
+}
+
 func (s *executor) Cleanup() {
 	s.cleanupResources()
 	s.cleanupServices()
@@ -3187,6 +3187,7 @@ func (f FakeBuildTrace) SetCancelFunc(cancelFunc context.CancelFunc)           {
 func (f FakeBuildTrace) Cancel() bool                                          { return false }
 func (f FakeBuildTrace) SetFailuresCollector(fc common.FailuresCollector)      {}
 func (f FakeBuildTrace) SetMasked(masked []string)                             {}
+func (f FakeBuildTrace) SetTimestamps(enabled bool)                            {}
 func (f FakeBuildTrace) IsStdout() bool {
 	return false
 }
@@ -3310,3 +3311,40 @@ func TestGenerateScripts(t *testing.T) {
 		})
 	}
 }
+
+func TestAddShVariantScripts(t *testing.T) {
+	successfulResponse, err := common.GetRemoteSuccessfulMultistepBuild()
+	require.NoError(t, err)
+
+	e := &executor{
+		AbstractExecutor: executors.AbstractExecutor{
+			Build: &common.Build{
+				JobResponse: successfulResponse,
+			},
+		},
+	}
+	buildStages := e.Build.BuildStages()
+
+	// The first stage was skipped for the bash script
+	scripts := map[string]string{detectShellScriptName: detectShellScript}
+	for _, stage := range buildStages[1:] {
+		scripts[string(stage)] = "BASH"
+	}
+
+	m := new(common.MockShell)
+	defer m.AssertExpectations(t)
+	for _, stage := range buildStages[1:] {
+		m.On("GenerateScript", stage, e.ExecutorOptions.Shell).
+			Return("SH", nil).
+			Once()
+	}
+
+	require.NoError(t, e.addShVariantScripts(scripts, m))
+
+	assert.Equal(t, shells.BashFileDetectShellScript, scripts[detectShellScriptName])
+	assert.NotContains(t, scripts, string(buildStages[0])+shells.ShVariantSuffix)
+	for _, stage := range buildStages[1:] {
+		assert.Equal(t, "BASH", scripts[string(stage)])
+		assert.Equal(t, "SH", scripts[string(stage)+shells.ShVariantSuffix])
+	}
+}
@@ -204,11 +204,21 @@ func (s *executor) run(cmd common.ExecutorCommand) error {
 		return err
 	case <-cmd.Context.Done():
 		logger := common.NewProcessLoggerAdapter(s.BuildLogger)
-		return newProcessKillWaiter(logger, process.GracefulTimeout, process.KillTimeout).
+		return newProcessKillWaiter(logger, s.gracefulKillTimeout(), process.KillTimeout).
 			KillAndWait(c, waitCh)
 	}
 }
 
+// gracefulKillTimeout returns the time the script has to terminate after
+// receiving SIGTERM before being killed
+func (s *executor) gracefulKillTimeout() time.Duration {
+	if gracePeriod := s.Build.GetCancelGracePeriod(); gracePeriod > 0 {
+		return gracePeriod
+	}
+
+	return process.GracefulTimeout
+}
+
 func init() {
 	// Look for self
 	runnerCommand, err := osext.Executable()
@@ -240,6 +250,7 @@ func init() {
 	featuresUpdater := func(features *common.FeaturesInfo) {
 		features.Variables = true
 		features.Shared = true
+		features.CancelGracePeriod = true
 
 		if runtime.GOOS != "windows" {
 			features.Session = true
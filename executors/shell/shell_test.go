@@ -9,6 +9,7 @@ import (
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 
 	"gitlab.com/gitlab-org/gitlab-runner/common"
 	"gitlab.com/gitlab-org/gitlab-runner/executors"
@@ -194,3 +195,40 @@ func TestProcessTermination_Legacy(t *testing.T) {
 		assert.True(t, errors.As(err, &buildErr), "expected %T, got %T", buildErr, err)
 	})
 }
+
+func TestExecutor_GracefulKillTimeout(t *testing.T) {
+	tests := map[string]struct {
+		runner          *common.RunnerConfig
+		expectedTimeout time.Duration
+	}{
+		"runner not set": {
+			expectedTimeout: process.GracefulTimeout,
+		},
+		"grace period not configured": {
+			runner:          &common.RunnerConfig{},
+			expectedTimeout: process.GracefulTimeout,
+		},
+		"grace period configured": {
+			runner: &common.RunnerConfig{
+				RunnerSettings: common.RunnerSettings{CancelGracePeriod: 30},
+			},
+			expectedTimeout: 30 * time.Second,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			build := &common.Build{Runner: tt.runner}
+			err := common.GetExecutorProvider("shell").GetFeatures(&build.ExecutorFeatures)
+			require.NoError(t, err)
+
+			executor := executor{
+				AbstractExecutor: executors.AbstractExecutor{
+					Build: build,
+				},
+			}
+
+			assert.Equal(t, tt.expectedTimeout, executor.gracefulKillTimeout())
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package archives
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sirupsen/logrus"
+)
+
+func createArchive(w io.Writer, format Format, fileNames []string, opts []Option) error {
+	switch format {
+	case FormatTar:
+		return CreateTarArchive(w, fileNames)
+	case FormatTarZstd:
+		return CreateTarZstdArchive(w, fileNames, opts...)
+	default:
+		return CreateZipArchive(w, fileNames, opts...)
+	}
+}
+
+// CreateFile writes the archive of the files in the given format, the file
+// is replaced only once the archive is complete
+func CreateFile(fileName string, format Format, fileNames []string, opts ...Option) error {
+	// create directories to store archive
+	err := os.MkdirAll(filepath.Dir(fileName), 0700)
+	if err != nil {
+		return err
+	}
+
+	tempFile, err := ioutil.TempFile(filepath.Dir(fileName), "archive_")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = tempFile.Close()
+		_ = os.Remove(tempFile.Name())
+	}()
+
+	logrus.Debugln("Temporary file:", tempFile.Name())
+	err = createArchive(tempFile, format, fileNames, opts)
+	if err != nil {
+		return err
+	}
+	_ = tempFile.Close()
+
+	err = os.Rename(tempFile.Name(), fileName)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// ExtractFile extracts the archive, its format being detected from its
+// content so that the archives of all the formats can be extracted
+func ExtractFile(fileName string, opts ...Option) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	format, err := DetectFormat(file)
+	if err != nil {
+		return err
+	}
+
+	if format == FormatZip {
+		return ExtractZipFile(fileName, opts...)
+	}
+
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		return err
+	}
+
+	if format == FormatTarZstd {
+		return ExtractTarZstdArchive(file, opts...)
+	}
+
+	return ExtractTarArchive(file)
+}
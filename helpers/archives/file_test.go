@@ -0,0 +1,64 @@
+package archives
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCreateAndExtractFile(t *testing.T) {
+	for _, format := range []Format{FormatZip, FormatTar, FormatTarZstd} {
+		t.Run(string(format), func(t *testing.T) {
+			testInWorkDir(t, func(t *testing.T, fileName string) {
+				paths := []string{
+					createTestDirectory(t, singleByte),
+					createTestFile(t, singleByte),
+					createSymlinkFile(t, singleByte),
+				}
+
+				err := CreateFile(fileName, format, paths, WithCompressionLevel(CompressionLevelFastest))
+				require.NoError(t, err)
+
+				for _, path := range paths {
+					require.NoError(t, os.Remove(path))
+				}
+
+				err = ExtractFile(fileName)
+				require.NoError(t, err)
+
+				fi, err := os.Stat(paths[0])
+				require.NoError(t, err)
+				assert.True(t, fi.IsDir())
+
+				content, err := ioutil.ReadFile(paths[1])
+				require.NoError(t, err)
+				assert.Equal(t, testZipFileContent, content)
+
+				link, err := os.Readlink(paths[2])
+				require.NoError(t, err)
+				assert.Equal(t, "old_symlink", link)
+			})
+		})
+	}
+}
+
+func TestExtractFileNotFound(t *testing.T) {
+	err := ExtractFile("non_existing_archive")
+	assert.True(t, os.IsNotExist(err), "expected not exist error, got %v", err)
+}
+
+func TestExtractFileUnknownFormat(t *testing.T) {
+	file, err := ioutil.TempFile("", "archive")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+
+	_, err = file.WriteString("not an archive")
+	require.NoError(t, err)
+	file.Close()
+
+	err = ExtractFile(file.Name())
+	assert.Equal(t, errUnknownFormat, err)
+}
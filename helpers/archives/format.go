@@ -0,0 +1,73 @@
+package archives
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Format is the format of an archive of files
+type Format string
+
+const (
+	FormatZip     Format = "zip"
+	FormatTar     Format = "tar"
+	FormatTarZstd Format = "tarzstd"
+)
+
+const (
+	tarBlockSize   = 512
+	tarMagicOffset = 257
+)
+
+var (
+	zipMagic         = []byte("PK\x03\x04")
+	zipEmptyMagic    = []byte("PK\x05\x06")
+	zstdMagic        = []byte("\x28\xb5\x2f\xfd")
+	tarMagic         = []byte("ustar")
+	tarEmptyMagic    = make([]byte, tarBlockSize)
+	errUnknownFormat = errors.New("unknown archive format")
+)
+
+// ParseFormat returns the archive format for its name, an empty name
+// selecting zip
+func ParseFormat(name string) (Format, error) {
+	switch format := Format(name); format {
+	case "":
+		return FormatZip, nil
+	case FormatZip, FormatTar, FormatTarZstd:
+		return format, nil
+	default:
+		return "", fmt.Errorf("unsupported archive format: %s", name)
+	}
+}
+
+// DetectFormat returns the format of the archive from its magic bytes
+func DetectFormat(r io.Reader) (Format, error) {
+	header := make([]byte, tarBlockSize)
+	n, err := io.ReadFull(r, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, zipMagic), bytes.HasPrefix(header, zipEmptyMagic):
+		return FormatZip, nil
+
+	case bytes.HasPrefix(header, zstdMagic):
+		return FormatTarZstd, nil
+
+	case len(header) > tarMagicOffset+len(tarMagic) &&
+		bytes.Equal(header[tarMagicOffset:tarMagicOffset+len(tarMagic)], tarMagic):
+		return FormatTar, nil
+
+	case bytes.Equal(header, tarEmptyMagic):
+		// the archive without any file is only made of the end blocks
+		return FormatTar, nil
+
+	default:
+		return "", errUnknownFormat
+	}
+}
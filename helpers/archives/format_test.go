@@ -0,0 +1,116 @@
+package archives
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseFormat(t *testing.T) {
+	tests := map[string]struct {
+		expectedFormat Format
+		expectedErr    string
+	}{
+		"":        {expectedFormat: FormatZip},
+		"zip":     {expectedFormat: FormatZip},
+		"tar":     {expectedFormat: FormatTar},
+		"tarzstd": {expectedFormat: FormatTarZstd},
+		"gzip":    {expectedErr: "unsupported archive format: gzip"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			format, err := ParseFormat(name)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedFormat, format)
+		})
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := map[string]struct {
+		createArchive  func(t *testing.T, fileNames []string) []byte
+		expectedFormat Format
+		expectedErr    error
+	}{
+		"zip": {
+			createArchive: func(t *testing.T, fileNames []string) []byte {
+				var buffer bytes.Buffer
+				require.NoError(t, CreateZipArchive(&buffer, fileNames))
+				return buffer.Bytes()
+			},
+			expectedFormat: FormatZip,
+		},
+		"empty zip": {
+			createArchive: func(t *testing.T, fileNames []string) []byte {
+				var buffer bytes.Buffer
+				require.NoError(t, CreateZipArchive(&buffer, nil))
+				return buffer.Bytes()
+			},
+			expectedFormat: FormatZip,
+		},
+		"tar": {
+			createArchive: func(t *testing.T, fileNames []string) []byte {
+				var buffer bytes.Buffer
+				require.NoError(t, CreateTarArchive(&buffer, fileNames))
+				return buffer.Bytes()
+			},
+			expectedFormat: FormatTar,
+		},
+		"empty tar": {
+			createArchive: func(t *testing.T, fileNames []string) []byte {
+				var buffer bytes.Buffer
+				require.NoError(t, CreateTarArchive(&buffer, nil))
+				return buffer.Bytes()
+			},
+			expectedFormat: FormatTar,
+		},
+		"tarzstd": {
+			createArchive: func(t *testing.T, fileNames []string) []byte {
+				var buffer bytes.Buffer
+				require.NoError(t, CreateTarZstdArchive(&buffer, fileNames))
+				return buffer.Bytes()
+			},
+			expectedFormat: FormatTarZstd,
+		},
+		"unknown": {
+			createArchive: func(t *testing.T, fileNames []string) []byte {
+				return []byte("not an archive")
+			},
+			expectedErr: errUnknownFormat,
+		},
+		"empty": {
+			createArchive: func(t *testing.T, fileNames []string) []byte {
+				return nil
+			},
+			expectedErr: errUnknownFormat,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			file, err := ioutil.TempFile("", "test_file")
+			require.NoError(t, err)
+			defer os.Remove(file.Name())
+
+			_, err = file.Write(testZipFileContent)
+			require.NoError(t, err)
+			file.Close()
+
+			archive := tt.createArchive(t, []string{file.Name()})
+
+			format, err := DetectFormat(bytes.NewReader(archive))
+			assert.Equal(t, tt.expectedErr, err)
+			assert.Equal(t, tt.expectedFormat, format)
+		})
+	}
+}
@@ -1,24 +1,26 @@
 package archives
 
 import (
-	"compress/gzip"
 	"fmt"
 	"io"
 	"os"
 
+	"github.com/klauspost/compress/gzip"
 	"github.com/sirupsen/logrus"
 )
 
-func writeGzipFile(w io.Writer, fileName string, fileInfo os.FileInfo) error {
+func writeGzipFile(w io.Writer, fileName string, fileInfo os.FileInfo, level CompressionLevel) error {
 	if !fileInfo.Mode().IsRegular() {
 		return fmt.Errorf("the %q is not a regular file", fileName)
 	}
 
-	gz := gzip.NewWriter(w)
+	gz, err := gzip.NewWriterLevel(w, level.flateLevel())
+	if err != nil {
+		return err
+	}
 	gz.Header.Name = fileInfo.Name()
 	gz.Header.Comment = fileName
 	gz.Header.ModTime = fileInfo.ModTime()
-	defer func() { _ = gz.Close() }()
 
 	file, err := os.Open(fileName)
 	if err != nil {
@@ -27,24 +29,56 @@ func writeGzipFile(w io.Writer, fileName string, fileInfo os.FileInfo) error {
 	defer func() { _ = file.Close() }()
 
 	_, err = io.Copy(gz, file)
-	return err
+	if err != nil {
+		return err
+	}
+
+	return gz.Close()
 }
 
-func CreateGzipArchive(w io.Writer, fileNames []string) error {
-	for _, fileName := range fileNames {
-		fi, err := os.Lstat(fileName)
-		if os.IsNotExist(err) {
-			logrus.Warningln("File ignored:", err)
-			continue
-		} else if err != nil {
-			return err
-		}
+// prepareGzipFile compresses the file ahead of being written to the stream,
+// it returns a nil spool for the ignored files
+func prepareGzipFile(fileName string, level CompressionLevel) (*spool, error) {
+	fi, err := os.Lstat(fileName)
+	if os.IsNotExist(err) {
+		logrus.Warningln("File ignored:", err)
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
 
-		err = writeGzipFile(w, fileName, fi)
-		if err != nil {
-			return err
-		}
+	data := new(spool)
+	err = writeGzipFile(data, fileName, fi, level)
+	if err != nil {
+		_ = data.Close()
+		return nil, err
 	}
 
-	return nil
+	return data, nil
+}
+
+// CreateGzipArchive writes every file as a member of the gzip stream. The
+// files are compressed concurrently, but written in the order of the list
+func CreateGzipArchive(w io.Writer, fileNames []string, opts ...Option) error {
+	o := newOptions(opts)
+
+	return writeOrdered(fileNames, o.concurrency, func(fileName string) preparedFile {
+		data, err := prepareGzipFile(fileName, o.compressionLevel)
+
+		return preparedFile{
+			write: func() error {
+				if err != nil || data == nil {
+					return err
+				}
+
+				_, err := data.WriteTo(w)
+				return err
+			},
+			cleanup: func() {
+				if data != nil {
+					_ = data.Close()
+				}
+			},
+		}
+	})
 }
@@ -9,6 +9,7 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 )
 
@@ -111,3 +112,25 @@ func TestGzipArchivesExistingAndNonExistingFile(t *testing.T) {
 	// we have only one stream
 	testGzipStreams(t, &buffer, [][]byte{testGzipFileContent})
 }
+
+func TestGzipArchiveCompressionLevels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "test_dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	filePath := filepath.Join(dir, "file")
+	err = ioutil.WriteFile(filePath, bytes.Repeat(testGzipFileContent, 1000), 0644)
+	require.NoError(t, err)
+
+	sizes := make(map[CompressionLevel]int)
+	for _, level := range []CompressionLevel{CompressionLevelStore, CompressionLevelBest} {
+		var buffer bytes.Buffer
+		err = CreateGzipArchive(&buffer, []string{filePath}, WithCompressionLevel(level))
+		require.NoError(t, err)
+
+		sizes[level] = buffer.Len()
+		testGzipStreams(t, &buffer, [][]byte{bytes.Repeat(testGzipFileContent, 1000)})
+	}
+
+	assert.Greater(t, sizes[CompressionLevelStore], sizes[CompressionLevelBest])
+}
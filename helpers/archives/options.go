@@ -0,0 +1,98 @@
+package archives
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressionLevel selects the trade-off between the speed of the archiving
+// and the size of the archive
+type CompressionLevel string
+
+const (
+	CompressionLevelDefault CompressionLevel = "default"
+	CompressionLevelStore   CompressionLevel = "store"
+	CompressionLevelFastest CompressionLevel = "fastest"
+	CompressionLevelBest    CompressionLevel = "best"
+)
+
+// ParseCompressionLevel returns the compression level for its name, an empty
+// name selecting the default one
+func ParseCompressionLevel(name string) (CompressionLevel, error) {
+	switch level := CompressionLevel(name); level {
+	case "":
+		return CompressionLevelDefault, nil
+	case CompressionLevelDefault, CompressionLevelStore, CompressionLevelFastest, CompressionLevelBest:
+		return level, nil
+	default:
+		return "", fmt.Errorf("unsupported compression level: %s", name)
+	}
+}
+
+func (l CompressionLevel) flateLevel() int {
+	switch l {
+	case CompressionLevelStore:
+		return flate.NoCompression
+	case CompressionLevelFastest:
+		return flate.BestSpeed
+	case CompressionLevelBest:
+		return flate.BestCompression
+	default:
+		return flate.DefaultCompression
+	}
+}
+
+// zstdLevel returns the level of the zstd compression, which doesn't support
+// storing the data uncompressed
+func (l CompressionLevel) zstdLevel() zstd.EncoderLevel {
+	switch l {
+	case CompressionLevelStore, CompressionLevelFastest:
+		return zstd.SpeedFastest
+	case CompressionLevelBest:
+		return zstd.SpeedBestCompression
+	default:
+		return zstd.SpeedDefault
+	}
+}
+
+type options struct {
+	compressionLevel CompressionLevel
+	concurrency      int
+}
+
+// Option configures the creation or the extraction of an archive
+type Option func(*options)
+
+// WithCompressionLevel sets the compression level of the created archive
+func WithCompressionLevel(level CompressionLevel) Option {
+	return func(o *options) {
+		o.compressionLevel = level
+	}
+}
+
+// WithConcurrency sets the number of files compressed or extracted at the
+// same time, the number of CPUs when not positive
+func WithConcurrency(concurrency int) Option {
+	return func(o *options) {
+		o.concurrency = concurrency
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		compressionLevel: CompressionLevelDefault,
+	}
+
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.concurrency < 1 {
+		o.concurrency = runtime.NumCPU()
+	}
+
+	return o
+}
@@ -0,0 +1,48 @@
+package archives
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCompressionLevel(t *testing.T) {
+	tests := map[string]struct {
+		expectedLevel CompressionLevel
+		expectedErr   string
+	}{
+		"":        {expectedLevel: CompressionLevelDefault},
+		"default": {expectedLevel: CompressionLevelDefault},
+		"store":   {expectedLevel: CompressionLevelStore},
+		"fastest": {expectedLevel: CompressionLevelFastest},
+		"best":    {expectedLevel: CompressionLevelBest},
+		"fast":    {expectedErr: "unsupported compression level: fast"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			level, err := ParseCompressionLevel(name)
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedLevel, level)
+		})
+	}
+}
+
+func TestNewOptions(t *testing.T) {
+	o := newOptions(nil)
+	assert.Equal(t, CompressionLevelDefault, o.compressionLevel)
+	assert.Equal(t, runtime.NumCPU(), o.concurrency)
+
+	o = newOptions([]Option{WithCompressionLevel(CompressionLevelBest), WithConcurrency(3)})
+	assert.Equal(t, CompressionLevelBest, o.compressionLevel)
+	assert.Equal(t, 3, o.concurrency)
+
+	o = newOptions([]Option{WithConcurrency(-1)})
+	assert.Equal(t, runtime.NumCPU(), o.concurrency)
+}
@@ -0,0 +1,83 @@
+package archives
+
+// preparedFile is the result of the preparation of a file by a worker
+type preparedFile struct {
+	// write adds the file to the archive, it's called in the order of the
+	// files and only until one of them fails
+	write func() error
+	// cleanup releases the resources held by the file, it's always called
+	cleanup func()
+}
+
+type orderedTask struct {
+	fileName string
+	prepared preparedFile
+	done     chan struct{}
+}
+
+// writeOrdered prepares the files using concurrent workers, but writes them
+// in the order of the list to keep the archives reproducible. The number of
+// prepared files waiting to be written is bounded by the concurrency
+func writeOrdered(fileNames []string, concurrency int, prepare func(fileName string) preparedFile) error {
+	tasks := make(chan *orderedTask, concurrency)
+	stop := make(chan struct{})
+
+	go startOrderedTasks(fileNames, concurrency, prepare, tasks, stop)
+
+	var err error
+	for task := range tasks {
+		<-task.done
+
+		if err == nil && task.prepared.write != nil {
+			err = task.prepared.write()
+			if err != nil {
+				close(stop)
+			}
+		}
+
+		if task.prepared.cleanup != nil {
+			task.prepared.cleanup()
+		}
+	}
+
+	return err
+}
+
+func startOrderedTasks(
+	fileNames []string,
+	concurrency int,
+	prepare func(fileName string) preparedFile,
+	tasks chan<- *orderedTask,
+	stop <-chan struct{},
+) {
+	defer close(tasks)
+
+	workers := make(chan struct{}, concurrency)
+
+	for _, fileName := range fileNames {
+		task := &orderedTask{
+			fileName: fileName,
+			done:     make(chan struct{}),
+		}
+
+		select {
+		case tasks <- task:
+		case <-stop:
+			return
+		}
+
+		select {
+		case workers <- struct{}{}:
+		case <-stop:
+			close(task.done)
+			return
+		}
+
+		go func() {
+			defer func() { <-workers }()
+			defer close(task.done)
+
+			task.prepared = prepare(task.fileName)
+		}()
+	}
+}
@@ -0,0 +1,75 @@
+package archives
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteOrdered(t *testing.T) {
+	var fileNames []string
+	delays := make(map[string]time.Duration)
+	for i := 0; i < 20; i++ {
+		fileName := fmt.Sprintf("file_%d", i)
+		fileNames = append(fileNames, fileName)
+		// the later files are prepared faster
+		delays[fileName] = time.Duration(20-i) * time.Millisecond / 10
+	}
+
+	var written []string
+	var cleanups int32
+
+	err := writeOrdered(fileNames, 4, func(fileName string) preparedFile {
+		time.Sleep(delays[fileName])
+
+		return preparedFile{
+			write: func() error {
+				written = append(written, fileName)
+				return nil
+			},
+			cleanup: func() {
+				atomic.AddInt32(&cleanups, 1)
+			},
+		}
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, fileNames, written)
+	assert.Equal(t, int32(len(fileNames)), atomic.LoadInt32(&cleanups))
+}
+
+func TestWriteOrderedStopsOnError(t *testing.T) {
+	var fileNames []string
+	for i := 0; i < 100; i++ {
+		fileNames = append(fileNames, fmt.Sprintf("file_%d", i))
+	}
+
+	var written int
+	var prepared, cleanups int32
+
+	err := writeOrdered(fileNames, 2, func(fileName string) preparedFile {
+		atomic.AddInt32(&prepared, 1)
+
+		return preparedFile{
+			write: func() error {
+				written++
+				if fileName == "file_3" {
+					return errors.New("write failed")
+				}
+				return nil
+			},
+			cleanup: func() {
+				atomic.AddInt32(&cleanups, 1)
+			},
+		}
+	})
+
+	assert.EqualError(t, err, "write failed")
+	assert.Equal(t, 4, written)
+	assert.Less(t, atomic.LoadInt32(&prepared), int32(len(fileNames)))
+	assert.Equal(t, atomic.LoadInt32(&prepared), atomic.LoadInt32(&cleanups))
+}
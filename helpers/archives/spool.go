@@ -0,0 +1,77 @@
+package archives
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// spoolMemoryLimit is the amount of data kept in memory by the spool, the
+// rest is written to a temporary file
+const spoolMemoryLimit = 1024 * 1024
+
+// spool holds the data of an archive entry until it's its turn to be written
+// to the archive
+type spool struct {
+	buffer bytes.Buffer
+	file   *os.File
+	size   int64
+}
+
+func (s *spool) Write(p []byte) (n int, err error) {
+	if s.file == nil && s.buffer.Len()+len(p) <= spoolMemoryLimit {
+		n, err = s.buffer.Write(p)
+		s.size += int64(n)
+		return n, err
+	}
+
+	if s.file == nil {
+		s.file, err = ioutil.TempFile("", "archive_spool_")
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	n, err = s.file.Write(p)
+	s.size += int64(n)
+	return n, err
+}
+
+func (s *spool) Size() int64 {
+	return s.size
+}
+
+// WriteTo writes the data held in memory followed by the one written to
+// the temporary file
+func (s *spool) WriteTo(w io.Writer) (int64, error) {
+	n, err := s.buffer.WriteTo(w)
+	if err != nil || s.file == nil {
+		return n, err
+	}
+
+	_, err = s.file.Seek(0, io.SeekStart)
+	if err != nil {
+		return n, err
+	}
+
+	m, err := io.Copy(w, s.file)
+	return n + m, err
+}
+
+func (s *spool) Close() error {
+	if s.file == nil {
+		return nil
+	}
+
+	_ = s.file.Close()
+	return os.Remove(s.file.Name())
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
@@ -0,0 +1,52 @@
+package archives
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSpool(t *testing.T) {
+	tests := map[string]struct {
+		size         int
+		expectedFile bool
+	}{
+		"kept in memory": {
+			size: spoolMemoryLimit,
+		},
+		"written to a temporary file": {
+			size:         spoolMemoryLimit + 1,
+			expectedFile: true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			data := bytes.Repeat([]byte("x"), tt.size)
+
+			s := new(spool)
+			defer s.Close()
+
+			for i := 0; i < len(data); i += 1000 {
+				end := i + 1000
+				if end > len(data) {
+					end = len(data)
+				}
+
+				_, err := s.Write(data[i:end])
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, int64(tt.size), s.Size())
+			assert.Equal(t, tt.expectedFile, s.file != nil)
+
+			var out bytes.Buffer
+			n, err := s.WriteTo(&out)
+			require.NoError(t, err)
+			assert.Equal(t, int64(tt.size), n)
+			assert.Equal(t, data, out.Bytes())
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package archives
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+)
+
+func createTarEntry(archive *tar.Writer, fileName string) error {
+	fi, err := os.Lstat(fileName)
+	if err != nil {
+		logrus.Warningln("File ignored:", err)
+		return nil
+	}
+
+	var link string
+	switch fi.Mode() & os.ModeType {
+	case os.ModeSymlink:
+		link, err = os.Readlink(fileName)
+		if err != nil {
+			return err
+		}
+
+	case os.ModeNamedPipe, os.ModeSocket, os.ModeDevice:
+		// Ignore the files that of these types
+		logrus.Warningln("File ignored:", fileName)
+		return nil
+	}
+
+	header, err := tar.FileInfoHeader(fi, link)
+	if err != nil {
+		return err
+	}
+	header.Name = filepath.ToSlash(fileName)
+	if fi.IsDir() {
+		header.Name += "/"
+	}
+
+	err = archive.WriteHeader(header)
+	if err != nil || !fi.Mode().IsRegular() {
+		return err
+	}
+
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = file.Close() }()
+
+	_, err = io.CopyN(archive, file, header.Size)
+	return err
+}
+
+// CreateTarArchive writes the files to an uncompressed tar archive
+func CreateTarArchive(w io.Writer, fileNames []string) error {
+	tracker := newPathErrorTracker()
+
+	archive := tar.NewWriter(w)
+
+	for _, fileName := range fileNames {
+		if err := errorIfGitDirectory(fileName); tracker.actionable(err) {
+			printGitArchiveWarning("archive")
+		}
+
+		err := createTarEntry(archive, fileName)
+		if err != nil {
+			return err
+		}
+	}
+
+	return archive.Close()
+}
+
+// CreateTarZstdArchive writes the files to a tar archive compressed with
+// zstd, the compression using concurrent workers
+func CreateTarZstdArchive(w io.Writer, fileNames []string, opts ...Option) error {
+	o := newOptions(opts)
+
+	encoder, err := zstd.NewWriter(
+		w,
+		zstd.WithEncoderLevel(o.compressionLevel.zstdLevel()),
+		zstd.WithEncoderConcurrency(o.concurrency),
+	)
+	if err != nil {
+		return err
+	}
+
+	err = CreateTarArchive(encoder, fileNames)
+	closeErr := encoder.Close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
@@ -0,0 +1,129 @@
+package archives
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readTarHeaders(t *testing.T, r io.Reader) []*tar.Header {
+	var headers []*tar.Header
+
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return headers
+		}
+		require.NoError(t, err)
+
+		if header.Typeflag == tar.TypeReg {
+			content, err := ioutil.ReadAll(archive)
+			require.NoError(t, err)
+			assert.Equal(t, testZipFileContent, content)
+		}
+
+		headers = append(headers, header)
+	}
+}
+
+func TestTarCreate(t *testing.T) {
+	testInWorkDir(t, func(t *testing.T, fileName string) {
+		paths := []string{
+			createTestFile(t, singleByte),
+			createSymlinkFile(t, singleByte),
+			createTestDirectory(t, singleByte),
+			createTestPipe(t, singleByte),
+			createTestFile(t, multiBytes),
+			createSymlinkFile(t, multiBytes),
+			createTestDirectory(t, multiBytes),
+			createTestPipe(t, multiBytes),
+			"non_existing_file.txt",
+		}
+
+		var buffer bytes.Buffer
+		err := CreateTarArchive(&buffer, paths)
+		require.NoError(t, err)
+
+		headers := readTarHeaders(t, &buffer)
+		require.Len(t, headers, 6)
+
+		assert.Equal(t, paths[0], headers[0].Name)
+		assert.Equal(t, byte(tar.TypeReg), headers[0].Typeflag)
+		assert.Equal(t, int64(0640), headers[0].Mode&0777)
+
+		assert.Equal(t, paths[1], headers[1].Name)
+		assert.Equal(t, byte(tar.TypeSymlink), headers[1].Typeflag)
+		assert.Equal(t, "old_symlink", headers[1].Linkname)
+
+		assert.Equal(t, paths[2]+"/", headers[2].Name)
+		assert.Equal(t, byte(tar.TypeDir), headers[2].Typeflag)
+
+		assert.Equal(t, paths[4], headers[3].Name)
+		assert.Equal(t, paths[5], headers[4].Name)
+		assert.Equal(t, paths[6]+"/", headers[5].Name)
+	})
+}
+
+func TestTarCreateWithGitPath(t *testing.T) {
+	testInWorkDir(t, func(t *testing.T, fileName string) {
+		output := logrus.StandardLogger().Out
+		var buf bytes.Buffer
+		logrus.SetOutput(&buf)
+		defer logrus.SetOutput(output)
+
+		paths := []string{
+			createTestGitPathFile(t, singleByte),
+		}
+
+		var buffer bytes.Buffer
+		err := CreateTarArchive(&buffer, paths)
+		require.NoError(t, err)
+
+		assert.Contains(t, buf.String(), "Part of .git directory is on the list of files to archive")
+		assert.Len(t, readTarHeaders(t, &buffer), 1)
+	})
+}
+
+func TestTarZstdCreate(t *testing.T) {
+	testInWorkDir(t, func(t *testing.T, fileName string) {
+		paths := []string{
+			createTestFile(t, singleByte),
+			createTestDirectory(t, singleByte),
+		}
+
+		for _, level := range []CompressionLevel{CompressionLevelStore, CompressionLevelDefault, CompressionLevelBest} {
+			var buffer bytes.Buffer
+			err := CreateTarZstdArchive(&buffer, paths, WithCompressionLevel(level), WithConcurrency(2))
+			require.NoError(t, err)
+
+			decoder, err := zstd.NewReader(&buffer)
+			require.NoError(t, err)
+
+			headers := readTarHeaders(t, decoder)
+			decoder.Close()
+
+			require.Len(t, headers, 2)
+			assert.Equal(t, paths[0], headers[0].Name)
+			assert.Equal(t, paths[1]+"/", headers[1].Name)
+		}
+	})
+}
+
+func TestTarCreateWriteFailure(t *testing.T) {
+	testInWorkDir(t, func(t *testing.T, fileName string) {
+		paths := []string{
+			createTestFile(t, singleByte),
+		}
+
+		err := CreateTarArchive(failingWriter{}, paths)
+		assert.EqualError(t, err, "write failed")
+	})
+}
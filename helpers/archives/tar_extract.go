@@ -0,0 +1,150 @@
+package archives
+
+import (
+	"archive/tar"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/sirupsen/logrus"
+)
+
+func extractTarDirectoryEntry(header *tar.Header) error {
+	err := os.Mkdir(header.Name, header.FileInfo().Mode().Perm())
+
+	// The error that directory does exists is not a error for us
+	if os.IsExist(err) {
+		err = nil
+	}
+	return err
+}
+
+func extractTarSymlinkEntry(header *tar.Header) error {
+	// Remove symlink before creating a new one, otherwise we can error that file does exist
+	_ = os.Remove(header.Name)
+	return os.Symlink(header.Linkname, header.Name)
+}
+
+func extractTarFileEntry(r io.Reader, header *tar.Header) error {
+	// Remove file before creating a new one, otherwise we can error that file does exist
+	_ = os.Remove(header.Name)
+	out, err := os.OpenFile(header.Name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, header.FileInfo().Mode().Perm())
+	if err != nil {
+		return err
+	}
+	defer func() { _ = out.Close() }()
+
+	_, err = io.Copy(out, r)
+	return err
+}
+
+func extractTarEntry(r io.Reader, header *tar.Header) error {
+	// Create all parents to extract the file
+	err := os.MkdirAll(filepath.Dir(header.Name), 0777)
+	if err != nil {
+		return err
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		return extractTarDirectoryEntry(header)
+
+	case tar.TypeSymlink:
+		return extractTarSymlinkEntry(header)
+
+	case tar.TypeReg:
+		return extractTarFileEntry(r, header)
+
+	default:
+		// Ignore the files that of these types
+		logrus.Warningf("File ignored: %q", header.Name)
+		return nil
+	}
+}
+
+// restoreTarMetadata sets the permissions, the owner and the modification
+// time of the extracted file
+func restoreTarMetadata(header *tar.Header) error {
+	if header.Typeflag != tar.TypeSymlink {
+		err := os.Chmod(header.Name, header.FileInfo().Mode().Perm())
+		if err != nil {
+			return err
+		}
+
+		err = os.Chtimes(header.Name, header.ModTime, header.ModTime)
+		if err != nil {
+			return err
+		}
+	}
+
+	return lchownTarEntry(header)
+}
+
+// ExtractTarArchive extracts the files of the tar archive, the metadata being
+// restored once all of them are written as the directories may be read-only.
+// The symlinks are created after the other entries, so that the files aren't
+// written through them
+func ExtractTarArchive(r io.Reader) error {
+	tracker := newPathErrorTracker()
+
+	var headers, symlinks []*tar.Header
+
+	archive := tar.NewReader(r)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		header.Name = filepath.FromSlash(header.Name)
+
+		if err := errorIfGitDirectory(header.Name); tracker.actionable(err) {
+			printGitArchiveWarning("extract")
+		}
+
+		if header.Typeflag == tar.TypeSymlink {
+			symlinks = append(symlinks, header)
+			continue
+		}
+
+		if err := extractTarEntry(archive, header); tracker.actionable(err) {
+			logrus.Warningf("%s: %s (suppressing repeats)", header.Name, err)
+			continue
+		}
+
+		headers = append(headers, header)
+	}
+
+	for _, header := range symlinks {
+		if err := extractTarEntry(nil, header); tracker.actionable(err) {
+			logrus.Warningf("%s: %s (suppressing repeats)", header.Name, err)
+			continue
+		}
+
+		headers = append(headers, header)
+	}
+
+	for _, header := range headers {
+		if err := restoreTarMetadata(header); tracker.actionable(err) {
+			logrus.Warningf("%s: %s (suppressing repeats)", header.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// ExtractTarZstdArchive extracts the files of the tar archive compressed with
+// zstd, the decompression using concurrent workers
+func ExtractTarZstdArchive(r io.Reader, opts ...Option) error {
+	o := newOptions(opts)
+
+	decoder, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(o.concurrency))
+	if err != nil {
+		return err
+	}
+	defer decoder.Close()
+
+	return ExtractTarArchive(decoder)
+}
@@ -0,0 +1,131 @@
+package archives
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func createTarArchive(t *testing.T, headers []*tar.Header, content []byte) *bytes.Buffer {
+	var buffer bytes.Buffer
+
+	archive := tar.NewWriter(&buffer)
+	for _, header := range headers {
+		if header.Typeflag == tar.TypeReg {
+			header.Size = int64(len(content))
+		}
+
+		require.NoError(t, archive.WriteHeader(header))
+
+		if header.Typeflag == tar.TypeReg {
+			_, err := archive.Write(content)
+			require.NoError(t, err)
+		}
+	}
+	require.NoError(t, archive.Close())
+
+	return &buffer
+}
+
+func TestExtractTarArchive(t *testing.T) {
+	testInWorkDir(t, func(t *testing.T, fileName string) {
+		modTime := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+		buffer := createTarArchive(t, []*tar.Header{
+			{Typeflag: tar.TypeDir, Name: "directory/", Mode: 0711, ModTime: modTime},
+			{Typeflag: tar.TypeReg, Name: "directory/file.txt", Mode: 0640, ModTime: modTime},
+			{Typeflag: tar.TypeReg, Name: "parent/file.txt", Mode: 0600, ModTime: modTime},
+			{Typeflag: tar.TypeSymlink, Name: "directory/symlink", Linkname: "file.txt", ModTime: modTime},
+			{Typeflag: tar.TypeFifo, Name: "pipe", Mode: 0600, ModTime: modTime},
+		}, testZipFileContent)
+
+		err := ExtractTarArchive(buffer)
+		require.NoError(t, err)
+
+		fi, err := os.Stat("directory")
+		require.NoError(t, err)
+		assert.True(t, fi.IsDir())
+		assert.Equal(t, os.FileMode(0711), fi.Mode().Perm())
+		assert.Equal(t, modTime, fi.ModTime())
+
+		content, err := ioutil.ReadFile("directory/file.txt")
+		require.NoError(t, err)
+		assert.Equal(t, testZipFileContent, content)
+
+		fi, err = os.Stat("directory/file.txt")
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0640), fi.Mode().Perm())
+		assert.Equal(t, modTime, fi.ModTime())
+
+		_, err = os.Stat("parent/file.txt")
+		assert.NoError(t, err)
+
+		link, err := os.Readlink("directory/symlink")
+		require.NoError(t, err)
+		assert.Equal(t, "file.txt", link)
+
+		_, err = os.Lstat("pipe")
+		assert.True(t, os.IsNotExist(err), "expected pipe to be ignored")
+	})
+}
+
+func TestExtractTarArchiveDoesNotWriteThroughSymlinks(t *testing.T) {
+	outside, err := ioutil.TempDir("", "outside")
+	require.NoError(t, err)
+	defer os.RemoveAll(outside)
+
+	testInWorkDir(t, func(t *testing.T, fileName string) {
+		buffer := createTarArchive(t, []*tar.Header{
+			{Typeflag: tar.TypeSymlink, Name: "link", Linkname: outside, ModTime: time.Now()},
+			{Typeflag: tar.TypeReg, Name: "link/file.txt", Mode: 0600, ModTime: time.Now()},
+		}, testZipFileContent)
+
+		err := ExtractTarArchive(buffer)
+		require.NoError(t, err)
+
+		_, err = os.Stat(filepath.Join(outside, "file.txt"))
+		assert.True(t, os.IsNotExist(err), "expected the file not to be written outside of the directory")
+
+		content, err := ioutil.ReadFile(filepath.Join("link", "file.txt"))
+		require.NoError(t, err)
+		assert.Equal(t, testZipFileContent, content)
+
+		fi, err := os.Lstat("link")
+		require.NoError(t, err)
+		assert.True(t, fi.IsDir(), "expected the symlink not to replace the directory")
+	})
+}
+
+func TestExtractTarArchiveWithGitPath(t *testing.T) {
+	testInWorkDir(t, func(t *testing.T, fileName string) {
+		output := logrus.StandardLogger().Out
+		var buf bytes.Buffer
+		logrus.SetOutput(&buf)
+		defer logrus.SetOutput(output)
+
+		buffer := createTarArchive(t, []*tar.Header{
+			{Typeflag: tar.TypeReg, Name: ".git/test_file", Mode: 0640},
+		}, testZipFileContent)
+
+		err := ExtractTarArchive(buffer)
+		require.NoError(t, err)
+
+		assert.Contains(t, buf.String(), "Part of .git directory is on the list of files to extract")
+
+		_, err = os.Stat(".git/test_file")
+		assert.NoError(t, err)
+	})
+}
+
+func TestExtractTarArchiveInvalid(t *testing.T) {
+	err := ExtractTarArchive(bytes.NewBufferString("not a tar archive"))
+	assert.Error(t, err)
+}
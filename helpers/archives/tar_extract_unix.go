@@ -0,0 +1,12 @@
+// +build linux darwin freebsd openbsd
+
+package archives
+
+import (
+	"archive/tar"
+	"os"
+)
+
+func lchownTarEntry(header *tar.Header) error {
+	return os.Lchown(header.Name, header.Uid, header.Gid)
+}
@@ -0,0 +1,8 @@
+package archives
+
+import "archive/tar"
+
+func lchownTarEntry(header *tar.Header) error {
+	// TODO: currently not supported
+	return nil
+}
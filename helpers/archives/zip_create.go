@@ -1,12 +1,12 @@
 package archives
 
 import (
-	"archive/zip"
+	"hash/crc32"
 	"io"
-	"io/ioutil"
 	"os"
-	"path/filepath"
 
+	"github.com/klauspost/compress/flate"
+	"github.com/klauspost/compress/zip"
 	"github.com/sirupsen/logrus"
 )
 
@@ -31,106 +31,156 @@ func createZipSymlinkEntry(archive *zip.Writer, fh *zip.FileHeader) error {
 	return err
 }
 
-func createZipFileEntry(archive *zip.Writer, fh *zip.FileHeader) error {
-	fh.Method = zip.Deflate
-	fw, err := archive.CreateHeader(fh)
-	if err != nil {
-		return err
+// zipEntry is a file of the archive, with its content compressed ahead of
+// being written when it's a regular file
+type zipEntry struct {
+	header *zip.FileHeader
+	mode   os.FileMode
+	data   *spool
+}
+
+func (e *zipEntry) close() {
+	if e.data != nil {
+		_ = e.data.Close()
 	}
+}
 
+// compressZipFileEntry compresses the content of the file, setting the
+// checksum and the sizes needed to write it raw to the archive
+func compressZipFileEntry(fh *zip.FileHeader, level CompressionLevel) (*spool, error) {
 	file, err := os.Open(fh.Name)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer func() { _ = file.Close() }()
 
-	_, err = io.Copy(fw, file)
-	_ = file.Close()
+	data := new(spool)
+
+	var compressor io.WriteCloser = nopWriteCloser{Writer: data}
+	fh.Method = zip.Store
+	if level != CompressionLevelStore {
+		fh.Method = zip.Deflate
+		compressor, err = flate.NewWriter(data, level.flateLevel())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	checksum := crc32.NewIEEE()
+	n, err := io.Copy(io.MultiWriter(compressor, checksum), file)
+	if err == nil {
+		err = compressor.Close()
+	}
+	if err != nil {
+		_ = data.Close()
+		return nil, err
+	}
+
+	fh.CRC32 = checksum.Sum32()
+	fh.UncompressedSize64 = uint64(n)
+	fh.CompressedSize64 = uint64(data.Size())
+
+	return data, nil
+}
+
+func createZipFileEntry(archive *zip.Writer, entry *zipEntry) error {
+	fw, err := archive.CreateHeaderRaw(entry.header)
 	if err != nil {
 		return err
 	}
-	return nil
+
+	_, err = entry.data.WriteTo(fw)
+	return err
 }
 
-func createZipEntry(archive *zip.Writer, fileName string) error {
+// prepareZipEntry reads the metadata of the file and compresses its content,
+// it returns a nil entry for the ignored files
+func prepareZipEntry(fileName string, level CompressionLevel) (*zipEntry, error) {
 	fi, err := os.Lstat(fileName)
 	if err != nil {
 		logrus.Warningln("File ignored:", err)
-		return nil
+		return nil, nil
 	}
 
 	fh, err := zip.FileInfoHeader(fi)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	fh.Name = fileName
 	fh.Extra = createZipExtra(fi)
 	// Set EFS flag to indicate that filenames and comments are UTF-8 encoded
 	fh.Flags |= 0x800
 
-	switch fi.Mode() & os.ModeType {
-	case os.ModeDir:
-		return createZipDirectoryEntry(archive, fh)
+	entry := &zipEntry{header: fh, mode: fi.Mode()}
 
-	case os.ModeSymlink:
-		return createZipSymlinkEntry(archive, fh)
+	switch fi.Mode() & os.ModeType {
+	case os.ModeDir, os.ModeSymlink:
+		return entry, nil
 
 	case os.ModeNamedPipe, os.ModeSocket, os.ModeDevice:
 		// Ignore the files that of these types
 		logrus.Warningln("File ignored:", fileName)
-		return nil
+		return nil, nil
 
 	default:
-		return createZipFileEntry(archive, fh)
+		entry.data, err = compressZipFileEntry(fh, level)
+		return entry, err
 	}
 }
 
-func CreateZipArchive(w io.Writer, fileNames []string) error {
-	tracker := newPathErrorTracker()
-
-	archive := zip.NewWriter(w)
-	defer func() { _ = archive.Close() }()
+func createZipEntry(archive *zip.Writer, entry *zipEntry) error {
+	switch entry.mode & os.ModeType {
+	case os.ModeDir:
+		return createZipDirectoryEntry(archive, entry.header)
 
-	for _, fileName := range fileNames {
-		if err := errorIfGitDirectory(fileName); tracker.actionable(err) {
-			printGitArchiveWarning("archive")
-		}
+	case os.ModeSymlink:
+		return createZipSymlinkEntry(archive, entry.header)
 
-		err := createZipEntry(archive, fileName)
-		if err != nil {
-			return err
-		}
+	default:
+		return createZipFileEntry(archive, entry)
 	}
-
-	return nil
 }
 
-func CreateZipFile(fileName string, fileNames []string) error {
-	// create directories to store archive
-	err := os.MkdirAll(filepath.Dir(fileName), 0700)
-	if err != nil {
-		return err
-	}
+// CreateZipArchive writes the files to a zip archive. The files are
+// compressed concurrently, but written in the order of the list
+func CreateZipArchive(w io.Writer, fileNames []string, opts ...Option) error {
+	o := newOptions(opts)
+	tracker := newPathErrorTracker()
 
-	tempFile, err := ioutil.TempFile(filepath.Dir(fileName), "archive_")
-	if err != nil {
-		return err
-	}
-	defer func() {
-		_ = tempFile.Close()
-		_ = os.Remove(tempFile.Name())
-	}()
+	archive := zip.NewWriter(w)
 
-	logrus.Debugln("Temporary file:", tempFile.Name())
-	err = CreateZipArchive(tempFile, fileNames)
-	if err != nil {
-		return err
-	}
-	_ = tempFile.Close()
+	err := writeOrdered(fileNames, o.concurrency, func(fileName string) preparedFile {
+		entry, err := prepareZipEntry(fileName, o.compressionLevel)
+
+		return preparedFile{
+			write: func() error {
+				if err := errorIfGitDirectory(fileName); tracker.actionable(err) {
+					printGitArchiveWarning("archive")
+				}
+
+				if err != nil || entry == nil {
+					return err
+				}
+
+				return createZipEntry(archive, entry)
+			},
+			cleanup: func() {
+				if entry != nil {
+					entry.close()
+				}
+			},
+		}
+	})
 
-	err = os.Rename(tempFile.Name(), fileName)
+	// the central directory is written even when the archive is incomplete
+	closeErr := archive.Close()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return closeErr
+}
+
+func CreateZipFile(fileName string, fileNames []string, opts ...Option) error {
+	return CreateFile(fileName, FormatZip, fileNames, opts...)
 }
@@ -3,6 +3,8 @@ package archives
 import (
 	"archive/zip"
 	"bytes"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"syscall"
@@ -178,3 +180,97 @@ func TestZipCreateWithGitPath(t *testing.T) {
 		assert.NotEmpty(t, archive.File[1].Extra)
 	})
 }
+
+func TestZipCreateCompressionLevels(t *testing.T) {
+	tests := map[CompressionLevel]uint16{
+		CompressionLevelStore:   zip.Store,
+		CompressionLevelFastest: zip.Deflate,
+		CompressionLevelDefault: zip.Deflate,
+		CompressionLevelBest:    zip.Deflate,
+	}
+
+	for level, expectedMethod := range tests {
+		t.Run(string(level), func(t *testing.T) {
+			testInWorkDir(t, func(t *testing.T, fileName string) {
+				paths := []string{
+					createTestFile(t, singleByte),
+					createSymlinkFile(t, singleByte),
+				}
+				err := CreateZipFile(fileName, paths, WithCompressionLevel(level))
+				require.NoError(t, err)
+
+				archive, err := zip.OpenReader(fileName)
+				require.NoError(t, err)
+				defer archive.Close()
+
+				require.Len(t, archive.File, 2)
+				assert.Equal(t, expectedMethod, archive.File[0].Method)
+
+				r, err := archive.File[0].Open()
+				require.NoError(t, err)
+				defer r.Close()
+
+				content, err := ioutil.ReadAll(r)
+				require.NoError(t, err)
+				assert.Equal(t, testZipFileContent, content)
+			})
+		})
+	}
+}
+
+func TestZipCreateConcurrently(t *testing.T) {
+	testInWorkDir(t, func(t *testing.T, fileName string) {
+		var paths []string
+		contents := make(map[string][]byte)
+
+		for i := 0; i < 50; i++ {
+			name := fmt.Sprintf("file_%d.txt", i)
+			// every tenth file is spooled to a temporary file
+			content := bytes.Repeat([]byte(name), (i%10)*spoolMemoryLimit/len(name)/5+1)
+
+			err := ioutil.WriteFile(name, content, 0640)
+			require.NoError(t, err)
+
+			paths = append(paths, name)
+			contents[name] = content
+		}
+
+		err := CreateZipFile(fileName, paths, WithConcurrency(4))
+		require.NoError(t, err)
+
+		archive, err := zip.OpenReader(fileName)
+		require.NoError(t, err)
+		defer archive.Close()
+
+		require.Len(t, archive.File, len(paths))
+		for i, file := range archive.File {
+			assert.Equal(t, paths[i], file.Name)
+
+			r, err := file.Open()
+			require.NoError(t, err)
+
+			content, err := ioutil.ReadAll(r)
+			_ = r.Close()
+			require.NoError(t, err)
+			assert.Equal(t, contents[file.Name], content)
+		}
+	})
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("write failed")
+}
+
+func TestZipCreateWriteFailure(t *testing.T) {
+	testInWorkDir(t, func(t *testing.T, fileName string) {
+		paths := []string{
+			createTestFile(t, singleByte),
+			createTestFile(t, multiBytes),
+		}
+
+		err := CreateZipArchive(failingWriter{}, paths, WithConcurrency(2))
+		assert.EqualError(t, err, "write failed")
+	})
+}
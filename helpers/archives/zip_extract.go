@@ -6,6 +6,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/sirupsen/logrus"
 )
@@ -83,19 +84,86 @@ func extractZipFile(file *zip.File) (err error) {
 	return
 }
 
-func ExtractZipArchive(archive *zip.Reader) error {
+// latestZipFiles returns the files of the archive, keeping only the last
+// entry when a name is repeated as it's the one overwriting the others
+func latestZipFiles(files []*zip.File) []*zip.File {
+	latest := make(map[string]int, len(files))
+	for i, file := range files {
+		latest[file.Name] = i
+	}
+
+	result := make([]*zip.File, 0, len(latest))
+	for i, file := range files {
+		if latest[file.Name] == i {
+			result = append(result, file)
+		}
+	}
+
+	return result
+}
+
+func extractZipFilesConcurrently(files []*zip.File, concurrency int, extract func(file *zip.File)) {
+	queue := make(chan *zip.File)
+
+	wg := new(sync.WaitGroup)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for file := range queue {
+				extract(file)
+			}
+		}()
+	}
+
+	for _, file := range files {
+		queue <- file
+	}
+	close(queue)
+
+	wg.Wait()
+}
+
+// ExtractZipArchive extracts the files of the archive. The directories are
+// created first, then the regular files are extracted concurrently and the
+// symlinks are created last, so that the files aren't written through them
+func ExtractZipArchive(archive *zip.Reader, opts ...Option) error {
+	o := newOptions(opts)
 	tracker := newPathErrorTracker()
 
-	for _, file := range archive.File {
+	extract := func(file *zip.File) {
+		if err := extractZipFile(file); tracker.actionable(err) {
+			logrus.Warningf("%s: %s (suppressing repeats)", file.Name, err)
+		}
+	}
+
+	var directories, files, symlinks []*zip.File
+	for _, file := range latestZipFiles(archive.File) {
 		if err := errorIfGitDirectory(file.Name); tracker.actionable(err) {
 			printGitArchiveWarning("extract")
 		}
 
-		if err := extractZipFile(file); tracker.actionable(err) {
-			logrus.Warningf("%s: %s (suppressing repeats)", file.Name, err)
+		switch file.Mode() & os.ModeType {
+		case os.ModeDir:
+			directories = append(directories, file)
+		case os.ModeSymlink:
+			symlinks = append(symlinks, file)
+		default:
+			files = append(files, file)
 		}
 	}
 
+	for _, file := range directories {
+		extract(file)
+	}
+
+	extractZipFilesConcurrently(files, o.concurrency, extract)
+
+	for _, file := range symlinks {
+		extract(file)
+	}
+
 	for _, file := range archive.File {
 		// Update file permissions
 		if err := os.Chmod(file.Name, file.Mode().Perm()); tracker.actionable(err) {
@@ -111,12 +179,12 @@ func ExtractZipArchive(archive *zip.Reader) error {
 	return nil
 }
 
-func ExtractZipFile(fileName string) error {
+func ExtractZipFile(fileName string, opts ...Option) error {
 	archive, err := zip.OpenReader(fileName)
 	if err != nil {
 		return err
 	}
 	defer func() { _ = archive.Close() }()
 
-	return ExtractZipArchive(&archive.Reader)
+	return ExtractZipArchive(&archive.Reader, opts...)
 }
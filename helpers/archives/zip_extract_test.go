@@ -3,6 +3,7 @@ package archives
 import (
 	"archive/zip"
 	"bytes"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
@@ -94,3 +95,41 @@ func TestExtractZipFileNotFound(t *testing.T) {
 	err := ExtractZipFile("non_existing_zip_file.zip")
 	assert.Error(t, err)
 }
+
+func createArchiveWithManyFiles(t *testing.T, archive *zip.Writer) {
+	_, err := archive.Create("many_files/")
+	require.NoError(t, err)
+
+	for i := 0; i < 50; i++ {
+		testFile, err := archive.Create(fmt.Sprintf("many_files/file_%d.txt", i))
+		require.NoError(t, err)
+		_, err = fmt.Fprintf(testFile, "test file %d", i)
+		require.NoError(t, err)
+	}
+
+	// the last entry of a repeated name is extracted
+	testFile, err := archive.Create("many_files/file_0.txt")
+	require.NoError(t, err)
+	_, err = io.WriteString(testFile, "overwritten")
+	require.NoError(t, err)
+}
+
+func TestExtractZipFileConcurrently(t *testing.T) {
+	testOnArchive(t, createArchiveWithManyFiles, func(t *testing.T, fileName string) {
+		defer os.RemoveAll("many_files")
+
+		err := ExtractZipFile(fileName, WithConcurrency(4))
+		require.NoError(t, err)
+
+		for i := 0; i < 50; i++ {
+			content, err := ioutil.ReadFile(fmt.Sprintf("many_files/file_%d.txt", i))
+			require.NoError(t, err)
+
+			expectedContent := fmt.Sprintf("test file %d", i)
+			if i == 0 {
+				expectedContent = "overwritten"
+			}
+			assert.Equal(t, expectedContent, string(content))
+		}
+	})
+}
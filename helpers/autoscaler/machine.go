@@ -0,0 +1,192 @@
+package autoscaler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+const connectCacheTime = 5 * time.Minute
+
+var errProvisionNotSupported = errors.New("instance providers don't support provisioning of existing instances")
+
+// Machine implements docker.Machine on top of instance provider plugins, so
+// that the docker+machine autoscaling logic can be used with them. The driver
+// passed to Create is the path of the plugin executable.
+type Machine struct {
+	lock sync.RWMutex
+
+	// providers are the instance providers known so far, by plugin path
+	providers map[string]InstanceProvider
+	// instances maps the name of the instances to the plugin path
+	instances map[string]string
+	// connectCache stores until when an instance is known to be reachable
+	connectCache map[string]time.Time
+
+	newProvider func(path string) InstanceProvider
+}
+
+func NewMachine() *Machine {
+	return &Machine{
+		providers:    make(map[string]InstanceProvider),
+		instances:    make(map[string]string),
+		connectCache: make(map[string]time.Time),
+		newProvider:  NewPlugin,
+	}
+}
+
+// Register makes the plugin known, so that its instances are listed
+func (m *Machine) Register(path string) InstanceProvider {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.register(path)
+}
+
+func (m *Machine) register(path string) InstanceProvider {
+	provider, ok := m.providers[path]
+	if !ok {
+		provider = m.newProvider(path)
+		m.providers[path] = provider
+	}
+
+	return provider
+}
+
+func (m *Machine) providerFor(name string) (InstanceProvider, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	path, ok := m.instances[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown instance %q", name)
+	}
+
+	return m.providers[path], nil
+}
+
+func (m *Machine) Create(driver, name string, opts ...string) error {
+	m.lock.Lock()
+	provider := m.register(driver)
+	m.instances[name] = driver
+	m.lock.Unlock()
+
+	logrus.WithFields(logrus.Fields{
+		"operation": "create",
+		"plugin":    driver,
+		"name":      name,
+	}).Debugln("Creating instance")
+
+	return provider.Create(context.Background(), name, opts)
+}
+
+func (m *Machine) Provision(name string) error {
+	return errProvisionNotSupported
+}
+
+func (m *Machine) Remove(name string) error {
+	provider, err := m.providerFor(name)
+	if err != nil {
+		return err
+	}
+
+	err = provider.Delete(context.Background(), name)
+	if err != nil {
+		return err
+	}
+
+	m.lock.Lock()
+	delete(m.instances, name)
+	delete(m.connectCache, name)
+	m.lock.Unlock()
+
+	return nil
+}
+
+// Stop does nothing, instances are stopped when they are deleted
+func (m *Machine) Stop(name string, timeout time.Duration) error {
+	return nil
+}
+
+func (m *Machine) List() ([]string, error) {
+	m.lock.RLock()
+	providers := make(map[string]InstanceProvider, len(m.providers))
+	for path, provider := range m.providers {
+		providers[path] = provider
+	}
+	m.lock.RUnlock()
+
+	var names []string
+	for path, provider := range providers {
+		instances, err := provider.List(context.Background())
+		if err != nil {
+			return nil, err
+		}
+
+		m.lock.Lock()
+		for _, name := range instances {
+			m.instances[name] = path
+		}
+		m.lock.Unlock()
+
+		names = append(names, instances...)
+	}
+
+	return names, nil
+}
+
+func (m *Machine) Exist(name string) bool {
+	provider, err := m.providerFor(name)
+	if err != nil {
+		return false
+	}
+
+	instances, err := provider.List(context.Background())
+	if err != nil {
+		return false
+	}
+
+	for _, instance := range instances {
+		if instance == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (m *Machine) CanConnect(name string, skipCache bool) bool {
+	m.lock.RLock()
+	expires, ok := m.connectCache[name]
+	m.lock.RUnlock()
+
+	if ok && !skipCache && time.Now().Before(expires) {
+		return true
+	}
+
+	_, err := m.Credentials(name)
+	if err != nil {
+		return false // we only cache positive hits, instances usually don't disconnect
+	}
+
+	m.lock.Lock()
+	m.connectCache[name] = time.Now().Add(connectCacheTime)
+	m.lock.Unlock()
+
+	return true
+}
+
+func (m *Machine) Credentials(name string) (docker.Credentials, error) {
+	provider, err := m.providerFor(name)
+	if err != nil {
+		return docker.Credentials{}, err
+	}
+
+	return provider.ConnectInfo(context.Background(), name)
+}
@@ -0,0 +1,154 @@
+package autoscaler
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+const (
+	createTimeout  = 30 * time.Minute
+	commandTimeout = 5 * time.Minute
+)
+
+// PluginError is returned when the plugin exits with a failure
+type PluginError struct {
+	Command string
+	Message string
+	Inner   error
+}
+
+func (e *PluginError) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("instance provider plugin %s: %v", e.Command, e.Inner)
+	}
+
+	return fmt.Sprintf("instance provider plugin %s: %s", e.Command, e.Message)
+}
+
+func (e *PluginError) Unwrap() error {
+	return e.Inner
+}
+
+// plugin is an InstanceProvider implemented by an external executable,
+// speaking the protocol described by ProtocolVersion
+type plugin struct {
+	path string
+}
+
+// NewPlugin returns the InstanceProvider implemented by the plugin executable
+func NewPlugin(path string) InstanceProvider {
+	return &plugin{path: path}
+}
+
+func (p *plugin) Create(ctx context.Context, name string, options []string) error {
+	ctx, cancel := context.WithTimeout(ctx, createTimeout)
+	defer cancel()
+
+	return p.run(ctx, CommandCreate, Request{Name: name, Options: options}, nil)
+}
+
+func (p *plugin) Delete(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	return p.run(ctx, CommandDelete, Request{Name: name}, nil)
+}
+
+func (p *plugin) List(ctx context.Context) ([]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	var response ListResponse
+	err := p.run(ctx, CommandList, Request{}, &response)
+	if err != nil {
+		return nil, err
+	}
+
+	return response.Instances, nil
+}
+
+func (p *plugin) ConnectInfo(ctx context.Context, name string) (docker.Credentials, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	var response ConnectInfoResponse
+	err := p.run(ctx, CommandConnectInfo, Request{Name: name}, &response)
+	if err != nil {
+		return docker.Credentials{}, err
+	}
+
+	if response.Host == "" {
+		return docker.Credentials{}, &PluginError{Command: CommandConnectInfo, Message: "no host returned"}
+	}
+
+	return docker.Credentials{
+		Host:      response.Host,
+		CertPath:  response.CertPath,
+		TLSVerify: response.TLSVerify,
+	}, nil
+}
+
+func (p *plugin) run(ctx context.Context, command string, request Request, response interface{}) error {
+	request.Version = ProtocolVersion
+
+	input, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	stdout := new(bytes.Buffer)
+	stderr := new(bytes.Buffer)
+
+	cmd := exec.CommandContext(ctx, p.path, command)
+	cmd.Env = os.Environ()
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	logger := logrus.WithFields(logrus.Fields{
+		"plugin":    p.path,
+		"operation": command,
+		"name":      request.Name,
+	})
+	logger.Debugln("Executing instance provider plugin")
+
+	err = cmd.Run()
+	logPluginOutput(logger, stderr.String())
+
+	if err != nil {
+		var errorResponse ErrorResponse
+		_ = json.Unmarshal(stdout.Bytes(), &errorResponse)
+
+		return &PluginError{Command: command, Message: errorResponse.Error, Inner: err}
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	err = json.Unmarshal(stdout.Bytes(), response)
+	if err != nil {
+		return &PluginError{Command: command, Message: "invalid response", Inner: err}
+	}
+
+	return nil
+}
+
+func logPluginOutput(logger logrus.FieldLogger, output string) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			logger.Infoln(line)
+		}
+	}
+}
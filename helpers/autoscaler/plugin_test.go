@@ -0,0 +1,164 @@
+package autoscaler_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/autoscaler"
+)
+
+var fakeCloudPlugin string
+
+func TestMain(m *testing.M) {
+	fmt.Println("Compiling fake cloud plugin")
+
+	targetDir, err := ioutil.TempDir("", "fakecloud")
+	if err != nil {
+		panic("Error on preparing tmp directory for fake cloud plugin binary")
+	}
+
+	fakeCloudPlugin = filepath.Join(targetDir, "fakecloud")
+	if runtime.GOOS == "windows" {
+		fakeCloudPlugin += ".exe"
+	}
+
+	cmd := exec.Command("go", "build", "-o", fakeCloudPlugin, "./testdata/fakecloud")
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err = cmd.Run()
+	if err != nil {
+		panic("Error on executing go build to prepare fake cloud plugin")
+	}
+
+	code := m.Run()
+
+	_ = os.RemoveAll(targetDir)
+	os.Exit(code)
+}
+
+func setupFakeCloud(t *testing.T) func() {
+	stateDir, err := ioutil.TempDir("", "fakecloud-state")
+	require.NoError(t, err)
+
+	oldStateDir, stateDirSet := os.LookupEnv("FAKECLOUD_STATE_DIR")
+	oldDockerHost, dockerHostSet := os.LookupEnv("FAKECLOUD_DOCKER_HOST")
+	require.NoError(t, os.Setenv("FAKECLOUD_STATE_DIR", stateDir))
+	require.NoError(t, os.Setenv("FAKECLOUD_DOCKER_HOST", "tcp://127.0.0.1:2375"))
+
+	return func() {
+		_ = os.RemoveAll(stateDir)
+
+		restoreEnv("FAKECLOUD_STATE_DIR", oldStateDir, stateDirSet)
+		restoreEnv("FAKECLOUD_DOCKER_HOST", oldDockerHost, dockerHostSet)
+	}
+}
+
+func restoreEnv(key string, value string, set bool) {
+	if set {
+		_ = os.Setenv(key, value)
+		return
+	}
+
+	_ = os.Unsetenv(key)
+}
+
+func TestPluginLifecycle(t *testing.T) {
+	defer setupFakeCloud(t)()
+
+	ctx := context.Background()
+	p := autoscaler.NewPlugin(fakeCloudPlugin)
+
+	instances, err := p.List(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, instances)
+
+	require.NoError(t, p.Create(ctx, "instance-1", []string{"size=small"}))
+	require.NoError(t, p.Create(ctx, "instance-2", nil))
+
+	instances, err = p.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"instance-1", "instance-2"}, instances)
+
+	credentials, err := p.ConnectInfo(ctx, "instance-1")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://127.0.0.1:2375", credentials.Host)
+
+	require.NoError(t, p.Delete(ctx, "instance-1"))
+
+	instances, err = p.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"instance-2"}, instances)
+}
+
+func TestPluginErrors(t *testing.T) {
+	defer setupFakeCloud(t)()
+
+	ctx := context.Background()
+	p := autoscaler.NewPlugin(fakeCloudPlugin)
+
+	err := p.Create(ctx, "instance-1", []string{"fail"})
+	var pluginErr *autoscaler.PluginError
+	require.True(t, errors.As(err, &pluginErr))
+	assert.Equal(t, autoscaler.CommandCreate, pluginErr.Command)
+	assert.Equal(t, "instance creation failed", pluginErr.Message)
+
+	_, err = p.ConnectInfo(ctx, "unknown")
+	require.True(t, errors.As(err, &pluginErr))
+	assert.Contains(t, pluginErr.Message, `instance "unknown" not found`)
+
+	err = autoscaler.NewPlugin(filepath.Join(os.TempDir(), "not-existing-plugin")).Delete(ctx, "instance-1")
+	assert.Error(t, err)
+}
+
+func TestMachine(t *testing.T) {
+	defer setupFakeCloud(t)()
+
+	m := autoscaler.NewMachine()
+
+	instances, err := m.List()
+	require.NoError(t, err)
+	assert.Empty(t, instances, "no plugin is registered yet")
+
+	require.NoError(t, m.Create(fakeCloudPlugin, "runner-1-machine-1"))
+	assert.True(t, m.Exist("runner-1-machine-1"))
+	assert.True(t, m.CanConnect("runner-1-machine-1", true))
+	assert.Error(t, m.Provision("runner-1-machine-1"))
+	assert.NoError(t, m.Stop("runner-1-machine-1", 0))
+
+	credentials, err := m.Credentials("runner-1-machine-1")
+	require.NoError(t, err)
+	assert.Equal(t, "tcp://127.0.0.1:2375", credentials.Host)
+
+	require.NoError(t, m.Remove("runner-1-machine-1"))
+	assert.False(t, m.Exist("runner-1-machine-1"))
+	assert.False(t, m.CanConnect("runner-1-machine-1", true))
+}
+
+func TestMachineDiscoversInstancesOfRegisteredPlugins(t *testing.T) {
+	defer setupFakeCloud(t)()
+
+	require.NoError(t, autoscaler.NewPlugin(fakeCloudPlugin).Create(context.Background(), "existing", nil))
+
+	m := autoscaler.NewMachine()
+	assert.False(t, m.Exist("existing"), "plugin is not registered yet")
+
+	m.Register(fakeCloudPlugin)
+
+	instances, err := m.List()
+	require.NoError(t, err)
+	assert.Equal(t, []string{"existing"}, instances)
+	assert.True(t, m.Exist("existing"))
+
+	require.NoError(t, m.Remove("existing"))
+}
@@ -0,0 +1,47 @@
+package autoscaler
+
+// ProtocolVersion is the version of the plugin protocol. It's sent with every
+// request, so that plugins can detect which requests and fields are supported.
+//
+// The plugin is executed once per request, with the name of the command as
+// its only argument:
+//
+//   <plugin> create|delete|list|connect-info
+//
+// The Request is written as JSON to the standard input of the plugin. The
+// plugin writes the response as JSON to its standard output and exits with
+// status 0. On failure the plugin exits with a non-zero status and may write
+// an ErrorResponse to its standard output. Anything written to the standard
+// error is logged by the runner.
+const ProtocolVersion = 1
+
+const (
+	CommandCreate      = "create"
+	CommandDelete      = "delete"
+	CommandList        = "list"
+	CommandConnectInfo = "connect-info"
+)
+
+// Request is the input of all the plugin commands
+type Request struct {
+	Version int      `json:"version"`
+	Name    string   `json:"name,omitempty"`
+	Options []string `json:"options,omitempty"`
+}
+
+// ListResponse is the output of the list command
+type ListResponse struct {
+	Instances []string `json:"instances"`
+}
+
+// ConnectInfoResponse is the output of the connect-info command
+type ConnectInfoResponse struct {
+	Host      string `json:"host"`
+	CertPath  string `json:"tls_cert_path,omitempty"`
+	TLSVerify bool   `json:"tls_verify,omitempty"`
+}
+
+// ErrorResponse is the output of a failed command
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
@@ -0,0 +1,22 @@
+package autoscaler
+
+import (
+	"context"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/docker"
+)
+
+// InstanceProvider manages the instances on which the Docker executor
+// runs the jobs, for example the virtual machines of a cloud provider
+type InstanceProvider interface {
+	// Create creates a new instance and waits until its Docker daemon is
+	// ready to accept connections
+	Create(ctx context.Context, name string, options []string) error
+	// Delete deletes the instance
+	Delete(ctx context.Context, name string) error
+	// List returns the names of all the instances of the provider
+	List(ctx context.Context) ([]string, error)
+	// ConnectInfo returns the credentials to connect to the Docker daemon
+	// of the instance
+	ConnectInfo(ctx context.Context, name string) (docker.Credentials, error)
+}
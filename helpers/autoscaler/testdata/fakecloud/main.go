@@ -0,0 +1,190 @@
+// fakecloud is an instance provider plugin for tests. Instances are recorded
+// in the FAKECLOUD_STATE_DIR directory.
+//
+// By default the instances are only records and point to the local Docker
+// daemon (or FAKECLOUD_DOCKER_HOST). With FAKECLOUD_MODE=dind every instance
+// is a Docker-in-Docker container started on the local Docker daemon.
+//
+// Creating an instance with the "fail" option fails, to test error handling.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/autoscaler"
+)
+
+const (
+	dindImage        = "docker:19.03-dind"
+	dindStartTimeout = 2 * time.Minute
+)
+
+type instance struct {
+	Host string `json:"host"`
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		fail(errors.New("usage: fakecloud create|delete|list|connect-info"))
+	}
+
+	var request autoscaler.Request
+	err := json.NewDecoder(os.Stdin).Decode(&request)
+	if err != nil {
+		fail(fmt.Errorf("decoding request: %w", err))
+	}
+
+	if request.Version != autoscaler.ProtocolVersion {
+		fail(fmt.Errorf("unsupported protocol version %d", request.Version))
+	}
+
+	stateDir := os.Getenv("FAKECLOUD_STATE_DIR")
+	if stateDir == "" {
+		fail(errors.New("FAKECLOUD_STATE_DIR is not set"))
+	}
+
+	var response interface{}
+	switch os.Args[1] {
+	case autoscaler.CommandCreate:
+		err = create(stateDir, request)
+	case autoscaler.CommandDelete:
+		err = remove(stateDir, request.Name)
+	case autoscaler.CommandList:
+		response, err = list(stateDir)
+	case autoscaler.CommandConnectInfo:
+		response, err = connectInfo(stateDir, request.Name)
+	default:
+		err = fmt.Errorf("unknown command %q", os.Args[1])
+	}
+
+	if err != nil {
+		fail(err)
+	}
+
+	if response != nil {
+		_ = json.NewEncoder(os.Stdout).Encode(response)
+	}
+}
+
+func fail(err error) {
+	_ = json.NewEncoder(os.Stdout).Encode(autoscaler.ErrorResponse{Error: err.Error()})
+	os.Exit(1)
+}
+
+func instancePath(stateDir string, name string) string {
+	return filepath.Join(stateDir, name+".json")
+}
+
+func create(stateDir string, request autoscaler.Request) error {
+	for _, option := range request.Options {
+		if option == "fail" {
+			return errors.New("instance creation failed")
+		}
+	}
+
+	host := os.Getenv("FAKECLOUD_DOCKER_HOST")
+	if host == "" {
+		host = "unix:///var/run/docker.sock"
+	}
+
+	if os.Getenv("FAKECLOUD_MODE") == "dind" {
+		var err error
+		host, err = startDind(request.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, "Created instance", request.Name)
+
+	data, err := json.Marshal(instance{Host: host})
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(instancePath(stateDir, request.Name), data, 0600)
+}
+
+func startDind(name string) (string, error) {
+	err := exec.Command(
+		"docker", "run", "-d", "--privileged",
+		"--name", name,
+		"-e", "DOCKER_TLS_CERTDIR=",
+		"-p", "127.0.0.1::2375",
+		dindImage,
+	).Run()
+	if err != nil {
+		return "", fmt.Errorf("starting Docker-in-Docker container: %w", err)
+	}
+
+	out, err := exec.Command("docker", "port", name, "2375/tcp").Output()
+	if err != nil {
+		return "", fmt.Errorf("getting Docker-in-Docker port: %w", err)
+	}
+
+	host := "tcp://" + strings.TrimSpace(strings.Split(string(out), "\n")[0])
+
+	deadline := time.Now().Add(dindStartTimeout)
+	for time.Now().Before(deadline) {
+		if exec.Command("docker", "-H", host, "info").Run() == nil {
+			return host, nil
+		}
+		time.Sleep(time.Second)
+	}
+
+	return "", errors.New("Docker-in-Docker daemon didn't start")
+}
+
+func remove(stateDir string, name string) error {
+	if os.Getenv("FAKECLOUD_MODE") == "dind" {
+		_ = exec.Command("docker", "rm", "-f", "-v", name).Run()
+	}
+
+	err := os.Remove(instancePath(stateDir, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	fmt.Fprintln(os.Stderr, "Deleted instance", name)
+
+	return nil
+}
+
+func list(stateDir string) (*autoscaler.ListResponse, error) {
+	files, err := filepath.Glob(filepath.Join(stateDir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	response := &autoscaler.ListResponse{Instances: []string{}}
+	for _, file := range files {
+		response.Instances = append(response.Instances, strings.TrimSuffix(filepath.Base(file), ".json"))
+	}
+	sort.Strings(response.Instances)
+
+	return response, nil
+}
+
+func connectInfo(stateDir string, name string) (*autoscaler.ConnectInfoResponse, error) {
+	data, err := ioutil.ReadFile(instancePath(stateDir, name))
+	if err != nil {
+		return nil, fmt.Errorf("instance %q not found", name)
+	}
+
+	var i instance
+	err = json.Unmarshal(data, &i)
+	if err != nil {
+		return nil, err
+	}
+
+	return &autoscaler.ConnectInfoResponse{Host: i.Host}, nil
+}
@@ -33,17 +33,21 @@ func (s *BuildSection) timestamp(format string, logger RawLogger) {
 	logger.SendRawLog(sectionLine)
 }
 
-func (s *BuildSection) start(logger RawLogger) {
+// Start marks the beginning of the section in the log. It's used when the
+// section can't be wrapped by Execute, as when the end of the section is
+// reported separately
+func (s *BuildSection) Start(logger RawLogger) {
 	s.timestamp(traceSectionStart, logger)
 }
 
-func (s *BuildSection) end(logger RawLogger) {
+// End marks the end of the section in the log
+func (s *BuildSection) End(logger RawLogger) {
 	s.timestamp(traceSectionEnd, logger)
 }
 
 func (s *BuildSection) Execute(logger RawLogger) error {
-	s.start(logger)
-	defer s.end(logger)
+	s.Start(logger)
+	defer s.End(logger)
 
 	return s.Run()
 }
@@ -43,6 +43,7 @@ type Client interface {
 		condition container.WaitCondition,
 	) (<-chan container.ContainerWaitOKBody, <-chan error)
 	ContainerLogs(ctx context.Context, container string, options types.ContainerLogsOptions) (io.ReadCloser, error)
+	ContainerStatPath(ctx context.Context, containerID string, path string) (types.ContainerPathStat, error)
 	ContainerExecCreate(ctx context.Context, container string, config types.ExecConfig) (types.IDResponse, error)
 	ContainerExecAttach(ctx context.Context, execID string, config types.ExecStartCheck) (types.HijackedResponse, error)
 
@@ -52,6 +53,7 @@ type Client interface {
 		options types.NetworkCreate,
 	) (types.NetworkCreateResponse, error)
 	NetworkRemove(ctx context.Context, networkID string) error
+	NetworkConnect(ctx context.Context, networkID, containerID string, config *network.EndpointSettings) error
 	NetworkDisconnect(ctx context.Context, networkID, containerID string, force bool) error
 	NetworkList(ctx context.Context, options types.NetworkListOptions) ([]types.NetworkResource, error)
 	NetworkInspect(ctx context.Context, networkID string) (types.NetworkResource, error)
@@ -60,6 +62,7 @@ type Client interface {
 	VolumeRemove(ctx context.Context, volumeID string, force bool) error
 
 	Info(ctx context.Context) (types.Info, error)
+	DiskUsage(ctx context.Context) (types.DiskUsage, error)
 
 	Close() error
 }
@@ -230,6 +230,27 @@ func (_m *MockClient) ContainerStart(ctx context.Context, containerID string, op
 	return r0
 }
 
+// ContainerStatPath provides a mock function with given fields: ctx, containerID, path
+func (_m *MockClient) ContainerStatPath(ctx context.Context, containerID string, path string) (types.ContainerPathStat, error) {
+	ret := _m.Called(ctx, containerID, path)
+
+	var r0 types.ContainerPathStat
+	if rf, ok := ret.Get(0).(func(context.Context, string, string) types.ContainerPathStat); ok {
+		r0 = rf(ctx, containerID, path)
+	} else {
+		r0 = ret.Get(0).(types.ContainerPathStat)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, string, string) error); ok {
+		r1 = rf(ctx, containerID, path)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ContainerWait provides a mock function with given fields: ctx, containerID, condition
 func (_m *MockClient) ContainerWait(ctx context.Context, containerID string, condition container.WaitCondition) (<-chan container.ContainerWaitOKBody, <-chan error) {
 	ret := _m.Called(ctx, containerID, condition)
@@ -255,6 +276,27 @@ func (_m *MockClient) ContainerWait(ctx context.Context, containerID string, con
 	return r0, r1
 }
 
+// DiskUsage provides a mock function with given fields: ctx
+func (_m *MockClient) DiskUsage(ctx context.Context) (types.DiskUsage, error) {
+	ret := _m.Called(ctx)
+
+	var r0 types.DiskUsage
+	if rf, ok := ret.Get(0).(func(context.Context) types.DiskUsage); ok {
+		r0 = rf(ctx)
+	} else {
+		r0 = ret.Get(0).(types.DiskUsage)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context) error); ok {
+		r1 = rf(ctx)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // ImageImportBlocking provides a mock function with given fields: ctx, source, ref, options
 func (_m *MockClient) ImageImportBlocking(ctx context.Context, source types.ImageImportSource, ref string, options types.ImageImportOptions) error {
 	ret := _m.Called(ctx, source, ref, options)
@@ -355,6 +397,20 @@ func (_m *MockClient) NetworkCreate(ctx context.Context, networkName string, opt
 	return r0, r1
 }
 
+// NetworkConnect provides a mock function with given fields: ctx, networkID, containerID, config
+func (_m *MockClient) NetworkConnect(ctx context.Context, networkID string, containerID string, config *network.EndpointSettings) error {
+	ret := _m.Called(ctx, networkID, containerID, config)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, *network.EndpointSettings) error); ok {
+		r0 = rf(ctx, networkID, containerID, config)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // NetworkDisconnect provides a mock function with given fields: ctx, networkID, containerID, force
 func (_m *MockClient) NetworkDisconnect(ctx context.Context, networkID string, containerID string, force bool) error {
 	ret := _m.Called(ctx, networkID, containerID, force)
@@ -167,6 +167,16 @@ func (c *officialDockerClient) ContainerLogs(
 	return rc, wrapError("ContainerLogs", err, started)
 }
 
+func (c *officialDockerClient) ContainerStatPath(
+	ctx context.Context,
+	containerID string,
+	path string,
+) (types.ContainerPathStat, error) {
+	started := time.Now()
+	stat, err := c.client.ContainerStatPath(ctx, containerID, path)
+	return stat, wrapError("ContainerStatPath", err, started)
+}
+
 func (c *officialDockerClient) ContainerExecCreate(
 	ctx context.Context,
 	container string,
@@ -203,6 +213,17 @@ func (c *officialDockerClient) NetworkRemove(ctx context.Context, networkID stri
 	return wrapError("NetworkRemove", err, started)
 }
 
+func (c *officialDockerClient) NetworkConnect(
+	ctx context.Context,
+	networkID string,
+	containerID string,
+	config *network.EndpointSettings,
+) error {
+	started := time.Now()
+	err := c.client.NetworkConnect(ctx, networkID, containerID, config)
+	return wrapError("NetworkConnect", err, started)
+}
+
 func (c *officialDockerClient) NetworkDisconnect(ctx context.Context, networkID, containerID string, force bool) error {
 	started := time.Now()
 	err := c.client.NetworkDisconnect(ctx, networkID, containerID, force)
@@ -245,6 +266,12 @@ func (c *officialDockerClient) Info(ctx context.Context) (types.Info, error) {
 	return info, wrapError("Info", err, started)
 }
 
+func (c *officialDockerClient) DiskUsage(ctx context.Context) (types.DiskUsage, error) {
+	started := time.Now()
+	usage, err := c.client.DiskUsage(ctx)
+	return usage, wrapError("DiskUsage", err, started)
+}
+
 func (c *officialDockerClient) ImageImportBlocking(
 	ctx context.Context,
 	source types.ImageImportSource,
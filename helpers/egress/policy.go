@@ -0,0 +1,149 @@
+package egress
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/bmatcuk/doublestar"
+)
+
+// BlockedError is returned when a destination is not allowed by the Policy
+type BlockedError struct {
+	Host   string
+	Port   int
+	Reason string
+}
+
+func (e *BlockedError) Error() string {
+	return fmt.Sprintf("egress to %s blocked: %s", net.JoinHostPort(e.Host, strconv.Itoa(e.Port)), e.Reason)
+}
+
+type resolver interface {
+	LookupIPAddr(ctx context.Context, host string) ([]net.IPAddr, error)
+}
+
+// Policy describes which destinations are reachable from a build network.
+// Everything that is not explicitly allowed is denied.
+type Policy struct {
+	cidrs []*net.IPNet
+	hosts []string
+	ports map[int]bool
+	// destinations are the host:port pairs that are reachable regardless of
+	// the other rules, e.g. the GitLab instance
+	destinations map[string]bool
+
+	resolver resolver
+}
+
+func NewPolicy(cidrs []string, hosts []string, ports []int, destinations []string) (*Policy, error) {
+	p := &Policy{
+		hosts:        make([]string, 0, len(hosts)),
+		ports:        make(map[int]bool, len(ports)),
+		destinations: make(map[string]bool, len(destinations)),
+		resolver:     net.DefaultResolver,
+	}
+
+	for _, cidr := range cidrs {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("parsing allowed CIDR %q: %w", cidr, err)
+		}
+
+		p.cidrs = append(p.cidrs, ipNet)
+	}
+
+	for _, host := range hosts {
+		p.hosts = append(p.hosts, strings.ToLower(host))
+	}
+
+	for _, port := range ports {
+		if port < 1 || port > 65535 {
+			return nil, fmt.Errorf("invalid allowed port %d", port)
+		}
+
+		p.ports[port] = true
+	}
+
+	for _, destination := range destinations {
+		host, port, err := net.SplitHostPort(destination)
+		if err != nil {
+			return nil, fmt.Errorf("parsing allowed destination %q: %w", destination, err)
+		}
+
+		p.destinations[destinationKey(host, port)] = true
+	}
+
+	return p, nil
+}
+
+func destinationKey(host string, port string) string {
+	return net.JoinHostPort(strings.ToLower(host), port)
+}
+
+// Resolve checks the destination against the policy and returns the address
+// that should be dialed. Hostnames that are not explicitly allowed are resolved
+// and dialed by IP, so the checked address is the one that is connected to.
+func (p *Policy) Resolve(ctx context.Context, host string, port int) (string, error) {
+	if p.destinations[destinationKey(host, strconv.Itoa(port))] {
+		return net.JoinHostPort(host, strconv.Itoa(port)), nil
+	}
+
+	if len(p.ports) > 0 && !p.ports[port] {
+		return "", &BlockedError{Host: host, Port: port, Reason: "port not allowed"}
+	}
+
+	if p.hostAllowed(host) {
+		return net.JoinHostPort(host, strconv.Itoa(port)), nil
+	}
+
+	ip := net.ParseIP(host)
+	if ip != nil {
+		if !p.ipAllowed(ip) {
+			return "", &BlockedError{Host: host, Port: port, Reason: "address not allowed"}
+		}
+
+		return net.JoinHostPort(ip.String(), strconv.Itoa(port)), nil
+	}
+
+	if len(p.cidrs) < 1 {
+		return "", &BlockedError{Host: host, Port: port, Reason: "host not allowed"}
+	}
+
+	addrs, err := p.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return "", &BlockedError{Host: host, Port: port, Reason: fmt.Sprintf("resolving host: %v", err)}
+	}
+
+	for _, addr := range addrs {
+		if p.ipAllowed(addr.IP) {
+			return net.JoinHostPort(addr.IP.String(), strconv.Itoa(port)), nil
+		}
+	}
+
+	return "", &BlockedError{Host: host, Port: port, Reason: "host not allowed"}
+}
+
+func (p *Policy) hostAllowed(host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range p.hosts {
+		ok, _ := doublestar.Match(pattern, host)
+		if ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (p *Policy) ipAllowed(ip net.IP) bool {
+	for _, cidr := range p.cidrs {
+		if cidr.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
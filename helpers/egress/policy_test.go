@@ -0,0 +1,151 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type fakeResolver map[string][]net.IPAddr
+
+func (f fakeResolver) LookupIPAddr(_ context.Context, host string) ([]net.IPAddr, error) {
+	addrs, ok := f[host]
+	if !ok {
+		return nil, errors.New("no such host")
+	}
+
+	return addrs, nil
+}
+
+func TestNewPolicy(t *testing.T) {
+	tests := map[string]struct {
+		cidrs         []string
+		ports         []int
+		destinations  []string
+		expectedError bool
+	}{
+		"valid": {
+			cidrs: []string{"10.0.0.0/8", "fd00::/8"},
+			ports: []int{443},
+		},
+		"invalid CIDR": {
+			cidrs:         []string{"10.0.0.0"},
+			expectedError: true,
+		},
+		"invalid port": {
+			ports:         []int{70000},
+			expectedError: true,
+		},
+		"invalid destination": {
+			destinations:  []string{"gitlab.example.com"},
+			expectedError: true,
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			_, err := NewPolicy(tt.cidrs, nil, tt.ports, tt.destinations)
+			if tt.expectedError {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestPolicyResolve(t *testing.T) {
+	policy, err := NewPolicy(
+		[]string{"10.1.0.0/16"},
+		[]string{"*.mirror.example.com"},
+		[]int{80, 443},
+		[]string{"gitlab.example.com:8443"},
+	)
+	require.NoError(t, err)
+
+	policy.resolver = fakeResolver{
+		"artifacts.internal":   {{IP: net.ParseIP("10.1.2.3")}},
+		"registry.example.com": {{IP: net.ParseIP("1.2.3.4")}},
+	}
+
+	tests := map[string]struct {
+		host            string
+		port            int
+		expectedAddress string
+		expectedReason  string
+	}{
+		"allowed hostname pattern": {
+			host:            "npm.MIRROR.example.com",
+			port:            443,
+			expectedAddress: "npm.MIRROR.example.com:443",
+		},
+		"allowed IP": {
+			host:            "10.1.200.1",
+			port:            80,
+			expectedAddress: "10.1.200.1:80",
+		},
+		"blocked IP": {
+			host:           "10.2.0.1",
+			port:           80,
+			expectedReason: "address not allowed",
+		},
+		"hostname resolved into allowed CIDR": {
+			host:            "artifacts.internal",
+			port:            443,
+			expectedAddress: "10.1.2.3:443",
+		},
+		"hostname resolved outside of allowed CIDR": {
+			host:           "registry.example.com",
+			port:           443,
+			expectedReason: "host not allowed",
+		},
+		"unresolvable hostname": {
+			host:           "unknown.example.com",
+			port:           443,
+			expectedReason: "resolving host: no such host",
+		},
+		"blocked port": {
+			host:           "npm.mirror.example.com",
+			port:           22,
+			expectedReason: "port not allowed",
+		},
+		"allowed destination on a port that isn't allowed": {
+			host:            "GitLab.example.com",
+			port:            8443,
+			expectedAddress: "GitLab.example.com:8443",
+		},
+		"allowed destination host on another port": {
+			host:           "gitlab.example.com",
+			port:           22,
+			expectedReason: "port not allowed",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			address, err := policy.Resolve(context.Background(), tt.host, tt.port)
+			if tt.expectedReason != "" {
+				var blockedErr *BlockedError
+				require.True(t, errors.As(err, &blockedErr))
+				assert.Equal(t, tt.expectedReason, blockedErr.Reason)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, tt.expectedAddress, address)
+		})
+	}
+}
+
+func TestPolicyResolveWithoutRules(t *testing.T) {
+	policy, err := NewPolicy(nil, nil, nil, nil)
+	require.NoError(t, err)
+
+	_, err = policy.Resolve(context.Background(), "example.com", 443)
+	assert.Error(t, err)
+}
@@ -0,0 +1,156 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// BlockedLogPrefix starts every line that the proxy writes about a blocked
+// connection. Executors use it to pick these lines out of the proxy output.
+const BlockedLogPrefix = "egress-blocked: "
+
+const defaultDialTimeout = 30 * time.Second
+
+type dialer interface {
+	DialContext(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// Proxy is an HTTP proxy that handles both CONNECT tunnels and plain HTTP
+// requests, forwarding only the ones that are allowed by the Policy.
+type Proxy struct {
+	policy *Policy
+	out    io.Writer
+	outMu  sync.Mutex
+
+	dialer    dialer
+	transport *http.Transport
+}
+
+func NewProxy(policy *Policy, out io.Writer) *Proxy {
+	p := &Proxy{
+		policy: policy,
+		out:    out,
+		dialer: &net.Dialer{Timeout: defaultDialTimeout},
+	}
+
+	p.transport = &http.Transport{
+		Proxy:       nil,
+		DialContext: p.dial,
+	}
+
+	return p
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodConnect {
+		p.handleConnect(w, r)
+		return
+	}
+
+	p.handleHTTP(w, r)
+}
+
+func (p *Proxy) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+
+	port, err := strconv.Atoi(portStr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid port %q: %w", portStr, err)
+	}
+
+	dialAddress, err := p.policy.Resolve(ctx, host, port)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.dialer.DialContext(ctx, network, dialAddress)
+}
+
+func (p *Proxy) handleConnect(w http.ResponseWriter, r *http.Request) {
+	upstream, err := p.dial(r.Context(), "tcp", r.Host)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	defer func() { _ = upstream.Close() }()
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "hijacking not supported", http.StatusInternalServerError)
+		return
+	}
+
+	client, _, err := hijacker.Hijack()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() { _ = client.Close() }()
+
+	_, err = client.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+	if err != nil {
+		return
+	}
+
+	done := make(chan struct{}, 2)
+	tunnel := func(dst, src net.Conn) {
+		_, _ = io.Copy(dst, src)
+		done <- struct{}{}
+	}
+
+	go tunnel(upstream, client)
+	go tunnel(client, upstream)
+	<-done
+}
+
+func (p *Proxy) handleHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Host == "" {
+		http.Error(w, "only proxy requests are supported", http.StatusBadRequest)
+		return
+	}
+
+	outReq := r.Clone(r.Context())
+	outReq.RequestURI = ""
+	outReq.Header.Del("Proxy-Connection")
+	outReq.Header.Del("Proxy-Authorization")
+
+	resp, err := p.transport.RoundTrip(outReq)
+	if err != nil {
+		p.handleError(w, err)
+		return
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	for key, values := range resp.Header {
+		for _, value := range values {
+			w.Header().Add(key, value)
+		}
+	}
+
+	w.WriteHeader(resp.StatusCode)
+	_, _ = io.Copy(w, resp.Body)
+}
+
+func (p *Proxy) handleError(w http.ResponseWriter, err error) {
+	var blockedErr *BlockedError
+	if errors.As(err, &blockedErr) {
+		p.outMu.Lock()
+		_, _ = fmt.Fprintln(p.out, BlockedLogPrefix+blockedErr.Error())
+		p.outMu.Unlock()
+
+		http.Error(w, blockedErr.Error(), http.StatusForbidden)
+		return
+	}
+
+	http.Error(w, err.Error(), http.StatusBadGateway)
+}
@@ -0,0 +1,99 @@
+package egress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestProxyClient(t *testing.T, policy *Policy, out *bytes.Buffer) (*http.Client, func()) {
+	proxyServer := httptest.NewServer(NewProxy(policy, out))
+
+	proxyURL, err := url.Parse(proxyServer.URL)
+	require.NoError(t, err)
+
+	client := &http.Client{Transport: &http.Transport{Proxy: http.ProxyURL(proxyURL)}}
+
+	return client, proxyServer.Close
+}
+
+func TestProxyHTTP(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Upstream", "yes")
+		_, _ = w.Write([]byte("hello"))
+	}))
+	defer upstream.Close()
+
+	tests := map[string]struct {
+		cidrs          []string
+		expectedStatus int
+		expectedBody   string
+		expectedLog    string
+	}{
+		"allowed": {
+			cidrs:          []string{"127.0.0.0/8"},
+			expectedStatus: http.StatusOK,
+			expectedBody:   "hello",
+		},
+		"blocked": {
+			cidrs:          []string{"10.0.0.0/8"},
+			expectedStatus: http.StatusForbidden,
+			expectedLog:    BlockedLogPrefix + "egress to " + upstream.Listener.Addr().String() + " blocked",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			policy, err := NewPolicy(tt.cidrs, nil, nil, nil)
+			require.NoError(t, err)
+
+			out := new(bytes.Buffer)
+			client, cleanup := newTestProxyClient(t, policy, out)
+			defer cleanup()
+
+			resp, err := client.Get(upstream.URL)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+
+			assert.Equal(t, tt.expectedStatus, resp.StatusCode)
+			if tt.expectedBody != "" {
+				body, err := ioutil.ReadAll(resp.Body)
+				require.NoError(t, err)
+				assert.Equal(t, tt.expectedBody, string(body))
+				assert.Equal(t, "yes", resp.Header.Get("X-Upstream"))
+			}
+
+			assert.Contains(t, out.String(), tt.expectedLog)
+		})
+	}
+}
+
+func TestProxyConnect(t *testing.T) {
+	upstream := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("secure hello"))
+	}))
+	defer upstream.Close()
+
+	policy, err := NewPolicy([]string{"127.0.0.0/8"}, nil, nil, nil)
+	require.NoError(t, err)
+
+	out := new(bytes.Buffer)
+	client, cleanup := newTestProxyClient(t, policy, out)
+	defer cleanup()
+	client.Transport.(*http.Transport).TLSClientConfig = upstream.Client().Transport.(*http.Transport).TLSClientConfig
+
+	resp, err := client.Get(upstream.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	require.NoError(t, err)
+	assert.Equal(t, "secure hello", string(body))
+	assert.Empty(t, out.String())
+}
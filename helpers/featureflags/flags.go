@@ -11,6 +11,7 @@ const (
 	UseDirectDownload                    string = "FF_USE_DIRECT_DOWNLOAD"
 	SkipNoOpBuildStages                  string = "FF_SKIP_NOOP_BUILD_STAGES"
 	ShellExecutorUseLegacyProcessKill    string = "FF_SHELL_EXECUTOR_USE_LEGACY_PROCESS_KILL"
+	ScriptSections                       string = "FF_SCRIPT_SECTIONS"
 )
 
 type FeatureFlag struct {
@@ -76,6 +77,14 @@ var flags = []FeatureFlag{
 		Description: "Use the old process termination that was used prior to GitLab 13.1 where only `SIGKILL`" +
 			" was sent",
 	},
+	{
+		Name:            ScriptSections,
+		DefaultValue:    "false",
+		Deprecated:      false,
+		ToBeRemovedWith: "",
+		Description: "When set to `true` each command of the job's script is printed in a collapsible section " +
+			"of the job log, showing how long it took",
+	},
 }
 
 func GetAll() []FeatureFlag {
@@ -0,0 +1,60 @@
+package filelock
+
+import (
+	"errors"
+	"os"
+)
+
+// ErrLocked is returned by TryLock when the lock is held by someone else
+var ErrLocked = errors.New("file is locked")
+
+// FileLock is an exclusive advisory lock backed by a file. It can be used to
+// synchronize processes, including the ones running in different containers
+// sharing the same volume
+type FileLock struct {
+	path string
+	file *os.File
+}
+
+func New(path string) *FileLock {
+	return &FileLock{path: path}
+}
+
+// Lock blocks until the lock is acquired
+func (l *FileLock) Lock() error {
+	return l.acquire(true)
+}
+
+// TryLock acquires the lock or returns ErrLocked when it's already held
+func (l *FileLock) TryLock() error {
+	return l.acquire(false)
+}
+
+func (l *FileLock) acquire(wait bool) error {
+	file, err := os.OpenFile(l.path, os.O_CREATE|os.O_RDWR, 0666)
+	if err != nil {
+		return err
+	}
+
+	err = lockFile(file, wait)
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+
+	l.file = file
+
+	return nil
+}
+
+func (l *FileLock) Unlock() error {
+	if l.file == nil {
+		return nil
+	}
+
+	err := unlockFile(l.file)
+	_ = l.file.Close()
+	l.file = nil
+
+	return err
+}
@@ -0,0 +1,30 @@
+package filelock
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filelock")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "test.lock")
+
+	first := New(path)
+	require.NoError(t, first.Lock())
+
+	second := New(path)
+	assert.Equal(t, ErrLocked, second.TryLock())
+
+	require.NoError(t, first.Unlock())
+	require.NoError(t, second.TryLock())
+	assert.NoError(t, second.Unlock())
+	assert.NoError(t, second.Unlock(), "unlocking twice is a no-op")
+}
@@ -21,6 +21,10 @@ type CommandOptions struct {
 	Stderr io.Writer
 	Stdin  io.Reader
 
+	// ExtraFiles are inherited by the process as the file descriptors
+	// starting from 3. Not supported on Windows
+	ExtraFiles []*os.File
+
 	Logger Logger
 
 	GracefulKillTimeout time.Duration
@@ -40,6 +44,7 @@ func NewOSCmd(executable string, args []string, options CommandOptions) Commande
 	c.Stdin = options.Stdin
 	c.Stdout = options.Stdout
 	c.Stderr = options.Stderr
+	c.ExtraFiles = options.ExtraFiles
 
 	return &osCmd{internal: c}
 }
@@ -149,6 +149,30 @@ func (e *shellEscaper) processChar(char byte, out *bytes.Buffer) bool {
 	}
 }
 
+// PosixShellEscape returns the string wrapped in single quotes when it contains
+// characters that aren't safe to use unquoted. Unlike ShellEscape it only uses
+// the quoting defined by POSIX, the control characters are kept as they are
+func PosixShellEscape(str string) string {
+	if str == "" {
+		return "''"
+	}
+
+	if strings.IndexFunc(str, isPosixUnsafe) < 0 {
+		return str
+	}
+
+	return "'" + strings.ReplaceAll(str, "'", `'\''`) + "'"
+}
+
+func isPosixUnsafe(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+		return false
+	default:
+		return !strings.ContainsRune("_@%+=:,./-", r)
+	}
+}
+
 func ToBackslash(path string) string {
 	return strings.ReplaceAll(path, "/", "\\")
 }
@@ -35,6 +35,25 @@ func TestShellEscape(t *testing.T) {
 	}
 }
 
+func TestPosixShellEscape(t *testing.T) {
+	var tests = []struct {
+		in  string
+		out string
+	}{
+		{"standard_string", "standard_string"},
+		{"standard string", "'standard string'"},
+		{"it's", `'it'\''s'`},
+		{"+\t\n\r&", "'+\t\n\r&'"},
+		{"$HOME", "'$HOME'"},
+		{"", "''"},
+	}
+
+	for _, test := range tests {
+		actual := PosixShellEscape(test.in)
+		assert.Equal(t, test.out, actual, "src=%v", test.in)
+	}
+}
+
 func TestToBackslash(t *testing.T) {
 	result := ToBackslash("smb://user/me/directory")
 	expected := "smb:\\\\user\\me\\directory"
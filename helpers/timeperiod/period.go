@@ -1,19 +1,68 @@
 package timeperiod
 
 import (
+	"sync"
 	"time"
 
 	"github.com/gorhill/cronexpr"
 )
 
+// maxActivationLookback limits how far back the start of an activation is
+// searched for periods that are always active
+const maxActivationLookback = 7 * 24 * time.Hour
+
 type TimePeriod struct {
 	expressions    []*cronexpr.Expression
 	location       *time.Location
 	GetCurrentTime func() time.Time
+
+	activationLock  sync.Mutex
+	activationStart time.Time
+	activationCheck time.Time
 }
 
 func (t *TimePeriod) InPeriod() bool {
+	return t.inPeriodAt(t.GetCurrentTime())
+}
+
+// ActivationStart returns when the current activation of the period started,
+// so that the recurring activations of the same period can be told apart.
+// It's precise to a minute and returns the zero time outside of the period.
+func (t *TimePeriod) ActivationStart() time.Time {
 	now := t.GetCurrentTime().In(t.location)
+	if !t.inPeriodAt(now) {
+		return time.Time{}
+	}
+
+	t.activationLock.Lock()
+	defer t.activationLock.Unlock()
+
+	checked := !t.activationCheck.IsZero() && !now.Before(t.activationCheck)
+
+	start := now.Truncate(time.Minute)
+	for now.Sub(start) < maxActivationLookback {
+		if checked && !start.After(t.activationCheck) {
+			// The period is active since the previous check
+			start = t.activationStart
+			break
+		}
+
+		previous := start.Add(-time.Minute)
+		if !t.inPeriodAt(previous) {
+			break
+		}
+
+		start = previous
+	}
+
+	t.activationStart = start
+	t.activationCheck = now
+
+	return start
+}
+
+func (t *TimePeriod) inPeriodAt(now time.Time) bool {
+	now = now.In(t.location)
 	for _, expression := range t.expressions {
 		nextIn := expression.Next(now)
 		timeSince := now.Sub(nextIn)
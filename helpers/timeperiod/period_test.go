@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 var daysOfWeek = map[time.Weekday]string{
@@ -101,3 +102,41 @@ func TestTimeperiodsWithTimezone(t *testing.T) {
 	testTimeperiodsWithTimezone(t, period, timezone, time.January, 1, 20, 30, false)
 	testTimeperiodsWithTimezone(t, period, timezone, time.July, 1, 20, 30, false)
 }
+
+func TestActivationStart(t *testing.T) {
+	now := time.Date(2020, time.May, 5, 9, 30, 15, 0, time.UTC)
+
+	timePeriods, err := TimePeriods([]string{"* * 9-17 * * mon-fri *"}, "UTC")
+	require.NoError(t, err)
+	timePeriods.GetCurrentTime = func() time.Time {
+		return now
+	}
+
+	firstActivation := time.Date(2020, time.May, 5, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, firstActivation, timePeriods.ActivationStart())
+
+	now = now.Add(8 * time.Hour)
+	assert.Equal(t, firstActivation, timePeriods.ActivationStart(), "activation lasts until the period ends")
+
+	now = now.Add(time.Hour)
+	assert.True(t, timePeriods.ActivationStart().IsZero(), "there's no activation outside of the period")
+
+	now = time.Date(2020, time.May, 6, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2020, time.May, 6, 9, 0, 0, 0, time.UTC), timePeriods.ActivationStart())
+}
+
+func TestActivationStartOfAlwaysActivePeriod(t *testing.T) {
+	now := time.Date(2020, time.May, 5, 9, 30, 0, 0, time.UTC)
+
+	timePeriods, err := TimePeriods([]string{"* * * * * * *"}, "UTC")
+	require.NoError(t, err)
+	timePeriods.GetCurrentTime = func() time.Time {
+		return now
+	}
+
+	start := timePeriods.ActivationStart()
+	assert.False(t, start.IsZero())
+
+	now = now.Add(time.Hour)
+	assert.Equal(t, start, timePeriods.ActivationStart())
+}
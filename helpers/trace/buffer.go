@@ -28,6 +28,8 @@ type Buffer struct {
 	finish        chan struct{}
 
 	maskTree *trie.Trie
+
+	timestamps lineTimestamps
 }
 
 func (b *Buffer) SetMasked(values []string) {
@@ -97,6 +99,7 @@ func (b *Buffer) advanceAll() {
 	b.lock.Lock()
 	defer b.lock.Unlock()
 
+	_ = b.flushMarkerAtEndUnsafe()
 	_ = b.advanceAllUnsafe()
 }
 
@@ -134,6 +137,14 @@ func (b *Buffer) limitExceededMessage() string {
 	)
 }
 
+func (b *Buffer) maskRuneUnsafe(r rune) error {
+	if _, err := b.advanceBuffer.WriteRune(r); err != nil {
+		return err
+	}
+
+	return b.advanceLogUnsafe()
+}
+
 func (b *Buffer) writeRune(r rune) error {
 	b.lock.Lock()
 	defer b.lock.Unlock()
@@ -143,11 +154,12 @@ func (b *Buffer) writeRune(r rune) error {
 		return io.EOF
 	}
 
-	if _, err := b.advanceBuffer.WriteRune(r); err != nil {
-		return err
+	writeRune := b.maskRuneUnsafe
+	if b.timestamps.enabled {
+		writeRune = b.timestampRuneUnsafe
 	}
 
-	if err := b.advanceLogUnsafe(); err != nil {
+	if err := writeRune(r); err != nil {
 		return err
 	}
 
@@ -195,6 +207,7 @@ func New() (*Buffer, error) {
 		finish:     make(chan struct{}),
 		logFile:    logFile,
 		logWriter:  bufio.NewWriter(logFile),
+		timestamps: lineTimestamps{lineStart: true},
 	}
 	go buffer.process(reader)
 	return buffer, nil
@@ -2,6 +2,7 @@ package trace
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -55,3 +56,77 @@ func TestTraceLimit(t *testing.T) {
 
 	assert.Equal(t, "This is the\n\x1b[31;1mJob's log exceeded limit of 10 bytes.\x1b[0;m\n", string(content))
 }
+
+func TestTimestamps(t *testing.T) {
+	const timestamp = "2020-01-02T03:04:05Z "
+
+	tests := map[string]struct {
+		input    string
+		masked   []string
+		expected string
+	}{
+		"lines": {
+			input:    "first line\nsecond line\n",
+			expected: timestamp + "first line\n" + timestamp + "second line\n",
+		},
+		"empty lines": {
+			input:    "first line\n\n\nsecond line",
+			expected: timestamp + "first line\n\n\n" + timestamp + "second line",
+		},
+		"carriage return line endings": {
+			input:    "first line\r\nsecond line\r\n",
+			expected: timestamp + "first line\r\n" + timestamp + "second line\r\n",
+		},
+		"progress updates": {
+			input:    "progress 10%\rprogress 20%\rdone\n",
+			expected: timestamp + "progress 10%\r" + timestamp + "progress 20%\r" + timestamp + "done\n",
+		},
+		"ANSI sequences": {
+			input:    "\x1b[32;1mgreen line\x1b[0;m\n",
+			expected: "\x1b[32;1m" + timestamp + "green line\x1b[0;m\n",
+		},
+		"section markers": {
+			input: "section_start:1234:step_script\r\x1b[0K\x1b[0KExecuting step\n" +
+				"section_end:1234:step_script\r\x1b[0K",
+			expected: "section_start:1234:step_script\r\x1b[0K\x1b[0K" + timestamp + "Executing step\n" +
+				"section_end:1234:step_script\r\x1b[0K",
+		},
+		"text looking like a section marker": {
+			input:    "section_start is not a marker\nsecret\n",
+			expected: timestamp + "section_start is not a marker\n" + timestamp + "secret\n",
+		},
+		"unfinished section marker": {
+			input:    "section_",
+			expected: timestamp + "section_",
+		},
+		"masking": {
+			input:    "the secret\nsecret value\n",
+			masked:   []string{"secret"},
+			expected: timestamp + "the [MASKED]\n" + timestamp + "[MASKED] value\n",
+		},
+	}
+
+	for tn, tc := range tests {
+		t.Run(tn, func(t *testing.T) {
+			buffer, err := New()
+			require.NoError(t, err)
+			defer buffer.Close()
+
+			buffer.SetMasked(tc.masked)
+			buffer.SetTimestamps(true)
+			buffer.timestamps.now = func() time.Time {
+				return time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+			}
+
+			_, err = buffer.Write([]byte(tc.input))
+			require.NoError(t, err)
+
+			buffer.Finish()
+
+			content, err := buffer.Bytes(0, 1000)
+			require.NoError(t, err)
+
+			assert.Equal(t, tc.expected, string(content))
+		})
+	}
+}
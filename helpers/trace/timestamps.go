@@ -0,0 +1,215 @@
+package trace
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	sectionMarkerPrefix = "section_"
+	// sectionMarkerMaxLength bounds the number of characters held back while
+	// checking whether a line starts with a section marker
+	sectionMarkerMaxLength = 256
+)
+
+const (
+	escapeNone = iota
+	escapeStarted
+	escapeCSI
+)
+
+// lineTimestamps tracks the position in the line to prefix each of them with
+// a timestamp. The prefix is written before the first visible character of
+// the line, after the ANSI sequences and the section markers, so that they
+// keep working as before
+type lineTimestamps struct {
+	enabled bool
+	now     func() time.Time
+
+	lineStart bool
+	afterCR   bool
+	escape    int
+	marker    []rune
+}
+
+func (b *Buffer) SetTimestamps(enabled bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.timestamps.enabled = enabled
+}
+
+// flushMarkerAtEndUnsafe writes the characters held back when the log ends
+// without completing the section marker
+func (b *Buffer) flushMarkerAtEndUnsafe() error {
+	if len(b.timestamps.marker) == 0 {
+		return nil
+	}
+
+	runes := b.timestamps.marker
+	b.timestamps.marker = nil
+
+	err := b.writeTimestampUnsafe()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range runes {
+		err = b.maskRuneUnsafe(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (b *Buffer) timestampRuneUnsafe(r rune) error {
+	t := &b.timestamps
+
+	if t.afterCR {
+		t.afterCR = false
+		if r == '\n' {
+			return b.maskRuneUnsafe(r)
+		}
+	}
+
+	if !t.lineStart {
+		b.updateLineStateUnsafe(r)
+		return b.maskRuneUnsafe(r)
+	}
+
+	if t.escape != escapeNone || (r == '\033' && len(t.marker) == 0) {
+		b.updateEscapeStateUnsafe(r)
+		return b.maskRuneUnsafe(r)
+	}
+
+	if r == '\n' || r == '\r' {
+		if len(t.marker) > 0 {
+			return b.flushMarkerUnsafe(r)
+		}
+
+		b.updateLineStateUnsafe(r)
+		return b.maskRuneUnsafe(r)
+	}
+
+	if len(t.marker) > 0 || r == rune(sectionMarkerPrefix[0]) {
+		return b.collectMarkerUnsafe(r)
+	}
+
+	err := b.writeTimestampUnsafe()
+	if err != nil {
+		return err
+	}
+
+	return b.maskRuneUnsafe(r)
+}
+
+func (b *Buffer) updateLineStateUnsafe(r rune) {
+	switch r {
+	case '\n':
+		b.timestamps.lineStart = true
+	case '\r':
+		b.timestamps.lineStart = true
+		b.timestamps.afterCR = true
+	}
+}
+
+func (b *Buffer) updateEscapeStateUnsafe(r rune) {
+	t := &b.timestamps
+
+	switch {
+	case t.escape == escapeNone:
+		t.escape = escapeStarted
+	case t.escape == escapeStarted && r == '[':
+		t.escape = escapeCSI
+	case t.escape == escapeStarted:
+		t.escape = escapeNone
+	case r >= 0x40 && r <= 0x7e:
+		// final byte of the control sequence
+		t.escape = escapeNone
+	}
+}
+
+// collectMarkerUnsafe holds back the characters that may be a section marker,
+// which has to stay at the beginning of the line to be recognized
+func (b *Buffer) collectMarkerUnsafe(r rune) error {
+	t := &b.timestamps
+	t.marker = append(t.marker, r)
+
+	marker := string(t.marker)
+	if len(marker) < len(sectionMarkerPrefix) {
+		if strings.HasPrefix(sectionMarkerPrefix, marker) {
+			return nil
+		}
+	} else if strings.HasPrefix(marker, sectionMarkerPrefix) && isMarkerRune(r) &&
+		len(t.marker) < sectionMarkerMaxLength {
+		return nil
+	}
+
+	// not a section marker, the line starts here
+	runes := t.marker
+	t.marker = nil
+
+	err := b.writeTimestampUnsafe()
+	if err != nil {
+		return err
+	}
+
+	for _, markerRune := range runes {
+		err = b.timestampRuneUnsafe(markerRune)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flushMarkerUnsafe writes the section marker ended by a line break. The line
+// isn't started yet, the content following the marker gets the timestamp
+func (b *Buffer) flushMarkerUnsafe(r rune) error {
+	t := &b.timestamps
+
+	runes := append(t.marker, r)
+	t.marker = nil
+
+	for _, markerRune := range runes {
+		err := b.maskRuneUnsafe(markerRune)
+		if err != nil {
+			return err
+		}
+	}
+
+	b.updateLineStateUnsafe(r)
+
+	return nil
+}
+
+// writeTimestampUnsafe writes the prefix directly to the log, it's not
+// subject to masking
+func (b *Buffer) writeTimestampUnsafe() error {
+	t := &b.timestamps
+	t.lineStart = false
+
+	// the characters waiting for the masking belong to the previous line
+	err := b.advanceAllUnsafe()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now
+	if t.now != nil {
+		now = t.now
+	}
+
+	n, err := b.logWriter.WriteString(now().UTC().Format(time.RFC3339) + " ")
+	b.logSize += n
+
+	return err
+}
+
+func isMarkerRune(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') ||
+		strings.ContainsRune("_.-:[]=,", r)
+}
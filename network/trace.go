@@ -72,6 +72,10 @@ func (c *clientJobTrace) SetMasked(masked []string) {
 	c.buffer.SetMasked(masked)
 }
 
+func (c *clientJobTrace) SetTimestamps(enabled bool) {
+	c.buffer.SetTimestamps(enabled)
+}
+
 func (c *clientJobTrace) SetCancelFunc(cancelFunc context.CancelFunc) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
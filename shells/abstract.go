@@ -6,14 +6,18 @@ import (
 	"net/url"
 	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
 	"gitlab.com/gitlab-org/gitlab-runner/cache"
 	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers/featureflags"
 	"gitlab.com/gitlab-org/gitlab-runner/helpers/tls"
 )
 
+var sectionNameRegex = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+
 type AbstractShell struct {
 }
 
@@ -105,7 +109,7 @@ func (b *AbstractShell) cacheExtractor(w ShellWriter, info common.ShellScriptInf
 			continue
 		}
 
-		b.addExtractCacheCommand(w, info, cacheFile, cacheKey)
+		b.addExtractCacheCommand(w, info, b.cacheKeys(info.Build, cacheKey, cacheFile, cacheOptions.FallbackKeys))
 	}
 
 	if skipRestoreCache {
@@ -115,32 +119,74 @@ func (b *AbstractShell) cacheExtractor(w ShellWriter, info common.ShellScriptInf
 	return nil
 }
 
+type cacheKey struct {
+	key  string
+	file string
+}
+
+// cacheKeys returns the key of the cache followed by its fallback keys, in
+// the order in which they are tried
+func (b *AbstractShell) cacheKeys(build *common.Build, key, file string, fallbackKeys []string) []cacheKey {
+	keys := []cacheKey{{key: key, file: file}}
+
+	for _, fallbackKey := range fallbackKeys {
+		if fallbackKey == "" {
+			continue
+		}
+
+		key, file := b.cacheFile(build, fallbackKey)
+		if key == "" {
+			continue
+		}
+
+		keys = append(keys, cacheKey{key: key, file: file})
+	}
+
+	return keys
+}
+
 func (b *AbstractShell) addExtractCacheCommand(
 	w ShellWriter,
 	info common.ShellScriptInfo,
-	cacheFile string,
-	cacheKey string,
+	keys []cacheKey,
+) {
+	// Execute cache-extractor command. Failure is not fatal.
+	b.guardRunnerCommand(w, info.RunnerCommand, "Extracting cache", func() {
+		b.addExtractCacheKeyCommand(w, info, keys)
+	})
+}
+
+// addExtractCacheKeyCommand tries to extract the cache of the first key, and
+// of the following keys when it fails, stopping at the first hit
+func (b *AbstractShell) addExtractCacheKeyCommand(
+	w ShellWriter,
+	info common.ShellScriptInfo,
+	keys []cacheKey,
 ) {
+	current := keys[0]
+
 	args := []string{
 		"cache-extractor",
-		"--file", cacheFile,
+		"--file", current.file,
 		"--timeout", strconv.Itoa(info.Build.GetCacheRequestTimeout()),
 	}
 
 	// Generate cache download address
-	if url := cache.GetCacheDownloadURL(info.Build, cacheKey); url != nil {
+	if url := cache.GetCacheDownloadURL(info.Build, current.key); url != nil {
 		args = append(args, "--url", url.String())
 	}
 
-	// Execute cache-extractor command. Failure is not fatal.
-	b.guardRunnerCommand(w, info.RunnerCommand, "Extracting cache", func() {
-		w.Noticef("Checking cache for %s...", cacheKey)
-		w.IfCmdWithOutput(info.RunnerCommand, args...)
-		w.Noticef("Successfully extracted cache")
-		w.Else()
+	w.Noticef("Checking cache for %s...", current.key)
+	w.IfCmdWithOutput(info.RunnerCommand, args...)
+	w.Noticef("Successfully extracted cache")
+	w.Else()
+	if len(keys) > 1 {
+		w.Warningf("Failed to extract cache for %s, trying the fallback key", current.key)
+		b.addExtractCacheKeyCommand(w, info, keys[1:])
+	} else {
 		w.Warningf("Failed to extract cache")
-		w.EndIf()
-	})
+	}
+	w.EndIf()
 }
 
 func (b *AbstractShell) downloadArtifacts(w ShellWriter, job common.Dependency, info common.ShellScriptInfo) {
@@ -254,12 +300,13 @@ func (b *AbstractShell) writeCloneFetchCmds(w ShellWriter, info common.ShellScri
 		w.Variable(common.JobVariable{Key: "GIT_LFS_SKIP_SMUDGE", Value: "1"})
 	}
 
-	err := b.handleGetSourcesStrategy(w, build)
+	err := b.handleGetSourcesStrategy(w, info)
 	if err != nil {
 		return err
 	}
 
 	if build.GetGitCheckout() {
+		b.writeSparseCheckoutCmd(w, build)
 		b.writeCheckoutCmd(w, build)
 
 		// If LFS smudging was disabled by the user (by setting the GIT_LFS_SKIP_SMUDGE variable
@@ -287,14 +334,17 @@ func (b *AbstractShell) writeCloneFetchCmds(w ShellWriter, info common.ShellScri
 	return nil
 }
 
-func (b *AbstractShell) handleGetSourcesStrategy(w ShellWriter, build *common.Build) error {
+func (b *AbstractShell) handleGetSourcesStrategy(w ShellWriter, info common.ShellScriptInfo) error {
+	build := info.Build
 	projectDir := build.FullProjectDir()
 
 	switch build.GetGitStrategy() {
 	case common.GitFetch:
+		b.writeGitReferenceCacheCmd(w, info, projectDir)
 		b.writeRefspecFetchCmd(w, build, projectDir)
 	case common.GitClone:
 		w.RmDir(projectDir)
+		b.writeGitReferenceCacheCmd(w, info, projectDir)
 		b.writeRefspecFetchCmd(w, build, projectDir)
 	case common.GitNone:
 		w.Noticef("Skipping Git repository setup")
@@ -306,6 +356,38 @@ func (b *AbstractShell) handleGetSourcesStrategy(w ShellWriter, build *common.Bu
 	return nil
 }
 
+// writeGitReferenceCacheCmd updates the reference repository shared between
+// the jobs and makes the objects stored in it available to the project
+// repository, so that only the missing ones are fetched from the remote
+func (b *AbstractShell) writeGitReferenceCacheCmd(w ShellWriter, info common.ShellScriptInfo, projectDir string) {
+	build := info.Build
+	if build.GitReferenceCacheDir == "" {
+		return
+	}
+
+	args := []string{
+		"git-reference-cache",
+		"--dir", build.GitReferenceCacheDir,
+		"--url", build.GetRemoteURL(),
+		"--repository", projectDir,
+		"--timeout", build.GetBuildTimeout().String(),
+	}
+
+	if maxSize := build.Runner.GitReferenceCache.MaxSize; maxSize > 0 {
+		args = append(args, "--max-size", strconv.FormatInt(maxSize, 10))
+	}
+
+	// Failure is not fatal, all the objects are fetched from the remote then
+	b.guardRunnerCommand(w, info.RunnerCommand, "Git reference cache", func() {
+		w.Noticef("Updating Git reference cache...")
+		w.IfCmdWithOutput(info.RunnerCommand, args...)
+		w.Noticef("Using Git reference cache")
+		w.Else()
+		w.Warningf("Failed to update Git reference cache")
+		w.EndIf()
+	})
+}
+
 func (b *AbstractShell) writeRefspecFetchCmd(w ShellWriter, build *common.Build, projectDir string) {
 	depth := build.GitInfo.Depth
 
@@ -343,7 +425,48 @@ func (b *AbstractShell) writeRefspecFetchCmd(w ShellWriter, build *common.Build,
 
 	fetchArgs = append(fetchArgs, build.GetGitFetchFlags()...)
 
+	filter := build.GetGitFetchFilter()
+	if filter == "" {
+		// A repository kept from a job using a filter would still fetch
+		// with it, the objects already missing are fetched on demand
+		w.IfCmd("git", "config", "remote.origin.partialclonefilter")
+		w.Command("git", "config", "--unset", "remote.origin.partialclonefilter")
+		w.EndIf()
+
+		w.Command("git", fetchArgs...)
+		return
+	}
+
+	// Fetching with a filter requires a git version supporting partial
+	// clones, which is checked before fetching so that other failures of
+	// the fetch aren't hidden. The whole history is fetched otherwise
+	w.IfCmd("git", "rev-list", "--objects", "--all", "--max-count=0", "--filter="+filter)
+	w.Noticef("Fetching changes with the %s partial clone filter...", filter)
+	w.Command("git", append(fetchArgs, "--filter", filter)...)
+	w.Else()
+	w.Warningf("The %s partial clone filter isn't supported, git 2.22 or newer is required. Fetching all objects...", filter)
 	w.Command("git", fetchArgs...)
+	w.EndIf()
+}
+
+func (b *AbstractShell) writeSparseCheckoutCmd(w ShellWriter, build *common.Build) {
+	paths := build.GetGitSparseCheckoutPaths()
+	if len(paths) == 0 {
+		// A repository kept from a job using sparse checkout would
+		// still check out the paths configured then
+		w.IfCmd("git", "config", "core.sparseCheckout")
+		w.Noticef("Disabling sparse checkout...")
+		w.Command("git", "sparse-checkout", "disable")
+		w.EndIf()
+		return
+	}
+
+	w.Noticef("Configuring sparse checkout...")
+	w.IfCmd("git", "sparse-checkout", "init", "--cone")
+	w.Command("git", append([]string{"sparse-checkout", "set"}, paths...)...)
+	w.Else()
+	w.Warningf("Sparse checkout requires git 2.25 or newer. Checking out the whole repository...")
+	w.EndIf()
 }
 
 func (b *AbstractShell) writeGitCleanup(w ShellWriter) {
@@ -372,10 +495,10 @@ func (b *AbstractShell) writeSubmoduleUpdateCmds(w ShellWriter, info common.Shel
 
 	switch build.GetSubmoduleStrategy() {
 	case common.SubmoduleNormal:
-		b.writeSubmoduleUpdateCmd(w, build, false)
+		return b.writeSubmoduleUpdateCmd(w, build, false)
 
 	case common.SubmoduleRecursive:
-		b.writeSubmoduleUpdateCmd(w, build, true)
+		return b.writeSubmoduleUpdateCmd(w, build, true)
 
 	case common.SubmoduleNone:
 		w.Noticef("Skipping Git submodules setup")
@@ -387,19 +510,34 @@ func (b *AbstractShell) writeSubmoduleUpdateCmds(w ShellWriter, info common.Shel
 	return nil
 }
 
-func (b *AbstractShell) writeSubmoduleUpdateCmd(w ShellWriter, build *common.Build, recursive bool) {
+func (b *AbstractShell) writeSubmoduleUpdateCmd(w ShellWriter, build *common.Build, recursive bool) error {
+	paths, err := build.GetSubmodulePaths()
+	if err != nil {
+		return err
+	}
+
+	depth, err := build.GetSubmoduleDepth()
+	if err != nil {
+		return err
+	}
+
 	if recursive {
 		w.Noticef("Updating/initializing submodules recursively...")
 	} else {
 		w.Noticef("Updating/initializing submodules...")
 	}
 
+	var pathArgs []string
+	if len(paths) > 0 {
+		pathArgs = append([]string{"--"}, paths...)
+	}
+
 	// Sync .git/config to .gitmodules in case URL changes (e.g. new build token)
 	args := []string{"submodule", "sync"}
 	if recursive {
 		args = append(args, "--recursive")
 	}
-	w.Command("git", args...)
+	w.Command("git", append(args, pathArgs...)...)
 
 	// Update / initialize submodules
 	updateArgs := []string{"submodule", "update", "--init"}
@@ -408,6 +546,11 @@ func (b *AbstractShell) writeSubmoduleUpdateCmd(w ShellWriter, build *common.Bui
 		updateArgs = append(updateArgs, "--recursive")
 		foreachArgs = append(foreachArgs, "--recursive")
 	}
+	if depth > 0 {
+		updateArgs = append(updateArgs, "--depth", strconv.Itoa(depth))
+	}
+	updateArgs = append(updateArgs, build.GetSubmoduleUpdateFlags()...)
+	updateArgs = append(updateArgs, pathArgs...)
 
 	// Clean changed files in submodules
 	// "git submodule update --force" option not supported in Git 1.7.1 (shipped with CentOS 6)
@@ -420,6 +563,8 @@ func (b *AbstractShell) writeSubmoduleUpdateCmd(w ShellWriter, build *common.Bui
 		w.Command("git", append(foreachArgs, "git lfs pull")...)
 		w.EndIf()
 	}
+
+	return nil
 }
 
 func (b *AbstractShell) writeRestoreCacheScript(w ShellWriter, info common.ShellScriptInfo) error {
@@ -444,7 +589,6 @@ func (b *AbstractShell) writeCommands(w ShellWriter, commands ...string) {
 		if command != "" {
 			lines := strings.SplitN(command, "\n", 2)
 			if len(lines) > 1 {
-				// TODO: this should be collapsable once we introduce that in GitLab
 				w.Noticef("$ %s # collapsed multi-line command", lines[0])
 			} else {
 				w.Noticef("$ %s", lines[0])
@@ -457,6 +601,45 @@ func (b *AbstractShell) writeCommands(w ShellWriter, commands ...string) {
 	}
 }
 
+// writeScriptCommands writes the commands of the step. With script sections
+// enabled each of them is printed in its own collapsible section
+func (b *AbstractShell) writeScriptCommands(
+	w ShellWriter,
+	info common.ShellScriptInfo,
+	stepName common.StepName,
+	commands ...string,
+) {
+	if !info.Build.IsFeatureFlagOn(featureflags.ScriptSections) {
+		b.writeCommands(w, commands...)
+		return
+	}
+
+	prefix := "script_step_" + sectionNameRegex.ReplaceAllString(string(stepName), "_")
+
+	for i, command := range commands {
+		command = strings.TrimSpace(command)
+		if command == "" {
+			w.EmptyLine()
+			continue
+		}
+
+		id := fmt.Sprintf("%s_%d", prefix, i)
+		w.SectionStart(id, commandHeader(command))
+		w.Line(command)
+		w.CheckForErrors()
+		w.SectionEnd(id)
+	}
+}
+
+func commandHeader(command string) string {
+	lines := strings.SplitN(command, "\n", 2)
+	if len(lines) > 1 {
+		return fmt.Sprintf("$ %s # collapsed multi-line command", lines[0])
+	}
+
+	return "$ " + lines[0]
+}
+
 func (b *AbstractShell) writeUserScript(
 	w ShellWriter,
 	info common.ShellScriptInfo,
@@ -481,7 +664,7 @@ func (b *AbstractShell) writeUserScript(
 		b.writeCommands(w, info.PreBuildScript)
 	}
 
-	b.writeCommands(w, scriptStep.Script...)
+	b.writeScriptCommands(w, info, scriptStep.Name, scriptStep.Script...)
 
 	if info.PostBuildScript != "" {
 		b.writeCommands(w, info.PostBuildScript)
@@ -490,10 +673,17 @@ func (b *AbstractShell) writeUserScript(
 	return nil
 }
 
-func (b *AbstractShell) cacheArchiver(w ShellWriter, info common.ShellScriptInfo) error {
+func (b *AbstractShell) cacheArchiver(w ShellWriter, info common.ShellScriptInfo, onSuccess bool) error {
 	skipArchiveCache := true
 
 	for _, cacheOptions := range info.Build.Cache {
+		if onSuccess && !cacheOptions.When.OnSuccess() {
+			continue
+		}
+		if !onSuccess && !cacheOptions.When.OnFailure() {
+			continue
+		}
+
 		// Create list of files to archive
 		var archiverArgs []string
 		for _, path := range cacheOptions.Paths {
@@ -548,6 +738,10 @@ func (b *AbstractShell) addCacheUploadCommand(
 		"--timeout", strconv.Itoa(info.Build.GetCacheRequestTimeout()),
 	}
 
+	if format := info.Build.GetCacheArchiveFormat(); format != "" {
+		args = append(args, "--archive-format", format)
+	}
+
 	args = append(args, archiverArgs...)
 
 	// Generate cache upload address
@@ -670,16 +864,24 @@ func (b *AbstractShell) writeAfterScript(w ShellWriter, info common.ShellScriptI
 	b.writeCdBuildDir(w, info)
 
 	w.Noticef("Running after script...")
-	b.writeCommands(w, afterScriptStep.Script...)
+	b.writeScriptCommands(w, info, afterScriptStep.Name, afterScriptStep.Script...)
 	return nil
 }
 
-func (b *AbstractShell) writeArchiveCacheScript(w ShellWriter, info common.ShellScriptInfo) error {
+func (b *AbstractShell) writeArchiveCache(w ShellWriter, info common.ShellScriptInfo, onSuccess bool) error {
 	b.writeExports(w, info)
 	b.writeCdBuildDir(w, info)
 
 	// Find cached files and archive them
-	return b.cacheArchiver(w, info)
+	return b.cacheArchiver(w, info, onSuccess)
+}
+
+func (b *AbstractShell) writeArchiveCacheScript(w ShellWriter, info common.ShellScriptInfo) error {
+	return b.writeArchiveCache(w, info, true)
+}
+
+func (b *AbstractShell) writeArchiveCacheOnFailureScript(w ShellWriter, info common.ShellScriptInfo) error {
+	return b.writeArchiveCache(w, info, false)
 }
 
 func (b *AbstractShell) writeUploadArtifactsOnSuccessScript(w ShellWriter, info common.ShellScriptInfo) error {
@@ -698,6 +900,7 @@ func (b *AbstractShell) writeScript(w ShellWriter, buildStage common.BuildStage,
 		common.BuildStageDownloadArtifacts:        b.writeDownloadArtifactsScript,
 		common.BuildStageAfterScript:              b.writeAfterScript,
 		common.BuildStageArchiveCache:             b.writeArchiveCacheScript,
+		common.BuildStageArchiveOnFailureCache:    b.writeArchiveCacheOnFailureScript,
 		common.BuildStageUploadOnSuccessArtifacts: b.writeUploadArtifactsOnSuccessScript,
 		common.BuildStageUploadOnFailureArtifacts: b.writeUploadArtifactsOnFailureScript,
 	}
@@ -35,6 +35,37 @@ fi
 
 `
 
+// ShVariantSuffix is appended to the path of a script to get the path of its
+// sh variant
+const ShVariantSuffix = ".sh"
+
+// BashFileDetectShellScript is the detect script for a script passed as the
+// file argument. When bash isn't found, it runs the sh variant of the script,
+// stored next to it with the ShVariantSuffix, instead
+const BashFileDetectShellScript = `if [ -x /usr/local/bin/bash ]; then
+	exec /usr/local/bin/bash "$@"
+elif [ -x /usr/bin/bash ]; then
+	exec /usr/bin/bash "$@"
+elif [ -x /bin/bash ]; then
+	exec /bin/bash "$@"
+elif [ -x /usr/local/bin/sh ]; then
+	exec /usr/local/bin/sh "$1` + ShVariantSuffix + `"
+elif [ -x /usr/bin/sh ]; then
+	exec /usr/bin/sh "$1` + ShVariantSuffix + `"
+elif [ -x /bin/sh ]; then
+	exec /bin/sh "$1` + ShVariantSuffix + `"
+elif [ -x /busybox/sh ]; then
+	exec /busybox/sh "$1` + ShVariantSuffix + `"
+else
+	echo shell not found
+	exit 1
+fi
+
+`
+
+// BashPaths are the paths where the detect scripts look for bash
+var BashPaths = []string{"/usr/local/bin/bash", "/usr/bin/bash", "/bin/bash"}
+
 type BashShell struct {
 	AbstractShell
 	Shell string
@@ -45,6 +76,10 @@ type BashWriter struct {
 	TemporaryPath string
 	Shell         string
 	indent        int
+
+	// sectionTrap is set once the trap ending the open section on exit
+	// is written
+	sectionTrap bool
 }
 
 func (b *BashWriter) GetTemporaryPath() string {
@@ -196,6 +231,37 @@ func (b *BashWriter) EmptyLine() {
 	b.Line("echo")
 }
 
+func (b *BashWriter) SectionStart(id string, command string) {
+	if !b.sectionTrap {
+		b.Line(posixSectionTrap(helpers.ShellEscape))
+		b.sectionTrap = true
+	}
+
+	b.Line(posixSection(helpers.ShellEscape, "section_start", id, helpers.ANSI_BOLD_GREEN+command+helpers.ANSI_RESET))
+	b.Line(scriptSectionVariable + "=" + id)
+}
+
+func (b *BashWriter) SectionEnd(id string) {
+	b.Line(posixSection(helpers.ShellEscape, "section_end", id, ""))
+	b.Line(scriptSectionVariable + "=")
+}
+
+// scriptSectionVariable holds the ID of the open section in the scripts of
+// the POSIX shells
+const scriptSectionVariable = "runner_script_section"
+
+func posixSection(escape func(string) string, marker string, id string, text string) string {
+	return "printf '%s\\n' \"" + marker + ":$(date +%s):" + id + "\"" + escape("\r"+helpers.ANSI_CLEAR+text)
+}
+
+// posixSectionTrap returns the trap ending the open section when the script
+// exits, as the shell exits right away when a command of the section fails
+func posixSectionTrap(escape func(string) string) string {
+	end := posixSection(escape, "section_end", "${"+scriptSectionVariable+"}", "")
+
+	return "trap " + escape("if [ -n \"${"+scriptSectionVariable+":-}\" ]; then "+end+"; fi") + " EXIT"
+}
+
 func (b *BashWriter) Finish(trace bool) string {
 	var buffer bytes.Buffer
 	w := bufio.NewWriter(&buffer)
@@ -280,13 +346,13 @@ func (b *BashShell) generateScript(
 	buildStage common.BuildStage,
 	info common.ShellScriptInfo,
 ) (string, error) {
-	b.ensurePrepareStageHostnameMessage(w, buildStage, info)
+	writePrepareStageHostnameMessage(w, buildStage, info)
 	err := b.writeScript(w, buildStage, info)
 	script := w.Finish(info.Build.IsDebugTraceEnabled())
 	return script, err
 }
 
-func (b *BashShell) ensurePrepareStageHostnameMessage(
+func writePrepareStageHostnameMessage(
 	w ShellWriter,
 	buildStage common.BuildStage,
 	info common.ShellScriptInfo,
@@ -305,6 +371,5 @@ func (b *BashShell) IsDefault() bool {
 }
 
 func init() {
-	common.RegisterShell(&BashShell{Shell: "sh"})
 	common.RegisterShell(&BashShell{Shell: "bash"})
 }
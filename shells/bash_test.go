@@ -1,9 +1,17 @@
 package shells
 
 import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/helpers"
 )
 
 func TestBash_CommandShellEscapes(t *testing.T) {
@@ -19,3 +27,67 @@ func TestBash_IfCmdShellEscapes(t *testing.T) {
 
 	assert.Equal(t, `if $'foo' "x&(y)" >/dev/null 2>/dev/null; then`+"\n", writer.String())
 }
+
+func TestBash_Sections(t *testing.T) {
+	writer := &BashWriter{}
+	writer.SectionStart("script_step_script_0", "$ echo 'hello'")
+	writer.SectionEnd("script_step_script_0")
+
+	writer.SectionStart("script_step_script_1", "$ false")
+
+	expected := `trap $'if [ -n "${runner_script_section:-}" ]; then ` +
+		`printf \'%s\\n\' "section_end:$(date +%s):${runner_script_section}"$\'\\r\\x1b[0K\'; fi' EXIT` + "\n" +
+		`printf '%s\n' "section_start:$(date +%s):script_step_script_0"$'\r\x1b[0K\x1b[32;1m$ echo \'hello\'\x1b[0;m'` + "\n" +
+		"runner_script_section=script_step_script_0\n" +
+		`printf '%s\n' "section_end:$(date +%s):script_step_script_0"$'\r\x1b[0K'` + "\n" +
+		"runner_script_section=\n" +
+		`printf '%s\n' "section_start:$(date +%s):script_step_script_1"$'\r\x1b[0K\x1b[32;1m$ false\x1b[0;m'` + "\n" +
+		"runner_script_section=script_step_script_1\n"
+	assert.Equal(t, expected, writer.String())
+}
+
+func TestBashFileDetectShellScript(t *testing.T) {
+	if helpers.SkipIntegrationTests(t, "sh") {
+		t.Skip()
+	}
+
+	dir, err := ioutil.TempDir("", "detect-shell")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	script := filepath.Join(dir, "step_script")
+	require.NoError(t, ioutil.WriteFile(script, []byte("echo bash variant\n"), 0600))
+	require.NoError(t, ioutil.WriteFile(script+ShVariantSuffix, []byte("echo sh variant\n"), 0600))
+
+	// Looking for bash at paths that don't exist simulates an image without it
+	withoutBash := BashFileDetectShellScript
+	for _, path := range BashPaths {
+		withoutBash = strings.Replace(withoutBash, path, filepath.Join(dir, "missing", "bash"), -1)
+	}
+
+	tests := map[string]struct {
+		detectScript   string
+		expectedOutput string
+	}{
+		"bash found": {
+			detectScript:   BashFileDetectShellScript,
+			expectedOutput: "bash variant\n",
+		},
+		"bash not found": {
+			detectScript:   withoutBash,
+			expectedOutput: "sh variant\n",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			if tt.detectScript == BashFileDetectShellScript && helpers.SkipIntegrationTests(t, "bash") {
+				t.Skip()
+			}
+
+			output, err := exec.Command("sh", "-c", tt.detectScript, "detect", script).CombinedOutput()
+			require.NoError(t, err, "output: %s", string(output))
+			assert.Equal(t, tt.expectedOutput, string(output))
+		})
+	}
+}
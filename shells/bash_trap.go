@@ -9,18 +9,19 @@ import (
 	"gitlab.com/gitlab-org/gitlab-runner/common"
 )
 
-// BashTrapShellScript is used to wrap a shell script in a trap that makes sure the script always exits
+// trapShellScript is used to wrap a shell script in a trap that makes sure the script always exits
 // with exit code of 0 this can be useful in container environments where exiting with an exit code different from 0
 // would kill the container.
 // At the same time it writes to a file the actual exit code of the script as well as the filename
 // of the script as json.
-const bashTrapShellScript = `runner_script_trap() {
+// It only uses POSIX constructs, as it's shared by the bash and sh scripts.
+const trapShellScript = `runner_script_trap() {
 	exit_code=$?
 	log_file=%s
 	out_json="{\"command_exit_code\": $exit_code, \"script\": \"$0\"}"
 
 	# Make sure the command status will always be printed on a new line 
-	if [[ $(tail -c1 $log_file | wc -l) -gt 0 ]]; then
+	if [ "$(tail -c1 $log_file | wc -l)" -gt 0 ]; then
 		printf "$out_json\n" >> $log_file
 	else 
 		printf "\n$out_json\n" >> $log_file
@@ -53,7 +54,7 @@ func (b *BashTrapShellWriter) Finish(trace bool) string {
 }
 
 func (b *BashTrapShellWriter) writeTrap(w io.Writer) {
-	_, _ = fmt.Fprintf(w, bashTrapShellScript, b.logFile)
+	_, _ = fmt.Fprintf(w, trapShellScript, b.logFile)
 }
 
 type BashTrapShell struct {
@@ -73,3 +74,44 @@ func (b *BashTrapShell) GenerateScript(buildStage common.BuildStage, info common
 
 	return b.generateScript(w, buildStage, info)
 }
+
+type ShTrapShellWriter struct {
+	*ShWriter
+
+	logFile string
+}
+
+func (b *ShTrapShellWriter) Finish(trace bool) string {
+	var buffer bytes.Buffer
+	w := bufio.NewWriter(&buffer)
+
+	b.writeShebang(w)
+	b.writeTrap(w)
+	b.writeTrace(w, trace)
+	b.writeScript(w)
+
+	_ = w.Flush()
+	return buffer.String()
+}
+
+func (b *ShTrapShellWriter) writeTrap(w io.Writer) {
+	_, _ = fmt.Fprintf(w, trapShellScript, b.logFile)
+}
+
+type ShTrapShell struct {
+	*ShShell
+
+	LogFile string
+}
+
+func (b *ShTrapShell) GenerateScript(buildStage common.BuildStage, info common.ShellScriptInfo) (string, error) {
+	w := &ShTrapShellWriter{
+		ShWriter: &ShWriter{
+			TemporaryPath: info.Build.TmpProjectDir(),
+			Shell:         b.Shell,
+		},
+		logFile: b.LogFile,
+	}
+
+	return b.generateScript(w, buildStage, info)
+}
@@ -24,6 +24,12 @@ type CmdWriter struct {
 	TemporaryPath                     string
 	indent                            int
 	disableDelayedErrorLevelExpansion bool
+
+	// section is the ID of the open section, ended before exiting on errors
+	section string
+	// sectionCR is set once the carriage return used by the section
+	// markers is read
+	sectionCR bool
 }
 
 func batchQuote(text string) string {
@@ -86,11 +92,30 @@ func (b *CmdWriter) Unindent() {
 }
 
 func (b *CmdWriter) checkErrorLevel() {
+	if b.section != "" {
+		b.checkErrorLevelInSection()
+		return
+	}
+
 	errCheck := "IF !errorlevel! NEQ 0 exit /b !errorlevel!"
 	b.Line(b.updateErrLevelCheck(errCheck))
 	b.Line("")
 }
 
+// checkErrorLevelInSection ends the open section before exiting, as it would
+// be left open otherwise. The exit code is saved first, as the commands
+// printing the marker reset it
+func (b *CmdWriter) checkErrorLevelInSection() {
+	b.Line(b.updateErrLevelCheck(`set "runner_exit_code=!errorlevel!"`))
+	b.Line(b.updateErrLevelCheck("IF !runner_exit_code! NEQ 0 ("))
+	b.Indent()
+	b.writeSection("section_end", b.section, "")
+	b.Line(b.updateErrLevelCheck("exit /b !runner_exit_code!"))
+	b.Unindent()
+	b.Line(")")
+	b.Line("")
+}
+
 func (b *CmdWriter) updateErrLevelCheck(errCheck string) string {
 	if b.disableDelayedErrorLevelExpansion {
 		return strings.ReplaceAll(errCheck, "!", "%")
@@ -218,6 +243,34 @@ func (b *CmdWriter) Errorf(format string, arguments ...interface{}) {
 	b.Line("echo " + batchEscapeVariable(coloredText))
 }
 
+// cmdSectionTimestamp sets runner_timestamp to the Unix timestamp used by the
+// section markers
+const cmdSectionTimestamp = `for /f %%a in ('powershell -NoProfile -NonInteractive -Command ` +
+	`"[DateTimeOffset]::UtcNow.ToUnixTimeSeconds()"') do set "runner_timestamp=%%a"`
+
+func (b *CmdWriter) SectionStart(id string, command string) {
+	b.writeSection("section_start", id, helpers.ANSI_BOLD_GREEN+command+helpers.ANSI_RESET)
+	b.section = id
+}
+
+func (b *CmdWriter) SectionEnd(id string) {
+	b.writeSection("section_end", id, "")
+	b.section = ""
+}
+
+// writeSection prints the marker with echo. Batch has no way to get the Unix
+// timestamp, it's read from the output of PowerShell. The carriage return
+// can't be written in the script, it's read from the output of copy /Z
+func (b *CmdWriter) writeSection(marker string, id string, text string) {
+	if !b.sectionCR {
+		b.Line(`for /f %%a in ('copy /Z "%~f0" nul') do set "runner_cr=%%a"`)
+		b.sectionCR = true
+	}
+
+	b.Line(cmdSectionTimestamp)
+	b.Line("echo " + marker + ":!runner_timestamp!:" + id + "!runner_cr!" + batchEscapeVariable(helpers.ANSI_CLEAR+text))
+}
+
 func (b *CmdWriter) EmptyLine() {
 	b.Line("echo.")
 }
@@ -3,9 +3,11 @@ package shells
 import (
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 type testCase struct {
@@ -88,3 +90,66 @@ func TestCMD_DelayedExpanstionFeatureFlag(t *testing.T) {
 			})
 	}
 }
+
+func TestCMD_Sections(t *testing.T) {
+	timestamp := cmdSectionTimestamp + "\r\n"
+
+	writer := &CmdWriter{}
+	writer.SectionStart("script_step_script_0", "$ echo 100% & done")
+	writer.Line("dir")
+	writer.CheckForErrors()
+	writer.SectionEnd("script_step_script_0")
+	writer.Line("dir")
+	writer.CheckForErrors()
+
+	expected := `for /f %%a in ('copy /Z "%~f0" nul') do set "runner_cr=%%a"` + "\r\n" +
+		timestamp +
+		"echo section_start:!runner_timestamp!:script_step_script_0!runner_cr!\x1b[0K\x1b[32;1m$ echo 100%% ^& done\x1b[0;m\r\n" +
+		"dir\r\n" +
+		`set "runner_exit_code=!errorlevel!"` + "\r\n" +
+		"IF !runner_exit_code! NEQ 0 (\r\n" +
+		"  " + timestamp +
+		"  echo section_end:!runner_timestamp!:script_step_script_0!runner_cr!\x1b[0K\r\n" +
+		"  exit /b !runner_exit_code!\r\n" +
+		")\r\n" +
+		"\r\n" +
+		timestamp +
+		"echo section_end:!runner_timestamp!:script_step_script_0!runner_cr!\x1b[0K\r\n" +
+		"dir\r\n" +
+		"IF !errorlevel! NEQ 0 exit /b !errorlevel!\r\n" +
+		"\r\n"
+	assert.Equal(t, expected, writer.String())
+}
+
+func TestCMD_SectionMarker(t *testing.T) {
+	tests := map[string]struct {
+		write    func(writer *CmdWriter)
+		expected string
+	}{
+		"section start": {
+			write: func(writer *CmdWriter) {
+				writer.SectionStart("step_script", "Executing step")
+			},
+			expected: "echo section_start:!runner_timestamp!:step_script!runner_cr!\x1b[0K\x1b[32;1mExecuting step\x1b[0;m",
+		},
+		"section end": {
+			write: func(writer *CmdWriter) {
+				writer.SectionEnd("step_script")
+			},
+			expected: "echo section_end:!runner_timestamp!:step_script!runner_cr!\x1b[0K",
+		},
+	}
+
+	for tn, tt := range tests {
+		t.Run(tn, func(t *testing.T) {
+			writer := &CmdWriter{}
+			tt.write(writer)
+
+			lines := strings.Split(writer.String(), "\r\n")
+			require.Len(t, lines, 4)
+			assert.Equal(t, `for /f %%a in ('powershell -NoProfile -NonInteractive -Command `+
+				`"[DateTimeOffset]::UtcNow.ToUnixTimeSeconds()"') do set "runner_timestamp=%%a"`, lines[1])
+			assert.Equal(t, tt.expected, lines[2])
+		})
+	}
+}
@@ -33,6 +33,9 @@ type PsWriter struct {
 	indent        int
 	Shell         string
 	EOL           string
+
+	// section is the ID of the open section, ended before exiting on errors
+	section string
 }
 
 func psQuote(text string) string {
@@ -83,7 +86,12 @@ func (p *PsWriter) Unindent() {
 }
 
 func (p *PsWriter) checkErrorLevel() {
-	p.Line("if(!$?) { Exit &{if($LASTEXITCODE) {$LASTEXITCODE} else {1}} }")
+	exit := "Exit &{if($LASTEXITCODE) {$LASTEXITCODE} else {1}}"
+	if p.section != "" {
+		exit = "echo " + psSection("section_end", p.section, "") + "; " + exit
+	}
+
+	p.Line("if(!$?) { " + exit + " }")
 	p.Line("")
 }
 
@@ -260,6 +268,27 @@ func (p *PsWriter) EmptyLine() {
 	p.Line(`echo ""`)
 }
 
+func (p *PsWriter) SectionStart(id string, command string) {
+	p.Line("echo " + psSection("section_start", id, helpers.ANSI_BOLD_GREEN+command+helpers.ANSI_RESET))
+	p.section = id
+}
+
+func (p *PsWriter) SectionEnd(id string) {
+	p.Line("echo " + psSection("section_end", id, ""))
+	p.section = ""
+}
+
+// psSection returns the expression printing the section marker with the
+// current timestamp
+func psSection(marker string, id string, text string) string {
+	return fmt.Sprintf(
+		`("%s:$([DateTimeOffset]::UtcNow.ToUnixTimeSeconds()):%s" + %s)`,
+		marker,
+		id,
+		psQuoteVariable("\r"+helpers.ANSI_CLEAR+text),
+	)
+}
+
 func (p *PsWriter) Absolute(dir string) string {
 	if filepath.IsAbs(dir) {
 		return dir
@@ -79,3 +79,33 @@ func TestPowershell_MkTmpDirOnUNCShare(t *testing.T) {
 		writer.String(),
 	)
 }
+
+func TestPowershell_Sections(t *testing.T) {
+	writer := &PsWriter{Shell: "powershell", EOL: "\r\n"}
+	writer.SectionStart("script_step_script_0", "$ echo $Env:NAME")
+	writer.SectionEnd("script_step_script_0")
+
+	expected := "echo (\"section_start:$([DateTimeOffset]::UtcNow.ToUnixTimeSeconds()):script_step_script_0\" + " +
+		"\"`r\x1b[0K\x1b[32;1m`$ echo `$Env:NAME\x1b[0;m\")\r\n" +
+		"echo (\"section_end:$([DateTimeOffset]::UtcNow.ToUnixTimeSeconds()):script_step_script_0\" + " +
+		"\"`r\x1b[0K\")\r\n"
+	assert.Equal(t, expected, writer.String())
+}
+
+func TestPowershell_CheckForErrorsEndsSection(t *testing.T) {
+	writer := &PsWriter{Shell: "powershell", EOL: "\r\n"}
+	writer.SectionStart("script_step_script_0", "$ exit 1")
+	writer.Reset()
+	writer.CheckForErrors()
+
+	expected := "if(!$?) { " +
+		"echo (\"section_end:$([DateTimeOffset]::UtcNow.ToUnixTimeSeconds()):script_step_script_0\" + \"`r\x1b[0K\"); " +
+		"Exit &{if($LASTEXITCODE) {$LASTEXITCODE} else {1}} }\r\n\r\n"
+	assert.Equal(t, expected, writer.String())
+
+	writer.SectionEnd("script_step_script_0")
+	writer.Reset()
+	writer.CheckForErrors()
+
+	assert.Equal(t, "if(!$?) { Exit &{if($LASTEXITCODE) {$LASTEXITCODE} else {1}} }\r\n\r\n", writer.String())
+}
@@ -0,0 +1,334 @@
+package shells
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers"
+)
+
+const ShDetectShellScript = `if [ -x /usr/local/bin/sh ]; then
+	exec /usr/local/bin/sh $@
+elif [ -x /usr/bin/sh ]; then
+	exec /usr/bin/sh $@
+elif [ -x /bin/sh ]; then
+	exec /bin/sh $@
+elif [ -x /busybox/sh ]; then
+	exec /busybox/sh $@
+else
+	echo shell not found
+	exit 1
+fi
+
+`
+
+// shVariablePrefixRegex matches the variable reference the paths returned by
+// Absolute and the values returned by EnvVariableKey start with
+var shVariablePrefixRegex = regexp.MustCompile(`^\$[a-zA-Z_][a-zA-Z0-9_]*`)
+
+// shQuote escapes the argument with PosixShellEscape. The variable reference
+// it starts with is kept out of the quotes to be expanded
+func shQuote(text string) string {
+	variable := shVariablePrefixRegex.FindString(text)
+	if variable == "" {
+		return helpers.PosixShellEscape(text)
+	}
+
+	quoted := "\"" + variable + "\""
+	if rest := text[len(variable):]; rest != "" {
+		quoted += helpers.PosixShellEscape(rest)
+	}
+
+	return quoted
+}
+
+// ShShell generates scripts using only the constructs defined by POSIX, for
+// the images shipping a minimal shell like dash or busybox instead of bash
+type ShShell struct {
+	AbstractShell
+	Shell string
+}
+
+type ShWriter struct {
+	bytes.Buffer
+	TemporaryPath string
+	Shell         string
+	indent        int
+
+	// sectionTrap is set once the trap ending the open section on exit
+	// is written
+	sectionTrap bool
+}
+
+func (b *ShWriter) GetTemporaryPath() string {
+	return b.TemporaryPath
+}
+
+func (b *ShWriter) Line(text string) {
+	b.WriteString(strings.Repeat("  ", b.indent) + text + "\n")
+}
+
+func (b *ShWriter) Linef(format string, arguments ...interface{}) {
+	b.Line(fmt.Sprintf(format, arguments...))
+}
+
+func (b *ShWriter) CheckForErrors() {
+}
+
+func (b *ShWriter) Indent() {
+	b.indent++
+}
+
+func (b *ShWriter) Unindent() {
+	b.indent--
+}
+
+func (b *ShWriter) Command(command string, arguments ...string) {
+	b.Line(b.buildCommand(command, arguments...))
+}
+
+func (b *ShWriter) buildCommand(command string, arguments ...string) string {
+	list := []string{
+		helpers.PosixShellEscape(command),
+	}
+
+	for _, argument := range arguments {
+		list = append(list, shQuote(argument))
+	}
+
+	return strings.Join(list, " ")
+}
+
+func (b *ShWriter) TmpFile(name string) string {
+	return b.Absolute(path.Join(b.TemporaryPath, name))
+}
+
+func (b *ShWriter) EnvVariableKey(name string) string {
+	return fmt.Sprintf("$%s", name)
+}
+
+func (b *ShWriter) Variable(variable common.JobVariable) {
+	if variable.File {
+		variableFile := b.TmpFile(variable.Key)
+		b.Linef("mkdir -p %s", shQuote(helpers.ToSlash(b.TemporaryPath)))
+		b.Linef("printf '%%s' %s > %s", helpers.PosixShellEscape(variable.Value), shQuote(variableFile))
+		b.Linef("export %s=%s", helpers.PosixShellEscape(variable.Key), shQuote(variableFile))
+	} else {
+		b.Linef("export %s=%s", helpers.PosixShellEscape(variable.Key), helpers.PosixShellEscape(variable.Value))
+	}
+}
+
+func (b *ShWriter) IfDirectory(path string) {
+	b.Linef("if [ -d %s ]; then", shQuote(path))
+	b.Indent()
+}
+
+func (b *ShWriter) IfFile(path string) {
+	b.Linef("if [ -e %s ]; then", shQuote(path))
+	b.Indent()
+}
+
+func (b *ShWriter) IfCmd(cmd string, arguments ...string) {
+	cmdline := b.buildCommand(cmd, arguments...)
+	b.Linef("if %s >/dev/null 2>/dev/null; then", cmdline)
+	b.Indent()
+}
+
+func (b *ShWriter) IfCmdWithOutput(cmd string, arguments ...string) {
+	cmdline := b.buildCommand(cmd, arguments...)
+	b.Linef("if %s; then", cmdline)
+	b.Indent()
+}
+
+func (b *ShWriter) Else() {
+	b.Unindent()
+	b.Line("else")
+	b.Indent()
+}
+
+func (b *ShWriter) EndIf() {
+	b.Unindent()
+	b.Line("fi")
+}
+
+func (b *ShWriter) Cd(path string) {
+	b.Command("cd", path)
+}
+
+func (b *ShWriter) MkDir(path string) {
+	b.Command("mkdir", "-p", path)
+}
+
+func (b *ShWriter) MkTmpDir(name string) string {
+	path := path.Join(b.TemporaryPath, name)
+	b.MkDir(path)
+
+	return path
+}
+
+func (b *ShWriter) RmDir(path string) {
+	b.Command("rm", "-r", "-f", path)
+}
+
+func (b *ShWriter) RmFile(path string) {
+	b.Command("rm", "-f", path)
+}
+
+func (b *ShWriter) Absolute(dir string) string {
+	if path.IsAbs(dir) {
+		return dir
+	}
+	return path.Join("$PWD", dir)
+}
+
+func (b *ShWriter) Join(elem ...string) string {
+	return path.Join(elem...)
+}
+
+// print uses printf, as echo interprets the backslashes in some of the
+// shells
+func (b *ShWriter) print(text string) {
+	b.Line("printf '%s\\n' " + helpers.PosixShellEscape(text))
+}
+
+func (b *ShWriter) Printf(format string, arguments ...interface{}) {
+	b.print(helpers.ANSI_RESET + fmt.Sprintf(format, arguments...))
+}
+
+func (b *ShWriter) Noticef(format string, arguments ...interface{}) {
+	b.print(helpers.ANSI_BOLD_GREEN + fmt.Sprintf(format, arguments...) + helpers.ANSI_RESET)
+}
+
+func (b *ShWriter) Warningf(format string, arguments ...interface{}) {
+	b.print(helpers.ANSI_YELLOW + fmt.Sprintf(format, arguments...) + helpers.ANSI_RESET)
+}
+
+func (b *ShWriter) Errorf(format string, arguments ...interface{}) {
+	b.print(helpers.ANSI_BOLD_RED + fmt.Sprintf(format, arguments...) + helpers.ANSI_RESET)
+}
+
+func (b *ShWriter) EmptyLine() {
+	b.Line("echo")
+}
+
+func (b *ShWriter) SectionStart(id string, command string) {
+	if !b.sectionTrap {
+		b.Line(posixSectionTrap(helpers.PosixShellEscape))
+		b.sectionTrap = true
+	}
+
+	b.Line(posixSection(helpers.PosixShellEscape, "section_start", id, helpers.ANSI_BOLD_GREEN+command+helpers.ANSI_RESET))
+	b.Line(scriptSectionVariable + "=" + id)
+}
+
+func (b *ShWriter) SectionEnd(id string) {
+	b.Line(posixSection(helpers.PosixShellEscape, "section_end", id, ""))
+	b.Line(scriptSectionVariable + "=")
+}
+
+func (b *ShWriter) Finish(trace bool) string {
+	var buffer bytes.Buffer
+	w := bufio.NewWriter(&buffer)
+
+	b.writeShebang(w)
+	b.writeTrace(w, trace)
+	b.writeScript(w)
+
+	_ = w.Flush()
+	return buffer.String()
+}
+
+func (b *ShWriter) writeShebang(w io.Writer) {
+	if b.Shell != "" {
+		_, _ = io.WriteString(w, "#!/usr/bin/env "+b.Shell+"\n\n")
+	}
+}
+
+func (b *ShWriter) writeTrace(w io.Writer, trace bool) {
+	if trace {
+		_, _ = io.WriteString(w, "set -o xtrace\n")
+	}
+}
+
+func (b *ShWriter) writeScript(w io.Writer) {
+	_, _ = io.WriteString(w, "set -e\n")
+	// pipefail isn't defined by POSIX, but it's supported by most of the shells
+	_, _ = io.WriteString(w, "if (set -o pipefail) 2>/dev/null; then set -o pipefail; fi\n")
+	_, _ = io.WriteString(w, "set +o noclobber\n")
+	_, _ = io.WriteString(w, ": | eval "+helpers.PosixShellEscape(b.String())+"\n")
+	_, _ = io.WriteString(w, "exit 0\n")
+}
+
+func (b *ShShell) GetName() string {
+	return b.Shell
+}
+
+func (b *ShShell) GetConfiguration(info common.ShellScriptInfo) (*common.ShellConfiguration, error) {
+	var detectScript string
+	var shellCommand string
+	if info.Type == common.LoginShell {
+		detectScript = strings.ReplaceAll(ShDetectShellScript, "$@", "-l")
+		shellCommand = b.Shell + " -l"
+	} else {
+		detectScript = strings.ReplaceAll(ShDetectShellScript, "$@", "")
+		shellCommand = b.Shell
+	}
+
+	script := &common.ShellConfiguration{}
+	script.DockerCommand = []string{"sh", "-c", detectScript}
+
+	// su
+	if info.User != "" {
+		script.Command = "su"
+		if runtime.GOOS == "linux" {
+			script.Arguments = append(script.Arguments, "-s", "/bin/"+b.Shell)
+		}
+		script.Arguments = append(
+			script.Arguments,
+			info.User,
+			"-c", shellCommand,
+		)
+	} else {
+		script.Command = b.Shell
+		if info.Type == common.LoginShell {
+			script.Arguments = append(script.Arguments, "-l")
+		}
+	}
+
+	return script, nil
+}
+
+func (b *ShShell) GenerateScript(buildStage common.BuildStage, info common.ShellScriptInfo) (string, error) {
+	w := &ShWriter{
+		TemporaryPath: info.Build.TmpProjectDir(),
+		Shell:         b.Shell,
+	}
+
+	return b.generateScript(w, buildStage, info)
+}
+
+func (b *ShShell) generateScript(
+	w ShellWriter,
+	buildStage common.BuildStage,
+	info common.ShellScriptInfo,
+) (string, error) {
+	writePrepareStageHostnameMessage(w, buildStage, info)
+	err := b.writeScript(w, buildStage, info)
+	script := w.Finish(info.Build.IsDebugTraceEnabled())
+	return script, err
+}
+
+func (b *ShShell) IsDefault() bool {
+	return false
+}
+
+func init() {
+	common.RegisterShell(&ShShell{Shell: "sh"})
+}
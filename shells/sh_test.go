@@ -0,0 +1,113 @@
+package shells
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/gitlab-org/gitlab-runner/common"
+	"gitlab.com/gitlab-org/gitlab-runner/helpers"
+)
+
+func TestSh_CommandShellEscapes(t *testing.T) {
+	writer := &ShWriter{}
+	writer.Command("foo", "x&(y)")
+
+	assert.Equal(t, `foo 'x&(y)'`+"\n", writer.String())
+}
+
+func TestSh_IfCmdShellEscapes(t *testing.T) {
+	writer := &ShWriter{}
+	writer.IfCmd("foo", "x&(y)")
+
+	assert.Equal(t, `if foo 'x&(y)' >/dev/null 2>/dev/null; then`+"\n", writer.String())
+}
+
+func TestSh_Variable(t *testing.T) {
+	writer := &ShWriter{TemporaryPath: "/tmp/project.tmp"}
+	writer.Variable(common.JobVariable{Key: "VALUE", Value: "it's $HOME"})
+	writer.Variable(common.JobVariable{Key: "FILE", Value: "-n content", File: true})
+
+	expected := `export VALUE='it'\''s $HOME'` + "\n" +
+		`mkdir -p /tmp/project.tmp` + "\n" +
+		`printf '%s' '-n content' > /tmp/project.tmp/FILE` + "\n" +
+		`export FILE=/tmp/project.tmp/FILE` + "\n"
+	assert.Equal(t, expected, writer.String())
+}
+
+func TestSh_CommandKeepsWriterVariables(t *testing.T) {
+	writer := &ShWriter{}
+	writer.Command("git", "config", writer.EnvVariableKey("CI_SERVER_TLS_CA_FILE"))
+	writer.Command("cd", writer.Absolute("my project"))
+	writer.Command("echo", "$HOME is `pwd` \\n")
+
+	expected := `git config "$CI_SERVER_TLS_CA_FILE"` + "\n" +
+		`cd "$PWD"'/my project'` + "\n" +
+		`echo "$HOME"' is ` + "`pwd`" + ` \n'` + "\n"
+	assert.Equal(t, expected, writer.String())
+}
+
+func TestSh_Sections(t *testing.T) {
+	writer := &ShWriter{}
+	writer.SectionStart("script_step_script_0", "$ echo 'hello'")
+	writer.SectionEnd("script_step_script_0")
+
+	expected := `trap 'if [ -n "${runner_script_section:-}" ]; then ` +
+		`printf '\''%s\n'\'' "section_end:$(date +%s):${runner_script_section}"'\''` + "\r\x1b[0K'\\''; fi' EXIT\n" +
+		`printf '%s\n' "section_start:$(date +%s):script_step_script_0"'` +
+		"\r\x1b[0K\x1b[32;1m$ echo '\\''hello'\\''\x1b[0;m'\n" +
+		"runner_script_section=script_step_script_0\n" +
+		`printf '%s\n' "section_end:$(date +%s):script_step_script_0"'` + "\r\x1b[0K'\n" +
+		"runner_script_section=\n"
+	assert.Equal(t, expected, writer.String())
+}
+
+func TestSh_GenerateScript(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sh-script")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	info := common.ShellScriptInfo{
+		Shell: "sh",
+		Build: &common.Build{
+			BuildDir: dir,
+			Runner:   &common.RunnerConfig{},
+			JobResponse: common.JobResponse{
+				Variables: common.JobVariables{
+					{Key: "GREETING", Value: `it's "quoted" \n`},
+				},
+				Steps: common.Steps{
+					common.Step{
+						Name:   common.StepNameScript,
+						Script: common.StepScript{`printf '%s\n' "greeting: $GREETING"`},
+					},
+				},
+			},
+		},
+	}
+
+	shell := &ShShell{Shell: "sh"}
+	script, err := shell.GenerateScript("step_script", info)
+	require.NoError(t, err)
+
+	for _, shellName := range []string{"bash", "sh"} {
+		t.Run(shellName, func(t *testing.T) {
+			if helpers.SkipIntegrationTests(t, shellName) {
+				t.Skip()
+			}
+
+			cmd := exec.Command(shellName)
+			cmd.Dir = dir
+			cmd.Stdin = strings.NewReader(script)
+
+			output, err := cmd.CombinedOutput()
+			require.NoError(t, err, "output: %s", string(output))
+			assert.Contains(t, string(output), `greeting: it's "quoted" \n`)
+		})
+	}
+}
@@ -34,5 +34,10 @@ type ShellWriter interface {
 	Errorf(fmt string, arguments ...interface{})
 	EmptyLine()
 
+	// SectionStart and SectionEnd mark a collapsible section of the job log.
+	// The timestamps are taken when the script is executed
+	SectionStart(id string, command string)
+	SectionEnd(id string)
+
 	Finish(trace bool) string
 }
@@ -20,7 +20,7 @@ func runShell(t *testing.T, shell, cwd string, writer shells.ShellWriter) {
 	var cmdArgs []string
 
 	switch shell {
-	case "bash":
+	case "bash", "sh":
 		extension = "sh"
 
 	case "cmd":
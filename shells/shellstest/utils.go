@@ -12,7 +12,7 @@ import (
 type shellWriterFactory func() shells.ShellWriter
 
 func OnEachShell(t *testing.T, f func(t *testing.T, shell string)) {
-	shells := []string{"bash", "cmd", "powershell", "pwsh"}
+	shells := []string{"bash", "sh", "cmd", "powershell", "pwsh"}
 
 	for _, shell := range shells {
 		t.Run(shell, func(t *testing.T) {
@@ -30,6 +30,9 @@ func OnEachShellWithWriter(t *testing.T, f func(t *testing.T, shell string, writ
 		"bash": func() shells.ShellWriter {
 			return &shells.BashWriter{}
 		},
+		"sh": func() shells.ShellWriter {
+			return &shells.ShWriter{}
+		},
 		"cmd": func() shells.ShellWriter {
 			return &shells.CmdWriter{}
 		},